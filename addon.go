@@ -22,6 +22,8 @@ type hookList struct {
 	monitorStart        []monitor.StartHook
 	monitorInputProcess []monitor.StartInputHook
 	monitorEvent        []monitor.EventHook
+	monitorRecStart     []monitor.RecStartHook
+	monitorRecFailed    []monitor.RecFailedHook
 	monitorRecSave      []monitor.RecSaveHook
 	monitorRecSaved     []monitor.RecSavedHook
 	migrationMonitor    []monitor.MigationHook
@@ -75,6 +77,16 @@ func RegisterMonitorEventHook(h monitor.EventHook) {
 	hooks.monitorEvent = append(hooks.monitorEvent, h)
 }
 
+// RegisterMonitorRecStartHook registers hook that's called when monitor starts recording.
+func RegisterMonitorRecStartHook(h monitor.RecStartHook) {
+	hooks.monitorRecStart = append(hooks.monitorRecStart, h)
+}
+
+// RegisterMonitorRecFailedHook registers hook that's called when a recording fails.
+func RegisterMonitorRecFailedHook(h monitor.RecFailedHook) {
+	hooks.monitorRecFailed = append(hooks.monitorRecFailed, h)
+}
+
 // RegisterMonitorRecSaveHook registers hook that's called when monitor saves recording.
 func RegisterMonitorRecSaveHook(h monitor.RecSaveHook) {
 	hooks.monitorRecSave = append(hooks.monitorRecSave, h)
@@ -144,6 +156,16 @@ func (h *hookList) monitor() *monitor.Hooks {
 			hook(r, event)
 		}
 	}
+	recStartHook := func(r *monitor.Recorder, recID string) {
+		for _, hook := range h.monitorRecStart {
+			hook(r, recID)
+		}
+	}
+	recFailedHook := func(r *monitor.Recorder, err error) {
+		for _, hook := range h.monitorRecFailed {
+			hook(r, err)
+		}
+	}
 	recSaveHook := func(r *monitor.Recorder, args *string) {
 		for _, hook := range h.monitorRecSave {
 			hook(r, args)
@@ -168,6 +190,8 @@ func (h *hookList) monitor() *monitor.Hooks {
 		Start:      startHook,
 		StartInput: startInputHook,
 		Event:      eventHook,
+		RecStart:   recStartHook,
+		RecFailed:  recFailedHook,
 		RecSave:    recSaveHook,
 		RecSaved:   recSavedHook,
 		Migrate:    migrateHook,
@@ -3,13 +3,17 @@
 package alert
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"nvr"
 	"nvr/pkg/log"
 	"nvr/pkg/monitor"
 	"nvr/pkg/storage"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -17,20 +21,59 @@ import (
 type Hook func(*monitor.Recorder, *storage.Event, []byte)
 
 var addon struct {
-	hooks []Hook
+	hooks     []Hook
+	notifiers map[string]Hook
+	alerter   *alerter
 }
 
-// RegisterAlertHook registers hook that's called on alerts.
+// RegisterAlertHook registers hook that's called on all alerts.
 func RegisterAlertHook(hook Hook) {
 	addon.hooks = append(addon.hooks, hook)
 }
 
+// RegisterNotifier registers a named hook. Rules can
+// select which notifiers they invoke, default is all.
+func RegisterNotifier(name string, hook Hook) {
+	if addon.notifiers == nil {
+		addon.notifiers = make(map[string]Hook)
+	}
+	addon.notifiers[name] = hook
+}
+
 func init() {
 	RegisterAlertHook(logAlert)
-	a := newAlerter(addon.hooks)
 
 	nvr.RegisterLogSource([]string{"alert"})
-	nvr.RegisterMonitorEventHook(a.onEvent)
+	// The alerter is created after all addons
+	// have had a chance to register their hooks.
+	nvr.RegisterAppRunHook(func(_ context.Context, app *nvr.App) error {
+		configPath := filepath.Join(app.Env.ConfigDir, "alert.json")
+		rules, err := readRulesConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("alert: config: %v: %w", configPath, err)
+		}
+		for _, r := range rules {
+			for _, name := range r.Notifiers {
+				if _, exist := addon.notifiers[name]; !exist {
+					return fmt.Errorf("alert: rule %v: notifier does not exist: %v", r.Name, name)
+				}
+			}
+		}
+
+		addon.alerter = newAlerter(addon.hooks)
+		addon.alerter.notifiers = addon.notifiers
+		addon.alerter.rules = rules
+
+		crawler := storage.NewCrawler(os.DirFS(app.Storage.RecordingsDir()))
+		crawler.SetMaxRecordingLength(app.MonitorManager.MaxVideoLength)
+		app.Router.Handle("/api/alert/dry-run", app.Auth.Admin(app.Auth.CSRF(
+			handleDryRun(crawler),
+		)))
+		return nil
+	})
+	nvr.RegisterMonitorEventHook(func(r *monitor.Recorder, event *storage.Event) {
+		addon.alerter.onEvent(r, event)
+	})
 }
 
 func newAlerter(alertHooks []Hook) *alerter {
@@ -42,7 +85,11 @@ func newAlerter(alertHooks []Hook) *alerter {
 
 type alerter struct {
 	alertHooks []Hook
-	prevAlerts map[string]time.Time // map[monitorID]prevAlert.
+	notifiers  map[string]Hook
+	rules      []rule
+
+	mu         sync.Mutex
+	prevAlerts map[string]time.Time // map[monitorID or rule/monitorID]prevAlert.
 }
 
 func (a *alerter) onEvent(r *monitor.Recorder, event *storage.Event) {
@@ -50,8 +97,7 @@ func (a *alerter) onEvent(r *monitor.Recorder, event *storage.Event) {
 		id := r.Config.ID()
 		rawConfig := r.Config.Get("alert")
 
-		err := a.processEvent(r, event, id, rawConfig)
-		if err != nil {
+		if err := a.processEvent(r, event, id, rawConfig); err != nil {
 			r.Logger.Log(log.Entry{
 				Level:     log.LevelError,
 				Src:       "alert",
@@ -62,11 +108,57 @@ func (a *alerter) onEvent(r *monitor.Recorder, event *storage.Event) {
 	}()
 }
 
+// alertMatch is the union of the monitor config and rule matches.
+// Each event produces at most one alert and each notifier is invoked once.
+type alertMatch struct {
+	matched      bool
+	detections   []storage.Detection
+	allNotifiers bool
+	notifiers    []string
+}
+
+func (m *alertMatch) add(detections []storage.Detection, notifiers []string) {
+	m.matched = true
+	m.detections = append(m.detections, detections...)
+	if len(notifiers) == 0 {
+		m.allNotifiers = true
+		return
+	}
+	for _, name := range notifiers {
+		if !containsString(m.notifiers, name) {
+			m.notifiers = append(m.notifiers, name)
+		}
+	}
+}
+
+// processEvent matches the event against the per monitor
+// alert config and the global rules and sends the alert.
 func (a *alerter) processEvent(
 	r *monitor.Recorder,
 	event *storage.Event,
 	id string,
 	rawConfig string,
+) error {
+	var m alertMatch
+	configErr := a.matchConfig(&m, event, id, rawConfig)
+	a.matchRules(&m, event, id)
+	if !m.matched {
+		return configErr
+	}
+
+	err := a.alert(r, event, m)
+	if configErr != nil {
+		return configErr
+	}
+	return err
+}
+
+// matchConfig matches the per monitor alert config.
+func (a *alerter) matchConfig(
+	m *alertMatch,
+	event *storage.Event,
+	id string,
+	rawConfig string,
 ) error {
 	if rawConfig == "" {
 		return nil
@@ -88,28 +180,107 @@ func (a *alerter) processEvent(
 		return fmt.Errorf("could not parse cooldown: %w", err)
 	}
 
-	cooldown := time.Duration(cooldownFloat * float64(time.Minute))
-	if a.prevAlerts[id].Add(cooldown).After(time.Now()) {
-		return nil
-	}
-
 	threshold, err := strconv.ParseFloat(config.Threshold, 64)
 	if err != nil {
 		return fmt.Errorf("could not parse threshold: %w", err)
 	}
 
-	d := bestDetection(*event)
+	d := BestDetection(*event)
 	if d.Score < threshold {
 		return nil
 	}
 
-	a.prevAlerts[id] = time.Now()
+	cooldown := time.Duration(cooldownFloat * float64(time.Minute))
+	if !a.takeCooldown(id, cooldown) {
+		return nil
+	}
+
+	m.add(event.Detections, nil)
+	return nil
+}
+
+// matchRules matches the global rules.
+func (a *alerter) matchRules(m *alertMatch, event *storage.Event, id string) {
+	for _, rule := range a.rules {
+		matches := rule.match(id, *event)
+		if len(matches) == 0 {
+			continue
+		}
+		if !a.takeCooldown(rule.Name+"/"+id, rule.cooldown) {
+			continue
+		}
+		m.add(matches, rule.Notifiers)
+	}
+}
+
+// takeCooldown returns true and resets the cooldown
+// if the previous alert was longer than cooldown ago.
+func (a *alerter) takeCooldown(key string, cooldown time.Duration) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if a.prevAlerts[key].Add(cooldown).After(now) {
+		return false
+	}
+	a.prevAlerts[key] = now
+	return true
+}
+
+// alert calls the hooks and the matched notifiers. The hooks
+// receive a copy of the event with only the matched detections.
+func (a *alerter) alert(r *monitor.Recorder, e *storage.Event, m alertMatch) error {
+	event := *e
+	event.Detections = matchedDetections(*e, m.detections)
+
+	// The hooks are called without image if it couldn't be created.
+	var image []byte
+	var err error
+	if event.Frame != nil {
+		image, err = annotate(*event.Frame, event.Detections)
+		if err != nil {
+			err = fmt.Errorf("could not annotate frame: %w", err)
+		}
+	}
 
 	for _, hook := range a.alertHooks {
-		hook(r, event, nil)
+		hook(r, &event, image)
+	}
+	if m.allNotifiers {
+		for _, hook := range a.notifiers {
+			hook(r, &event, image)
+		}
+		return err
+	}
+	for _, name := range m.notifiers {
+		if hook, exist := a.notifiers[name]; exist {
+			hook(r, &event, image)
+		}
 	}
+	return err
+}
 
-	return nil
+// matchedDetections returns the event detections that are
+// in matches, in event order and without duplicates.
+func matchedDetections(event storage.Event, matches []storage.Detection) []storage.Detection {
+	var detections []storage.Detection
+	for _, d := range event.Detections {
+		for _, match := range matches {
+			if d == match {
+				detections = append(detections, d)
+				break
+			}
+		}
+	}
+	return detections
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 // Config is a monitor alert config.
@@ -131,7 +302,8 @@ func (c *Config) fillMissing() {
 	}
 }
 
-func bestDetection(e storage.Event) storage.Detection {
+// BestDetection returns the detection with the highest score.
+func BestDetection(e storage.Event) storage.Detection {
 	var best storage.Detection
 	for _, d := range e.Detections {
 		if d.Score > best.Score {
@@ -143,7 +315,7 @@ func bestDetection(e storage.Event) storage.Detection {
 
 func logAlert(r *monitor.Recorder, event *storage.Event, _ []byte) {
 	monitorID := r.Config.ID()
-	d := bestDetection(*event)
+	d := BestDetection(*event)
 	r.Logger.Log(log.Entry{
 		Level:     log.LevelInfo,
 		Src:       "alert",
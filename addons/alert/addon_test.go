@@ -3,7 +3,9 @@
 package alert
 
 import (
+	"bytes"
 	"encoding/json"
+	"image/jpeg"
 	"testing"
 	"time"
 
@@ -161,4 +163,30 @@ func TestProcessEvent(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, outEvent, event2)
 	})
+	t.Run("image", func(t *testing.T) {
+		var outImage []byte
+		onEvent := func(_ *monitor.Recorder, _ *storage.Event, image []byte) {
+			outImage = image
+		}
+
+		a := newAlerter([]Hook{onEvent})
+
+		frame := newTestFrame()
+		event := &storage.Event{
+			Detections: []storage.Detection{{Score: 50}},
+			Frame:      &frame,
+		}
+		config := rawConf(t, Config{
+			Enable:    "true",
+			Threshold: "0",
+			Cooldown:  "0",
+		})
+
+		err := a.processEvent(nil, event, "", config)
+		require.NoError(t, err)
+
+		img, err := jpeg.Decode(bytes.NewReader(outImage))
+		require.NoError(t, err)
+		require.Equal(t, frame.Image.Bounds(), img.Bounds())
+	})
 }
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/storage"
+	"strings"
+)
+
+var (
+	regionColor = color.RGBA{R: 255, G: 0, B: 64, A: 255}
+	textColor   = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+const (
+	lineWidth   = 2
+	jpegQuality = 85
+)
+
+// annotate draws the detection regions with their labels
+// and scores on the frame and encodes it as jpeg.
+func annotate(frame storage.Frame, detections []storage.Detection) ([]byte, error) {
+	bounds := frame.Image.Bounds()
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, frame.Image, bounds.Min, draw.Src)
+
+	// Scale the text with the image.
+	scale := 1 + bounds.Dx()/640
+
+	for _, d := range detections {
+		if d.Region == nil {
+			continue
+		}
+
+		var labelPos *image.Point
+		if r := d.Region.Rect; r != nil {
+			top, left, bottom, right := r[0], r[1], r[2], r[3]
+			rect := image.Rectangle{
+				Min: frame.ToImage(ffmpeg.Point{left, top}),
+				Max: frame.ToImage(ffmpeg.Point{right, bottom}),
+			}
+			drawRect(img, rect)
+			labelPos = &rect.Min
+		}
+		if p := d.Region.Polygon; p != nil && len(*p) != 0 {
+			points := make([]image.Point, len(*p))
+			for i, point := range *p {
+				points[i] = frame.ToImage(point)
+			}
+			drawPolygon(img, points)
+			if labelPos == nil {
+				labelPos = &points[0]
+			}
+		}
+		if labelPos == nil {
+			continue
+		}
+
+		label := fmt.Sprintf("%v %.0f%%", d.Label, d.Score)
+		drawLabel(img, *labelPos, label, scale)
+	}
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func drawRect(img *image.RGBA, r image.Rectangle) {
+	src := image.NewUniform(regionColor)
+	edges := []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+lineWidth), // Top.
+		image.Rect(r.Min.X, r.Max.Y-lineWidth, r.Max.X, r.Max.Y), // Bottom.
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+lineWidth, r.Max.Y), // Left.
+		image.Rect(r.Max.X-lineWidth, r.Min.Y, r.Max.X, r.Max.Y), // Right.
+	}
+	for _, edge := range edges {
+		draw.Draw(img, edge, src, image.Point{}, draw.Src)
+	}
+}
+
+func drawPolygon(img *image.RGBA, points []image.Point) {
+	for i, p := range points {
+		next := points[(i+1)%len(points)]
+		drawLine(img, p, next)
+	}
+}
+
+// drawLine Bresenham's line algorithm.
+func drawLine(img *image.RGBA, p0 image.Point, p1 image.Point) {
+	abs := func(v int) int {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	sign := func(v int) int {
+		if v < 0 {
+			return -1
+		}
+		return 1
+	}
+
+	dx, dy := abs(p1.X-p0.X), -abs(p1.Y-p0.Y)
+	sx, sy := sign(p1.X-p0.X), sign(p1.Y-p0.Y)
+	e := dx + dy
+	x, y := p0.X, p0.Y
+	for {
+		// Pixels outside the image are ignored by Set.
+		for i := 0; i < lineWidth; i++ {
+			for j := 0; j < lineWidth; j++ {
+				img.SetRGBA(x+i, y+j, regionColor)
+			}
+		}
+		if x == p1.X && y == p1.Y {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y += sy
+		}
+	}
+}
+
+// drawLabel draws text on a background above the point,
+// or below it if there isn't enough space.
+func drawLabel(img *image.RGBA, pos image.Point, text string, scale int) {
+	const padding = 1
+	text = strings.ToUpper(text)
+	glyphW, glyphH := (glyphWidth+1)*scale, glyphHeight*scale
+	width := len(text)*glyphW + 2*padding*scale
+	height := glyphH + 2*padding*scale
+
+	bg := image.Rect(pos.X, pos.Y-height, pos.X+width, pos.Y)
+	if bg.Min.Y < img.Rect.Min.Y {
+		bg = bg.Add(image.Pt(0, height))
+	}
+	draw.Draw(img, bg, image.NewUniform(regionColor), image.Point{}, draw.Src)
+
+	x := bg.Min.X + padding*scale
+	y := bg.Min.Y + padding*scale
+	for _, r := range text {
+		drawGlyph(img, x, y, r, scale)
+		x += glyphW
+	}
+}
+
+func drawGlyph(img *image.RGBA, x int, y int, r rune, scale int) {
+	glyph, exist := font[r]
+	if !exist {
+		glyph = font['?']
+	}
+	for row, bits := range glyph {
+		for col := 0; col < glyphWidth; col++ {
+			if bits&(1<<(glyphWidth-1-col)) == 0 {
+				continue
+			}
+			pixel := image.Rect(
+				x+col*scale, y+row*scale,
+				x+(col+1)*scale, y+(row+1)*scale,
+			)
+			draw.Draw(img, pixel, image.NewUniform(textColor), image.Point{}, draw.Src)
+		}
+	}
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// font 5x7 bitmap font, one byte per row, the most significant bit is the left column.
+var font = map[rune][glyphHeight]uint8{
+	'A': {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'B': {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C': {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D': {0x1e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x1e},
+	'E': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G': {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H': {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I': {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M': {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P': {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q': {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R': {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S': {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T': {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X': {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	' ': {},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	':': {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'-': {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'_': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1f},
+	'%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'?': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package alert
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFrame() storage.Frame {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(img, img.Rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	return storage.Frame{Image: img}
+}
+
+// isRegionColor compares with tolerance for jpeg compression.
+func isRegionColor(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r>>8 > 200 && g>>8 < 60 && b>>8 < 120
+}
+
+func TestAnnotate(t *testing.T) {
+	t.Run("rect", func(t *testing.T) {
+		detections := []storage.Detection{{
+			Label: "person",
+			Score: 87.5,
+			Region: &storage.Region{
+				Rect: &ffmpeg.Rect{40, 20, 80, 60},
+			},
+		}}
+		buf, err := annotate(newTestFrame(), detections)
+		require.NoError(t, err)
+
+		img, err := jpeg.Decode(bytes.NewReader(buf))
+		require.NoError(t, err)
+		require.Equal(t, image.Rect(0, 0, 100, 100), img.Bounds())
+
+		// Rectangle edges.
+		require.True(t, isRegionColor(img.At(21, 60)), "left")
+		require.True(t, isRegionColor(img.At(59, 60)), "right")
+		require.True(t, isRegionColor(img.At(40, 79)), "bottom")
+
+		// Label background above the rectangle.
+		require.True(t, isRegionColor(img.At(22, 36)), "label")
+
+		// Inside and outside.
+		require.False(t, isRegionColor(img.At(40, 60)), "inside")
+		require.False(t, isRegionColor(img.At(90, 10)), "outside")
+	})
+	t.Run("polygon", func(t *testing.T) {
+		detections := []storage.Detection{{
+			Region: &storage.Region{
+				Polygon: &ffmpeg.Polygon{{10, 50}, {90, 50}, {50, 90}},
+			},
+		}}
+		buf, err := annotate(newTestFrame(), detections)
+		require.NoError(t, err)
+
+		img, err := jpeg.Decode(bytes.NewReader(buf))
+		require.NoError(t, err)
+		require.True(t, isRegionColor(img.At(60, 50)))
+		require.False(t, isRegionColor(img.At(50, 70)))
+	})
+	t.Run("fullFrame", func(t *testing.T) {
+		frame := newTestFrame()
+		// The image is the center of the full frame.
+		frame.FullFrame = image.Rect(-100, -100, 200, 200)
+
+		require.Equal(t, image.Pt(-100, -100), frame.ToImage(ffmpeg.Point{0, 0}))
+		require.Equal(t, image.Pt(50, 50), frame.ToImage(ffmpeg.Point{50, 50}))
+	})
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"nvr/pkg/storage"
+	"sort"
+	"time"
+)
+
+// DryRunRequest rule to test against saved recordings.
+type DryRunRequest struct {
+	Rule  Rule      `json:"rule"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// DryRunMatch event that matched the rule.
+type DryRunMatch struct {
+	RecordingID string              `json:"recordingID"`
+	MonitorID   string              `json:"monitorID"`
+	Time        time.Time           `json:"time"`
+	Detections  []storage.Detection `json:"detections"`
+
+	// False if the alert would have been suppressed by the cooldown.
+	Alert bool `json:"alert"`
+}
+
+// DryRunResponse matches, oldest first.
+type DryRunResponse struct {
+	Matches []DryRunMatch `json:"matches"`
+	Alerts  int           `json:"alerts"`
+
+	// True if the number of matches exceeded the limit.
+	Truncated bool `json:"truncated"`
+}
+
+const dryRunMaxMatches = 1000
+
+// ErrInvalidRange invalid range.
+var ErrInvalidRange = errors.New("invalid range")
+
+// dryRun evaluates the rule against the events in recordings between start and end.
+func dryRun(crawler *storage.Crawler, r rule, start time.Time, end time.Time) (*DryRunResponse, error) {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return nil, ErrInvalidRange
+	}
+
+	res := &DryRunResponse{Matches: []DryRunMatch{}}
+	query := storage.SearchQuery{
+		Monitors: r.Monitors,
+		Start:    start,
+		End:      end,
+		Limit:    100,
+	}
+	for {
+		page, err := crawler.Search(query)
+		if err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+		for _, rec := range page.Recordings {
+			for _, match := range dryRunRecording(r, rec, start, end) {
+				if len(res.Matches) >= dryRunMaxMatches {
+					res.Truncated = true
+					break
+				}
+				res.Matches = append(res.Matches, match)
+			}
+		}
+		if page.Cursor == "" || res.Truncated {
+			break
+		}
+		query.Cursor = page.Cursor
+	}
+
+	// Recordings are searched newest first.
+	sort.SliceStable(res.Matches, func(i, j int) bool {
+		return res.Matches[i].Time.Before(res.Matches[j].Time)
+	})
+
+	prevAlerts := make(map[string]time.Time)
+	for i, m := range res.Matches {
+		prev, exist := prevAlerts[m.MonitorID]
+		if exist && prev.Add(r.cooldown).After(m.Time) {
+			continue
+		}
+		prevAlerts[m.MonitorID] = m.Time
+		res.Matches[i].Alert = true
+		res.Alerts++
+	}
+	return res, nil
+}
+
+func dryRunRecording(r rule, rec storage.Recording, start time.Time, end time.Time) []DryRunMatch {
+	if rec.Data == nil || len(rec.ID) < 20 {
+		return nil
+	}
+	monitorID := rec.ID[20:]
+
+	var matches []DryRunMatch
+	for _, event := range rec.Data.Events {
+		if event.Time.Before(start) || event.Time.After(end) {
+			continue
+		}
+		detections := r.match(monitorID, event)
+		if len(detections) == 0 {
+			continue
+		}
+		matches = append(matches, DryRunMatch{
+			RecordingID: rec.ID,
+			MonitorID:   monitorID,
+			Time:        event.Time,
+			Detections:  detections,
+		})
+	}
+	return matches
+}
+
+func handleDryRun(crawler *storage.Crawler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req DryRunRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "unmarshal request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Rule.Name == "" {
+			req.Rule.Name = "dry-run"
+		}
+		rule, err := parseRule(req.Rule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := dryRun(crawler, *rule, req.Start, req.End)
+		if errors.Is(err, ErrInvalidRange) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr"
+	"nvr/addons/alert"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var addon struct {
+	notifier *notifier
+}
+
+func init() {
+	nvr.RegisterLogSource([]string{"email"})
+	nvr.RegisterTplHook(modifyTemplates)
+	nvr.RegisterAppRunHook(func(_ context.Context, app *nvr.App) error {
+		configPath := app.Env.ConfigDir + "/email.json"
+		config, err := readConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("email: config: %w, %v", err, configPath)
+		}
+		addon.notifier, err = newNotifier(*config)
+		if err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+		return nil
+	})
+	alert.RegisterNotifier("email", func(r *monitor.Recorder, event *storage.Event, image []byte) {
+		addon.notifier.onAlert(r, event, image)
+	})
+}
+
+// Config global email configuration.
+type Config struct {
+	// SMTP server "host:port".
+	Address  string `json:"address"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+
+	// Use implicit TLS instead of STARTTLS, usually port 465.
+	TLS bool `json:"tls"`
+
+	// Go templates, see templateData.
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+var defaultConfig = Config{
+	Address: "smtp.example.com:587",
+	From:    "nvr@example.com",
+	Subject: `{{.MonitorName}}: {{.Label}} detected`,
+	Body: `{{.Label}} detected on {{.MonitorName}} with score {{.Score}}` +
+		` at {{.Time.Format "2006-01-02 15:04:05"}}.`,
+}
+
+// ErrInvalidConfig invalid config.
+var ErrInvalidConfig = errors.New("invalid config")
+
+func readConfig(configPath string) (*Config, error) {
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		data, _ := json.MarshalIndent(defaultConfig, "", "    ")
+		if err := os.WriteFile(configPath, data, 0o600); err != nil {
+			return nil, fmt.Errorf("generate config: %w", err)
+		}
+	}
+
+	file, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(file, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("%w: address missing", ErrInvalidConfig)
+	}
+	if config.From == "" {
+		return nil, fmt.Errorf("%w: from missing", ErrInvalidConfig)
+	}
+	if config.Subject == "" {
+		config.Subject = defaultConfig.Subject
+	}
+	if config.Body == "" {
+		config.Body = defaultConfig.Body
+	}
+	return &config, nil
+}
+
+// templateData is available to the subject and body templates.
+type templateData struct {
+	MonitorID   string
+	MonitorName string
+	Label       string
+	Score       float64
+	Time        time.Time
+}
+
+type notifier struct {
+	config  Config
+	subject *template.Template
+	body    *template.Template
+
+	// Stubbed in tests.
+	send func(Config, []string, []byte) error
+}
+
+func newNotifier(config Config) (*notifier, error) {
+	subject, err := template.New("subject").Parse(config.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("parse subject template: %w", err)
+	}
+	body, err := template.New("body").Parse(config.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse body template: %w", err)
+	}
+	return &notifier{
+		config:  config,
+		subject: subject,
+		body:    body,
+		send:    sendMail,
+	}, nil
+}
+
+func (n *notifier) onAlert(r *monitor.Recorder, event *storage.Event, image []byte) {
+	recipients := parseRecipients(r.Config.Get("alertEmail"))
+	if len(recipients) == 0 {
+		return
+	}
+
+	monitorID := r.Config.ID()
+	logf := func(level log.Level, format string, a ...interface{}) {
+		r.Logger.Log(log.Entry{
+			Level:     level,
+			Src:       "email",
+			MonitorID: monitorID,
+			Msg:       fmt.Sprintf(format, a...),
+		})
+	}
+
+	d := alert.BestDetection(*event)
+	data := templateData{
+		MonitorID:   monitorID,
+		MonitorName: r.Config.Name(),
+		Label:       d.Label,
+		Score:       d.Score,
+		Time:        event.Time,
+	}
+
+	// Don't block other alert hooks.
+	go func() {
+		msg, err := n.message(data, recipients, image)
+		if err != nil {
+			logf(log.LevelError, "%v", err)
+			return
+		}
+		if err := n.send(n.config, recipients, msg); err != nil {
+			logf(log.LevelError, "send: %v", err)
+			return
+		}
+		logf(log.LevelInfo, "sent to %v", strings.Join(recipients, ", "))
+	}()
+}
+
+func (n *notifier) message(data templateData, to []string, image []byte) ([]byte, error) {
+	var subject bytes.Buffer
+	if err := n.subject.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("execute subject template: %w", err)
+	}
+	var body bytes.Buffer
+	if err := n.body.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("execute body template: %w", err)
+	}
+
+	m := mail{
+		from:    n.config.From,
+		to:      to,
+		subject: subject.String(),
+		body:    body.String(),
+		date:    data.Time,
+		image:   image,
+	}
+	msg, err := m.marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal message: %w", err)
+	}
+	return msg, nil
+}
+
+// parseRecipients parses a comma separated list of addresses.
+func parseRecipients(raw string) []string {
+	var recipients []string
+	for _, r := range strings.Split(raw, ",") {
+		r = strings.TrimSpace(r)
+		if r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	return recipients
+}
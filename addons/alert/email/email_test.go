@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// smtpServer is a minimal SMTP server that stores received messages.
+type smtpServer struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	from     string
+	to       []string
+	messages [][]byte
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpServer{l: l}
+	t.Cleanup(func() { l.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n")) //nolint:errcheck
+	}
+	reply("220 localhost")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.TrimPrefix(line, "MAIL FROM:")
+			s.mu.Unlock()
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, strings.TrimPrefix(line, "RCPT TO:"))
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data bytes.Buffer
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.Bytes())
+			s.mu.Unlock()
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	s := newSMTPServer(t)
+
+	config := defaultConfig
+	config.Address = s.l.Addr().String()
+	n, err := newNotifier(config)
+	require.NoError(t, err)
+
+	data := templateData{
+		MonitorID:   "m1",
+		MonitorName: "Door",
+		Label:       "person",
+		Score:       87.5,
+		Time:        time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC),
+	}
+	to := []string{"a@example.com", "b@example.com"}
+	image := []byte("jpeg data")
+
+	msg, err := n.message(data, to, image)
+	require.NoError(t, err)
+	require.NoError(t, sendMail(config, to, msg))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	require.Equal(t, "<nvr@example.com>", s.from)
+	require.Equal(t, []string{"<a@example.com>", "<b@example.com>"}, s.to)
+	require.Len(t, s.messages, 1)
+
+	m, err := netmail.ReadMessage(bytes.NewReader(s.messages[0]))
+	require.NoError(t, err)
+	require.Equal(t, "Door: person detected", m.Header.Get("Subject"))
+	require.Equal(t, "a@example.com, b@example.com", m.Header.Get("To"))
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+
+	r := multipart.NewReader(m.Body, params["boundary"])
+	part, err := r.NextPart()
+	require.NoError(t, err)
+	body, err := io.ReadAll(part)
+	require.NoError(t, err)
+	require.Equal(t, "person detected on Door with score 87.5 at 2001-02-03 04:05:06.", string(body))
+
+	part, err = r.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "detection.jpeg", part.FileName())
+	attachment, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+	require.NoError(t, err)
+	require.Equal(t, image, attachment)
+
+	_, err = r.NextPart()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestNewNotifier(t *testing.T) {
+	config := defaultConfig
+	config.Subject = "{{"
+	_, err := newNotifier(config)
+	require.Error(t, err)
+}
+
+func TestReadConfig(t *testing.T) {
+	t.Run("generate", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "email.json")
+		config, err := readConfig(configPath)
+		require.NoError(t, err)
+		require.Equal(t, defaultConfig, *config)
+	})
+	t.Run("fromMissing", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "email.json")
+		err := os.WriteFile(configPath, []byte(`{"address":"x:25"}`), 0o600)
+		require.NoError(t, err)
+
+		_, err = readConfig(configPath)
+		require.ErrorIs(t, err, ErrInvalidConfig)
+	})
+}
+
+func TestParseRecipients(t *testing.T) {
+	require.Nil(t, parseRecipients(""))
+	require.Equal(t, []string{"a", "b"}, parseRecipients(" a, ,b "))
+}
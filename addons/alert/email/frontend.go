@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package email
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func modifyTemplates(pageFiles map[string]string) error {
+	js, exists := pageFiles["settings.js"]
+	if !exists {
+		return fmt.Errorf("email: settings.js: %w", os.ErrNotExist)
+	}
+	pageFiles["settings.js"] = modifySettingsjs(js)
+	return nil
+}
+
+func modifySettingsjs(tpl string) string {
+	const target = "logLevel: fieldTemplate.select("
+
+	const javascript = `
+	alertEmail: newField(
+		[],
+		{
+			input: "text",
+		},
+		{
+			label: "Alert email",
+			placeholder: "a@example.com, b@example.com",
+		}
+	),`
+
+	return strings.ReplaceAll(tpl, target, javascript+target)
+}
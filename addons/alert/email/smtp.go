@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+type mail struct {
+	from    string
+	to      []string
+	subject string
+	body    string
+	date    time.Time
+
+	// Optional jpeg attachment.
+	image []byte
+}
+
+func (m mail) marshal() ([]byte, error) {
+	var b bytes.Buffer
+	writeHeader := func(key string, value string) {
+		b.WriteString(key + ": " + value + "\r\n")
+	}
+	writeHeader("From", m.from)
+	writeHeader("To", strings.Join(m.to, ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", m.subject))
+	writeHeader("Date", m.date.Format(time.RFC1123Z))
+	writeHeader("MIME-Version", "1.0")
+
+	w := multipart.NewWriter(&b)
+	writeHeader("Content-Type", "multipart/mixed; boundary="+w.Boundary())
+	b.WriteString("\r\n")
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(m.body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(m.image) != 0 {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/jpeg"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {`attachment; filename="detection.jpeg"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, m.image); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeBase64 writes base64 with lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) error {
+	const lineLength = 76
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := lineLength
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := w.Write([]byte(encoded[:n] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// sendMail is similar to smtp.SendMail but also supports implicit TLS.
+func sendMail(config Config, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(config.Address)
+	if err != nil {
+		return fmt.Errorf("split host port: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if config.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", config.Address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", config.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(time.Minute)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("new client: %w", err)
+	}
+	defer c.Close()
+
+	if !config.TLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return fmt.Errorf("starttls: %w", err)
+			}
+		}
+	}
+	if config.Username != "" {
+		auth := smtp.PlainAuth("", config.Username, config.Password, host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(config.From); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return fmt.Errorf("rcpt %v: %w", addr, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close data: %w", err)
+	}
+	return c.Quit()
+}
@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/storage"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule alert rule. An alert is sent if any detection matches.
+type Rule struct {
+	Name string `json:"name"`
+
+	// Monitor IDs, empty matches all monitors.
+	Monitors []string `json:"monitors"`
+
+	// Minimum score by label. "*" matches any label.
+	Labels map[string]float64 `json:"labels"`
+
+	// Optional, the detection center must be inside. Percent values.
+	Zone ffmpeg.Polygon `json:"zone"`
+
+	// Optional, the rule is only active during these windows.
+	Schedule []TimeWindow `json:"schedule"`
+
+	// Minimum time between alerts per monitor, Go duration.
+	Cooldown string `json:"cooldown"`
+
+	// Notifiers to invoke, empty invokes all.
+	Notifiers []string `json:"notifiers"`
+}
+
+// TimeWindow weekly time window in local time.
+type TimeWindow struct {
+	// "mon", "tue", "wed", "thu", "fri", "sat", "sun". Empty matches all days.
+	Days []string `json:"days"`
+
+	// "hh:mm", the window wraps around midnight if end is before start.
+	// The window covers the whole day if they are equal.
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// RulesConfig global alert configuration.
+type RulesConfig struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Errors.
+var (
+	ErrInvalidRule = errors.New("invalid rule")
+	ErrInvalidTime = errors.New("invalid time")
+)
+
+// anyLabel matches all labels.
+const anyLabel = "*"
+
+func readRulesConfig(configPath string) ([]rule, error) {
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		data, _ := json.MarshalIndent(RulesConfig{Rules: []Rule{}}, "", "    ")
+		if err := os.WriteFile(configPath, data, 0o600); err != nil {
+			return nil, fmt.Errorf("generate config: %w", err)
+		}
+	}
+
+	file, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var config RulesConfig
+	if err := json.Unmarshal(file, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	rules := make([]rule, 0, len(config.Rules))
+	names := make(map[string]struct{})
+	for _, r := range config.Rules {
+		parsed, err := parseRule(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, exist := names[r.Name]; exist {
+			return nil, fmt.Errorf("%w: duplicate name: %v", ErrInvalidRule, r.Name)
+		}
+		names[r.Name] = struct{}{}
+		rules = append(rules, *parsed)
+	}
+	return rules, nil
+}
+
+// rule parsed rule.
+type rule struct {
+	Rule
+	monitors map[string]struct{}
+	cooldown time.Duration
+	windows  []timeWindow
+}
+
+func parseRule(r Rule) (*rule, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("%w: name missing", ErrInvalidRule)
+	}
+	if len(r.Labels) == 0 {
+		return nil, fmt.Errorf("%w: %v: labels missing", ErrInvalidRule, r.Name)
+	}
+	if len(r.Zone) != 0 && len(r.Zone) < 3 {
+		return nil, fmt.Errorf("%w: %v: zone must have at least 3 points", ErrInvalidRule, r.Name)
+	}
+
+	var cooldown time.Duration
+	if r.Cooldown != "" {
+		var err error
+		cooldown, err = time.ParseDuration(r.Cooldown)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v: cooldown: %v", ErrInvalidRule, r.Name, err)
+		}
+	}
+
+	windows := make([]timeWindow, 0, len(r.Schedule))
+	for _, w := range r.Schedule {
+		parsed, err := parseTimeWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v: schedule: %v", ErrInvalidRule, r.Name, err)
+		}
+		windows = append(windows, *parsed)
+	}
+
+	monitors := make(map[string]struct{}, len(r.Monitors))
+	for _, id := range r.Monitors {
+		monitors[id] = struct{}{}
+	}
+
+	return &rule{
+		Rule:     r,
+		monitors: monitors,
+		cooldown: cooldown,
+		windows:  windows,
+	}, nil
+}
+
+func (r rule) matchMonitor(monitorID string) bool {
+	if len(r.monitors) == 0 {
+		return true
+	}
+	_, exist := r.monitors[monitorID]
+	return exist
+}
+
+func (r rule) active(t time.Time) bool {
+	if len(r.windows) == 0 {
+		return true
+	}
+	for _, w := range r.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the detections that match the rule.
+func (r rule) match(monitorID string, event storage.Event) []storage.Detection {
+	if !r.matchMonitor(monitorID) || !r.active(event.Time.Local()) {
+		return nil
+	}
+	var matches []storage.Detection
+	for _, d := range event.Detections {
+		if r.matchDetection(d) {
+			matches = append(matches, d)
+		}
+	}
+	return matches
+}
+
+func (r rule) matchDetection(d storage.Detection) bool {
+	threshold, exist := r.Labels[d.Label]
+	if !exist {
+		threshold, exist = r.Labels[anyLabel]
+		if !exist {
+			return false
+		}
+	}
+	if d.Score < threshold {
+		return false
+	}
+	if len(r.Zone) == 0 {
+		return true
+	}
+	if d.Region == nil || d.Region.Rect == nil {
+		return false
+	}
+	x, y := d.Region.Rect.Center()
+	return ffmpeg.VertexInsidePoly(int(x), int(y), r.Zone)
+}
+
+type timeWindow struct {
+	days  [7]bool // Indexed by time.Weekday.
+	start int     // Minutes since midnight.
+	end   int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func parseTimeWindow(w TimeWindow) (*timeWindow, error) {
+	var parsed timeWindow
+	if len(w.Days) == 0 {
+		for i := range parsed.days {
+			parsed.days[i] = true
+		}
+	}
+	for _, day := range w.Days {
+		weekday, exist := weekdays[strings.ToLower(day)]
+		if !exist {
+			return nil, fmt.Errorf("invalid day: %q", day)
+		}
+		parsed.days[weekday] = true
+	}
+
+	var err error
+	if parsed.start, err = parseClock(w.Start); err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	if parsed.end, err = parseClock(w.End); err != nil {
+		return nil, fmt.Errorf("end: %w", err)
+	}
+	return &parsed, nil
+}
+
+// parseClock parses "hh:mm" and returns the minutes since midnight.
+func parseClock(s string) (int, error) {
+	rawHour, rawMinute, found := strings.Cut(s, ":")
+	if !found {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTime, s)
+	}
+	hour, err := strconv.Atoi(rawHour)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTime, s)
+	}
+	minute, err := strconv.Atoi(rawMinute)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTime, s)
+	}
+	return hour*60 + minute, nil
+}
+
+func (w timeWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case w.start == w.end:
+		return w.days[day]
+	case w.start < w.end:
+		return w.days[day] && minute >= w.start && minute < w.end
+	case minute >= w.start:
+		return w.days[day]
+	case minute < w.end:
+		// The window started the previous day.
+		return w.days[(day+6)%7]
+	}
+	return false
+}
@@ -0,0 +1,371 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRule(t *testing.T, r Rule) rule {
+	t.Helper()
+	if r.Name == "" {
+		r.Name = "test"
+	}
+	parsed, err := parseRule(r)
+	require.NoError(t, err)
+	return *parsed
+}
+
+func rect(top, left, bottom, right int) *storage.Region {
+	return &storage.Region{Rect: &ffmpeg.Rect{top, left, bottom, right}}
+}
+
+func TestParseRule(t *testing.T) {
+	cases := map[string]Rule{
+		"nameMissing":     {Labels: map[string]float64{"a": 1}},
+		"labelsMissing":   {Name: "a"},
+		"invalidZone":     {Name: "a", Labels: map[string]float64{"a": 1}, Zone: ffmpeg.Polygon{{0, 0}}},
+		"invalidCooldown": {Name: "a", Labels: map[string]float64{"a": 1}, Cooldown: "x"},
+		"invalidDay": {
+			Name:     "a",
+			Labels:   map[string]float64{"a": 1},
+			Schedule: []TimeWindow{{Days: []string{"x"}, Start: "00:00", End: "01:00"}},
+		},
+		"invalidTime": {
+			Name:     "a",
+			Labels:   map[string]float64{"a": 1},
+			Schedule: []TimeWindow{{Start: "24:00", End: "01:00"}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseRule(tc)
+			require.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	now := time.Now()
+	event := storage.Event{
+		Time: now,
+		Detections: []storage.Detection{
+			{Label: "person", Score: 60, Region: rect(0, 0, 20, 20)},
+			{Label: "car", Score: 90, Region: rect(80, 80, 100, 100)},
+			{Label: "dog", Score: 30, Region: rect(80, 80, 100, 100)},
+		},
+	}
+	labels := func(detections []storage.Detection) []string {
+		var labels []string
+		for _, d := range detections {
+			labels = append(labels, d.Label)
+		}
+		return labels
+	}
+
+	t.Run("labels", func(t *testing.T) {
+		r := newTestRule(t, Rule{Labels: map[string]float64{"person": 50, "car": 95}})
+		require.Equal(t, []string{"person"}, labels(r.match("m1", event)))
+	})
+	t.Run("anyLabel", func(t *testing.T) {
+		r := newTestRule(t, Rule{Labels: map[string]float64{"*": 50, "car": 95}})
+		require.Equal(t, []string{"person"}, labels(r.match("m1", event)))
+	})
+	t.Run("zone", func(t *testing.T) {
+		r := newTestRule(t, Rule{
+			Labels: map[string]float64{"*": 0},
+			Zone:   ffmpeg.Polygon{{50, 50}, {100, 50}, {100, 100}, {50, 100}},
+		})
+		require.Equal(t, []string{"car", "dog"}, labels(r.match("m1", event)))
+	})
+	t.Run("monitors", func(t *testing.T) {
+		r := newTestRule(t, Rule{
+			Monitors: []string{"m2"},
+			Labels:   map[string]float64{"*": 0},
+		})
+		require.Nil(t, r.match("m1", event))
+		require.Len(t, r.match("m2", event), 3)
+	})
+	t.Run("schedule", func(t *testing.T) {
+		hour := now.Hour()
+		active := newTestRule(t, Rule{
+			Labels: map[string]float64{"*": 0},
+			Schedule: []TimeWindow{{
+				Start: time.Date(0, 0, 0, hour, 0, 0, 0, time.Local).Format("15:04"),
+				End:   time.Date(0, 0, 0, hour+1, 0, 0, 0, time.Local).Format("15:04"),
+			}},
+		})
+		require.Len(t, active.match("m1", event), 3)
+
+		inactive := newTestRule(t, Rule{
+			Labels: map[string]float64{"*": 0},
+			Schedule: []TimeWindow{{
+				Start: time.Date(0, 0, 0, hour+1, 0, 0, 0, time.Local).Format("15:04"),
+				End:   time.Date(0, 0, 0, hour+2, 0, 0, 0, time.Local).Format("15:04"),
+			}},
+		})
+		require.Nil(t, inactive.match("m1", event))
+	})
+}
+
+func TestTimeWindow(t *testing.T) {
+	// 2001-02-05 is a Monday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2001, 2, day, hour, min, 0, 0, time.UTC)
+	}
+	cases := map[string]struct {
+		window   TimeWindow
+		time     time.Time
+		expected bool
+	}{
+		"inside":         {TimeWindow{Start: "08:00", End: "17:00"}, at(5, 8, 0), true},
+		"end":            {TimeWindow{Start: "08:00", End: "17:00"}, at(5, 17, 0), false},
+		"before":         {TimeWindow{Start: "08:00", End: "17:00"}, at(5, 7, 59), false},
+		"day":            {TimeWindow{Days: []string{"mon"}, Start: "08:00", End: "17:00"}, at(5, 9, 0), true},
+		"otherDay":       {TimeWindow{Days: []string{"tue"}, Start: "08:00", End: "17:00"}, at(5, 9, 0), false},
+		"wholeDay":       {TimeWindow{Days: []string{"Mon"}, Start: "00:00", End: "00:00"}, at(5, 23, 59), true},
+		"wrapEvening":    {TimeWindow{Days: []string{"mon"}, Start: "22:00", End: "06:00"}, at(5, 23, 0), true},
+		"wrapMorning":    {TimeWindow{Days: []string{"mon"}, Start: "22:00", End: "06:00"}, at(6, 5, 0), true},
+		"wrapMorningMon": {TimeWindow{Days: []string{"mon"}, Start: "22:00", End: "06:00"}, at(5, 5, 0), false},
+		"wrapOutside":    {TimeWindow{Start: "22:00", End: "06:00"}, at(5, 12, 0), false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			w, err := parseTimeWindow(tc.window)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, w.contains(tc.time))
+		})
+	}
+}
+
+func TestReadRulesConfig(t *testing.T) {
+	t.Run("generate", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "alert.json")
+		rules, err := readRulesConfig(configPath)
+		require.NoError(t, err)
+		require.Empty(t, rules)
+
+		_, err = os.Stat(configPath)
+		require.NoError(t, err)
+	})
+	t.Run("duplicate", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "alert.json")
+		raw := `{"rules":[{"name":"a","labels":{"x":1}},{"name":"a","labels":{"x":1}}]}`
+		require.NoError(t, os.WriteFile(configPath, []byte(raw), 0o600))
+
+		_, err := readRulesConfig(configPath)
+		require.ErrorIs(t, err, ErrInvalidRule)
+	})
+}
+
+func TestProcessRules(t *testing.T) {
+	var calls []string
+	newHook := func(name string) Hook {
+		return func(*monitor.Recorder, *storage.Event, []byte) {
+			calls = append(calls, name)
+		}
+	}
+
+	a := newAlerter([]Hook{newHook("log")})
+	a.notifiers = map[string]Hook{"a": newHook("a"), "b": newHook("b")}
+	a.rules = []rule{
+		newTestRule(t, Rule{
+			Name:      "1",
+			Labels:    map[string]float64{"person": 50},
+			Cooldown:  "1h",
+			Notifiers: []string{"b"},
+		}),
+		newTestRule(t, Rule{
+			Name:      "2",
+			Labels:    map[string]float64{"car": 50},
+			Notifiers: []string{"a"},
+		}),
+	}
+
+	person := &storage.Event{Detections: []storage.Detection{{Label: "person", Score: 60}}}
+	require.NoError(t, a.processEvent(nil, person, "m1", ""))
+	require.Equal(t, []string{"log", "b"}, calls)
+
+	// Cooldown is per monitor.
+	calls = nil
+	require.NoError(t, a.processEvent(nil, person, "m1", ""))
+	require.NoError(t, a.processEvent(nil, person, "m2", ""))
+	require.Equal(t, []string{"log", "b"}, calls)
+
+	calls = nil
+	car := &storage.Event{Detections: []storage.Detection{{Label: "car", Score: 60}}}
+	require.NoError(t, a.processEvent(nil, car, "m1", ""))
+	require.Equal(t, []string{"log", "a"}, calls)
+}
+
+func dryRunTestFS() fstest.MapFS {
+	at := func(hour, min int) time.Time {
+		return time.Date(2001, 2, 3, hour, min, 0, 0, time.UTC)
+	}
+	file := func(start time.Time, events []storage.Event) *fstest.MapFile {
+		raw, err := json.Marshal(storage.RecordingData{
+			Start:  start,
+			End:    start.Add(10 * time.Minute),
+			Events: events,
+		})
+		if err != nil {
+			panic(err)
+		}
+		return &fstest.MapFile{Data: raw}
+	}
+	person := []storage.Detection{{Label: "person", Score: 90}}
+	return fstest.MapFS{
+		"2001/02/03/m1/2001-02-03_01-00-00_m1.json": file(at(1, 0), []storage.Event{
+			{Time: at(1, 1), Detections: person},
+			{Time: at(1, 2), Detections: person},
+			{Time: at(1, 3), Detections: []storage.Detection{{Label: "car", Score: 90}}},
+		}),
+		"2001/02/03/m1/2001-02-03_02-00-00_m1.json": file(at(2, 0), []storage.Event{
+			{Time: at(2, 1), Detections: person},
+		}),
+		"2001/02/03/m2/2001-02-03_01-30-00_m2.json": file(at(1, 30), []storage.Event{
+			{Time: at(1, 31), Detections: person},
+		}),
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	crawler := storage.NewCrawler(dryRunTestFS())
+	start := time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	t.Run("ok", func(t *testing.T) {
+		r := newTestRule(t, Rule{
+			Labels:   map[string]float64{"person": 50},
+			Cooldown: "30m",
+		})
+		res, err := dryRun(crawler, r, start, end)
+		require.NoError(t, err)
+
+		type match struct {
+			id    string
+			min   int
+			alert bool
+		}
+		var actual []match
+		for _, m := range res.Matches {
+			actual = append(actual, match{m.MonitorID, m.Time.Hour()*60 + m.Time.Minute(), m.Alert})
+		}
+		expected := []match{
+			{"m1", 61, true},
+			{"m1", 62, false},
+			{"m2", 91, true},
+			{"m1", 121, true},
+		}
+		require.Equal(t, expected, actual)
+		require.Equal(t, 3, res.Alerts)
+		require.False(t, res.Truncated)
+	})
+	t.Run("monitors", func(t *testing.T) {
+		r := newTestRule(t, Rule{
+			Monitors: []string{"m2"},
+			Labels:   map[string]float64{"*": 0},
+		})
+		res, err := dryRun(crawler, r, start, end)
+		require.NoError(t, err)
+		require.Len(t, res.Matches, 1)
+		require.Equal(t, "2001-02-03_01-30-00_m2", res.Matches[0].RecordingID)
+	})
+	t.Run("invalidRange", func(t *testing.T) {
+		r := newTestRule(t, Rule{Labels: map[string]float64{"*": 0}})
+		_, err := dryRun(crawler, r, end, start)
+		require.ErrorIs(t, err, ErrInvalidRange)
+	})
+	t.Run("handler", func(t *testing.T) {
+		body, err := json.Marshal(DryRunRequest{
+			Rule:  Rule{Labels: map[string]float64{"car": 50}},
+			Start: start,
+			End:   end,
+		})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/alert/dry-run", bytes.NewReader(body))
+		handleDryRun(crawler).ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var res DryRunResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		require.Len(t, res.Matches, 1)
+		require.Equal(t, 1, res.Alerts)
+	})
+	t.Run("handlerInvalidRule", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/alert/dry-run", bytes.NewReader([]byte(`{}`)))
+		handleDryRun(crawler).ServeHTTP(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestProcessEventConfigAndRules(t *testing.T) {
+	var calls []string
+	newHook := func(name string) Hook {
+		return func(*monitor.Recorder, *storage.Event, []byte) {
+			calls = append(calls, name)
+		}
+	}
+
+	a := newAlerter([]Hook{newHook("log")})
+	a.notifiers = map[string]Hook{"a": newHook("a")}
+	a.rules = []rule{
+		newTestRule(t, Rule{Name: "1", Labels: map[string]float64{"person": 50}}),
+		newTestRule(t, Rule{Name: "2", Labels: map[string]float64{"*": 50}}),
+	}
+	config := rawConf(t, Config{
+		Enable:    "true",
+		Threshold: "50",
+		Cooldown:  "0",
+	})
+
+	// The hooks and each notifier are called once per event.
+	person := &storage.Event{Detections: []storage.Detection{{Label: "person", Score: 60}}}
+	require.NoError(t, a.processEvent(nil, person, "m1", config))
+	require.Equal(t, []string{"log", "a"}, calls)
+
+	// Rules are processed if the monitor config is invalid.
+	calls = nil
+	a.prevAlerts = map[string]time.Time{}
+	require.Error(t, a.processEvent(nil, person, "m1", "{"))
+	require.Equal(t, []string{"log", "a"}, calls)
+}
+
+func TestAlertMatchedDetections(t *testing.T) {
+	var outEvent *storage.Event
+	a := newAlerter([]Hook{func(_ *monitor.Recorder, event *storage.Event, _ []byte) {
+		outEvent = event
+	}})
+	a.rules = []rule{
+		newTestRule(t, Rule{Name: "1", Labels: map[string]float64{"person": 50}}),
+	}
+
+	person := storage.Detection{Label: "person", Score: 60}
+	event := &storage.Event{Detections: []storage.Detection{
+		{Label: "car", Score: 90},
+		person,
+	}}
+	require.NoError(t, a.processEvent(nil, event, "m1", ""))
+
+	// The notifiers only see the detections that matched the rule.
+	require.Equal(t, []storage.Detection{person}, outEvent.Detections)
+	require.Equal(t, person, BestDetection(*outEvent))
+	require.Len(t, event.Detections, 2)
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package webhook
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func modifyTemplates(pageFiles map[string]string) error {
+	js, exists := pageFiles["settings.js"]
+	if !exists {
+		return fmt.Errorf("webhook: settings.js: %w", os.ErrNotExist)
+	}
+	pageFiles["settings.js"] = modifySettingsjs(js)
+	return nil
+}
+
+func modifySettingsjs(tpl string) string {
+	const target = "logLevel: fieldTemplate.select("
+
+	const javascript = `
+	alertWebhooks: newField(
+		[],
+		{
+			input: "text",
+		},
+		{
+			label: "Alert webhooks",
+			placeholder: "name1, name2",
+		}
+	),`
+
+	return strings.ReplaceAll(tpl, target, javascript+target)
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"time"
+)
+
+func handleLog(n *notifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(n.deliveryLog()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// handleTest sends a test event to a webhook and responds with the delivery.
+func handleTest(n *notifier, monitorConfigs func() monitor.RawConfigs) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		webhook, exist := n.webhooks[query.Get("name")]
+		if !exist {
+			http.Error(w, "webhook does not exist", http.StatusNotFound)
+			return
+		}
+
+		monitorID := query.Get("monitor")
+		rawConfig := monitor.RawConfig{"id": monitorID, "name": monitorID}
+		if monitorID != "" {
+			c, exist := monitorConfigs()[monitorID]
+			if !exist {
+				http.Error(w, "monitor does not exist", http.StatusNotFound)
+				return
+			}
+			rawConfig = c
+		}
+
+		event := storage.Event{
+			Time:       time.Now(),
+			Detections: []storage.Detection{{Label: "test", Score: 100}},
+		}
+		data := newTemplateData(monitor.NewConfig(rawConfig), event)
+
+		// Deliver once without retries.
+		delivery := Delivery{
+			Time:      time.Now(),
+			Webhook:   webhook.Name,
+			MonitorID: data.MonitorID,
+			Attempts:  1,
+		}
+		status, err := n.send(r.Context(), webhook, data)
+		delivery.Status = status
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		n.addDelivery(delivery)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(delivery); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
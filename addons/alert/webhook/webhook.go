@@ -0,0 +1,392 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"nvr"
+	"nvr/addons/alert"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var addon struct {
+	notifier *notifier
+}
+
+func init() {
+	nvr.RegisterLogSource([]string{"webhook"})
+	nvr.RegisterTplHook(modifyTemplates)
+	nvr.RegisterAppRunHook(func(ctx context.Context, app *nvr.App) error {
+		configPath := app.Env.ConfigDir + "/webhook.json"
+		config, err := readConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("webhook: config: %w, %v", err, configPath)
+		}
+
+		logf := func(level log.Level, monitorID string, format string, a ...interface{}) {
+			app.Logger.Log(log.Entry{
+				Level:     level,
+				Src:       "webhook",
+				MonitorID: monitorID,
+				Msg:       fmt.Sprintf(format, a...),
+			})
+		}
+		addon.notifier, err = newNotifier(ctx, *config, logf)
+		if err != nil {
+			return fmt.Errorf("webhook: %w", err)
+		}
+
+		app.Router.Handle("/api/webhook/log", app.Auth.Admin(handleLog(addon.notifier)))
+		app.Router.Handle("/api/webhook/test", app.Auth.Admin(app.Auth.CSRF(
+			handleTest(addon.notifier, app.MonitorManager.MonitorConfigs),
+		)))
+		return nil
+	})
+	alert.RegisterNotifier("webhook", func(r *monitor.Recorder, event *storage.Event, _ []byte) {
+		addon.notifier.onAlert(r.Config, event)
+	})
+}
+
+// Config global webhook configuration.
+type Config struct {
+	Webhooks []Webhook `json:"webhooks"`
+
+	// Number of attempts before a delivery is dropped.
+	Attempts int `json:"attempts"`
+
+	// Delay before the first retry, doubled for each attempt.
+	RetryDelay string `json:"retryDelay"`
+}
+
+// Webhook single webhook configuration.
+type Webhook struct {
+	// Unique name, used in the monitor settings.
+	Name string `json:"name"`
+
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+
+	// Go template. The request body, used if Form is empty.
+	Body string `json:"body"`
+
+	// Go templates by key. URL encoded form body.
+	Form map[string]string `json:"form"`
+}
+
+var defaultConfig = Config{
+	Webhooks: []Webhook{
+		{
+			Name:    "example",
+			URL:     "http://127.0.0.1:8080/example",
+			Method:  http.MethodPost,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body: `{"title":{{json .MonitorName}},` +
+				`"message":{{json (printf "%s %.0f%%" .Label .Score)}}}`,
+		},
+	},
+	Attempts:   3,
+	RetryDelay: "5s",
+}
+
+// Errors.
+var (
+	ErrInvalidConfig   = errors.New("invalid config")
+	ErrWebhookNotExist = errors.New("webhook does not exist")
+	ErrStatus          = errors.New("unexpected status code")
+)
+
+func readConfig(configPath string) (*Config, error) {
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		data, _ := json.MarshalIndent(defaultConfig, "", "    ")
+		if err := os.WriteFile(configPath, data, 0o600); err != nil {
+			return nil, fmt.Errorf("generate config: %w", err)
+		}
+	}
+
+	file, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(file, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+	if config.Attempts < 1 {
+		config.Attempts = 1
+	}
+	if config.RetryDelay == "" {
+		config.RetryDelay = defaultConfig.RetryDelay
+	}
+	return &config, nil
+}
+
+// templateData is available to the body and form templates.
+type templateData struct {
+	MonitorID   string
+	MonitorName string
+	Label       string
+	Score       float64
+	Time        time.Time
+	Detections  []storage.Detection
+}
+
+func newTemplateData(c monitor.Config, event storage.Event) templateData {
+	d := alert.BestDetection(event)
+	return templateData{
+		MonitorID:   c.ID(),
+		MonitorName: c.Name(),
+		Label:       d.Label,
+		Score:       d.Score,
+		Time:        event.Time,
+		Detections:  event.Detections,
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes a value, strings are quoted and escaped.
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+}
+
+// webhook parsed webhook.
+type webhook struct {
+	Webhook
+	body *template.Template
+	form map[string]*template.Template
+}
+
+func parseWebhook(w Webhook) (*webhook, error) {
+	if w.Name == "" {
+		return nil, fmt.Errorf("%w: name missing", ErrInvalidConfig)
+	}
+	if _, err := url.ParseRequestURI(w.URL); err != nil {
+		return nil, fmt.Errorf("%w: %v: url: %v", ErrInvalidConfig, w.Name, err)
+	}
+	if w.Method == "" {
+		w.Method = http.MethodPost
+	}
+
+	body, err := template.New("body").Funcs(templateFuncs).Parse(w.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%v: parse body template: %w", w.Name, err)
+	}
+	form := make(map[string]*template.Template, len(w.Form))
+	for key, value := range w.Form {
+		tmpl, err := template.New(key).Funcs(templateFuncs).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: parse form template %v: %w", w.Name, key, err)
+		}
+		form[key] = tmpl
+	}
+
+	return &webhook{Webhook: w, body: body, form: form}, nil
+}
+
+func (w *webhook) newRequest(ctx context.Context, data templateData) (*http.Request, error) {
+	var body bytes.Buffer
+	contentType := ""
+	if len(w.form) != 0 {
+		values := url.Values{}
+		for key, tmpl := range w.form {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, data); err != nil {
+				return nil, fmt.Errorf("execute form template %v: %w", key, err)
+			}
+			values.Set(key, b.String())
+		}
+		body.WriteString(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else if err := w.body.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("execute body template: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.Method, w.URL, &body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range w.Headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// Delivery log entry.
+type Delivery struct {
+	Time      time.Time `json:"time"`
+	Webhook   string    `json:"webhook"`
+	MonitorID string    `json:"monitorID"`
+	Attempts  int       `json:"attempts"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error"`
+}
+
+// Maximum number of deliveries kept in the log.
+const deliveryLogSize = 100
+
+type logFunc func(level log.Level, monitorID string, format string, a ...interface{})
+
+type notifier struct {
+	ctx        context.Context
+	webhooks   map[string]*webhook
+	attempts   int
+	retryDelay time.Duration
+	client     *http.Client
+	logf       logFunc
+
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+func newNotifier(ctx context.Context, config Config, logf logFunc) (*notifier, error) {
+	retryDelay, err := time.ParseDuration(config.RetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("%w: retryDelay: %v", ErrInvalidConfig, err)
+	}
+
+	webhooks := make(map[string]*webhook, len(config.Webhooks))
+	for _, w := range config.Webhooks {
+		parsed, err := parseWebhook(w)
+		if err != nil {
+			return nil, err
+		}
+		if _, exist := webhooks[w.Name]; exist {
+			return nil, fmt.Errorf("%w: duplicate name: %v", ErrInvalidConfig, w.Name)
+		}
+		webhooks[w.Name] = parsed
+	}
+
+	return &notifier{
+		ctx:        ctx,
+		webhooks:   webhooks,
+		attempts:   config.Attempts,
+		retryDelay: retryDelay,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		logf:       logf,
+	}, nil
+}
+
+func (n *notifier) onAlert(c monitor.Config, event *storage.Event) {
+	data := newTemplateData(c, *event)
+	for _, name := range parseNames(c.Get("alertWebhooks")) {
+		w, exist := n.webhooks[name]
+		if !exist {
+			n.logf(log.LevelError, data.MonitorID, "%v: %v", ErrWebhookNotExist, name)
+			continue
+		}
+		go n.deliver(n.ctx, w, data)
+	}
+}
+
+// deliver sends the request and retries on failure.
+func (n *notifier) deliver(ctx context.Context, w *webhook, data templateData) Delivery {
+	delivery := Delivery{
+		Time:      time.Now(),
+		Webhook:   w.Name,
+		MonitorID: data.MonitorID,
+	}
+
+	delay := n.retryDelay
+	for {
+		delivery.Attempts++
+		status, err := n.send(ctx, w, data)
+		delivery.Status = status
+		if err == nil {
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+		n.logf(log.LevelWarning, data.MonitorID, "%v: attempt %v: %v",
+			w.Name, delivery.Attempts, err)
+
+		if delivery.Attempts >= n.attempts {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			delivery.Error = ctx.Err().Error()
+			n.addDelivery(delivery)
+			return delivery
+		}
+		delay *= 2
+	}
+
+	if delivery.Error != "" {
+		n.logf(log.LevelError, data.MonitorID, "%v: delivery failed", w.Name)
+	} else {
+		n.logf(log.LevelInfo, data.MonitorID, "%v: delivered", w.Name)
+	}
+	n.addDelivery(delivery)
+	return delivery
+}
+
+func (n *notifier) send(ctx context.Context, w *webhook, data templateData) (int, error) {
+	req, err := w.newRequest(ctx, data)
+	if err != nil {
+		return 0, err
+	}
+	res, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16)) //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("%w: %v", ErrStatus, res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+func (n *notifier) addDelivery(d Delivery) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries = append(n.deliveries, d)
+	if len(n.deliveries) > deliveryLogSize {
+		n.deliveries = n.deliveries[len(n.deliveries)-deliveryLogSize:]
+	}
+}
+
+// deliveryLog returns the deliveries, newest first.
+func (n *notifier) deliveryLog() []Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	deliveries := make([]Delivery, len(n.deliveries))
+	for i, d := range n.deliveries {
+		deliveries[len(deliveries)-1-i] = d
+	}
+	return deliveries
+}
+
+// parseNames parses a comma separated list of webhook names.
+func parseNames(raw string) []string {
+	var names []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	contentType string
+	auth        string
+	body        string
+}
+
+// newTestServer responds with the status codes in order, then 200.
+func newTestServer(t *testing.T, statuses ...int) (*httptest.Server, func() []request) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []request
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, request{
+			contentType: r.Header.Get("Content-Type"),
+			auth:        r.Header.Get("Authorization"),
+			body:        string(body),
+		})
+		if len(requests) <= len(statuses) {
+			w.WriteHeader(statuses[len(requests)-1])
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), requests...)
+	}
+}
+
+func newTestNotifier(t *testing.T, webhooks ...Webhook) *notifier {
+	t.Helper()
+	config := Config{Webhooks: webhooks, Attempts: 3, RetryDelay: "1ms"}
+	logf := func(log.Level, string, string, ...interface{}) {}
+	n, err := newNotifier(context.Background(), config, logf)
+	require.NoError(t, err)
+	return n
+}
+
+var testData = templateData{
+	MonitorID:   "m1",
+	MonitorName: "Door",
+	Label:       "person",
+	Score:       87.5,
+	Time:        time.Unix(1, 0).UTC(),
+}
+
+func TestDeliver(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		s, requests := newTestServer(t)
+		n := newTestNotifier(t, Webhook{
+			Name:    "a",
+			URL:     s.URL,
+			Headers: map[string]string{"Content-Type": "application/json", "Authorization": "x"},
+			Body:    defaultConfig.Webhooks[0].Body,
+		})
+
+		d := n.deliver(context.Background(), n.webhooks["a"], testData)
+		require.Equal(t, "", d.Error)
+		require.Equal(t, http.StatusOK, d.Status)
+		require.Equal(t, 1, d.Attempts)
+
+		expected := []request{{
+			contentType: "application/json",
+			auth:        "x",
+			body:        `{"title":"Door","message":"person 88%"}`,
+		}}
+		require.Equal(t, expected, requests())
+	})
+	t.Run("form", func(t *testing.T) {
+		s, requests := newTestServer(t)
+		n := newTestNotifier(t, Webhook{
+			Name: "a",
+			URL:  s.URL,
+			Form: map[string]string{"title": "{{.MonitorName}}", "message": "{{.Label}}"},
+		})
+
+		d := n.deliver(context.Background(), n.webhooks["a"], testData)
+		require.Equal(t, "", d.Error)
+
+		expected := []request{{
+			contentType: "application/x-www-form-urlencoded",
+			body:        "message=person&title=Door",
+		}}
+		require.Equal(t, expected, requests())
+	})
+	t.Run("retry", func(t *testing.T) {
+		s, requests := newTestServer(t, 500, 503)
+		n := newTestNotifier(t, Webhook{Name: "a", URL: s.URL})
+
+		d := n.deliver(context.Background(), n.webhooks["a"], testData)
+		require.Equal(t, "", d.Error)
+		require.Equal(t, 3, d.Attempts)
+		require.Len(t, requests(), 3)
+	})
+	t.Run("failed", func(t *testing.T) {
+		s, requests := newTestServer(t, 500, 500, 500, 500)
+		n := newTestNotifier(t, Webhook{Name: "a", URL: s.URL})
+
+		d := n.deliver(context.Background(), n.webhooks["a"], testData)
+		require.Equal(t, "unexpected status code: 500", d.Error)
+		require.Equal(t, 3, d.Attempts)
+		require.Len(t, requests(), 3)
+		require.Equal(t, []Delivery{d}, n.deliveryLog())
+	})
+}
+
+func TestOnAlert(t *testing.T) {
+	s, requests := newTestServer(t)
+	n := newTestNotifier(t,
+		Webhook{Name: "a", URL: s.URL, Body: "a"},
+		Webhook{Name: "b", URL: s.URL, Body: "b"},
+	)
+	c := monitor.NewConfig(monitor.RawConfig{"id": "m1", "alertWebhooks": "b, x"})
+	n.onAlert(c, &storage.Event{Time: time.Now()})
+
+	require.Eventually(t, func() bool {
+		return len(requests()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "b", requests()[0].body)
+}
+
+func TestHandleTest(t *testing.T) {
+	s, requests := newTestServer(t)
+	n := newTestNotifier(t, Webhook{Name: "a", URL: s.URL, Body: "{{.MonitorName}} {{.Label}}"})
+	monitorConfigs := func() monitor.RawConfigs {
+		return monitor.RawConfigs{"m1": {"id": "m1", "name": "Door"}}
+	}
+	handler := handleTest(n, monitorConfigs)
+
+	t.Run("ok", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/webhook/test?name=a&monitor=m1", nil)
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var d Delivery
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&d))
+		require.Equal(t, http.StatusOK, d.Status)
+		require.Equal(t, "m1", d.MonitorID)
+		require.Equal(t, "Door test", requests()[0].body)
+	})
+	t.Run("webhookNotExist", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/webhook/test?name=x", nil)
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("monitorNotExist", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/webhook/test?name=a&monitor=x", nil)
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestNewNotifier(t *testing.T) {
+	logf := func(log.Level, string, string, ...interface{}) {}
+	cases := map[string]Config{
+		"duplicate": {
+			Webhooks:   []Webhook{{Name: "a", URL: "http://x"}, {Name: "a", URL: "http://x"}},
+			RetryDelay: "1s",
+		},
+		"nameMissing":  {Webhooks: []Webhook{{URL: "http://x"}}, RetryDelay: "1s"},
+		"invalidURL":   {Webhooks: []Webhook{{Name: "a", URL: "x"}}, RetryDelay: "1s"},
+		"invalidDelay": {RetryDelay: "x"},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := newNotifier(context.Background(), config, logf)
+			require.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "webhook.json")
+	config, err := readConfig(configPath)
+	require.NoError(t, err)
+	require.Equal(t, defaultConfig, *config)
+
+	_, err = os.Stat(configPath)
+	require.NoError(t, err)
+}
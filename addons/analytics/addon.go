@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var addon struct {
+	analyzer *analyzer
+}
+
+func init() {
+	nvr.RegisterLogSource([]string{"analytics"})
+	nvr.RegisterAppRunHook(func(ctx context.Context, app *nvr.App) error {
+		configPath := filepath.Join(app.Env.ConfigDir, "analytics.json")
+		config, err := readConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("analytics: config: %w: %v", err, configPath)
+		}
+
+		logf := func(level log.Level, format string, a ...interface{}) {
+			app.Logger.Log(log.Entry{
+				Level: level,
+				Src:   "analytics",
+				Msg:   fmt.Sprintf(format, a...),
+			})
+		}
+		addon.analyzer = newAnalyzer(*config, logf)
+
+		app.WG.Add(1)
+		go func() {
+			addon.analyzer.runSender(ctx, app.MonitorManager.TriggerEvent)
+			app.WG.Done()
+		}()
+		return nil
+	})
+	nvr.RegisterMonitorEventHook(func(r *monitor.Recorder, event *storage.Event) {
+		if addon.analyzer != nil {
+			addon.analyzer.onEvent(r.Config.ID(), *event)
+		}
+	})
+}
+
+// Line crossing line. The direction is "in" when the object crosses
+// from the left to the right side of the line, as seen when
+// looking from the first point towards the second point.
+type Line struct {
+	Name    string `json:"name"`
+	Monitor string `json:"monitor"`
+
+	// Labels to track, empty matches all labels.
+	Labels []string `json:"labels"`
+
+	// Start and end point in percent.
+	Points []ffmpeg.Point `json:"points"`
+
+	// "in", "out" or empty for both directions.
+	Direction string `json:"direction"`
+}
+
+// Area loitering area.
+type Area struct {
+	Name    string `json:"name"`
+	Monitor string `json:"monitor"`
+
+	// Labels to track, empty matches all labels.
+	Labels []string `json:"labels"`
+
+	// Polygon in percent.
+	Area ffmpeg.Polygon `json:"area"`
+
+	// Time the object must stay inside the area, Go duration.
+	Duration string `json:"duration"`
+}
+
+// Config global analytics configuration.
+type Config struct {
+	Lines []Line `json:"lines"`
+	Areas []Area `json:"areas"`
+
+	// Recording duration of the generated events, Go duration.
+	RecDuration string `json:"recDuration"`
+}
+
+// Directions.
+const (
+	directionIn   = "in"
+	directionOut  = "out"
+	directionBoth = ""
+)
+
+const defaultRecDuration = 30 * time.Second
+
+// Errors.
+var (
+	ErrInvalidLine        = errors.New("invalid line")
+	ErrInvalidArea        = errors.New("invalid area")
+	ErrInvalidRecDuration = errors.New("invalid recDuration")
+)
+
+func readConfig(configPath string) (*config, error) {
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		defaultConfig := Config{
+			Lines:       []Line{},
+			Areas:       []Area{},
+			RecDuration: defaultRecDuration.String(),
+		}
+		data, _ := json.MarshalIndent(defaultConfig, "", "    ")
+		if err := os.WriteFile(configPath, data, 0o600); err != nil {
+			return nil, fmt.Errorf("generate config: %w", err)
+		}
+	}
+
+	file, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var rawConfig Config
+	if err := json.Unmarshal(file, &rawConfig); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return parseConfig(rawConfig)
+}
+
+// config parsed config.
+type config struct {
+	// Lines and areas by monitor ID.
+	lines map[string][]line
+	areas map[string][]area
+
+	recDuration time.Duration
+}
+
+func parseConfig(rawConfig Config) (*config, error) {
+	c := config{
+		lines:       make(map[string][]line),
+		areas:       make(map[string][]area),
+		recDuration: defaultRecDuration,
+	}
+
+	if rawConfig.RecDuration != "" {
+		var err error
+		c.recDuration, err = time.ParseDuration(rawConfig.RecDuration)
+		if err != nil || c.recDuration <= 0 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecDuration, rawConfig.RecDuration)
+		}
+	}
+
+	names := make(map[string]struct{})
+	for _, l := range rawConfig.Lines {
+		parsed, err := parseLine(l)
+		if err != nil {
+			return nil, err
+		}
+		if _, exist := names[l.Monitor+"/"+l.Name]; exist {
+			return nil, fmt.Errorf("%w: duplicate name: %v", ErrInvalidLine, l.Name)
+		}
+		names[l.Monitor+"/"+l.Name] = struct{}{}
+		c.lines[l.Monitor] = append(c.lines[l.Monitor], *parsed)
+	}
+
+	names = make(map[string]struct{})
+	for _, a := range rawConfig.Areas {
+		parsed, err := parseArea(a)
+		if err != nil {
+			return nil, err
+		}
+		if _, exist := names[a.Monitor+"/"+a.Name]; exist {
+			return nil, fmt.Errorf("%w: duplicate name: %v", ErrInvalidArea, a.Name)
+		}
+		names[a.Monitor+"/"+a.Name] = struct{}{}
+		c.areas[a.Monitor] = append(c.areas[a.Monitor], *parsed)
+	}
+
+	return &c, nil
+}
+
+func parseLine(l Line) (*line, error) {
+	if err := validateName(l.Name); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLine, err)
+	}
+	if l.Monitor == "" {
+		return nil, fmt.Errorf("%w: %v: monitor missing", ErrInvalidLine, l.Name)
+	}
+	if len(l.Points) != 2 || l.Points[0] == l.Points[1] {
+		return nil, fmt.Errorf("%w: %v: must have 2 different points", ErrInvalidLine, l.Name)
+	}
+	switch l.Direction {
+	case directionIn, directionOut, directionBoth:
+	default:
+		return nil, fmt.Errorf("%w: %v: direction: %q", ErrInvalidLine, l.Name, l.Direction)
+	}
+
+	return &line{
+		name:      l.Name,
+		labels:    labelSet(l.Labels),
+		start:     toPoint(l.Points[0]),
+		end:       toPoint(l.Points[1]),
+		direction: l.Direction,
+	}, nil
+}
+
+func parseArea(a Area) (*area, error) {
+	if err := validateName(a.Name); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArea, err)
+	}
+	if a.Monitor == "" {
+		return nil, fmt.Errorf("%w: %v: monitor missing", ErrInvalidArea, a.Name)
+	}
+	if len(a.Area) < 3 {
+		return nil, fmt.Errorf("%w: %v: must have at least 3 points", ErrInvalidArea, a.Name)
+	}
+	duration, err := time.ParseDuration(a.Duration)
+	if err != nil || duration < 0 {
+		return nil, fmt.Errorf("%w: %v: duration: %q", ErrInvalidArea, a.Name, a.Duration)
+	}
+
+	return &area{
+		name:     a.Name,
+		labels:   labelSet(a.Labels),
+		polygon:  a.Area,
+		duration: duration,
+	}, nil
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("name missing")
+	}
+	if strings.Contains(name, ":") {
+		return fmt.Errorf("name cannot contain ':': %v", name)
+	}
+	return nil
+}
+
+func labelSet(labels []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(labels))
+	for _, label := range labels {
+		set[label] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package analytics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nvr/pkg/ffmpeg"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig(t *testing.T) {
+	t.Run("generate", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "analytics.json")
+
+		c, err := readConfig(configPath)
+		require.NoError(t, err)
+		require.Empty(t, c.lines)
+		require.Empty(t, c.areas)
+		require.Equal(t, defaultRecDuration, c.recDuration)
+
+		_, err = os.Stat(configPath)
+		require.NoError(t, err)
+	})
+	t.Run("unmarshalErr", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "analytics.json")
+		require.NoError(t, os.WriteFile(configPath, []byte("{"), 0o600))
+
+		_, err := readConfig(configPath)
+		require.Error(t, err)
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	validLine := func() Line {
+		return Line{
+			Name:      "gate",
+			Monitor:   "m1",
+			Labels:    []string{"person"},
+			Points:    []ffmpeg.Point{{0, 50}, {100, 50}},
+			Direction: "in",
+		}
+	}
+	validArea := func() Area {
+		return Area{
+			Name:     "firelane",
+			Monitor:  "m1",
+			Area:     ffmpeg.Polygon{{0, 0}, {100, 0}, {100, 100}},
+			Duration: "2m",
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		c, err := parseConfig(Config{
+			Lines:       []Line{validLine()},
+			Areas:       []Area{validArea()},
+			RecDuration: "10s",
+		})
+		require.NoError(t, err)
+
+		expectedLine := line{
+			name:      "gate",
+			labels:    map[string]struct{}{"person": {}},
+			start:     point{0, 50},
+			end:       point{100, 50},
+			direction: "in",
+		}
+		expectedArea := area{
+			name:     "firelane",
+			labels:   map[string]struct{}{},
+			polygon:  ffmpeg.Polygon{{0, 0}, {100, 0}, {100, 100}},
+			duration: 2 * time.Minute,
+		}
+		require.Equal(t, []line{expectedLine}, c.lines["m1"])
+		require.Equal(t, []area{expectedArea}, c.areas["m1"])
+		require.Equal(t, 10*time.Second, c.recDuration)
+	})
+	t.Run("sameNameOtherMonitor", func(t *testing.T) {
+		l2 := validLine()
+		l2.Monitor = "m2"
+		_, err := parseConfig(Config{Lines: []Line{validLine(), l2}})
+		require.NoError(t, err)
+	})
+
+	lineCases := map[string]func(*Line){
+		"nameMissing":      func(l *Line) { l.Name = "" },
+		"nameColon":        func(l *Line) { l.Name = "a:b" },
+		"monitorMissing":   func(l *Line) { l.Monitor = "" },
+		"onePoint":         func(l *Line) { l.Points = l.Points[:1] },
+		"samePoints":       func(l *Line) { l.Points[1] = l.Points[0] },
+		"invalidDirection": func(l *Line) { l.Direction = "x" },
+	}
+	for name, modify := range lineCases {
+		t.Run(name, func(t *testing.T) {
+			l := validLine()
+			modify(&l)
+			_, err := parseConfig(Config{Lines: []Line{l}})
+			require.ErrorIs(t, err, ErrInvalidLine)
+		})
+	}
+	t.Run("duplicateLine", func(t *testing.T) {
+		_, err := parseConfig(Config{Lines: []Line{validLine(), validLine()}})
+		require.ErrorIs(t, err, ErrInvalidLine)
+	})
+
+	areaCases := map[string]func(*Area){
+		"nameMissing":     func(a *Area) { a.Name = "" },
+		"monitorMissing":  func(a *Area) { a.Monitor = "" },
+		"twoPoints":       func(a *Area) { a.Area = a.Area[:2] },
+		"invalidDuration": func(a *Area) { a.Duration = "x" },
+		"durationMissing": func(a *Area) { a.Duration = "" },
+	}
+	for name, modify := range areaCases {
+		t.Run(name, func(t *testing.T) {
+			a := validArea()
+			modify(&a)
+			_, err := parseConfig(Config{Areas: []Area{a}})
+			require.ErrorIs(t, err, ErrInvalidArea)
+		})
+	}
+	t.Run("duplicateArea", func(t *testing.T) {
+		_, err := parseConfig(Config{Areas: []Area{validArea(), validArea()}})
+		require.ErrorIs(t, err, ErrInvalidArea)
+	})
+	t.Run("invalidRecDuration", func(t *testing.T) {
+		_, err := parseConfig(Config{RecDuration: "0s"})
+		require.ErrorIs(t, err, ErrInvalidRecDuration)
+	})
+}
@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package analytics
+
+import (
+	"context"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/log"
+	"nvr/pkg/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Label prefixes of the generated events.
+const (
+	lineCrossPrefix = "line_cross:"
+	loiterPrefix    = "loiter:"
+)
+
+// Tracks that haven't been seen for this long are forgotten,
+// unless the object is inside a area it hasn't loitered in yet.
+const trackTimeout = 30 * time.Second
+
+// Open area visits are evaluated at this interval, objects that
+// stop moving may no longer be reported by the detector.
+const areaCheckInterval = time.Second
+
+// Maximum number of generated events waiting to be sent.
+const queueSize = 100
+
+type logFunc func(log.Level, string, ...interface{})
+
+type triggerFunc func(monitorID string, event storage.Event) error
+
+type queuedEvent struct {
+	monitorID string
+	event     storage.Event
+}
+
+// analyzer follows tracked detections across events and
+// generates new events when they cross lines or loiter.
+type analyzer struct {
+	config
+	logf logFunc
+
+	mu sync.Mutex
+	// Tracks by monitor ID and track ID.
+	tracks map[string]map[int]*track
+
+	queue chan queuedEvent
+}
+
+type track struct {
+	pos      point
+	lastSeen time.Time
+
+	// Last detection of the object and the event it was in.
+	detection storage.Detection
+	event     storage.Event
+
+	// Time the object entered each area, zero if it's outside.
+	entered []time.Time
+	// True if loitering was reported for the current visit.
+	reported []bool
+}
+
+func newAnalyzer(c config, logf logFunc) *analyzer {
+	return &analyzer{
+		config: c,
+		logf:   logf,
+		tracks: make(map[string]map[int]*track),
+		queue:  make(chan queuedEvent, queueSize),
+	}
+}
+
+// onEvent is called by the event hook. Generated events are queued because
+// the hook is called by the recorder, which cannot accept new events yet.
+func (a *analyzer) onEvent(monitorID string, event storage.Event) {
+	lines, areas := a.lines[monitorID], a.areas[monitorID]
+	if len(lines) == 0 && len(areas) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tracks := a.tracks[monitorID]
+	if tracks == nil {
+		tracks = make(map[int]*track)
+		a.tracks[monitorID] = tracks
+	}
+	for id, t := range tracks {
+		if t.expired(event.Time) {
+			delete(tracks, id)
+		}
+	}
+
+	for _, d := range event.Detections {
+		if d.TrackID == 0 || d.Region == nil || d.Region.Rect == nil || isGenerated(d.Label) {
+			continue
+		}
+		x, y := d.Region.Rect.Center()
+		pos := point{x: x, y: y}
+
+		t, exist := tracks[d.TrackID]
+		if !exist {
+			t = &track{
+				entered:  make([]time.Time, len(areas)),
+				reported: make([]bool, len(areas)),
+			}
+			tracks[d.TrackID] = t
+		} else {
+			for _, l := range lines {
+				if label := l.check(d.Label, t.pos, pos); label != "" {
+					a.emit(monitorID, event, d, label)
+				}
+			}
+		}
+		t.pos = pos
+		t.lastSeen = event.Time
+		t.detection = d
+		t.event = event
+
+		for i, ar := range areas {
+			if ar.check(d.Label, t, i, event.Time) {
+				a.emit(monitorID, event, d, loiterPrefix+ar.name)
+			}
+		}
+	}
+}
+
+// checkAreas reports objects that have been inside a area for the duration
+// without being detected again. Objects that stop moving are no longer
+// reported by the detector, they're assumed to be where they were last seen.
+func (a *analyzer) checkAreas(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for monitorID, tracks := range a.tracks {
+		areas := a.areas[monitorID]
+		for id, t := range tracks {
+			if t.expired(now) {
+				delete(tracks, id)
+				continue
+			}
+			for i, ar := range areas {
+				if !matchLabel(ar.labels, t.detection.Label) || !ar.due(t, i, now) {
+					continue
+				}
+				source := t.event
+				source.Time = now
+				a.emit(monitorID, source, t.detection, loiterPrefix+ar.name)
+			}
+		}
+	}
+}
+
+// expired returns true if the track hasn't been seen for the
+// timeout and the object isn't waiting to be reported in a area.
+func (t *track) expired(now time.Time) bool {
+	if now.Sub(t.lastSeen) <= trackTimeout {
+		return false
+	}
+	for i, entered := range t.entered {
+		if !entered.IsZero() && !t.reported[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// emit queues a event with the detection relabeled, never blocks.
+func (a *analyzer) emit(monitorID string, source storage.Event, d storage.Detection, label string) {
+	d.Label = label
+	event := storage.Event{
+		Time:        source.Time,
+		Detections:  []storage.Detection{d},
+		Duration:    source.Duration,
+		RecDuration: a.recDuration,
+		Frame:       source.Frame,
+	}
+	select {
+	case a.queue <- queuedEvent{monitorID: monitorID, event: event}:
+		a.logf(log.LevelDebug, "%v: %v", monitorID, label)
+	default:
+		a.logf(log.LevelError, "%v: queue full, dropping event: %v", monitorID, label)
+	}
+}
+
+// runSender sends the queued events and checks the
+// open area visits until the context is canceled.
+func (a *analyzer) runSender(ctx context.Context, trigger triggerFunc) {
+	ticker := time.NewTicker(areaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.checkAreas(now)
+		case e := <-a.queue:
+			if err := trigger(e.monitorID, e.event); err != nil {
+				a.logf(log.LevelError, "%v: send event: %v", e.monitorID, err)
+			}
+		}
+	}
+}
+
+// isGenerated returns true if the label was generated by this addon.
+func isGenerated(label string) bool {
+	return strings.HasPrefix(label, lineCrossPrefix) ||
+		strings.HasPrefix(label, loiterPrefix)
+}
+
+func matchLabel(labels map[string]struct{}, label string) bool {
+	if len(labels) == 0 {
+		return true
+	}
+	_, exist := labels[label]
+	return exist
+}
+
+type point struct {
+	x, y float64
+}
+
+func toPoint(p ffmpeg.Point) point {
+	return point{x: float64(p[0]), y: float64(p[1])}
+}
+
+// side returns a positive value if p is on the right side of the line from
+// a to b and a negative value if it's on the left side. Image coordinates.
+func side(a, b, p point) float64 {
+	return (b.x-a.x)*(p.y-a.y) - (b.y-a.y)*(p.x-a.x)
+}
+
+type line struct {
+	name       string
+	labels     map[string]struct{}
+	start, end point
+	direction  string
+}
+
+// check returns the event label if the movement from
+// prev to pos crossed the line in the configured direction.
+func (l line) check(label string, prev, pos point) string {
+	if !matchLabel(l.labels, label) {
+		return ""
+	}
+	direction := l.crossing(prev, pos)
+	if direction == "" || (l.direction != directionBoth && l.direction != direction) {
+		return ""
+	}
+	return lineCrossPrefix + l.name + ":" + direction
+}
+
+// crossing returns "in" if the movement from p0 to p1 crossed the line from
+// the left to the right side, "out" if it crossed from the right to the
+// left side and empty if it didn't cross. Points on the line are left.
+func (l line) crossing(p0, p1 point) string {
+	right0 := side(l.start, l.end, p0) > 0
+	right1 := side(l.start, l.end, p1) > 0
+	if right0 == right1 {
+		return ""
+	}
+
+	// The line end points must be on different sides of the movement.
+	s0 := side(p0, p1, l.start)
+	s1 := side(p0, p1, l.end)
+	if (s0 > 0 && s1 > 0) || (s0 < 0 && s1 < 0) {
+		return ""
+	}
+
+	if right1 {
+		return directionIn
+	}
+	return directionOut
+}
+
+type area struct {
+	name     string
+	labels   map[string]struct{}
+	polygon  ffmpeg.Polygon
+	duration time.Duration
+}
+
+// check updates the track and returns true when the object
+// has been inside the area for the duration. Only reported
+// once until the object leaves the area.
+func (a area) check(label string, t *track, i int, now time.Time) bool {
+	if !matchLabel(a.labels, label) {
+		return false
+	}
+	x, y := int(t.pos.x+0.5), int(t.pos.y+0.5)
+	if !ffmpeg.VertexInsidePoly(x, y, a.polygon) {
+		t.entered[i] = time.Time{}
+		t.reported[i] = false
+		return false
+	}
+	if t.entered[i].IsZero() {
+		t.entered[i] = now
+	}
+	return a.due(t, i, now)
+}
+
+// due returns true once when the object has been inside the area for the duration.
+func (a area) due(t *track, i int, now time.Time) bool {
+	if t.entered[i].IsZero() || t.reported[i] || now.Sub(t.entered[i]) < a.duration {
+		return false
+	}
+	t.reported[i] = true
+	return true
+}
@@ -0,0 +1,291 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/log"
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAnalyzer(t *testing.T, rawConfig Config) *analyzer {
+	t.Helper()
+	c, err := parseConfig(rawConfig)
+	require.NoError(t, err)
+	return newAnalyzer(*c, func(log.Level, string, ...interface{}) {})
+}
+
+// testEvent returns a event with one detection centered at x, y.
+func testEvent(t time.Time, trackID int, label string, x, y int) storage.Event {
+	return storage.Event{
+		Time: t,
+		Detections: []storage.Detection{{
+			Label:   label,
+			Score:   90,
+			Region:  &storage.Region{Rect: &ffmpeg.Rect{y - 5, x - 5, y + 5, x + 5}},
+			TrackID: trackID,
+		}},
+		Duration: time.Second,
+	}
+}
+
+// queuedLabels returns the labels of the queued events.
+func queuedLabels(a *analyzer) []string {
+	var labels []string
+	for {
+		select {
+		case e := <-a.queue:
+			labels = append(labels, e.event.Detections[0].Label)
+		default:
+			return labels
+		}
+	}
+}
+
+func TestLineCrossing(t *testing.T) {
+	// Horizontal line from left to right, down is the right side.
+	l := line{start: point{10, 50}, end: point{90, 50}}
+
+	cases := map[string]struct {
+		p0, p1   point
+		expected string
+	}{
+		"in":        {point{50, 40}, point{50, 60}, directionIn},
+		"out":       {point{50, 60}, point{50, 40}, directionOut},
+		"sameSide":  {point{50, 40}, point{60, 45}, ""},
+		"outside":   {point{95, 40}, point{95, 60}, ""},
+		"diagonal":  {point{5, 40}, point{30, 60}, directionIn},
+		"ontoLine":  {point{50, 60}, point{50, 50}, directionOut},
+		"alongLine": {point{20, 50}, point{80, 50}, ""},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, l.crossing(tc.p0, tc.p1))
+		})
+	}
+}
+
+func TestAnalyzerLines(t *testing.T) {
+	config := Config{
+		Lines: []Line{
+			{
+				Name:      "gate",
+				Monitor:   "m1",
+				Labels:    []string{"person"},
+				Points:    []ffmpeg.Point{{0, 50}, {100, 50}},
+				Direction: "in",
+			},
+			{
+				Name:    "door",
+				Monitor: "m1",
+				Points:  []ffmpeg.Point{{50, 0}, {50, 100}},
+			},
+		},
+	}
+	now := time.Unix(1000, 0)
+
+	t.Run("in", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "person", 20, 40))
+		a.onEvent("m1", testEvent(now.Add(time.Second), 1, "person", 20, 60))
+		require.Equal(t, []string{"line_cross:gate:in"}, queuedLabels(a))
+
+		// Wrong direction.
+		a.onEvent("m1", testEvent(now.Add(2*time.Second), 1, "person", 20, 40))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("bothDirections", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "car", 40, 20))
+		a.onEvent("m1", testEvent(now.Add(time.Second), 1, "car", 60, 20))
+		a.onEvent("m1", testEvent(now.Add(2*time.Second), 1, "car", 40, 20))
+		require.Equal(t, []string{"line_cross:door:out", "line_cross:door:in"}, queuedLabels(a))
+	})
+	t.Run("labelFilter", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "car", 20, 40))
+		a.onEvent("m1", testEvent(now.Add(time.Second), 1, "car", 20, 60))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("separateTracks", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "person", 20, 40))
+		a.onEvent("m1", testEvent(now.Add(time.Second), 2, "person", 20, 60))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("otherMonitor", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m2", testEvent(now, 1, "person", 20, 40))
+		a.onEvent("m2", testEvent(now.Add(time.Second), 1, "person", 20, 60))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("untracked", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 0, "person", 20, 40))
+		a.onEvent("m1", testEvent(now.Add(time.Second), 0, "person", 20, 60))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("trackTimeout", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "person", 20, 40))
+		a.onEvent("m1", testEvent(now.Add(time.Minute), 1, "person", 20, 60))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("ignoreGenerated", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "line_cross:door:in", 40, 20))
+		a.onEvent("m1", testEvent(now.Add(time.Second), 1, "line_cross:door:in", 60, 20))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("event", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "person", 20, 40))
+		a.onEvent("m1", testEvent(now.Add(time.Second), 1, "person", 20, 60))
+
+		e := <-a.queue
+		require.Equal(t, "m1", e.monitorID)
+
+		expected := storage.Event{
+			Time: now.Add(time.Second),
+			Detections: []storage.Detection{{
+				Label:   "line_cross:gate:in",
+				Score:   90,
+				Region:  &storage.Region{Rect: &ffmpeg.Rect{55, 15, 65, 25}},
+				TrackID: 1,
+			}},
+			Duration:    time.Second,
+			RecDuration: defaultRecDuration,
+		}
+		require.Equal(t, expected, e.event)
+	})
+}
+
+func TestAnalyzerAreas(t *testing.T) {
+	config := Config{
+		Areas: []Area{{
+			Name:     "firelane",
+			Monitor:  "m1",
+			Labels:   []string{"car"},
+			Area:     ffmpeg.Polygon{{0, 0}, {50, 0}, {50, 50}, {0, 50}},
+			Duration: "2m",
+		}},
+	}
+	now := time.Unix(1000, 0)
+
+	t.Run("loiter", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		for s := 0; s <= 150; s += 10 {
+			a.onEvent("m1", testEvent(now.Add(time.Duration(s)*time.Second), 1, "car", 20, 20))
+		}
+		require.Equal(t, []string{"loiter:firelane"}, queuedLabels(a))
+	})
+	t.Run("leftArea", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(90*time.Second), 1, "car", 80, 80))
+		a.onEvent("m1", testEvent(now.Add(100*time.Second), 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(130*time.Second), 1, "car", 20, 20))
+		require.Empty(t, queuedLabels(a))
+
+		// Objects inside the area aren't forgotten while they're undetected.
+		a.onEvent("m1", testEvent(now.Add(220*time.Second), 1, "car", 20, 20))
+		require.Equal(t, []string{"loiter:firelane"}, queuedLabels(a))
+	})
+	t.Run("reportedAgainAfterLeaving", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(20*time.Second), 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(40*time.Second), 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(60*time.Second), 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(80*time.Second), 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(100*time.Second), 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(120*time.Second), 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(125*time.Second), 1, "car", 80, 80))
+		require.Equal(t, []string{"loiter:firelane"}, queuedLabels(a))
+
+		for s := 130; s <= 250; s += 20 {
+			a.onEvent("m1", testEvent(now.Add(time.Duration(s)*time.Second), 1, "car", 20, 20))
+		}
+		require.Equal(t, []string{"loiter:firelane"}, queuedLabels(a))
+	})
+	t.Run("labelFilter", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		for s := 0; s <= 150; s += 10 {
+			a.onEvent("m1", testEvent(now.Add(time.Duration(s)*time.Second), 1, "person", 20, 20))
+		}
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("stationary", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "car", 20, 20))
+		a.onEvent("m1", testEvent(now.Add(10*time.Second), 1, "car", 20, 20))
+
+		// The car is no longer reported after it stopped moving.
+		a.checkAreas(now.Add(119 * time.Second))
+		require.Empty(t, queuedLabels(a))
+
+		a.checkAreas(now.Add(120 * time.Second))
+		e := <-a.queue
+		require.Equal(t, "m1", e.monitorID)
+		require.Equal(t, now.Add(120*time.Second), e.event.Time)
+		require.Equal(t, "loiter:firelane", e.event.Detections[0].Label)
+		require.Equal(t, 1, e.event.Detections[0].TrackID)
+
+		a.checkAreas(now.Add(121 * time.Second))
+		require.Empty(t, queuedLabels(a))
+
+		// The track is forgotten after it has been reported.
+		a.checkAreas(now.Add(150 * time.Second))
+		require.Empty(t, a.tracks["m1"])
+	})
+	t.Run("checkLabelFilter", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "person", 20, 20))
+		a.checkAreas(now.Add(120 * time.Second))
+		require.Empty(t, queuedLabels(a))
+	})
+	t.Run("outsideForgotten", func(t *testing.T) {
+		a := newTestAnalyzer(t, config)
+		a.onEvent("m1", testEvent(now, 1, "car", 80, 80))
+		a.checkAreas(now.Add(trackTimeout + time.Second))
+		require.Empty(t, a.tracks["m1"])
+	})
+}
+
+func TestEmitQueueFull(t *testing.T) {
+	a := newTestAnalyzer(t, Config{})
+	for i := 0; i < queueSize+1; i++ {
+		a.emit("m1", storage.Event{}, storage.Detection{}, "x")
+	}
+	require.Len(t, a.queue, queueSize)
+}
+
+func TestRunSender(t *testing.T) {
+	a := newTestAnalyzer(t, Config{})
+
+	sent := make(chan string)
+	trigger := func(monitorID string, event storage.Event) error {
+		sent <- monitorID + " " + event.Detections[0].Label
+		return errors.New("mock")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.runSender(ctx, trigger)
+		close(done)
+	}()
+
+	a.emit("m1", storage.Event{}, storage.Detection{}, "x")
+	require.Equal(t, "m1 x", <-sent)
+
+	cancel()
+	<-done
+}
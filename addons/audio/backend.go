@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package audio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"nvr"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	nvr.RegisterMonitorInputProcessHook(onInputProcessStart)
+	nvr.RegisterLogSource([]string{"audio"})
+
+	nvr.RegisterTplHook(modifyTemplates)
+	nvr.RegisterAppRunHook(func(_ context.Context, app *nvr.App) error {
+		app.Router.Handle("/api/audio/levels", app.Auth.User(handleLevels(levels)))
+		return nil
+	})
+}
+
+// Latest levels of all running meters.
+var levels = newLevelStore()
+
+// Detection label of the events.
+const label = "sound"
+
+func onInputProcessStart(ctx context.Context, i *monitor.InputProcess, _ *[]string) {
+	if i.IsSubInput() {
+		return
+	}
+
+	id := i.Config.ID()
+	logf := func(level log.Level, format string, a ...interface{}) {
+		i.Logger.Log(log.Entry{
+			Level:     level,
+			Src:       "audio",
+			MonitorID: id,
+			Msg:       fmt.Sprintf(format, a...),
+		})
+	}
+
+	config, enable, err := parseConfig(i.Config)
+	if err != nil {
+		logf(log.LevelError, "could not parse config: %v", err)
+		return
+	}
+	if !enable {
+		return
+	}
+	if !i.Config.AudioEnabled() {
+		logf(log.LevelError, "audio encoder is disabled")
+		return
+	}
+
+	i.WG.Add(1)
+	go start(ctx, i, *config, logf)
+}
+
+func start(
+	ctx context.Context,
+	i *monitor.InputProcess,
+	config config,
+	logf log.Func,
+) {
+	defer i.WG.Done()
+	defer levels.delete(config.monitorID)
+
+	// Wait for the monitor to start.
+	select {
+	case <-time.After(10 * time.Second):
+	case <-ctx.Done():
+		return
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		chunks, err := i.SubscribeFrames(ctx, frameConfig)
+		if err != nil {
+			logf(log.LevelError, "subscribe audio: %v", err)
+		} else {
+			logf(log.LevelInfo, "started")
+			newDetector(i.SendEvent, config, logf).run(chunks)
+		}
+
+		select {
+		case <-time.After(3 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+var frameConfig = monitor.FrameConfig{
+	Filter: "aresample=" + strconv.Itoa(sampleRate) +
+		",aformat=sample_fmts=s16:channel_layouts=mono",
+	PixFmt:    "s16le",
+	FrameSize: chunkSize,
+	Audio:     true,
+}
+
+type detector struct {
+	sendEvent monitor.SendEventFunc
+	logf      log.Func
+	config    config
+
+	meter   *meter
+	trigger *trigger
+}
+
+func newDetector(sendEvent monitor.SendEventFunc, c config, logf log.Func) *detector {
+	return &detector{
+		sendEvent: sendEvent,
+		logf:      logf,
+		config:    c,
+		meter:     newMeter(c.window),
+		trigger: &trigger{
+			threshold: c.threshold,
+			duration:  c.duration,
+		},
+	}
+}
+
+// run measures the chunks until the channel is closed.
+func (d *detector) run(chunks <-chan monitor.Frame) {
+	for chunk := range chunks {
+		if chunk.Dropped > 0 {
+			d.logf(log.LevelWarning, "detector fell behind, %v chunks dropped", chunk.Dropped)
+			// The window and the time above the threshold must be continuous.
+			d.meter.reset()
+			d.trigger.reset()
+		}
+		level := d.meter.add(chunk.Data, chunk.Time)
+		levels.set(d.config.monitorID, level)
+
+		value := level.RMS
+		if d.config.mode == modePeak {
+			value = level.Peak
+		}
+		if !d.trigger.check(value, chunk.Time) {
+			continue
+		}
+
+		d.logf(log.LevelDebug, "trigger: %v %.1f dB", d.config.mode, value)
+		err := d.sendEvent(storage.Event{
+			Time: chunk.Time.Add(-d.config.timestampOffset),
+			Detections: []storage.Detection{{
+				Label: label,
+				Score: value,
+			}},
+			Duration:    d.config.window,
+			RecDuration: d.config.recDuration,
+		})
+		if err != nil {
+			d.logf(log.LevelError, "send event: %v", err)
+		}
+	}
+}
+
+type levelStore struct {
+	mu     sync.Mutex
+	levels map[string]Level
+}
+
+func newLevelStore() *levelStore {
+	return &levelStore{levels: make(map[string]Level)}
+}
+
+func (s *levelStore) set(monitorID string, level Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.levels[monitorID] = level
+}
+
+func (s *levelStore) delete(monitorID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.levels, monitorID)
+}
+
+func (s *levelStore) get() map[string]Level {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	levels := make(map[string]Level, len(s.levels))
+	for id, level := range s.levels {
+		levels[id] = level
+	}
+	return levels
+}
+
+// handleLevels returns the latest levels by monitor ID,
+// or the level of a single monitor if "id" is set.
+func handleLevels(store *levelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var response interface{}
+		all := store.get()
+		response = all
+
+		if id := r.URL.Query().Get("id"); id != "" {
+			level, exist := all[id]
+			if !exist {
+				http.Error(w, "monitor has no audio meter", http.StatusNotFound)
+				return
+			}
+			response = level
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector(t *testing.T) {
+	var events []storage.Event
+	sendEvent := func(e storage.Event) error {
+		events = append(events, e)
+		return nil
+	}
+	c := config{
+		monitorID:       "detectorTest",
+		timestampOffset: time.Millisecond,
+		mode:            modePeak,
+		threshold:       -10,
+		window:          100 * time.Millisecond,
+		duration:        100 * time.Millisecond,
+		recDuration:     time.Minute,
+	}
+	d := newDetector(sendEvent, c, func(log.Level, string, ...interface{}) {})
+	defer levels.delete(c.monitorID)
+
+	now := time.Unix(1000, 0)
+	chunks := make(chan monitor.Frame, 3)
+	chunks <- monitor.Frame{Time: now, Data: newChunk(math.MaxInt16)}
+	chunks <- monitor.Frame{Time: now.Add(100 * time.Millisecond), Data: newChunk(math.MaxInt16)}
+	chunks <- monitor.Frame{Time: now.Add(200 * time.Millisecond), Data: newChunk(0)}
+	close(chunks)
+	d.run(chunks)
+
+	require.Len(t, events, 1)
+	event := events[0]
+	require.Equal(t, now.Add(99*time.Millisecond), event.Time)
+	require.Equal(t, label, event.Detections[0].Label)
+	require.InDelta(t, 0, event.Detections[0].Score, 0.001)
+	require.Equal(t, 100*time.Millisecond, event.Duration)
+	require.Equal(t, time.Minute, event.RecDuration)
+
+	level := levels.get()[c.monitorID]
+	require.Equal(t, float64(minLevel), level.Peak)
+}
+
+func TestDetectorDroppedChunks(t *testing.T) {
+	var events []storage.Event
+	sendEvent := func(e storage.Event) error {
+		events = append(events, e)
+		return nil
+	}
+	c := config{
+		monitorID: "droppedTest",
+		mode:      modePeak,
+		threshold: -10,
+		window:    100 * time.Millisecond,
+		duration:  100 * time.Millisecond,
+	}
+	var logs []string
+	logf := func(_ log.Level, format string, a ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, a...))
+	}
+	d := newDetector(sendEvent, c, logf)
+	defer levels.delete(c.monitorID)
+
+	now := time.Unix(1000, 0)
+	chunks := make(chan monitor.Frame, 3)
+	chunks <- monitor.Frame{Time: now, Data: newChunk(math.MaxInt16)}
+	chunks <- monitor.Frame{
+		Time:    now.Add(200 * time.Millisecond),
+		Data:    newChunk(math.MaxInt16),
+		Dropped: 1,
+	}
+	chunks <- monitor.Frame{Time: now.Add(300 * time.Millisecond), Data: newChunk(math.MaxInt16)}
+	close(chunks)
+	d.run(chunks)
+
+	// The duration is restarted after the gap.
+	require.Len(t, events, 1)
+	require.Equal(t, now.Add(300*time.Millisecond), events[0].Time)
+	require.Equal(t, "detector fell behind, 1 chunks dropped", logs[0])
+}
+
+func TestHandleLevels(t *testing.T) {
+	store := newLevelStore()
+	store.set("1", Level{RMS: -20, Peak: -10, Time: time.Unix(1, 0).UTC()})
+
+	t.Run("all", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		handleLevels(store).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, res.Code)
+
+		var actual map[string]Level
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&actual))
+		require.Equal(t, map[string]Level{"1": {RMS: -20, Peak: -10, Time: time.Unix(1, 0).UTC()}}, actual)
+	})
+	t.Run("monitor", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		handleLevels(store).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/?id=1", nil))
+		require.Equal(t, http.StatusOK, res.Code)
+		require.JSONEq(t, `{"rms":-20,"peak":-10,"time":"1970-01-01T00:00:01Z"}`, res.Body.String())
+	})
+	t.Run("notFound", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		handleLevels(store).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/?id=2", nil))
+		require.Equal(t, http.StatusNotFound, res.Code)
+	})
+	t.Run("method", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		handleLevels(store).ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	})
+}
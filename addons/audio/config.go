@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr/pkg/monitor"
+	"strconv"
+	"time"
+)
+
+type config struct {
+	monitorID       string
+	timestampOffset time.Duration
+
+	mode      string
+	threshold float64
+	window    time.Duration
+	duration  time.Duration
+
+	recDuration time.Duration
+}
+
+// rawConfig monitor config, durations are in seconds.
+type rawConfig struct {
+	Enable      string `json:"enable"`
+	Mode        string `json:"mode"`
+	Threshold   string `json:"threshold"`
+	Window      string `json:"window"`
+	Duration    string `json:"duration"`
+	RecDuration string `json:"recDuration"`
+}
+
+// Level modes.
+const (
+	modeRMS  = "rms"
+	modePeak = "peak"
+)
+
+// Config errors.
+var (
+	ErrInvalidMode      = errors.New("invalid mode")
+	ErrInvalidThreshold = errors.New("threshold must be between -100 and 0")
+	ErrInvalidWindow    = errors.New("invalid window")
+	ErrInvalidDuration  = errors.New("invalid duration")
+)
+
+func parseConfig(c monitor.Config) (*config, bool, error) {
+	audio := c.Get("audio")
+	if audio == "" {
+		return nil, false, nil
+	}
+
+	var rawConf rawConfig
+	if err := json.Unmarshal([]byte(audio), &rawConf); err != nil {
+		return nil, false, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	enable := rawConf.Enable == "true"
+	if !enable {
+		return nil, false, nil
+	}
+
+	timestampOffset, err := parseTimestampOffset(c.TimestampOffset())
+	if err != nil {
+		return nil, false, err
+	}
+
+	mode := rawConf.Mode
+	switch mode {
+	case "":
+		mode = modeRMS
+	case modeRMS, modePeak:
+	default:
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidMode, mode)
+	}
+
+	threshold, err := strconv.ParseFloat(rawConf.Threshold, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("parse threshold: %w", err)
+	}
+	if threshold < minLevel || threshold > 0 {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidThreshold, threshold)
+	}
+
+	window, err := parseSeconds(rawConf.Window, 1)
+	if err != nil || window < chunkDuration {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidWindow, rawConf.Window)
+	}
+
+	duration, err := parseSeconds(rawConf.Duration, 0)
+	if err != nil || duration < 0 {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidDuration, rawConf.Duration)
+	}
+
+	recDuration, err := parseSeconds(rawConf.RecDuration, 30)
+	if err != nil || recDuration <= 0 {
+		return nil, false, fmt.Errorf("%w: recDuration: %v", ErrInvalidDuration, rawConf.RecDuration)
+	}
+
+	return &config{
+		monitorID:       c.ID(),
+		timestampOffset: timestampOffset,
+		mode:            mode,
+		threshold:       threshold,
+		window:          window,
+		duration:        duration,
+		recDuration:     recDuration,
+	}, true, nil
+}
+
+// parseSeconds parses a float in seconds, empty returns the default value.
+func parseSeconds(raw string, defaultValue float64) (time.Duration, error) {
+	seconds := defaultValue
+	if raw != "" {
+		var err error
+		seconds, err = strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func parseTimestampOffset(rawOffset string) (time.Duration, error) {
+	if rawOffset == "" {
+		return 0, nil
+	}
+	timestampOffset, err := strconv.Atoi(rawOffset)
+	if err != nil {
+		return 0, fmt.Errorf("parse timestamp offset %w", err)
+	}
+	return time.Duration(timestampOffset) * time.Millisecond, nil
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package audio
+
+import (
+	"testing"
+	"time"
+
+	"nvr/pkg/monitor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	newConfig := func(audio string) monitor.Config {
+		return monitor.NewConfig(monitor.RawConfig{
+			"id":              "1",
+			"timestampOffset": "2",
+			"audio":           audio,
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		audio := `{
+			"enable": "true",
+			"mode": "peak",
+			"threshold": "-20",
+			"window": "0.5",
+			"duration": "1.5",
+			"recDuration": "10"
+		}`
+		actual, enable, err := parseConfig(newConfig(audio))
+		require.NoError(t, err)
+		require.True(t, enable)
+
+		expected := config{
+			monitorID:       "1",
+			timestampOffset: 2 * time.Millisecond,
+			mode:            "peak",
+			threshold:       -20,
+			window:          500 * time.Millisecond,
+			duration:        1500 * time.Millisecond,
+			recDuration:     10 * time.Second,
+		}
+		require.Equal(t, expected, *actual)
+	})
+	t.Run("defaults", func(t *testing.T) {
+		actual, enable, err := parseConfig(newConfig(`{"enable": "true", "threshold": "-30"}`))
+		require.NoError(t, err)
+		require.True(t, enable)
+
+		expected := config{
+			monitorID:       "1",
+			timestampOffset: 2 * time.Millisecond,
+			mode:            "rms",
+			threshold:       -30,
+			window:          time.Second,
+			recDuration:     30 * time.Second,
+		}
+		require.Equal(t, expected, *actual)
+	})
+	t.Run("empty", func(t *testing.T) {
+		_, enable, err := parseConfig(newConfig(""))
+		require.NoError(t, err)
+		require.False(t, enable)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		_, enable, err := parseConfig(newConfig(`{"enable": "false"}`))
+		require.NoError(t, err)
+		require.False(t, enable)
+	})
+	t.Run("unmarshalErr", func(t *testing.T) {
+		_, _, err := parseConfig(newConfig("{"))
+		require.Error(t, err)
+	})
+
+	errCases := map[string]struct {
+		audio    string
+		expected error
+	}{
+		"mode":      {`{"enable":"true","threshold":"-20","mode":"x"}`, ErrInvalidMode},
+		"threshold": {`{"enable":"true","threshold":"10"}`, ErrInvalidThreshold},
+		"window":    {`{"enable":"true","threshold":"-20","window":"0.01"}`, ErrInvalidWindow},
+		"duration":  {`{"enable":"true","threshold":"-20","duration":"-1"}`, ErrInvalidDuration},
+		"recDur":    {`{"enable":"true","threshold":"-20","recDuration":"0"}`, ErrInvalidDuration},
+	}
+	for name, tc := range errCases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := parseConfig(newConfig(tc.audio))
+			require.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// The audio is decoded to 16 bit mono samples at this rate.
+const sampleRate = 8000
+
+// Levels are updated once per chunk.
+const chunkDuration = 100 * time.Millisecond
+
+const (
+	chunkSamples = int(sampleRate * chunkDuration / time.Second)
+	chunkSize    = chunkSamples * 2
+)
+
+// Lowest level in dBFS, silence.
+const minLevel = -100
+
+// Minimum time between events while the level stays above the threshold.
+const retriggerInterval = time.Second
+
+// Level audio level in dBFS.
+type Level struct {
+	RMS  float64   `json:"rms"`
+	Peak float64   `json:"peak"`
+	Time time.Time `json:"time"`
+}
+
+// meter calculates the RMS and peak level over a sliding window of chunks.
+type meter struct {
+	// Sum of squares and peak of each chunk in the window.
+	sums  []float64
+	peaks []float64
+	pos   int
+	n     int
+}
+
+func newMeter(window time.Duration) *meter {
+	chunks := int(window / chunkDuration)
+	if chunks < 1 {
+		chunks = 1
+	}
+	return &meter{
+		sums:  make([]float64, chunks),
+		peaks: make([]float64, chunks),
+	}
+}
+
+// add adds a chunk of 16 bit little endian samples
+// and returns the level over the window.
+func (m *meter) add(chunk []byte, t time.Time) Level {
+	var sum, peak float64
+	for i := 0; i+1 < len(chunk); i += 2 {
+		sample := float64(int16(binary.LittleEndian.Uint16(chunk[i:])))
+		sum += sample * sample
+		if math.Abs(sample) > peak {
+			peak = math.Abs(sample)
+		}
+	}
+
+	m.sums[m.pos] = sum
+	m.peaks[m.pos] = peak
+	m.pos = (m.pos + 1) % len(m.sums)
+	if m.n < len(m.sums) {
+		m.n++
+	}
+
+	var totalSum, maxPeak float64
+	for i := 0; i < m.n; i++ {
+		totalSum += m.sums[i]
+		if m.peaks[i] > maxPeak {
+			maxPeak = m.peaks[i]
+		}
+	}
+	samples := float64(m.n * len(chunk) / 2)
+
+	return Level{
+		RMS:  toDB(math.Sqrt(totalSum / samples)),
+		Peak: toDB(maxPeak),
+		Time: t,
+	}
+}
+
+// reset clears the window.
+func (m *meter) reset() {
+	for i := range m.sums {
+		m.sums[i] = 0
+		m.peaks[i] = 0
+	}
+	m.pos = 0
+	m.n = 0
+}
+
+// toDB converts a sample amplitude to dBFS.
+func toDB(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return minLevel
+	}
+	db := 20 * math.Log10(amplitude/math.MaxInt16)
+	if db < minLevel {
+		return minLevel
+	}
+	return db
+}
+
+// trigger tracks how long the level has been above the threshold.
+type trigger struct {
+	threshold float64
+	duration  time.Duration
+
+	aboveSince time.Time
+	lastEvent  time.Time
+}
+
+// check returns true when the level has been above the threshold for
+// the duration. Sustained sounds trigger again after the retrigger interval.
+func (t *trigger) check(level float64, now time.Time) bool {
+	if level < t.threshold {
+		t.aboveSince = time.Time{}
+		return false
+	}
+	if t.aboveSince.IsZero() {
+		t.aboveSince = now
+	}
+	if now.Sub(t.aboveSince) < t.duration || now.Sub(t.lastEvent) < retriggerInterval {
+		return false
+	}
+	t.lastEvent = now
+	return true
+}
+
+// reset restarts the duration, the retrigger interval is kept.
+func (t *trigger) reset() {
+	t.aboveSince = time.Time{}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newChunk returns a chunk of samples alternating between +amplitude and -amplitude.
+func newChunk(amplitude int16) []byte {
+	chunk := make([]byte, chunkSize)
+	for i := 0; i < chunkSamples; i++ {
+		sample := amplitude
+		if i%2 == 1 {
+			sample = -amplitude
+		}
+		binary.LittleEndian.PutUint16(chunk[i*2:], uint16(sample))
+	}
+	return chunk
+}
+
+func TestToDB(t *testing.T) {
+	require.Equal(t, float64(minLevel), toDB(0))
+	require.Equal(t, float64(minLevel), toDB(0.0001))
+	require.InDelta(t, 0, toDB(math.MaxInt16), 0.001)
+	require.InDelta(t, -6.02, toDB(math.MaxInt16/2), 0.01)
+}
+
+func TestMeter(t *testing.T) {
+	m := newMeter(300 * time.Millisecond)
+	now := time.Unix(1, 0)
+
+	level := m.add(newChunk(math.MaxInt16), now)
+	require.InDelta(t, 0, level.RMS, 0.001)
+	require.InDelta(t, 0, level.Peak, 0.001)
+	require.Equal(t, now, level.Time)
+
+	// The loud chunk is averaged with silence.
+	m.add(newChunk(0), now)
+	level = m.add(newChunk(0), now)
+	require.InDelta(t, 10*math.Log10(1.0/3), level.RMS, 0.001)
+	require.InDelta(t, 0, level.Peak, 0.001)
+
+	// The loud chunk has left the window.
+	level = m.add(newChunk(0), now)
+	require.Equal(t, float64(minLevel), level.RMS)
+	require.Equal(t, float64(minLevel), level.Peak)
+}
+
+func TestTrigger(t *testing.T) {
+	now := time.Unix(1000, 0)
+	at := func(ms int) time.Time {
+		return now.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	t.Run("duration", func(t *testing.T) {
+		tr := trigger{threshold: -20, duration: 500 * time.Millisecond}
+		require.False(t, tr.check(-10, at(0)))
+		require.False(t, tr.check(-10, at(400)))
+		require.True(t, tr.check(-10, at(500)))
+
+		// Retrigger interval.
+		require.False(t, tr.check(-10, at(1000)))
+		require.True(t, tr.check(-10, at(1500)))
+	})
+	t.Run("reset", func(t *testing.T) {
+		tr := trigger{threshold: -20, duration: 500 * time.Millisecond}
+		require.False(t, tr.check(-10, at(0)))
+		require.False(t, tr.check(-30, at(300)))
+		require.False(t, tr.check(-10, at(600)))
+		require.True(t, tr.check(-10, at(1100)))
+	})
+	t.Run("immediate", func(t *testing.T) {
+		tr := trigger{threshold: -20}
+		require.False(t, tr.check(-21, at(0)))
+		require.True(t, tr.check(-20, at(100)))
+	})
+}
@@ -23,12 +23,9 @@ import (
 )
 
 var addon = struct {
-	doodsIP      string
-	detectorList detectors
+	backends     []backend
 	previewCache *previewCache
 
-	sendRequest sendRequestFunc
-
 	logger *log.Logger
 }{}
 
@@ -38,42 +35,23 @@ func init() {
 
 	nvr.RegisterAppRunHook(func(ctx context.Context, app *nvr.App) error {
 		addon.logger = app.Logger
-		onEnv(app.Env)
+		onAppRun(ctx, app.WG, app.Env)
 		app.Router.Handle("/doods.mjs", app.Auth.Admin(serveDoodsMjs()))
 		app.Router.Handle("/api/doods/preview/", app.Auth.Admin(addon.previewCache))
-		onAppRun(ctx, app.WG)
+		app.Router.Handle("/api/doods/status", app.Auth.Admin(handleStatus()))
 		return nil
 	})
 	nvr.RegisterTplHook(modifyTemplates)
 }
 
-func onEnv(env storage.ConfigEnv) {
+func onAppRun(ctx context.Context, wg *sync.WaitGroup, env storage.ConfigEnv) {
 	configPath := env.ConfigDir + "/doods.json"
-	var err error
-	addon.doodsIP, err = readConfig(configPath)
+	config, err := readConfig(configPath)
 	if err != nil {
 		stdlog.Fatalf("doods: config: %v, %v\n", err, configPath)
 		return
 	}
 
-	for {
-		addon.detectorList, err = newFetcher(addon.doodsIP).fetchDetectors()
-		if err != nil {
-			fmt.Printf("doods: could not fetch detectors: %v %v\n"+
-				"it can sometimes take a minute for doods to start\n"+
-				"retrying..\n", addon.doodsIP, err)
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		fmt.Printf("doods: found %d detectors:\n", len(addon.detectorList))
-		for _, detector := range addon.detectorList {
-			fmt.Printf("  %v\n", detector.Name)
-		}
-		return
-	}
-}
-
-func onAppRun(ctx context.Context, wg *sync.WaitGroup) {
 	logf := func(level log.Level, format string, a ...interface{}) {
 		addon.logger.Log(log.Entry{
 			Level: level,
@@ -82,36 +60,82 @@ func onAppRun(ctx context.Context, wg *sync.WaitGroup) {
 		})
 	}
 
-	client := newClient(ctx, wg, logf, addon.doodsIP)
-	addon.sendRequest = client.sendRequest
+	// Detectors are fetched in the background to not block startup.
+	ips := append([]string{config.IP}, config.Servers...)
+	doods := newDoodsBackend(ctx, wg, logf, ips)
+	doods.start(ctx, wg)
+	addon.backends = []backend{doods}
 
-	wg.Add(1)
-	go client.start()
+	for _, c := range config.HTTPBackends {
+		addon.backends = append(addon.backends, newHTTPBackend(c))
+	}
 }
 
 // Config doods global configuration.
 type Config struct {
 	IP string `json:"ip"`
+
+	// Additional DOODS servers, requests are spread
+	// between these and the main server.
+	Servers []string `json:"servers,omitempty"`
+
+	// Generic HTTP detectors, CodeProject.AI or DeepStack.
+	HTTPBackends []HTTPBackendConfig `json:"httpBackends,omitempty"`
 }
 
-func readConfig(configPath string) (string, error) {
+// Config errors.
+var (
+	ErrHTTPBackendNameEmpty = errors.New("http backend name empty")
+	ErrHTTPBackendNameDup   = errors.New("duplicate http backend name")
+	ErrHTTPBackendURLEmpty  = errors.New("http backend url empty")
+	ErrHTTPBackendSize      = errors.New("http backend width and height must be positive")
+	ErrServerDup            = errors.New("duplicate server")
+)
+
+func readConfig(configPath string) (*Config, error) {
 	if !dirExist(configPath) {
 		if err := genConfig(configPath); err != nil {
-			return "", fmt.Errorf("generate config: %w", err)
+			return nil, fmt.Errorf("generate config: %w", err)
 		}
 	}
 
 	file, err := os.ReadFile(configPath)
 	if err != nil {
-		return "", fmt.Errorf("read config: %w", err)
+		return nil, fmt.Errorf("read config: %w", err)
 	}
 
 	var config Config
 	if err := json.Unmarshal(file, &config); err != nil {
-		return "", fmt.Errorf("unmarshal config: %w", err)
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	servers := map[string]struct{}{config.IP: {}}
+	for _, ip := range config.Servers {
+		if _, exist := servers[ip]; exist {
+			return nil, fmt.Errorf("%w: %v", ErrServerDup, ip)
+		}
+		servers[ip] = struct{}{}
 	}
 
-	return config.IP, nil
+	names := make(map[string]struct{})
+	for _, b := range config.HTTPBackends {
+		if b.Name == "" {
+			return nil, ErrHTTPBackendNameEmpty
+		}
+		if _, exist := names[b.Name]; exist {
+			return nil, fmt.Errorf("%w: %v", ErrHTTPBackendNameDup, b.Name)
+		}
+		names[b.Name] = struct{}{}
+
+		if b.URL == "" {
+			return nil, fmt.Errorf("%w: %v", ErrHTTPBackendURLEmpty, b.Name)
+		}
+		if b.Width <= 0 || b.Height <= 0 {
+			return nil, fmt.Errorf("%w: %v", ErrHTTPBackendSize, b.Name)
+		}
+	}
+
+	return &config, nil
 }
 
 var defaultConfig = Config{
@@ -168,15 +192,6 @@ type getDetectorsResponce struct {
 	Detectors detectors `json:"detectors"`
 }
 
-func detectorByName(name string) (detector, error) {
-	for _, detector := range addon.detectorList {
-		if detector.Name == name {
-			return detector, nil
-		}
-	}
-	return detector{}, fmt.Errorf("%v: %w", name, os.ErrNotExist)
-}
-
 type detectors []detector
 
 type detector struct {
@@ -230,6 +245,10 @@ type client struct {
 	pendingRequests map[string]chan detectResponse
 	requestChan     chan clientRequest
 	responseChan    chan detectResponse
+
+	statusMu  sync.Mutex
+	connected bool
+	lastErr   error
 }
 
 func newClient(
@@ -260,6 +279,7 @@ func (c *client) start() {
 	defer c.wg.Done()
 	for {
 		err := c.run()
+		c.setStatus(false, err)
 		if err != nil {
 			c.logf(log.LevelError, "client crashed: %v", err)
 		} else {
@@ -283,6 +303,7 @@ func (c *client) run() error {
 		return fmt.Errorf("connect: %v %w", c.url, err)
 	}
 	go c.startReader(conn)
+	c.setStatus(true, nil)
 
 	cleanup := func() {
 		conn.Close()
@@ -331,6 +352,20 @@ func (c *client) run() error {
 	}
 }
 
+func (c *client) setStatus(connected bool, err error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	c.connected = connected
+	c.lastErr = err
+}
+
+// status returns if the client is connected and the last error.
+func (c *client) status() (bool, error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.connected, c.lastErr
+}
+
 func (c *client) startReader(conn *websocket.Conn) {
 	var response detectResponse
 	for {
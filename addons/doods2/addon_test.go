@@ -44,9 +44,77 @@ func TestReadConfig(t *testing.T) {
 		err := os.WriteFile(configPath, []byte(file), 0o600)
 		require.NoError(t, err)
 
-		ip, err := readConfig(configPath)
+		config, err := readConfig(configPath)
 		require.NoError(t, err)
-		require.Equal(t, ip, "test:8080")
+		require.Equal(t, config.IP, "test:8080")
+	})
+	t.Run("httpBackends", func(t *testing.T) {
+		configPath, cancel := newTestConfig(t)
+		defer cancel()
+
+		file := `{
+			"ip": "test:8080",
+			"httpBackends": [{
+				"name": "a",
+				"url": "http://b/v1/vision/detection",
+				"width": 640,
+				"height": 480,
+				"labels": ["person"]
+			}]
+		}`
+		err := os.WriteFile(configPath, []byte(file), 0o600)
+		require.NoError(t, err)
+
+		config, err := readConfig(configPath)
+		require.NoError(t, err)
+
+		expected := []HTTPBackendConfig{{
+			Name:   "a",
+			URL:    "http://b/v1/vision/detection",
+			Width:  640,
+			Height: 480,
+			Labels: []string{"person"},
+		}}
+		require.Equal(t, expected, config.HTTPBackends)
+	})
+	t.Run("serverDup", func(t *testing.T) {
+		configPath, cancel := newTestConfig(t)
+		defer cancel()
+
+		file := `{"ip":"a:8080","servers":["b:8080","a:8080"]}`
+		err := os.WriteFile(configPath, []byte(file), 0o600)
+		require.NoError(t, err)
+
+		_, err = readConfig(configPath)
+		require.ErrorIs(t, err, ErrServerDup)
+	})
+	t.Run("httpBackendErrors", func(t *testing.T) {
+		cases := map[string]struct {
+			backends string
+			err      error
+		}{
+			"nameEmpty": {`[{"url":"x","width":1,"height":1}]`, ErrHTTPBackendNameEmpty},
+			"nameDup": {
+				`[{"name":"a","url":"x","width":1,"height":1},` +
+					`{"name":"a","url":"x","width":1,"height":1}]`,
+				ErrHTTPBackendNameDup,
+			},
+			"urlEmpty": {`[{"name":"a","width":1,"height":1}]`, ErrHTTPBackendURLEmpty},
+			"size":     {`[{"name":"a","url":"x","width":1}]`, ErrHTTPBackendSize},
+		}
+		for name, tc := range cases {
+			t.Run(name, func(t *testing.T) {
+				configPath, cancel := newTestConfig(t)
+				defer cancel()
+
+				file := `{"ip":"x","httpBackends":` + tc.backends + `}`
+				err := os.WriteFile(configPath, []byte(file), 0o600)
+				require.NoError(t, err)
+
+				_, err = readConfig(configPath)
+				require.ErrorIs(t, err, tc.err)
+			})
+		}
 	})
 	t.Run("genFile", func(t *testing.T) {
 		configPath, cancel := newTestConfig(t)
@@ -139,22 +207,6 @@ func TestFetchDetectors(t *testing.T) {
 	})
 }
 
-func TestDetectorByName(t *testing.T) {
-	t.Run("ok", func(t *testing.T) {
-		addon.detectorList = testDetectors
-
-		detector, err := detectorByName("1")
-		require.NoError(t, err)
-		require.Equal(t, detector, testDetectors[0])
-	})
-	t.Run("existError", func(t *testing.T) {
-		addon.detectorList = testDetectors
-
-		_, err := detectorByName("nil")
-		require.ErrorIs(t, err, os.ErrNotExist)
-	})
-}
-
 func logf(log.Level, string, ...interface{}) {}
 
 func TestClient(t *testing.T) {
@@ -10,13 +10,14 @@ import (
 	"image"
 	"image/png"
 	"io"
+	"math"
 	"nvr"
+	"nvr/pkg/activity"
 	"nvr/pkg/ffmpeg"
 	"nvr/pkg/log"
 	"nvr/pkg/monitor"
 	"nvr/pkg/storage"
 	"nvr/pkg/video/gortsplib/pkg/h264"
-	"os/exec"
 	"strconv"
 	"sync"
 	"time"
@@ -59,7 +60,8 @@ func onInputProcessStart(ctx context.Context, i *monitor.InputProcess, _ *[]stri
 		case <-ctx.Done():
 			return
 		}
-		if err := start(ctx, i, *config, logf); err != nil {
+		err := start(ctx, i, *config, logf)
+		if err != nil && !errors.Is(err, context.Canceled) {
 			logf(log.LevelError, "could not start: %v", err)
 		}
 	}()
@@ -71,7 +73,7 @@ func start(
 	config config,
 	logf log.Func,
 ) error {
-	detector, err := detectorByName(config.detectorName)
+	backend, detector, err := waitForDetector(ctx, config.detectorName, logf)
 	if err != nil {
 		return fmt.Errorf("get detector: %w", err)
 	}
@@ -98,17 +100,13 @@ func start(
 		return fmt.Errorf("calculate ffmpeg outputs: %w", err)
 	}
 
-	i := newInstance(addon.sendRequest, input, config, addon.previewCache, logf)
+	i := newInstance(backend.detect, input, config, addon.previewCache, logf)
 
 	i.outputs = *outputs
 	i.reverseValues = *reverseValues
+	i.fullFrame = fullFrame(*reverseValues, outputs.width, outputs.height)
 
-	i.ffArgs = generateFFmpegArgs(
-		*outputs,
-		config,
-		input.RTSPprotocol(),
-		input.RTSPaddress(),
-	)
+	i.frameConfig = generateFrameConfig(*outputs, config)
 
 	i.wg.Add(1)
 	go i.startProcess(ctx)
@@ -124,19 +122,21 @@ type instance struct {
 	sendEvent monitor.SendEventFunc
 
 	outputs       outputs
-	ffArgs        []string
+	frameConfig   monitor.FrameConfig
 	reverseValues reverseValues
-
-	newProcess   ffmpeg.NewProcessFunc
-	startReader  startReaderFunc
-	sendRequest  sendRequestFunc
-	encoder      png.Encoder
-	previewCache *previewCache
-
-	// watchdogTimer restarts process if it stops outputting frames.
-	watchdogTimer *time.Timer
+	fullFrame     image.Rectangle
+
+	subscribeFrames subscribeFramesFunc
+	startReader     startReaderFunc
+	sendRequest     sendRequestFunc
+	encoder         png.Encoder
+	previewCache    *previewCache
+	activity        *activity.Signal
+	tracker         *tracker
 }
 
+type subscribeFramesFunc func(context.Context, monitor.FrameConfig) (<-chan monitor.Frame, error)
+
 func newInstance(
 	sendRequest sendRequestFunc,
 	i *monitor.InputProcess,
@@ -151,13 +151,15 @@ func newInstance(
 		logf:      logf,
 		sendEvent: i.SendEvent,
 
-		newProcess:  ffmpeg.NewProcess,
-		startReader: startReader,
-		sendRequest: sendRequest,
+		subscribeFrames: i.SubscribeFrames,
+		startReader:     startReader,
+		sendRequest:     sendRequest,
 		encoder: png.Encoder{
 			CompressionLevel: png.BestSpeed,
 		},
 		previewCache: previewCache,
+		activity:     activity.Default,
+		tracker:      newTracker(c.stationaryTimeout),
 	}
 }
 
@@ -260,21 +262,26 @@ func calculateOutputs(c config, i inputs) (*outputs, *reverseValues, error) { //
 		}, nil
 }
 
-func generateFFmpegArgs(
-	out outputs,
-	c config,
-	rtspProtocol string,
-	rtspAddress string,
-) []string {
+// fullFrame returns the position of the full camera frame in output
+// frame coordinates. The conversion is linear, solve it for 0 and 1.
+func fullFrame(reverse reverseValues, width int, height int) image.Rectangle {
+	toOutput := func(uncrop func(float32) float32, multiplier float32, size int) (int, int) {
+		min := float64(uncrop(0) * multiplier)
+		max := float64(uncrop(1) * multiplier)
+		scale := float64(size) / (max - min)
+		return int(math.Round(-min * scale)), int(math.Round((1 - min) * scale))
+	}
+	x0, x1 := toOutput(reverse.uncropXfunc, reverse.paddingXmultiplier, width)
+	y0, y1 := toOutput(reverse.uncropYfunc, reverse.paddingYmultiplier, height)
+	return image.Rect(x0, y0, x1, y1)
+}
+
+func generateFrameConfig(out outputs, c config) monitor.FrameConfig {
 	// Output minimal
-	// ffmpeg -rtsp_transport tcp -i rtsp://x -filter
-	//   'fps=fps=3,scale=320:260,pad=320:320:0:0,crop:300:300:10:10'
-	//   -f rawvideo -pix_fmt rgb24 -
+	//   fps=fps=3,scale=320:260,pad=320:320:0:0,crop:300:300:10:10
 	//
 	// Output maximal
-	// ffmpeg -hwaccel x -rtsp_transport tcp -i rtsp://x -filter
-	//   'fps=fps=3,scale=320:260,pad=320:320:0:0,crop:300:300:10:10,hue=s=0'
-	//   -f rawvideo -pix_fmt rgb24 -
+	//   fps=fps=3,scale=320:260,pad=320:320:0:0,crop:300:300:10:10,hue=s=0
 	//
 	// Padding is done after scaling for higher efficiency.
 	// Cropping must come after padding.
@@ -290,17 +297,7 @@ func generateFFmpegArgs(
 	outputWidth := strconv.Itoa(out.width)
 	outputHeight := strconv.Itoa(out.height)
 
-	var args []string
-
-	args = append(args, "-y", "-threads", "1", "-loglevel", c.ffmpegLogLevel)
-
-	if c.hwaccel != "" {
-		args = append(args, ffmpeg.ParseArgs("-hwaccel "+c.hwaccel)...)
-	}
-
-	args = append(args, "-rtsp_transport", rtspProtocol, "-i", rtspAddress)
-
-	var filter string
+	filter := "fps=fps=" + fps + ",scale=" + scaledWidth + ":" + scaledHeight
 	filter += ",pad=" + paddedWidth + ":" + paddedHeight + ":0:0"
 	filter += ",crop=" + outputWidth + ":" + outputHeight + ":" + out.cropX + ":" + out.cropY
 
@@ -308,27 +305,54 @@ func generateFFmpegArgs(
 		filter += ",hue=s=0"
 	}
 
-	args = append(args,
-		"-filter", "fps=fps="+fps+",scale="+scaledWidth+":"+scaledHeight+filter)
-
-	args = append(args,
-		"-f", "rawvideo", "-pix_fmt", "rgb24", "-")
-
-	return args
+	return monitor.FrameConfig{
+		Filter:    filter,
+		PixFmt:    "rgb24",
+		FrameSize: out.frameSize,
+	}
 }
 
 func (i *instance) startProcess(parentCtx context.Context) {
 	defer i.wg.Done()
 
+	var activityChan <-chan struct{}
+	if i.c.motionWindow != 0 {
+		var cancel activity.CancelFunc
+		activityChan, cancel = i.activity.Subscribe(i.c.monitorID)
+		defer cancel()
+	}
+
 	for {
+		if activityChan != nil {
+			i.logf(log.LevelDebug, "waiting for motion")
+			if !waitForActivity(parentCtx, activityChan) {
+				return
+			}
+		}
+
 		ctx, cancel := context.WithCancel(parentCtx)
+
+		inactive := make(chan bool, 1)
+		if activityChan != nil {
+			go func() {
+				inactive <- cancelOnInactivity(ctx, cancel, activityChan, i.c.motionWindow)
+			}()
+		} else {
+			inactive <- false
+		}
+
 		err := i.runProcess(ctx, cancel)
+		cancel()
+		if <-inactive {
+			i.logf(log.LevelDebug, "no motion for %v, stopping detector", i.c.motionWindow)
+			continue
+		}
+
 		if err != nil && !errors.Is(err, context.Canceled) {
 			i.logf(log.LevelError, "detector crashed: %v", err)
 		} else {
 			i.logf(log.LevelInfo, "detector stopped")
 		}
-		cancel()
 
 		select {
 		case <-parentCtx.Done():
@@ -338,38 +362,56 @@ func (i *instance) startProcess(parentCtx context.Context) {
 	}
 }
 
-func (i *instance) runProcess(ctx context.Context, cancel context.CancelFunc) error {
-	cmd := exec.Command(i.env.FFmpegBin, i.ffArgs...)
-
-	processLogFunc := func(msg string) {
-		i.logf(log.FFmpegLevel(i.c.ffmpegLogLevel), "process: %v", msg)
+// waitForActivity blocks until activity is reported, returns
+// false if the context was canceled.
+func waitForActivity(ctx context.Context, activityChan <-chan struct{}) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-activityChan:
+		return true
 	}
+}
 
-	process := i.newProcess(cmd).
-		StderrLogger(processLogFunc)
+// cancelOnInactivity cancels the context if no activity has been
+// reported for the window. Returns true if it was canceled
+// because of inactivity and false if the context was canceled.
+func cancelOnInactivity(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	activityChan <-chan struct{},
+	window time.Duration,
+) bool {
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-activityChan:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(window)
+		case <-timer.C:
+			cancel()
+			return true
+		}
+	}
+}
 
-	stdout, err := cmd.StdoutPipe()
+func (i *instance) runProcess(ctx context.Context, cancel context.CancelFunc) error {
+	frames, err := i.subscribeFrames(ctx, i.frameConfig)
 	if err != nil {
-		return fmt.Errorf("could not get stderr pipe: %w", err)
+		return fmt.Errorf("subscribe frames: %w", err)
 	}
 
-	i.watchdogTimer = time.AfterFunc(10*time.Second, func() {
-		if ctx.Err() != nil {
-			return
-		}
-		i.logf(log.LevelError, "watchdog: process stopped outputting frames, restarting")
-		cancel()
-	})
-
 	i.wg.Add(1)
-	go i.startReader(ctx, cancel, i, stdout)
+	go i.startReader(ctx, cancel, i, frames)
 
-	i.logf(log.LevelInfo, "starting process: %v", cmd)
+	i.logf(log.LevelInfo, "subscribed to frames: %v", i.frameConfig.Filter)
 
-	err = process.Start(ctx) // Blocks until process exists.
-	if err != nil && !errors.Is(err, context.Canceled) {
-		return fmt.Errorf("process crashed: %w", err)
-	}
+	<-ctx.Done()
 	return nil
 }
 
@@ -377,18 +419,18 @@ type startReaderFunc func(
 	context.Context,
 	context.CancelFunc,
 	*instance,
-	io.Reader,
+	<-chan monitor.Frame,
 )
 
 func startReader(
 	ctx context.Context,
 	cancel context.CancelFunc,
 	i *instance,
-	stdout io.Reader,
+	frames <-chan monitor.Frame,
 ) {
 	defer i.wg.Done()
 
-	err := i.runReader(ctx, stdout)
+	err := i.runReader(ctx, frames)
 	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, context.Canceled) {
 		i.logf(log.LevelError, "instance crashed: %v", err)
 	} else {
@@ -397,22 +439,21 @@ func startReader(
 	cancel()
 }
 
-func (i *instance) runReader(ctx context.Context, stdout io.Reader) error {
+func (i *instance) runReader(ctx context.Context, frames <-chan monitor.Frame) error {
 	eventDuration := ffmpeg.FeedRateToDuration(i.c.feedRate)
 
 	img := NewRGB24(image.Rect(0, 0, i.outputs.width, i.outputs.height))
-	inputBuffer := make([]byte, i.outputs.frameSize)
 	tmpBuffer := []byte{}
 	outputBuffer := []byte{}
 
 	for {
-		if _, err := io.ReadAtLeast(stdout, inputBuffer, i.outputs.frameSize); err != nil {
-			return fmt.Errorf("read stdout: %w", err)
+		input, ok := <-frames
+		if !ok {
+			return fmt.Errorf("read frame: %w", io.EOF)
 		}
-		t := time.Now().Add(-i.c.timestampOffset)
-		i.watchdogTimer.Reset(10 * time.Second)
+		t := input.Time.Add(-i.c.timestampOffset)
 
-		img.Pix = inputBuffer
+		img.Pix = input.Data
 		b := bytes.NewBuffer(tmpBuffer)
 		if err := i.encoder.Encode(b, img); err != nil {
 			return fmt.Errorf("encode frame: %w", err)
@@ -435,6 +476,7 @@ func (i *instance) runReader(ctx context.Context, stdout io.Reader) error {
 		}
 
 		parsed := parseDetections(i.c.mask.Area, i.reverseValues, *detections)
+		parsed = i.tracker.update(t, parsed)
 		if len(parsed) == 0 {
 			continue
 		}
@@ -442,11 +484,16 @@ func (i *instance) runReader(ctx context.Context, stdout io.Reader) error {
 		i.logf(log.LevelDebug, "trigger: label:%v score:%.1f",
 			parsed[0].Label, parsed[0].Score)
 
+		// The input frame is shared with other subscribers.
+		frame := NewRGB24(img.Rect)
+		copy(frame.Pix, input.Data)
+
 		err = i.sendEvent(storage.Event{
 			Time:        t,
 			Detections:  parsed,
 			Duration:    eventDuration,
 			RecDuration: i.c.recDuration,
+			Frame:       &storage.Frame{Image: frame, FullFrame: i.fullFrame},
 		})
 		if err != nil {
 			return fmt.Errorf("send event: %w", err)
@@ -470,19 +517,15 @@ func parseDetections(mask ffmpeg.Polygon, reverse reverseValues, detections dete
 				reverse.paddingYmultiplier * 100)
 		}
 
-		top := convY(detection.Top)
-		left := convX(detection.Left)
-		bottom := convY(detection.Bottom)
-		right := convX(detection.Right)
-
-		height := bottom - top
-		width := right - left
-
-		centerY := top + (height / 2)
-		centerX := left + (width / 2)
+		rect := ffmpeg.Rect{
+			convY(detection.Top),
+			convX(detection.Left),
+			convY(detection.Bottom),
+			convX(detection.Right),
+		}
 
-		centerInsideMask := ffmpeg.VertexInsidePoly(centerY, centerX, mask)
-		if centerInsideMask {
+		centerX, centerY := rect.Center()
+		if ffmpeg.VertexInsidePoly(int(centerX), int(centerY), mask) {
 			continue
 		}
 
@@ -490,7 +533,7 @@ func parseDetections(mask ffmpeg.Polygon, reverse reverseValues, detections dete
 			Label: label,
 			Score: score,
 			Region: &storage.Region{
-				Rect: &ffmpeg.Rect{top, left, bottom, right},
+				Rect: &rect,
 			},
 		}
 		parsed = append(parsed, d)
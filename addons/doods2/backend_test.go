@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image"
 	"image/png"
 	"io"
 	"strconv"
@@ -14,9 +15,10 @@ import (
 	"testing"
 	"time"
 
+	"nvr/pkg/activity"
 	"nvr/pkg/ffmpeg"
-	"nvr/pkg/ffmpeg/ffmock"
 	"nvr/pkg/log"
+	"nvr/pkg/monitor"
 	"nvr/pkg/storage"
 
 	"github.com/stretchr/testify/require"
@@ -110,12 +112,55 @@ func TestCaclulateOutputs(t *testing.T) {
 	})
 }
 
-func TestGenerateArgs(t *testing.T) {
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.NoCompression}
+	require.NoError(t, encoder.Encode(&b, img))
+	return b.Bytes()
+}
+
+func TestFullFrame(t *testing.T) {
+	cases := []struct {
+		inputWidth   float64
+		inputHeight  float64
+		cropX        float64
+		cropY        float64
+		cropSize     float64
+		outputWidth  float64
+		outputHeight float64
+		expected     image.Rectangle
+	}{
+		{600, 400, 0, 0, 100, 300, 300, image.Rect(0, 0, 300, 200)},
+		{400, 600, 0, 0, 100, 300, 300, image.Rect(0, 0, 200, 300)},
+		{100, 100, 5, 5, 90, 90, 90, image.Rect(-5, -5, 95, 95)},
+		{200, 100, 0, 20, 80, 80, 80, image.Rect(0, -20, 100, 30)},
+	}
+	for i, tc := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			outputs, reverse, err := calculateOutputs(
+				config{
+					cropX:    tc.cropX,
+					cropY:    tc.cropY,
+					cropSize: tc.cropSize,
+				},
+				inputs{
+					inputWidth:   tc.inputWidth,
+					inputHeight:  tc.inputHeight,
+					outputWidth:  tc.outputWidth,
+					outputHeight: tc.outputHeight,
+				})
+			require.NoError(t, err)
+
+			actual := fullFrame(*reverse, outputs.width, outputs.height)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestGenerateFrameConfig(t *testing.T) {
 	t.Run("minimal", func(t *testing.T) {
-		c := config{
-			ffmpegLogLevel: "1",
-			feedRate:       4,
-		}
+		c := config{feedRate: 4}
 		outputs := outputs{
 			scaledWidth:  5,
 			scaledHeight: 6,
@@ -125,21 +170,20 @@ func TestGenerateArgs(t *testing.T) {
 			height:       10,
 			cropX:        "11",
 			cropY:        "12",
+			frameSize:    13,
 		}
-		args := generateFFmpegArgs(outputs, c, "2", "3")
-
-		actual := fmt.Sprintf("%v", args)
-		expected := "[-y -threads 1 -loglevel 1 -rtsp_transport 2 -i 3" +
-			" -filter fps=fps=4,scale=5:6,pad=7:8:0:0,crop=9:10:11:12" +
-			" -f rawvideo -pix_fmt rgb24 -]"
-		require.Equal(t, actual, expected)
+		actual := generateFrameConfig(outputs, c)
+		expected := monitor.FrameConfig{
+			Filter:    "fps=fps=4,scale=5:6,pad=7:8:0:0,crop=9:10:11:12",
+			PixFmt:    "rgb24",
+			FrameSize: 13,
+		}
+		require.Equal(t, expected, actual)
 	})
 	t.Run("maximal", func(t *testing.T) {
 		c := config{
-			grayMode:       true,
-			ffmpegLogLevel: "1",
-			hwaccel:        "2",
-			feedRate:       6,
+			grayMode: true,
+			feedRate: 6,
 		}
 		outputs := outputs{
 			scaledWidth:  7,
@@ -150,13 +194,14 @@ func TestGenerateArgs(t *testing.T) {
 			height:       12,
 			cropX:        "13",
 			cropY:        "14",
+			frameSize:    15,
+		}
+		actual := generateFrameConfig(outputs, c)
+		expected := monitor.FrameConfig{
+			Filter:    "fps=fps=6,scale=7:8,pad=9:10:0:0,crop=11:12:13:14,hue=s=0",
+			PixFmt:    "rgb24",
+			FrameSize: 15,
 		}
-		args := generateFFmpegArgs(outputs, c, "3", "4")
-
-		actual := fmt.Sprintf("%v", args)
-		expected := "[-y -threads 1 -loglevel 1 -hwaccel 2 -rtsp_transport 3 -i 4" +
-			" -filter fps=fps=6,scale=7:8,pad=9:10:0:0,crop=11:12:13:14,hue=s=0" +
-			" -f rawvideo -pix_fmt rgb24 -]"
 		require.Equal(t, expected, actual)
 	})
 }
@@ -188,16 +233,29 @@ func newTestInstance(logs chan string) *instance {
 		encoder: png.Encoder{
 			CompressionLevel: png.NoCompression,
 		},
-		previewCache:  newPreviewCache(),
-		newProcess:    ffmock.NewProcess,
-		startReader:   stubStartReader,
-		sendRequest:   stubSendRequest,
-		sendEvent:     stubSendEvent,
-		watchdogTimer: time.NewTimer(0),
+		previewCache:    newPreviewCache(),
+		tracker:         newTracker(0),
+		subscribeFrames: stubSubscribeFrames,
+		startReader:     stubStartReader,
+		sendRequest:     stubSendRequest,
+		sendEvent:       stubSendEvent,
 	}
 }
 
-func stubStartReader(context.Context, context.CancelFunc, *instance, io.Reader) {}
+func stubSubscribeFrames(ctx context.Context, _ monitor.FrameConfig) (<-chan monitor.Frame, error) {
+	frames := make(chan monitor.Frame)
+	go func() {
+		<-ctx.Done()
+		close(frames)
+	}()
+	return frames, nil
+}
+
+func stubSubscribeFramesErr(context.Context, monitor.FrameConfig) (<-chan monitor.Frame, error) {
+	return nil, errors.New("mock")
+}
+
+func stubStartReader(context.Context, context.CancelFunc, *instance, <-chan monitor.Frame) {}
 func stubSendRequest(context.Context, detectRequest) (*detections, error) {
 	return &detections{{Confidence: 100}}, nil
 }
@@ -207,7 +265,7 @@ func TestStartProcess(t *testing.T) {
 	t.Run("crashed", func(t *testing.T) {
 		logs := make(chan string)
 		i := newTestInstance(logs)
-		i.newProcess = ffmock.NewProcessErr
+		i.subscribeFrames = stubSubscribeFramesErr
 
 		ctx, cancel2 := context.WithCancel(context.Background())
 		defer cancel2()
@@ -215,23 +273,82 @@ func TestStartProcess(t *testing.T) {
 		i.wg.Add(1)
 		go i.startProcess(ctx)
 
-		require.Equal(t, "starting process: ", <-logs)
-		require.Equal(t, "detector crashed: process crashed: mock", <-logs)
+		require.Equal(t, "detector crashed: subscribe frames: mock", <-logs)
 	})
 	t.Run("canceled", func(t *testing.T) {
 		logs := make(chan string)
 		i := newTestInstance(logs)
-		i.newProcess = ffmock.NewProcessNil
-
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel()
 
 		i.wg.Add(1)
 		go i.startProcess(ctx)
 
-		require.Equal(t, "starting process: ", <-logs)
+		require.Equal(t, "subscribed to frames: ", <-logs)
 		require.Equal(t, "detector stopped", <-logs)
 	})
+	t.Run("motionGated", func(t *testing.T) {
+		logs := make(chan string)
+		i := newTestInstance(logs)
+		i.c.motionWindow = time.Hour
+		i.activity = activity.NewSignal()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		i.wg.Add(1)
+		go i.startProcess(ctx)
+
+		require.Equal(t, "waiting for motion", <-logs)
+		i.activity.Report(i.c.monitorID)
+		require.Equal(t, "subscribed to frames: ", <-logs)
+	})
+}
+
+func TestCancelOnInactivity(t *testing.T) {
+	t.Run("inactive", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		activityChan := make(chan struct{})
+		require.True(t, cancelOnInactivity(ctx, cancel, activityChan, time.Millisecond))
+		require.Error(t, ctx.Err())
+	})
+	t.Run("extended", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		activityChan := make(chan struct{})
+		done := make(chan bool)
+		go func() {
+			done <- cancelOnInactivity(ctx, cancel, activityChan, 50*time.Millisecond)
+		}()
+
+		start := time.Now()
+		for n := 0; n < 3; n++ {
+			time.Sleep(25 * time.Millisecond)
+			activityChan <- struct{}{}
+		}
+		require.True(t, <-done)
+		require.GreaterOrEqual(t, time.Since(start), 125*time.Millisecond)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		activityChan := make(chan struct{})
+		require.False(t, cancelOnInactivity(ctx, cancel, activityChan, time.Hour))
+	})
+}
+
+func TestWaitForActivity(t *testing.T) {
+	activityChan := make(chan struct{}, 1)
+	activityChan <- struct{}{}
+	require.True(t, waitForActivity(context.Background(), activityChan))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, waitForActivity(ctx, activityChan))
 }
 
 func TestRunProcess(t *testing.T) {
@@ -239,25 +356,31 @@ func TestRunProcess(t *testing.T) {
 		i := newTestInstance(nil)
 
 		ctx, cancel2 := context.WithCancel(context.Background())
-		defer cancel2()
+		cancel2()
 
 		err := i.runProcess(ctx, func() {})
 		require.NoError(t, err)
 	})
 	t.Run("crashed", func(t *testing.T) {
 		i := newTestInstance(nil)
-		i.newProcess = ffmock.NewProcessErr
+		i.subscribeFrames = stubSubscribeFramesErr
 
 		ctx, cancel2 := context.WithCancel(context.Background())
 		defer cancel2()
 
 		err := i.runProcess(ctx, func() {})
-		require.ErrorIs(t, err, ffmock.ErrMock)
+		require.Error(t, err)
 	})
-	t.Run("startClientCalled", func(t *testing.T) {
+	t.Run("startReaderCalled", func(t *testing.T) {
 		startReaderCalled := make(chan struct{})
-		mockStartReader := func(context.Context, context.CancelFunc, *instance, io.Reader) {
+		mockStartReader := func(
+			_ context.Context,
+			cancel context.CancelFunc,
+			_ *instance,
+			_ <-chan monitor.Frame,
+		) {
 			close(startReaderCalled)
+			cancel()
 		}
 
 		i := newTestInstance(nil)
@@ -266,7 +389,7 @@ func TestRunProcess(t *testing.T) {
 		ctx, cancel2 := context.WithCancel(context.Background())
 		defer cancel2()
 
-		err := i.runProcess(ctx, func() {})
+		err := i.runProcess(ctx, cancel2)
 		require.NoError(t, err)
 
 		<-startReaderCalled
@@ -278,8 +401,13 @@ var frames = []byte{
 	255, 0, 0, 0, 255, 0, 0, 0, 255, 128, 128, 128,
 }
 
-var imgFeed = func() *bytes.Reader {
-	return bytes.NewReader(frames)
+// imgFeed returns the frames on a closed channel.
+func imgFeed() <-chan monitor.Frame {
+	feed := make(chan monitor.Frame, 2)
+	feed <- monitor.Frame{Time: time.Now(), Data: frames[:12]}
+	feed <- monitor.Frame{Time: time.Now(), Data: frames[12:]}
+	close(feed)
+	return feed
 }
 
 var framePNG = "[137 80 78 71 13 10 26 10 0 0 0 13 73 72 68 82 0 0 0 2 0 0 0 2 16 2 0 0 0 173 68 70 48 0 0 0 42 73 68 65 84 120 1 0 26 0 229 255 0 255 255 0 0 0 0 0 0 255 255 0 0 0 0 0 0 0 255 255 128 128 128 128 128 128 1 0 0 255 255 107 57 8 251 44 117 64 132 0 0 0 0 73 69 78 68 174 66 96 130]"
@@ -363,7 +491,11 @@ func TestRunInstance(t *testing.T) {
 		require.Equal(t, firstRequest, secondRequest)
 		require.Equal(t, firstRequest, framePNG)
 
+		require.NotNil(t, event.Frame)
+		require.Equal(t, firstRequest, fmt.Sprint(encodePNG(t, event.Frame.Image)))
+
 		event.Time = time.Time{}
+		event.Frame = nil
 		actual := event
 
 		expected := storage.Event{
@@ -458,10 +590,10 @@ func TestParseDetections(t *testing.T) {
 		}
 
 		mask := ffmpeg.Polygon{
-			{20, 60},
-			{20, 80},
-			{40, 80},
-			{40, 60},
+			{60, 20},
+			{80, 20},
+			{80, 40},
+			{60, 40},
 		}
 
 		actual := parseDetections(mask, reverse, detections)
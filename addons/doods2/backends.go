@@ -0,0 +1,316 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"nvr/pkg/log"
+	"os"
+	"sync"
+	"time"
+)
+
+// backend object detection server.
+type backend interface {
+	// detectors returns the available detectors, empty until they are fetched.
+	detectors() detectors
+
+	// detect sends a frame to the detector and returns
+	// the detections in percent of the frame size.
+	detect(context.Context, detectRequest) (*detections, error)
+
+	status() backendStatus
+}
+
+// Backend states.
+const (
+	backendStarting = "starting"
+	backendOK       = "ok"
+	backendError    = "error"
+)
+
+type backendStatus struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	State     string   `json:"state"`
+	Error     string   `json:"error,omitempty"`
+	Detectors []string `json:"detectors"`
+
+	// Individual servers if the backend is a pool.
+	Servers []serverStatus `json:"servers,omitempty"`
+}
+
+// backendByDetector returns the backend that has the detector.
+func backendByDetector(name string) (backend, detector, error) {
+	for _, b := range addon.backends {
+		for _, d := range b.detectors() {
+			if d.Name == name {
+				return b, d, nil
+			}
+		}
+	}
+	return nil, detector{}, fmt.Errorf("%v: %w", name, os.ErrNotExist)
+}
+
+// allDetectors returns the detectors of all backends.
+func allDetectors() detectors {
+	list := detectors{}
+	for _, b := range addon.backends {
+		list = append(list, b.detectors()...)
+	}
+	return list
+}
+
+// waitForDetector waits until a backend provides the detector,
+// the backend may still be starting or temporarily unavailable.
+func waitForDetector(
+	ctx context.Context,
+	name string,
+	logf log.Func,
+) (backend, detector, error) {
+	logged := false
+	for {
+		b, d, err := backendByDetector(name)
+		if err == nil {
+			return b, d, nil
+		}
+		if !logged {
+			logf(log.LevelWarning, "waiting for detector: %v", err)
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, detector{}, ctx.Err()
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+func handleStatus() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		statuses := []backendStatus{}
+		for _, b := range addon.backends {
+			statuses = append(statuses, b.status())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// doodsBackend pool of DOODS servers. Detectors are fetched in
+// the background and frames are sent over a websocket to the
+// healthy server with the fewest requests in flight.
+type doodsBackend struct {
+	servers []*doodsServer
+	logf    log.Func
+
+	retrySleep time.Duration
+
+	mu           sync.Mutex
+	detectorList detectors
+
+	pickMu sync.Mutex
+}
+
+func newDoodsBackend(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	logf log.Func,
+	ips []string,
+) *doodsBackend {
+	servers := make([]*doodsServer, 0, len(ips))
+	for _, ip := range ips {
+		servers = append(servers, newDoodsServer(ctx, wg, logf, ip))
+	}
+	return &doodsBackend{
+		servers:    servers,
+		logf:       logf,
+		retrySleep: 3 * time.Second,
+	}
+}
+
+func (b *doodsBackend) start(ctx context.Context, wg *sync.WaitGroup) {
+	for _, s := range b.servers {
+		s := s
+		wg.Add(2)
+		go s.client.start()
+		go func() {
+			defer wg.Done()
+			b.fetchDetectors(ctx, s)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.logStatsLoop(ctx, time.Minute)
+	}()
+}
+
+// fetchDetectors retries until the detectors are fetched,
+// it can sometimes take a minute for doods to start.
+// The servers are expected to have the same detectors.
+func (b *doodsBackend) fetchDetectors(ctx context.Context, s *doodsServer) {
+	for {
+		list, err := s.fetcher.fetchDetectors()
+		s.setFetchErr(err)
+		if err == nil {
+			b.mu.Lock()
+			if b.detectorList == nil {
+				b.detectorList = list
+			}
+			b.mu.Unlock()
+
+			b.logf(log.LevelInfo, "found %d detectors: %v", len(list), s.ip)
+			return
+		}
+		b.logf(log.LevelWarning, "could not fetch detectors, retrying: %v %v", s.ip, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.retrySleep):
+		}
+	}
+}
+
+func (b *doodsBackend) logStatsLoop(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		for _, s := range b.servers {
+			stats := s.status()
+			b.logf(log.LevelDebug,
+				"server %v: state:%v in-flight:%d latency:%.1fms requests:%d errors:%d",
+				stats.Address, stats.State, stats.InFlight,
+				stats.LatencyMs, stats.Requests, stats.Errors)
+		}
+	}
+}
+
+func (b *doodsBackend) detectors() detectors {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.detectorList
+}
+
+var errNoHealthyServers = errors.New("no healthy servers")
+
+// detect sends the request to the least loaded healthy server
+// and retries on the next server if the request fails.
+func (b *doodsBackend) detect(ctx context.Context, request detectRequest) (*detections, error) {
+	tried := make(map[*doodsServer]struct{})
+	var lastErr error
+	for {
+		s := b.pickServer(tried)
+		if s == nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w: %v", errNoHealthyServers, lastErr)
+			}
+			return nil, errNoHealthyServers
+		}
+		tried[s] = struct{}{}
+
+		d, err := s.detect(ctx, request)
+		if err == nil {
+			return d, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		b.logf(log.LevelWarning, "server %v: %v", s.ip, err)
+		lastErr = err
+	}
+}
+
+// pickServer returns the healthy server with the fewest requests
+// in flight and adds a request to it, or nil if there are no servers left.
+// Unhealthy servers are only skipped while another server is healthy,
+// disconnected servers are always skipped.
+func (b *doodsBackend) pickServer(exclude map[*doodsServer]struct{}) *doodsServer {
+	b.pickMu.Lock()
+	defer b.pickMu.Unlock()
+
+	var best, bestUnhealthy *doodsServer
+	bestInFlight, bestUnhealthyInFlight := 0, 0
+	anyHealthy := false
+	now := time.Now()
+	for _, s := range b.servers {
+		inFlight, connected, healthy := s.load(now)
+		anyHealthy = anyHealthy || healthy
+		if _, exist := exclude[s]; exist || !connected {
+			continue
+		}
+		if !healthy {
+			if bestUnhealthy == nil || inFlight < bestUnhealthyInFlight {
+				bestUnhealthy = s
+				bestUnhealthyInFlight = inFlight
+			}
+			continue
+		}
+		if best == nil || inFlight < bestInFlight {
+			best = s
+			bestInFlight = inFlight
+		}
+	}
+	if best == nil && !anyHealthy {
+		best = bestUnhealthy
+	}
+	if best != nil {
+		best.addInFlight()
+	}
+	return best
+}
+
+func (b *doodsBackend) status() backendStatus {
+	b.mu.Lock()
+	s := backendStatus{
+		Name:      "doods",
+		Type:      "doods",
+		State:     backendError,
+		Detectors: detectorNames(b.detectorList),
+	}
+	b.mu.Unlock()
+
+	// The pool is ok if any server is ok.
+	starting := false
+	for _, server := range b.servers {
+		status := server.status()
+		s.Servers = append(s.Servers, status)
+		switch status.State {
+		case backendOK:
+			s.State = backendOK
+		case backendStarting:
+			starting = true
+		}
+	}
+	if s.State != backendOK && starting {
+		s.State = backendStarting
+	}
+	if s.State == backendError && len(s.Servers) != 0 {
+		s.Error = s.Servers[0].Error
+	}
+	return s
+}
+
+func detectorNames(list detectors) []string {
+	names := []string{}
+	for _, d := range list {
+		names = append(names, d.Name)
+	}
+	return names
+}
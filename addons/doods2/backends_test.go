@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubBackend struct {
+	name string
+	list detectors
+}
+
+func (b *stubBackend) detectors() detectors { return b.list }
+
+func (b *stubBackend) detect(context.Context, detectRequest) (*detections, error) {
+	return &detections{}, nil
+}
+
+func (b *stubBackend) status() backendStatus {
+	return backendStatus{
+		Name:      b.name,
+		Type:      "stub",
+		State:     backendOK,
+		Detectors: detectorNames(b.list),
+	}
+}
+
+func TestBackendByDetector(t *testing.T) {
+	a := &stubBackend{name: "a", list: testDetectors}
+	b := &stubBackend{name: "b", list: detectors{{Name: "2"}}}
+	addon.backends = []backend{a, b}
+	defer func() { addon.backends = nil }()
+
+	t.Run("ok", func(t *testing.T) {
+		backend, detector, err := backendByDetector("1")
+		require.NoError(t, err)
+		require.Equal(t, a, backend)
+		require.Equal(t, testDetectors[0], detector)
+
+		backend, detector, err = backendByDetector("2")
+		require.NoError(t, err)
+		require.Equal(t, b, backend)
+		require.Equal(t, "2", detector.Name)
+	})
+	t.Run("existError", func(t *testing.T) {
+		_, _, err := backendByDetector("nil")
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+	t.Run("allDetectors", func(t *testing.T) {
+		require.Equal(t, []string{"1", "1x", "2"}, detectorNames(allDetectors()))
+	})
+	t.Run("waitCanceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := waitForDetector(ctx, "nil", logf)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestHandleStatus(t *testing.T) {
+	addon.backends = []backend{&stubBackend{name: "a", list: testDetectors}}
+	defer func() { addon.backends = nil }()
+
+	t.Run("ok", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/doods/status", nil)
+		handleStatus().ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var statuses []backendStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &statuses))
+
+		expected := []backendStatus{{
+			Name:      "a",
+			Type:      "stub",
+			State:     backendOK,
+			Detectors: []string{"1", "1x"},
+		}}
+		require.Equal(t, expected, statuses)
+	})
+	t.Run("methodErr", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/doods/status", nil)
+		handleStatus().ServeHTTP(w, r)
+		require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestDoodsBackendFetchDetectors(t *testing.T) {
+	response, err := json.Marshal(getDetectorsResponce{testDetectors})
+	require.NoError(t, err)
+
+	// The first request fails.
+	var mu sync.Mutex
+	count := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+		if count == 1 {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		_, err := io.WriteString(w, string(response))
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := newDoodsBackend(ctx, &sync.WaitGroup{}, logf, []string{"x"})
+	b.retrySleep = time.Millisecond
+	s := b.servers[0]
+	s.fetcher = &fetcher{url: ts.URL}
+	require.Equal(t, backendStarting, b.status().State)
+
+	b.fetchDetectors(ctx, s)
+	require.Equal(t, testDetectors, b.detectors())
+
+	// Detectors are fetched but the client isn't connected.
+	require.Equal(t, backendStarting, b.status().State)
+
+	s.client.setStatus(true, nil)
+	status := b.status()
+	require.Equal(t, backendOK, status.State)
+	require.Equal(t, []string{"1", "1x"}, status.Detectors)
+	require.Equal(t, "x", status.Servers[0].Address)
+
+	s.client.setStatus(false, context.DeadlineExceeded)
+	require.Equal(t, backendError, b.status().State)
+}
@@ -15,8 +15,6 @@ import (
 
 type config struct {
 	monitorID       string
-	hwaccel         string
-	ffmpegLogLevel  string
 	timestampOffset time.Duration
 	thresholds      thresholds
 	cropX           float64
@@ -28,6 +26,15 @@ type config struct {
 	feedRate        float64
 	recDuration     time.Duration
 	useSubStream    bool
+
+	// Detections of objects that haven't moved for this long
+	// are ignored. Zero disables.
+	stationaryTimeout time.Duration
+
+	// Only run detection for this long after the motion
+	// addon reported activity. Zero runs continuously.
+	motionWindow  time.Duration
+	motionEnabled bool
 }
 
 type rawConfigV1 struct {
@@ -39,6 +46,9 @@ type rawConfigV1 struct {
 	FeedRate     string `json:"feedRate"`
 	Duration     string `json:"duration"`
 	UseSubStream string `json:"useSubStream"`
+
+	StationaryTimeout string `json:"stationaryTimeout,omitempty"`
+	MotionWindow      string `json:"motionWindow,omitempty"`
 }
 
 type mask struct {
@@ -99,10 +109,18 @@ func parseConfig(c monitor.Config) (*config, bool, error) { //nolint:funlen
 
 	useSubStream := c.SubInputEnabled() && rawConf.UseSubStream == "true"
 
+	stationaryTimeout, err := parseDuration(rawConf.StationaryTimeout)
+	if err != nil {
+		return nil, false, fmt.Errorf("stationary timeout: %w", err)
+	}
+
+	motionWindow, err := parseDuration(rawConf.MotionWindow)
+	if err != nil {
+		return nil, false, fmt.Errorf("motion window: %w", err)
+	}
+
 	return &config{
 		monitorID:       c.ID(),
-		hwaccel:         c.Hwaccel(),
-		ffmpegLogLevel:  c.LogLevel(),
 		timestampOffset: timestampOffset,
 		thresholds:      thresholds,
 		cropX:           crop[0],
@@ -114,9 +132,24 @@ func parseConfig(c monitor.Config) (*config, bool, error) { //nolint:funlen
 		feedRate:        feedRate,
 		recDuration:     recDuration,
 		useSubStream:    useSubStream,
+
+		stationaryTimeout: stationaryTimeout,
+		motionWindow:      motionWindow,
+		motionEnabled:     motionEnabled(c),
 	}, enable, nil
 }
 
+// motionEnabled returns true if the motion addon is enabled for the monitor.
+func motionEnabled(c monitor.Config) bool {
+	var rawMotion struct {
+		Enable string `json:"enable"`
+	}
+	if err := json.Unmarshal([]byte(c.Get("motion")), &rawMotion); err != nil {
+		return false
+	}
+	return rawMotion.Enable == "true"
+}
+
 func parseRawConfig(rawDoods string) (rawConfigV1, error) {
 	if rawDoods == "" {
 		return rawConfigV1{}, nil
@@ -186,6 +219,10 @@ var (
 	ErrInvalidCropY    = errors.New("invalid cropY")
 	ErrInvalidFeedRate = errors.New("invalid feed rate")
 	ErrInvalidDuration = errors.New("invalid duration")
+
+	ErrInvalidStationaryTimeout = errors.New("invalid stationary timeout")
+	ErrInvalidMotionWindow      = errors.New("invalid motion window")
+	ErrMotionDisabled           = errors.New("motion window requires the motion addon")
 )
 
 // The WebUI shouldn't allow the user to save invalid values, this is more of
@@ -206,6 +243,16 @@ func (c *config) validate() error {
 	if c.recDuration < 0 {
 		return fmt.Errorf("%w: %v", ErrInvalidDuration, c.recDuration)
 	}
+	if c.stationaryTimeout < 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidStationaryTimeout, c.stationaryTimeout)
+	}
+	if c.motionWindow < 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidMotionWindow, c.motionWindow)
+	}
+	// The detector would wait for motion forever.
+	if c.motionWindow != 0 && !c.motionEnabled {
+		return ErrMotionDisabled
+	}
 	return nil
 }
 
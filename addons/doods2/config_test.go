@@ -25,7 +25,9 @@ func TestParseConfig(t *testing.T) {
 			"detectorName": "14",
 			"feedRate":     "15",
 			"duration":     "0.000000016",
-			"useSubStream": "true"
+			"useSubStream": "true",
+			"stationaryTimeout": "17",
+			"motionWindow": "18"
 		}`
 		c := monitor.NewConfig(monitor.RawConfig{
 			"id":              "1",
@@ -34,6 +36,7 @@ func TestParseConfig(t *testing.T) {
 			"timestampOffset": "4",
 			"subInput":        "x",
 			"doods":           doods,
+			"motion":          `{"enable": "true"}`,
 		})
 		actual, enable, err := parseConfig(c)
 		require.NoError(t, err)
@@ -41,8 +44,6 @@ func TestParseConfig(t *testing.T) {
 
 		expected := config{
 			monitorID:       "1",
-			hwaccel:         "2",
-			ffmpegLogLevel:  "3",
 			timestampOffset: 4000000,
 			thresholds:      thresholds{"5": 6},
 			cropX:           7,
@@ -56,6 +57,10 @@ func TestParseConfig(t *testing.T) {
 			feedRate:     15,
 			recDuration:  16,
 			useSubStream: true,
+
+			stationaryTimeout: 17 * time.Second,
+			motionWindow:      18 * time.Second,
+			motionEnabled:     true,
 		}
 		require.Equal(t, expected, *actual)
 	})
@@ -161,6 +166,12 @@ func TestParseConfig(t *testing.T) {
 		"recDurationErr": {
 			"doods": `{"enable": "true", "duration":"nil"}`,
 		},
+		"stationaryTimeoutErr": {
+			"doods": `{"enable": "true", "stationaryTimeout":"nil"}`,
+		},
+		"motionWindowErr": {
+			"doods": `{"enable": "true", "motionWindow":"nil"}`,
+		},
 	}
 	for name, conf := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -275,6 +286,33 @@ func TestValidate(t *testing.T) {
 			},
 			ErrInvalidDuration,
 		},
+		"stationaryTimeoutErr": {
+			config{
+				monitorID:         "1",
+				detectorName:      "2",
+				feedRate:          3,
+				stationaryTimeout: -1,
+			},
+			ErrInvalidStationaryTimeout,
+		},
+		"motionWindowErr": {
+			config{
+				monitorID:    "1",
+				detectorName: "2",
+				feedRate:     3,
+				motionWindow: -1,
+			},
+			ErrInvalidMotionWindow,
+		},
+		"motionDisabled": {
+			config{
+				monitorID:    "1",
+				detectorName: "2",
+				feedRate:     3,
+				motionWindow: 1,
+			},
+			ErrMotionDisabled,
+		},
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -47,6 +47,8 @@ function _doods(hls, detectors) {
 			}
 		),
 		duration: fieldTemplate.integer("Trigger duration (sec)", "", "120"),
+		stationaryTimeout: fieldTemplate.integer("Stationary timeout (sec)", "", "0"),
+		motionWindow: fieldTemplate.integer("Motion window (sec)", "", "0"),
 		useSubStream: fieldTemplate.toggle("Use sub stream", "true"),
 		preview: preview(),
 	};
@@ -32,18 +32,16 @@ func modifySettingsjs(tpl string) string {
 
 //go:embed doods.mjs
 var doodsMjsFile string
-var doodsMjsCache string
 
+// serveDoodsMjs renders the detector list on every request
+// because backends may still be starting.
 func serveDoodsMjs() http.Handler {
-	if doodsMjsCache == "" {
-		data, _ := json.Marshal(addon.detectorList)
-		detectorsJSON := string(data)
-		doodsMjsCache = strings.Replace(doodsMjsFile, "$detectorsJSON", detectorsJSON, 1)
-	}
-
 	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		data, _ := json.Marshal(allDetectors())
+		file := strings.Replace(doodsMjsFile, "$detectorsJSON", string(data), 1)
+
 		w.Header().Set("content-type", "text/javascript")
-		if _, err := w.Write([]byte(doodsMjsCache)); err != nil {
+		if _, err := w.Write([]byte(file)); err != nil {
 			http.Error(w, "could not write: "+err.Error(), http.StatusInternalServerError)
 		}
 	})
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sync"
+)
+
+// HTTPBackendConfig generic HTTP/JSON detector that accepts a
+// multipart image and returns DeepStack style predictions.
+type HTTPBackendConfig struct {
+	// Unique name, also used as the detector name in the monitor settings.
+	Name string `json:"name"`
+
+	// Detection endpoint, "http://127.0.0.1:32168/v1/vision/detection".
+	URL string `json:"url"`
+
+	// Size of the frames sent to the server.
+	Width  int32 `json:"width"`
+	Height int32 `json:"height"`
+
+	// Labels that the server can detect.
+	Labels []string `json:"labels"`
+}
+
+// httpBackend CodeProject.AI or DeepStack server.
+type httpBackend struct {
+	c      HTTPBackendConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	requested bool
+	lastErr   error
+}
+
+func newHTTPBackend(c HTTPBackendConfig) *httpBackend {
+	return &httpBackend{
+		c:      c,
+		client: &http.Client{},
+	}
+}
+
+func (b *httpBackend) detectors() detectors {
+	return detectors{{
+		Name:   b.c.Name,
+		Model:  "http",
+		Labels: b.c.Labels,
+		Width:  b.c.Width,
+		Height: b.c.Height,
+	}}
+}
+
+func (b *httpBackend) detect(ctx context.Context, request detectRequest) (*detections, error) {
+	d, err := b.sendRequest(ctx, request)
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.requested = true
+	b.lastErr = err
+	b.mu.Unlock()
+
+	return d, err
+}
+
+var errHTTPBackend = errors.New("http backend error")
+
+type httpDetectResponse struct {
+	Success     bool             `json:"success"`
+	Error       string           `json:"error"`
+	Predictions []httpPrediction `json:"predictions"`
+}
+
+type httpPrediction struct {
+	Label      string  `json:"label"`
+	Confidence float32 `json:"confidence"`
+	XMin       float32 `json:"x_min"`
+	YMin       float32 `json:"y_min"`
+	XMax       float32 `json:"x_max"`
+	YMax       float32 `json:"y_max"`
+}
+
+func (b *httpBackend) sendRequest(ctx context.Context, request detectRequest) (*detections, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("image", "frame.png")
+	if err != nil {
+		return nil, fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := part.Write(*request.Data); err != nil {
+		return nil, fmt.Errorf("write form file: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("close writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.c.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	rawBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v %v", errHTTPBackend, res.Status, string(rawBody))
+	}
+
+	var response httpDetectResponse
+	if err := json.Unmarshal(rawBody, &response); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("%w: %v", errHTTPBackend, response.Error)
+	}
+
+	return b.parsePredictions(response.Predictions, request.Detect), nil
+}
+
+// parsePredictions converts the pixel coordinates to percent
+// and filters the predictions below the label thresholds.
+func (b *httpBackend) parsePredictions(predictions []httpPrediction, thresholds thresholds) *detections {
+	width := float32(b.c.Width)
+	height := float32(b.c.Height)
+
+	d := detections{}
+	for _, p := range predictions {
+		confidence := p.Confidence * 100
+		threshold, exist := thresholds[p.Label]
+		if !exist || float64(confidence) < threshold {
+			continue
+		}
+		d = append(d, Detection{
+			Top:        p.YMin / height,
+			Left:       p.XMin / width,
+			Bottom:     p.YMax / height,
+			Right:      p.XMax / width,
+			Label:      p.Label,
+			Confidence: confidence,
+		})
+	}
+	return &d
+}
+
+func (b *httpBackend) status() backendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := backendStatus{
+		Name:      b.c.Name,
+		Type:      "http",
+		State:     backendOK,
+		Detectors: []string{b.c.Name},
+	}
+	switch {
+	case !b.requested:
+		s.State = backendStarting
+	case b.lastErr != nil:
+		s.State = backendError
+		s.Error = b.lastErr.Error()
+	}
+	return s
+}
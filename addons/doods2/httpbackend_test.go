@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPBackend(t *testing.T) {
+	config := HTTPBackendConfig{
+		Name:   "a",
+		Width:  200,
+		Height: 100,
+		Labels: []string{"person", "car"},
+	}
+	newTestServer := func(t *testing.T, status int, response string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+
+			file, _, err := r.FormFile("image")
+			require.NoError(t, err)
+			data, err := io.ReadAll(file)
+			require.NoError(t, err)
+			require.Equal(t, []byte("frame"), data)
+
+			w.WriteHeader(status)
+			_, err = io.WriteString(w, response)
+			require.NoError(t, err)
+		}))
+	}
+	data := []byte("frame")
+	request := detectRequest{
+		Data:   &data,
+		Detect: thresholds{"person": 50, "car": 90},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ts := newTestServer(t, http.StatusOK, `{
+			"success": true,
+			"predictions": [
+				{
+					"label": "person", "confidence": 0.75,
+					"x_min": 20, "y_min": 10, "x_max": 100, "y_max": 50
+				},
+				{
+					"label": "car", "confidence": 0.8,
+					"x_min": 0, "y_min": 0, "x_max": 10, "y_max": 10
+				},
+				{
+					"label": "dog", "confidence": 1,
+					"x_min": 0, "y_min": 0, "x_max": 10, "y_max": 10
+				}
+			]
+		}`)
+		defer ts.Close()
+
+		c := config
+		c.URL = ts.URL
+		b := newHTTPBackend(c)
+		require.Equal(t, backendStarting, b.status().State)
+
+		d, err := b.detect(context.Background(), request)
+		require.NoError(t, err)
+
+		expected := &detections{{
+			Top:        0.1,
+			Left:       0.1,
+			Bottom:     0.5,
+			Right:      0.5,
+			Label:      "person",
+			Confidence: 75,
+		}}
+		require.Equal(t, expected, d)
+		require.Equal(t, backendOK, b.status().State)
+	})
+	t.Run("serverErr", func(t *testing.T) {
+		ts := newTestServer(t, http.StatusOK, `{"success":false,"error":"x"}`)
+		defer ts.Close()
+
+		c := config
+		c.URL = ts.URL
+		b := newHTTPBackend(c)
+
+		_, err := b.detect(context.Background(), request)
+		require.ErrorIs(t, err, errHTTPBackend)
+
+		status := b.status()
+		require.Equal(t, backendError, status.State)
+		require.Equal(t, "http backend error: x", status.Error)
+	})
+	t.Run("statusErr", func(t *testing.T) {
+		ts := newTestServer(t, http.StatusInternalServerError, "")
+		defer ts.Close()
+
+		c := config
+		c.URL = ts.URL
+		_, err := newHTTPBackend(c).detect(context.Background(), request)
+		require.ErrorIs(t, err, errHTTPBackend)
+	})
+	t.Run("deadline", func(t *testing.T) {
+		done := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer ts.Close()
+		defer close(done)
+
+		c := config
+		c.URL = ts.URL
+		b := newHTTPBackend(c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := b.detect(ctx, request)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, backendError, b.status().State)
+	})
+	t.Run("detectors", func(t *testing.T) {
+		expected := detectors{{
+			Name:   "a",
+			Model:  "http",
+			Labels: []string{"person", "car"},
+			Width:  200,
+			Height: 100,
+		}}
+		require.Equal(t, expected, newHTTPBackend(config).detectors())
+	})
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"context"
+	"errors"
+	"nvr/pkg/log"
+	"sync"
+	"time"
+)
+
+// A server is skipped for the duration after this many failed
+// requests in a row, a single slow response is not enough.
+const (
+	unhealthyFailures = 3
+	unhealthyDuration = 10 * time.Second
+)
+
+// doodsServer single server in the DOODS pool.
+type doodsServer struct {
+	ip      string
+	fetcher *fetcher
+	client  *client
+
+	mu             sync.Mutex
+	inFlight       int
+	unhealthyUntil time.Time
+	failures       int // Consecutive.
+	fetched        bool
+	fetchErr       error
+	lastErr        error
+	latency        time.Duration
+	requests       int
+	errors         int
+}
+
+func newDoodsServer(ctx context.Context, wg *sync.WaitGroup, logf log.Func, ip string) *doodsServer {
+	serverLogf := func(level log.Level, format string, a ...interface{}) {
+		logf(level, ip+": "+format, a...)
+	}
+	return &doodsServer{
+		ip:      ip,
+		fetcher: newFetcher(ip),
+		client:  newClient(ctx, wg, serverLogf, ip),
+	}
+}
+
+func (s *doodsServer) setFetchErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetched = err == nil
+	s.fetchErr = err
+}
+
+// load returns the number of requests in flight, if the
+// server is connected and if it's connected and healthy.
+func (s *doodsServer) load(now time.Time) (int, bool, bool) {
+	connected, _ := s.client.status()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight, connected, connected && !now.Before(s.unhealthyUntil)
+}
+
+func (s *doodsServer) addInFlight() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight++
+}
+
+// detect sends the request, addInFlight must be called first.
+func (s *doodsServer) detect(ctx context.Context, request detectRequest) (*detections, error) {
+	start := time.Now()
+	d, err := s.client.sendRequest(ctx, request)
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.requests++
+
+	if err != nil {
+		s.errors++
+		// Don't blame the server if the caller gave up, a request
+		// that exceeds the deadline means the server has stalled.
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			s.lastErr = err
+			s.failures++
+			if s.failures >= unhealthyFailures {
+				s.failures = 0
+				s.unhealthyUntil = time.Now().Add(unhealthyDuration)
+			}
+		}
+		return nil, err
+	}
+
+	s.lastErr = nil
+	s.failures = 0
+	// Exponential moving average.
+	if s.latency == 0 {
+		s.latency = elapsed
+	} else {
+		s.latency += (elapsed - s.latency) / 5
+	}
+	return d, nil
+}
+
+type serverStatus struct {
+	Address   string  `json:"address"`
+	State     string  `json:"state"`
+	Error     string  `json:"error,omitempty"`
+	InFlight  int     `json:"inFlight"`
+	LatencyMs float64 `json:"latencyMs"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+}
+
+func (s *doodsServer) status() serverStatus {
+	connected, clientErr := s.client.status()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := serverStatus{
+		Address:   s.ip,
+		State:     backendOK,
+		InFlight:  s.inFlight,
+		LatencyMs: float64(s.latency) / float64(time.Millisecond),
+		Requests:  s.requests,
+		Errors:    s.errors,
+	}
+	switch {
+	case s.fetchErr != nil:
+		status.State = backendError
+		status.Error = "fetch detectors: " + s.fetchErr.Error()
+	case !s.fetched:
+		status.State = backendStarting
+	case clientErr != nil && !connected:
+		status.State = backendError
+		status.Error = clientErr.Error()
+	case !connected:
+		status.State = backendStarting
+	case time.Now().Before(s.unhealthyUntil):
+		status.State = backendError
+		if s.lastErr != nil {
+			status.Error = s.lastErr.Error()
+		}
+	}
+	return status
+}
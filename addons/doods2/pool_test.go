@@ -0,0 +1,273 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDoodsServer detection server that responds after a delay.
+type fakeDoodsServer struct {
+	ip    string
+	delay time.Duration
+
+	mu       sync.Mutex
+	fail     bool
+	requests int
+}
+
+func newFakeDoodsServer(t *testing.T, delay time.Duration, fail bool) *fakeDoodsServer {
+	s := &fakeDoodsServer{delay: delay, fail: fail}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/detect", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := new(websocket.Upgrader).Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var writeMu sync.Mutex
+		for {
+			var request detectRequest
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.requests++
+			fail := s.fail
+			s.mu.Unlock()
+
+			go func() {
+				time.Sleep(s.delay)
+				response := detectResponse{
+					ID:         request.ID,
+					Detections: detections{{Label: s.ip}},
+				}
+				if fail {
+					response.ServerError = "fail"
+				}
+				writeMu.Lock()
+				defer writeMu.Unlock()
+				conn.WriteJSON(response) //nolint:errcheck
+			}()
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	s.ip = strings.TrimPrefix(server.URL, "http://")
+	return s
+}
+
+func (s *fakeDoodsServer) numRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func newTestPool(t *testing.T, fakes ...*fakeDoodsServer) *doodsBackend {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	ips := []string{}
+	for _, f := range fakes {
+		ips = append(ips, f.ip)
+	}
+	b := newDoodsBackend(ctx, wg, logf, ips)
+	for _, s := range b.servers {
+		s.client.warmup = 0
+		s.client.retrySleep = 0
+		wg.Add(1)
+		go s.client.start()
+	}
+	require.Eventually(t, func() bool {
+		for _, s := range b.servers {
+			if connected, _ := s.client.status(); !connected {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	return b
+}
+
+func TestDoodsPool(t *testing.T) {
+	t.Run("spread", func(t *testing.T) {
+		a := newFakeDoodsServer(t, 50*time.Millisecond, false)
+		b := newFakeDoodsServer(t, 50*time.Millisecond, false)
+		pool := newTestPool(t, a, b)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := pool.detect(context.Background(), detectRequest{})
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, 2, a.numRequests())
+		require.Equal(t, 2, b.numRequests())
+
+		status := pool.status()
+		require.Len(t, status.Servers, 2)
+		for _, s := range status.Servers {
+			require.Equal(t, 0, s.InFlight)
+			require.Equal(t, 2, s.Requests)
+			require.Greater(t, s.LatencyMs, float64(0))
+		}
+	})
+	t.Run("preferIdle", func(t *testing.T) {
+		slow := newFakeDoodsServer(t, 100*time.Millisecond, false)
+		fast := newFakeDoodsServer(t, 0, false)
+		pool := newTestPool(t, slow, fast)
+
+		done := make(chan struct{})
+		go func() {
+			_, err := pool.detect(context.Background(), detectRequest{})
+			require.NoError(t, err)
+			close(done)
+		}()
+		require.Eventually(t, func() bool {
+			return slow.numRequests() == 1
+		}, time.Second, time.Millisecond)
+
+		// The slow server has a request in flight.
+		for i := 0; i < 3; i++ {
+			d, err := pool.detect(context.Background(), detectRequest{})
+			require.NoError(t, err)
+			require.Equal(t, fast.ip, (*d)[0].Label)
+		}
+		<-done
+		require.Equal(t, 1, slow.numRequests())
+	})
+	t.Run("failover", func(t *testing.T) {
+		failing := newFakeDoodsServer(t, 0, true)
+		ok := newFakeDoodsServer(t, 0, false)
+		pool := newTestPool(t, failing, ok)
+
+		// Both servers are idle, the first one is tried first.
+		for i := 0; i < unhealthyFailures; i++ {
+			d, err := pool.detect(context.Background(), detectRequest{})
+			require.NoError(t, err)
+			require.Equal(t, ok.ip, (*d)[0].Label)
+		}
+		require.Equal(t, unhealthyFailures, failing.numRequests())
+
+		// The failing server is skipped while unhealthy.
+		_, err := pool.detect(context.Background(), detectRequest{})
+		require.NoError(t, err)
+		require.Equal(t, unhealthyFailures, failing.numRequests())
+		require.Equal(t, unhealthyFailures+1, ok.numRequests())
+
+		pool.servers[0].setFetchErr(nil)
+		status := pool.servers[0].status()
+		require.Equal(t, backendError, status.State)
+		require.Equal(t, unhealthyFailures, status.Errors)
+		require.Contains(t, status.Error, "fail")
+	})
+	t.Run("singleServerTransientFailure", func(t *testing.T) {
+		server := newFakeDoodsServer(t, 0, true)
+		pool := newTestPool(t, server)
+
+		_, err := pool.detect(context.Background(), detectRequest{})
+		require.ErrorIs(t, err, errNoHealthyServers)
+
+		// One failure doesn't mark the server unhealthy.
+		_, _, healthy := pool.servers[0].load(time.Now())
+		require.True(t, healthy)
+
+		server.mu.Lock()
+		server.fail = false
+		server.mu.Unlock()
+		d, err := pool.detect(context.Background(), detectRequest{})
+		require.NoError(t, err)
+		require.Equal(t, server.ip, (*d)[0].Label)
+	})
+	t.Run("lastServerNotExcluded", func(t *testing.T) {
+		server := newFakeDoodsServer(t, 0, true)
+		pool := newTestPool(t, server)
+
+		for i := 0; i < unhealthyFailures; i++ {
+			_, err := pool.detect(context.Background(), detectRequest{})
+			require.Error(t, err)
+		}
+		_, _, healthy := pool.servers[0].load(time.Now())
+		require.False(t, healthy)
+
+		// The only server is still used while unhealthy.
+		server.mu.Lock()
+		server.fail = false
+		server.mu.Unlock()
+		d, err := pool.detect(context.Background(), detectRequest{})
+		require.NoError(t, err)
+		require.Equal(t, server.ip, (*d)[0].Label)
+		require.Equal(t, unhealthyFailures+1, server.numRequests())
+	})
+	t.Run("noHealthyServers", func(t *testing.T) {
+		pool := newTestPool(t,
+			newFakeDoodsServer(t, 0, true),
+			newFakeDoodsServer(t, 0, true),
+		)
+		_, err := pool.detect(context.Background(), detectRequest{})
+		require.ErrorIs(t, err, errNoHealthyServers)
+
+		_, err = pool.detect(context.Background(), detectRequest{})
+		require.ErrorIs(t, err, errNoHealthyServers)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		slow := newFakeDoodsServer(t, time.Second, false)
+		pool := newTestPool(t, slow)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			require.Eventually(t, func() bool {
+				return slow.numRequests() == 1
+			}, time.Second, time.Millisecond)
+			cancel()
+		}()
+		_, err := pool.detect(ctx, detectRequest{})
+		require.ErrorIs(t, err, context.Canceled)
+
+		// The server isn't marked unhealthy when the caller gives up.
+		_, _, healthy := pool.servers[0].load(time.Now())
+		require.True(t, healthy)
+	})
+	t.Run("stalled", func(t *testing.T) {
+		stalled := newFakeDoodsServer(t, time.Second, false)
+		ok := newFakeDoodsServer(t, 0, false)
+		pool := newTestPool(t, stalled, ok)
+
+		// Both servers are idle, the first one is picked.
+		for i := 0; i < unhealthyFailures; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			_, err := pool.detect(ctx, detectRequest{})
+			cancel()
+			require.Error(t, err)
+		}
+		require.Equal(t, unhealthyFailures, stalled.numRequests())
+
+		// The stalled server is marked unhealthy.
+		_, _, healthy := pool.servers[0].load(time.Now())
+		require.False(t, healthy)
+
+		d, err := pool.detect(context.Background(), detectRequest{})
+		require.NoError(t, err)
+		require.Equal(t, ok.ip, (*d)[0].Label)
+		require.Equal(t, unhealthyFailures, stalled.numRequests())
+	})
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"image"
+	"math"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/storage"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Minimum intersection over union to match a detection to a track.
+	trackMinIoU = 0.3
+
+	// Minimum center movement, in percent of the frame,
+	// before a object is considered to be moving.
+	trackMinMovement = 5
+
+	// Tracks are removed after this many frames without a match.
+	trackLostFrames = 5
+
+	// Tracks that haven't been seen for this long are removed. Frames
+	// aren't processed while the detector is sleeping, tracks are kept
+	// until the detector wakes up, unless they have gone stale.
+	trackStaleTimeout = time.Hour
+)
+
+// lastTrackID is shared between trackers, track IDs
+// are unique per monitor across detector restarts.
+var lastTrackID atomic.Int64
+
+func newTrackID() int {
+	return int(lastTrackID.Add(1))
+}
+
+// tracker assigns track IDs to detections by matching them
+// to the detections in the previous frames with the same label.
+// The tracker is kept by the instance between detector restarts.
+type tracker struct {
+	mu     sync.Mutex
+	tracks []*track
+
+	// Zero disables.
+	stationaryTimeout time.Duration
+}
+
+type track struct {
+	id    int
+	label string
+	rect  ffmpeg.Rect
+
+	// Position when the object last moved.
+	anchor    ffmpeg.Rect
+	lastMoved time.Time
+	lastSeen  time.Time
+
+	// Number of consecutive frames without a match.
+	missed int
+}
+
+func newTracker(stationaryTimeout time.Duration) *tracker {
+	return &tracker{
+		stationaryTimeout: stationaryTimeout,
+	}
+}
+
+// update assigns track IDs to the detections and returns the
+// detections of new and moving objects. Detections of objects
+// that haven't moved within the stationary timeout are dropped.
+func (t *tracker) update(now time.Time, detections []storage.Detection) []storage.Detection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeStale(now)
+
+	active := []storage.Detection{}
+	matched := make(map[*track]struct{})
+	for _, d := range detections {
+		if d.Region == nil || d.Region.Rect == nil {
+			active = append(active, d)
+			continue
+		}
+		rect := *d.Region.Rect
+
+		tr := t.match(d.Label, rect, matched)
+		if tr == nil {
+			tr = &track{
+				id:        newTrackID(),
+				label:     d.Label,
+				anchor:    rect,
+				lastMoved: now,
+			}
+			t.tracks = append(t.tracks, tr)
+		} else if centerDistance(tr.anchor, rect) >= trackMinMovement {
+			tr.anchor = rect
+			tr.lastMoved = now
+		}
+		tr.rect = rect
+		tr.lastSeen = now
+		tr.missed = 0
+		matched[tr] = struct{}{}
+
+		d.TrackID = tr.id
+		if t.stationaryTimeout == 0 || now.Sub(tr.lastMoved) < t.stationaryTimeout {
+			active = append(active, d)
+		}
+	}
+	t.removeLost(matched)
+	return active
+}
+
+// match returns the unmatched track with the same label and the highest overlap.
+func (t *tracker) match(label string, rect ffmpeg.Rect, matched map[*track]struct{}) *track {
+	var best *track
+	bestIoU := trackMinIoU
+	for _, tr := range t.tracks {
+		if _, exist := matched[tr]; exist || tr.label != label {
+			continue
+		}
+		if iou := intersectionOverUnion(tr.rect, rect); iou >= bestIoU {
+			best = tr
+			bestIoU = iou
+		}
+	}
+	return best
+}
+
+// removeLost removes tracks that haven't been matched for too many frames.
+func (t *tracker) removeLost(matched map[*track]struct{}) {
+	tracks := t.tracks[:0]
+	for _, tr := range t.tracks {
+		if _, exist := matched[tr]; !exist {
+			tr.missed++
+		}
+		if tr.missed <= trackLostFrames {
+			tracks = append(tracks, tr)
+		}
+	}
+	t.tracks = tracks
+}
+
+func (t *tracker) removeStale(now time.Time) {
+	tracks := t.tracks[:0]
+	for _, tr := range t.tracks {
+		if now.Sub(tr.lastSeen) <= trackStaleTimeout {
+			tracks = append(tracks, tr)
+		}
+	}
+	t.tracks = tracks
+}
+
+func intersectionOverUnion(a ffmpeg.Rect, b ffmpeg.Rect) float64 {
+	toImage := func(r ffmpeg.Rect) image.Rectangle {
+		top, left, bottom, right := r[0], r[1], r[2], r[3]
+		return image.Rect(left, top, right, bottom)
+	}
+	area := func(r image.Rectangle) int {
+		return r.Dx() * r.Dy()
+	}
+	ra, rb := toImage(a), toImage(b)
+
+	intersection := ra.Intersect(rb)
+	if intersection.Empty() {
+		return 0
+	}
+
+	intersectionArea := area(intersection)
+	union := area(ra) + area(rb) - intersectionArea
+	if union <= 0 {
+		return 0
+	}
+	return float64(intersectionArea) / float64(union)
+}
+
+func centerDistance(a ffmpeg.Rect, b ffmpeg.Rect) float64 {
+	ax, ay := a.Center()
+	bx, by := b.Center()
+	return math.Hypot(ax-bx, ay-by)
+}
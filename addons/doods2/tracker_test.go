@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package doods
+
+import (
+	"testing"
+	"time"
+
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDetection(label string, rect ffmpeg.Rect) storage.Detection {
+	return storage.Detection{
+		Label:  label,
+		Score:  50,
+		Region: &storage.Region{Rect: &rect},
+	}
+}
+
+// trackIDs returns the track IDs relative to the last track ID.
+func trackIDs(base int, detections []storage.Detection) []int {
+	ids := []int{}
+	for _, d := range detections {
+		ids = append(ids, d.TrackID-base)
+	}
+	return ids
+}
+
+func TestTracker(t *testing.T) {
+	start := time.Unix(1000, 0)
+	frame := func(i int) time.Time {
+		return start.Add(time.Duration(i) * time.Second)
+	}
+
+	t.Run("trackIDs", func(t *testing.T) {
+		tr := newTracker(0)
+		base := int(lastTrackID.Load())
+
+		active := tr.update(frame(0), []storage.Detection{
+			newTestDetection("car", ffmpeg.Rect{10, 10, 30, 30}),
+			newTestDetection("person", ffmpeg.Rect{10, 10, 30, 30}),
+		})
+		require.Equal(t, []int{1, 2}, trackIDs(base, active))
+
+		active = tr.update(frame(1), []storage.Detection{
+			newTestDetection("person", ffmpeg.Rect{11, 11, 31, 31}),
+			newTestDetection("car", ffmpeg.Rect{10, 10, 30, 30}),
+			newTestDetection("car", ffmpeg.Rect{60, 60, 80, 80}),
+		})
+		require.Equal(t, []int{2, 1, 3}, trackIDs(base, active))
+	})
+	t.Run("lost", func(t *testing.T) {
+		tr := newTracker(0)
+		base := int(lastTrackID.Load())
+		car := newTestDetection("car", ffmpeg.Rect{10, 10, 30, 30})
+
+		active := tr.update(frame(0), []storage.Detection{car})
+		require.Equal(t, []int{1}, trackIDs(base, active))
+
+		for i := 1; i <= trackLostFrames; i++ {
+			require.Empty(t, tr.update(frame(i), nil))
+		}
+		active = tr.update(frame(trackLostFrames+1), []storage.Detection{car})
+		require.Equal(t, []int{1}, trackIDs(base, active))
+
+		for i := 1; i <= trackLostFrames+1; i++ {
+			require.Empty(t, tr.update(frame(trackLostFrames+1+i), nil))
+		}
+		active = tr.update(frame(trackLostFrames*2+3), []storage.Detection{car})
+		require.Equal(t, []int{2}, trackIDs(base, active))
+	})
+	t.Run("sleep", func(t *testing.T) {
+		tr := newTracker(time.Second)
+		base := int(lastTrackID.Load())
+		car := newTestDetection("car", ffmpeg.Rect{10, 10, 30, 30})
+
+		require.Len(t, tr.update(frame(0), []storage.Detection{car}), 1)
+		require.Len(t, tr.update(frame(1), []storage.Detection{car}), 0)
+
+		// Tracks are kept while the detector is sleeping.
+		wake := frame(1).Add(trackStaleTimeout)
+		require.Len(t, tr.update(wake, []storage.Detection{car}), 0)
+
+		// Stale tracks are removed.
+		wake = wake.Add(trackStaleTimeout + time.Second)
+		active := tr.update(wake, []storage.Detection{car})
+		require.Equal(t, []int{2}, trackIDs(base, active))
+	})
+	t.Run("stationary", func(t *testing.T) {
+		tr := newTracker(2 * time.Second)
+		base := int(lastTrackID.Load())
+		car := newTestDetection("car", ffmpeg.Rect{10, 10, 30, 30})
+		carMoved := newTestDetection("car", ffmpeg.Rect{16, 16, 36, 36})
+
+		require.Len(t, tr.update(frame(0), []storage.Detection{car}), 1)
+		require.Len(t, tr.update(frame(1), []storage.Detection{car}), 1)
+		require.Len(t, tr.update(frame(2), []storage.Detection{car}), 0)
+		require.Len(t, tr.update(frame(3), []storage.Detection{car}), 0)
+
+		// Small movements are ignored.
+		carJitter := newTestDetection("car", ffmpeg.Rect{11, 11, 31, 31})
+		require.Len(t, tr.update(frame(4), []storage.Detection{carJitter}), 0)
+
+		active := tr.update(frame(5), []storage.Detection{carMoved})
+		require.Equal(t, []int{1}, trackIDs(base, active))
+
+		// A new object is reported while the car is stationary.
+		person := newTestDetection("person", ffmpeg.Rect{50, 50, 90, 70})
+		active = tr.update(frame(8), []storage.Detection{carMoved, person})
+		require.Equal(t, []int{2}, trackIDs(base, active))
+	})
+	t.Run("uniqueIDs", func(t *testing.T) {
+		base := int(lastTrackID.Load())
+		car := newTestDetection("car", ffmpeg.Rect{10, 10, 30, 30})
+
+		active := newTracker(0).update(frame(0), []storage.Detection{car})
+		require.Equal(t, []int{1}, trackIDs(base, active))
+
+		// A restarted detector doesn't reuse track IDs.
+		active = newTracker(0).update(frame(1), []storage.Detection{car})
+		require.Equal(t, []int{2}, trackIDs(base, active))
+	})
+	t.Run("noRegion", func(t *testing.T) {
+		tr := newTracker(time.Second)
+		d := storage.Detection{Label: "x"}
+		require.Equal(t, []storage.Detection{d}, tr.update(frame(0), []storage.Detection{d}))
+		require.Equal(t, []storage.Detection{d}, tr.update(frame(5), []storage.Detection{d}))
+	})
+}
+
+func TestIntersectionOverUnion(t *testing.T) {
+	cases := map[string]struct {
+		a        ffmpeg.Rect
+		b        ffmpeg.Rect
+		expected float64
+	}{
+		"equal":    {ffmpeg.Rect{0, 0, 10, 10}, ffmpeg.Rect{0, 0, 10, 10}, 1},
+		"half":     {ffmpeg.Rect{0, 0, 10, 10}, ffmpeg.Rect{0, 0, 10, 5}, 0.5},
+		"disjoint": {ffmpeg.Rect{0, 0, 10, 10}, ffmpeg.Rect{20, 20, 30, 30}, 0},
+		"touching": {ffmpeg.Rect{0, 0, 10, 10}, ffmpeg.Rect{10, 0, 20, 10}, 0},
+		"empty":    {ffmpeg.Rect{0, 0, 0, 0}, ffmpeg.Rect{0, 0, 0, 0}, 0},
+		"overlap":  {ffmpeg.Rect{0, 0, 10, 10}, ffmpeg.Rect{5, 5, 15, 15}, 25.0 / 175},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.InDelta(t, tc.expected, intersectionOverUnion(tc.a, tc.b), 0.0001)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package motion
+
+import "nvr/pkg/ffmpeg"
+
+// Minimum pixel change counted by the illumination check, about 8%.
+const illuminationSensitivity = 20
+
+// Fraction of the changed pixels that must change in
+// the same direction for it to be a illumination change.
+const illuminationUniformity = 0.8
+
+// analyzer compares each frame to the previous frame or
+// to the zone backgrounds and reports the active zones.
+type analyzer struct {
+	zones  zones
+	width  int
+	height int
+
+	// Percent of changed pixels before the frame is ignored, 0 disables.
+	illuminationLimit float64
+	noiseFilter       bool
+
+	prevFrame []uint8
+	diff      []uint8
+	bgDiff    []uint8
+	filtered  []uint8
+
+	blobFinder *blobFinder
+}
+
+// onActiveFunc is called with the zone index, the percent of changed
+// pixels and the bounding boxes of the largest changed areas.
+type onActiveFunc func(zone int, score float64, regions []ffmpeg.Rect)
+
+func newAnalyzer(zones zones, width int, height int, c config) *analyzer {
+	frameSize := width * height
+	return &analyzer{
+		zones:             zones,
+		width:             width,
+		height:            height,
+		illuminationLimit: c.illuminationLimit,
+		noiseFilter:       c.noiseFilter,
+		diff:              make([]uint8, frameSize),
+		bgDiff:            make([]uint8, frameSize),
+		filtered:          make([]uint8, frameSize),
+		blobFinder:        newBlobFinder(width, height),
+	}
+}
+
+func (a *analyzer) analyze(frame []uint8, onActive onActiveFunc) {
+	if a.prevFrame == nil {
+		a.prevFrame = make([]uint8, len(frame))
+		copy(a.prevFrame, frame)
+		a.zones.resetBackground(frame)
+		return
+	}
+
+	diffFrames(frame, a.prevFrame, a.diff)
+	illuminationChange := a.illuminationLimit != 0 &&
+		isIlluminationChange(frame, a.prevFrame, a.illuminationLimit)
+	copy(a.prevFrame, frame)
+
+	// Clouds or auto exposure, start over with the new lighting.
+	if illuminationChange {
+		a.zones.resetBackground(frame)
+		return
+	}
+
+	if a.noiseFilter {
+		erode(a.diff, a.filtered, a.width, a.height)
+		a.diff, a.filtered = a.filtered, a.diff
+	}
+
+	for i, zone := range a.zones {
+		if zone == nil {
+			continue
+		}
+
+		diff := a.diff
+		if zone.background != nil {
+			zone.backgroundDiff(frame, a.bgDiff)
+			diff = a.bgDiff
+			if a.noiseFilter {
+				erode(a.bgDiff, a.filtered, a.width, a.height)
+				diff = a.filtered
+			}
+		}
+
+		score, isActive := zone.checkDiff(diff)
+		if !isActive {
+			continue
+		}
+
+		blobs := zone.filterBlobs(a.blobFinder.find(zone, diff))
+		if zone.hasBlobFilter() && len(blobs) == 0 {
+			continue
+		}
+
+		regions := make([]ffmpeg.Rect, 0, len(blobs))
+		for _, b := range blobs {
+			regions = append(regions, b.rect(a.width, a.height))
+		}
+		onActive(i, score, regions)
+	}
+}
+
+// isIlluminationChange returns true if more than limit percent
+// of the frame changed and most of the pixels changed in the
+// same direction, the whole image got brighter or darker.
+func isIlluminationChange(frame1, frame2 []uint8, limit float64) bool {
+	var brighter, darker int
+	for i := 0; i < len(frame1); i++ {
+		switch {
+		case frame1[i] >= frame2[i] && frame1[i]-frame2[i] >= illuminationSensitivity:
+			brighter++
+		case frame2[i] > frame1[i] && frame2[i]-frame1[i] >= illuminationSensitivity:
+			darker++
+		}
+	}
+
+	changed := brighter + darker
+	percentChanged := (float64(changed) / float64(len(frame1))) * 100
+	if percentChanged <= limit {
+		return false
+	}
+
+	dominant := brighter
+	if darker > dominant {
+		dominant = darker
+	}
+	return float64(dominant) >= float64(changed)*illuminationUniformity
+}
+
+// erode sets each pixel to the minimum of itself and its four
+// neighbors, isolated noise is removed while larger areas remain.
+func erode(src, dst []uint8, width, height int) {
+	for y := 0; y < height; y++ {
+		row := y * width
+		for x := 0; x < width; x++ {
+			i := row + x
+			v := src[i]
+			if x > 0 && src[i-1] < v {
+				v = src[i-1]
+			}
+			if x < width-1 && src[i+1] < v {
+				v = src[i+1]
+			}
+			if y > 0 && src[i-width] < v {
+				v = src[i-width]
+			}
+			if y < height-1 && src[i+width] < v {
+				v = src[i+width]
+			}
+			dst[i] = v
+		}
+	}
+}
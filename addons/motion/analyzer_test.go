@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package motion
+
+import (
+	"bytes"
+	"testing"
+
+	"nvr/pkg/ffmpeg"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzer(t *testing.T) {
+	fullArea := area{{0, 0}, {100, 0}, {100, 100}, {0, 100}}
+	newTestAnalyzer := func(zc zoneConfig, c config) (*analyzer, *[]float64) {
+		zc.Enable = true
+		zc.Sensitivity = 8
+		zc.ThresholdMin = 10
+		zc.ThresholdMax = 100
+		zc.Area = fullArea
+
+		zones := zones{newZone(4, 4, zc)}
+		scores := []float64{}
+		return newAnalyzer(zones, 4, 4, c), &scores
+	}
+	frame := func(v uint8) []uint8 {
+		return bytes.Repeat([]uint8{v}, 16)
+	}
+	// 2x2 object in the top left corner.
+	object := []uint8{
+		255, 255, 0, 0,
+		255, 255, 0, 0,
+		0, 0, 0, 0,
+		0, 0, 0, 0,
+	}
+
+	t.Run("diff", func(t *testing.T) {
+		a, scores := newTestAnalyzer(zoneConfig{}, config{})
+		onActive := func(_ int, score float64, _ []ffmpeg.Rect) { *scores = append(*scores, score) }
+
+		a.analyze(frame(0), onActive)
+		a.analyze(object, onActive)
+		// Stationary object.
+		a.analyze(object, onActive)
+		require.Equal(t, []float64{25}, *scores)
+	})
+	t.Run("background", func(t *testing.T) {
+		a, scores := newTestAnalyzer(zoneConfig{
+			Model:        modelBackground,
+			LearningRate: 50,
+		}, config{})
+		onActive := func(_ int, score float64, _ []ffmpeg.Rect) { *scores = append(*scores, score) }
+
+		a.analyze(frame(0), onActive)
+		a.analyze(object, onActive)
+		// The object is active until it becomes part of the background.
+		for i := 0; i < 5; i++ {
+			a.analyze(object, onActive)
+		}
+		require.Equal(t, []float64{25, 25, 25, 25}, *scores)
+	})
+	t.Run("illumination", func(t *testing.T) {
+		a, scores := newTestAnalyzer(zoneConfig{
+			Model:        modelBackground,
+			LearningRate: 1,
+		}, config{illuminationLimit: 80})
+		onActive := func(_ int, score float64, _ []ffmpeg.Rect) { *scores = append(*scores, score) }
+
+		a.analyze(frame(0), onActive)
+		// The whole image gets brighter.
+		a.analyze(frame(100), onActive)
+		a.analyze(frame(100), onActive)
+		require.Empty(t, *scores)
+	})
+	t.Run("noiseFilter", func(t *testing.T) {
+		noise := []uint8{
+			255, 0, 0, 0,
+			0, 0, 0, 255,
+			0, 255, 0, 0,
+			0, 0, 0, 0,
+		}
+		a, scores := newTestAnalyzer(zoneConfig{}, config{noiseFilter: true})
+		onActive := func(_ int, score float64, _ []ffmpeg.Rect) { *scores = append(*scores, score) }
+
+		a.analyze(frame(0), onActive)
+		a.analyze(noise, onActive)
+		require.Empty(t, *scores)
+
+		a, scores = newTestAnalyzer(zoneConfig{}, config{})
+		onActive = func(_ int, score float64, _ []ffmpeg.Rect) { *scores = append(*scores, score) }
+		a.analyze(frame(0), onActive)
+		a.analyze(noise, onActive)
+		require.Equal(t, []float64{18.75}, *scores)
+	})
+}
+
+func TestAnalyzerBlobs(t *testing.T) {
+	fullArea := area{{0, 0}, {100, 0}, {100, 100}, {0, 100}}
+	newTestZones := func(minBlobSize float64) zones {
+		return zones{newZone(4, 4, zoneConfig{
+			Enable:       true,
+			Sensitivity:  8,
+			ThresholdMin: 1,
+			ThresholdMax: 100,
+			Area:         fullArea,
+			MinBlobSize:  minBlobSize,
+		})}
+	}
+	frame := bytes.Repeat([]uint8{0}, 16)
+	// A 2x2 object and a single noise pixel.
+	object := []uint8{
+		255, 255, 0, 0,
+		255, 255, 0, 0,
+		0, 0, 0, 0,
+		0, 0, 0, 255,
+	}
+
+	t.Run("regions", func(t *testing.T) {
+		var regions []ffmpeg.Rect
+		onActive := func(_ int, _ float64, r []ffmpeg.Rect) { regions = r }
+
+		a := newAnalyzer(newTestZones(0), 4, 4, config{})
+		a.analyze(frame, onActive)
+		a.analyze(object, onActive)
+		expected := []ffmpeg.Rect{
+			{0, 0, 50, 50},
+			{75, 75, 100, 100},
+		}
+		require.Equal(t, expected, regions)
+	})
+	t.Run("minBlobSize", func(t *testing.T) {
+		var regions []ffmpeg.Rect
+		onActive := func(_ int, _ float64, r []ffmpeg.Rect) { regions = r }
+
+		a := newAnalyzer(newTestZones(10), 4, 4, config{})
+		a.analyze(frame, onActive)
+		a.analyze(object, onActive)
+		require.Equal(t, []ffmpeg.Rect{{0, 0, 50, 50}}, regions)
+	})
+	t.Run("onlyNoise", func(t *testing.T) {
+		noise := bytes.Repeat([]uint8{0}, 16)
+		noise[15] = 255
+
+		called := false
+		onActive := func(int, float64, []ffmpeg.Rect) { called = true }
+
+		a := newAnalyzer(newTestZones(10), 4, 4, config{})
+		a.analyze(frame, onActive)
+		a.analyze(noise, onActive)
+		require.False(t, called)
+	})
+}
+
+func TestIsIlluminationChange(t *testing.T) {
+	cases := map[string]struct {
+		frame1   []uint8
+		frame2   []uint8
+		expected bool
+	}{
+		"brighter":   {[]uint8{0, 0, 0, 0}, []uint8{50, 50, 50, 0}, true},
+		"darker":     {[]uint8{50, 50, 50, 50}, []uint8{0, 0, 0, 0}, true},
+		"belowLimit": {[]uint8{0, 0, 0, 0}, []uint8{50, 50, 0, 0}, false},
+		"mixed":      {[]uint8{0, 0, 50, 50}, []uint8{50, 50, 0, 0}, false},
+		"small":      {[]uint8{0, 0, 0, 0}, []uint8{10, 10, 10, 10}, false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, isIlluminationChange(tc.frame1, tc.frame2, 60))
+		})
+	}
+}
+
+func TestErode(t *testing.T) {
+	src := []uint8{
+		9, 0, 0,
+		0, 9, 9,
+		0, 9, 9,
+	}
+	dst := make([]uint8, 9)
+	erode(src, dst, 3, 3)
+	require.Equal(t, []uint8{
+		0, 0, 0,
+		0, 0, 0,
+		0, 0, 9,
+	}, dst)
+}
@@ -6,16 +6,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"nvr"
+	"nvr/pkg/activity"
 	"nvr/pkg/ffmpeg"
 	"nvr/pkg/log"
 	"nvr/pkg/monitor"
 	"nvr/pkg/storage"
 	"nvr/pkg/video/gortsplib/pkg/h264"
-	"os/exec"
 	"strconv"
-	"sync"
 	"time"
 )
 
@@ -78,9 +76,7 @@ func start(
 			return
 		}
 
-		ctx2, cancel := context.WithCancel(ctx)
-
-		if err := run(ctx2, cancel, i, config, logf); err != nil {
+		if err := run(ctx, i, config, logf); err != nil {
 			logf(log.LevelError, "%v", err)
 		}
 
@@ -94,7 +90,6 @@ func start(
 
 func run(
 	ctx context.Context,
-	cancel context.CancelFunc,
 	i *monitor.InputProcess,
 	config config,
 	logf log.Func,
@@ -118,57 +113,23 @@ func run(
 		return fmt.Errorf("create detector: %w", err)
 	}
 
-	args := generateFFmpegArgs(config, i.RTSPprotocol(), i.RTSPaddress())
-	cmd := exec.Command(i.Env.FFmpegBin, args...)
-
-	processLogFunc := func(msg string) {
-		logf(log.FFmpegLevel(config.logLevel), fmt.Sprintf("process: %v", msg))
-	}
-
-	process := ffmpeg.NewProcess(cmd).
-		StderrLogger(processLogFunc)
-
-	stdout, err := cmd.StdoutPipe()
+	frames, err := i.SubscribeFrames(ctx, monitor.FrameConfig{
+		Filter:    generateFilter(config),
+		PixFmt:    "gray",
+		FrameSize: d.frameSize,
+	})
 	if err != nil {
-		return fmt.Errorf("stdout: %w", err)
+		return fmt.Errorf("subscribe frames: %w", err)
 	}
 
-	logf(log.LevelInfo, "starting process: %v", cmd)
-
-	i.WG.Add(1)
-	go d.startFrameReader(cancel, i.WG, stdout)
-
-	err = process.Start(ctx)
-	if err != nil {
-		return fmt.Errorf("process crashed: %w", err)
-	}
+	logf(log.LevelInfo, "started")
+	d.runFrameReader(frames)
 	return nil
 }
 
-func generateFFmpegArgs(
-	c config,
-	rtspProtocol string,
-	rtspAddress string,
-) []string {
-	// Output.
-	//	ffmpeg -loglevel info -hwaccel x -y -rtsp_transport tcp -i rtsp://ip
-	//    -vf "fps=fps=3,scale=ih/2:iw/2" -f rawvideo -pix_fmt gray -
-
-	var args []string
-
-	args = append(args, "-y", "-threads", "1", "-loglevel", c.logLevel)
-
-	if c.hwaccel != "" {
-		args = append(args, ffmpeg.ParseArgs("-hwaccel "+c.hwaccel)...)
-	}
-
-	args = append(args, "-rtsp_transport", rtspProtocol, "-i", rtspAddress)
-
+func generateFilter(c config) string {
 	scale := strconv.Itoa(c.scale)
-	args = append(args, "-vf", "fps=fps="+c.feedRate+",scale=iw/"+scale+":ih/"+scale)
-	args = append(args, "-f", "rawvideo", "-pix_fmt", "gray", "-")
-
-	return args
+	return "fps=fps=" + c.feedRate + ",scale=iw/" + scale + ":ih/" + scale
 }
 
 type detector struct {
@@ -177,6 +138,8 @@ type detector struct {
 	config    config
 
 	frameSize int
+	width     int
+	height    int
 	zones     zones
 }
 
@@ -215,55 +178,45 @@ func newDetector(
 		config:    conf,
 
 		frameSize: width * height,
+		width:     width,
+		height:    height,
 		zones:     zones,
 	}, nil
 }
 
-func (d detector) startFrameReader(
-	cancel context.CancelFunc,
-	wg *sync.WaitGroup,
-	stdout io.Reader,
-) {
-	defer wg.Done()
-	err := d.runFrameReader(stdout)
-	if err != nil && !errors.Is(err, io.EOF) {
-		d.logf(log.LevelError, "frame reader: %v", err)
-	}
-	cancel()
-}
+func (d detector) runFrameReader(frames <-chan monitor.Frame) {
+	a := newAnalyzer(d.zones, d.width, d.height, d.config)
+	var frameTime time.Time
+
+	onActive := func(zone int, score float64, regions []ffmpeg.Rect) {
+		d.logf(log.LevelDebug, "detection: zone:%v score:%.2f regions:%v",
+			zone, score, len(regions))
+
+		detections := []storage.Detection{}
+		for _, rect := range regions {
+			rect := rect
+			detections = append(detections, storage.Detection{
+				Score:  score,
+				Region: &storage.Region{Rect: &rect},
+			})
+		}
+		if len(detections) == 0 {
+			detections = append(detections, storage.Detection{Score: score})
+		}
 
-func (d detector) runFrameReader(stdout io.Reader) error {
-	firstFrame := true
-	frameBuf := make([]uint8, d.frameSize)
-	prevFrameBuf := make([]uint8, d.frameSize)
-	diffBuf := make([]uint8, d.frameSize)
+		activity.Default.Report(d.config.monitorID)
 
-	onActive := func(zone int, score float64) {
-		d.logf(log.LevelDebug, "detection: zone:%v score:%.2f", zone, score)
-		t := time.Now().Add(-d.config.timestampOffset)
+		t := frameTime.Add(-d.config.timestampOffset)
 		d.sendEvent(storage.Event{ //nolint:errcheck
-			Detections: []storage.Detection{
-				{Score: score},
-			},
+			Detections:  detections,
 			Time:        t,
 			Duration:    d.config.duration,
 			RecDuration: d.config.recDuration,
 		})
 	}
 
-	for {
-		_, err := io.ReadFull(stdout, frameBuf)
-		if err != nil {
-			return fmt.Errorf("read frame: %w", err)
-		}
-
-		if firstFrame {
-			prevFrameBuf, frameBuf = frameBuf, prevFrameBuf
-			firstFrame = false
-			continue
-		}
-
-		d.zones.analyze(frameBuf, prevFrameBuf, diffBuf, onActive)
-		prevFrameBuf, frameBuf = frameBuf, prevFrameBuf
+	for frame := range frames {
+		frameTime = frame.Time
+		a.analyze(frame.Data, onActive)
 	}
 }
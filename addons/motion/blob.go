@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package motion
+
+import (
+	"nvr/pkg/ffmpeg"
+	"sort"
+)
+
+// Maximum number of blobs reported per zone, the largest are kept.
+const maxBlobs = 10
+
+// blob group of connected changed pixels.
+type blob struct {
+	minX int
+	minY int
+	maxX int
+	maxY int
+	area int
+}
+
+func (b blob) width() int  { return b.maxX - b.minX + 1 }
+func (b blob) height() int { return b.maxY - b.minY + 1 }
+
+// add adds the pixel and extends the bounding box.
+func (b *blob) add(x int, y int) {
+	b.area++
+	if x < b.minX {
+		b.minX = x
+	}
+	if y < b.minY {
+		b.minY = y
+	}
+	if x > b.maxX {
+		b.maxX = x
+	}
+	if y > b.maxY {
+		b.maxY = y
+	}
+}
+
+// rect returns the bounding box in percent of the frame.
+func (b blob) rect(width int, height int) ffmpeg.Rect {
+	return ffmpeg.Rect{
+		b.minY * 100 / height,
+		b.minX * 100 / width,
+		(b.maxY + 1) * 100 / height,
+		(b.maxX + 1) * 100 / width,
+	}
+}
+
+// blobFinder reuses the buffers between frames.
+type blobFinder struct {
+	width   int
+	height  int
+	visited []bool
+	stack   []int
+}
+
+func newBlobFinder(width int, height int) *blobFinder {
+	return &blobFinder{
+		width:   width,
+		height:  height,
+		visited: make([]bool, width*height),
+	}
+}
+
+// find returns the 8-connected groups of pixels inside
+// the zone where the difference is above the sensitivity.
+func (f *blobFinder) find(z *zone, diff []uint8) []blob {
+	for i := range f.visited {
+		f.visited[i] = false
+	}
+
+	isChanged := func(i int) bool {
+		return !f.visited[i] && z.inside[i] && diff[i] >= z.sensitivity
+	}
+
+	var blobs []blob
+	for start := range diff {
+		if !isChanged(start) {
+			continue
+		}
+
+		b := blob{
+			minX: f.width,
+			minY: f.height,
+		}
+		f.visited[start] = true
+		f.stack = append(f.stack[:0], start)
+		for len(f.stack) != 0 {
+			i := f.stack[len(f.stack)-1]
+			f.stack = f.stack[:len(f.stack)-1]
+
+			x := i % f.width
+			y := i / f.width
+			b.add(x, y)
+
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx := x + dx
+					ny := y + dy
+					if nx < 0 || ny < 0 || nx >= f.width || ny >= f.height {
+						continue
+					}
+					n := ny*f.width + nx
+					if isChanged(n) {
+						f.visited[n] = true
+						f.stack = append(f.stack, n)
+					}
+				}
+			}
+		}
+		blobs = append(blobs, b)
+	}
+	return blobs
+}
+
+// filterBlobs returns the blobs within the size and aspect
+// ratio limits of the zone, sorted by size, largest first.
+func (z *zone) filterBlobs(blobs []blob) []blob {
+	var filtered []blob
+	for _, b := range blobs {
+		size := float64(b.area) / float64(z.frameSize) * 100
+		if size < z.minBlobSize {
+			continue
+		}
+		if z.maxBlobSize != 0 && size > z.maxBlobSize {
+			continue
+		}
+
+		aspect := float64(b.width()) / float64(b.height())
+		if aspect < z.minBlobAspect {
+			continue
+		}
+		if z.maxBlobAspect != 0 && aspect > z.maxBlobAspect {
+			continue
+		}
+		filtered = append(filtered, b)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].area > filtered[j].area
+	})
+	if len(filtered) > maxBlobs {
+		filtered = filtered[:maxBlobs]
+	}
+	return filtered
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package motion
+
+import (
+	"testing"
+
+	"nvr/pkg/ffmpeg"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindBlobs(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		z := newZone(5, 4, zoneConfig{
+			Sensitivity: 8,
+			Area:        area{{0, 0}, {100, 0}, {100, 100}, {0, 100}},
+		})
+		diff := []uint8{
+			255, 0, 0, 0, 0,
+			0, 255, 0, 0, 255,
+			0, 0, 0, 0, 255,
+			0, 0, 0, 255, 255,
+		}
+		blobs := newBlobFinder(5, 4).find(z, diff)
+		expected := []blob{
+			// Diagonal pixels are connected.
+			{minX: 0, minY: 0, maxX: 1, maxY: 1, area: 2},
+			{minX: 3, minY: 1, maxX: 4, maxY: 3, area: 4},
+		}
+		require.Equal(t, expected, blobs)
+	})
+	t.Run("outsideZone", func(t *testing.T) {
+		z := newZone(4, 2, zoneConfig{
+			Sensitivity: 8,
+			Area:        area{{0, 0}, {50, 0}, {50, 100}, {0, 100}},
+		})
+		diff := []uint8{
+			255, 255, 255, 255,
+			0, 0, 0, 255,
+		}
+		blobs := newBlobFinder(4, 2).find(z, diff)
+		require.Equal(t, []blob{{minX: 0, minY: 0, maxX: 1, maxY: 0, area: 2}}, blobs)
+	})
+}
+
+func TestFilterBlobs(t *testing.T) {
+	small := blob{maxX: 0, maxY: 0, area: 1}
+	wide := blob{maxX: 9, maxY: 1, area: 20}
+	tall := blob{maxX: 1, maxY: 9, area: 20}
+	large := blob{maxX: 9, maxY: 9, area: 100}
+	blobs := []blob{small, wide, tall, large}
+
+	cases := map[string]struct {
+		config   zoneConfig
+		expected []blob
+	}{
+		"noLimits":  {zoneConfig{}, []blob{large, wide, tall, small}},
+		"minSize":   {zoneConfig{MinBlobSize: 1}, []blob{large, wide, tall}},
+		"maxSize":   {zoneConfig{MaxBlobSize: 4}, []blob{wide, tall, small}},
+		"minAspect": {zoneConfig{MinBlobAspect: 2}, []blob{wide}},
+		"maxAspect": {zoneConfig{MaxBlobAspect: 0.5}, []blob{tall}},
+		"none":      {zoneConfig{MinBlobSize: 50}, nil},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.config.Area = area{{0, 0}, {100, 0}, {100, 100}, {0, 100}}
+			z := newZone(40, 50, tc.config)
+			require.Equal(t, tc.expected, z.filterBlobs(blobs))
+		})
+	}
+	t.Run("maxBlobs", func(t *testing.T) {
+		z := newZone(40, 50, zoneConfig{})
+		many := make([]blob, maxBlobs+5)
+		require.Len(t, z.filterBlobs(many), maxBlobs)
+	})
+}
+
+func TestBlobRect(t *testing.T) {
+	b := blob{minX: 1, minY: 2, maxX: 4, maxY: 4}
+	require.Equal(t, ffmpeg.Rect{20, 10, 50, 50}, b.rect(10, 10))
+}
@@ -2,6 +2,7 @@ package motion
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"nvr/pkg/ffmpeg"
 	"nvr/pkg/monitor"
@@ -12,14 +13,17 @@ import (
 
 type config struct {
 	monitorID       string
-	logLevel        string
-	hwaccel         string
 	timestampOffset time.Duration
 	feedRate        string
 	duration        time.Duration
 	scale           int
 	recDuration     time.Duration
 	zones           []zoneConfig
+
+	// Percent of changed pixels before a frame is
+	// treated as a illumination change, 0 disables.
+	illuminationLimit float64
+	noiseFilter       bool
 }
 
 type rawConfigV0 struct {
@@ -28,8 +32,25 @@ type rawConfigV0 struct {
 	FrameScale string `json:"frameScale"`
 	Duration   string `json:"duration"`
 	Zones      []zoneConfig
+
+	IlluminationLimit string `json:"illuminationLimit"`
+	NoiseFilter       string `json:"noiseFilter"`
 }
 
+// Zone detection models.
+const (
+	modelDiff       = "diff"
+	modelBackground = "background"
+)
+
+// Config errors.
+var (
+	ErrInvalidModel        = errors.New("invalid model")
+	ErrInvalidLearningRate = errors.New("learning rate must be between 0 and 100")
+	ErrInvalidIllumination = errors.New("illumination limit must be between 0 and 100")
+	ErrInvalidBlobLimits   = errors.New("invalid blob limits")
+)
+
 func parseConfig(c monitor.Config) (*config, bool, error) {
 	motion := c.Get("motion")
 	if motion == "" {
@@ -66,19 +87,60 @@ func parseConfig(c monitor.Config) (*config, bool, error) {
 	}
 	recDuration := time.Duration(durationInt) * time.Second
 
+	var illuminationLimit float64
+	if rawConf.IlluminationLimit != "" {
+		illuminationLimit, err = strconv.ParseFloat(rawConf.IlluminationLimit, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("parse illumination limit: %w", err)
+		}
+		if illuminationLimit < 0 || illuminationLimit > 100 {
+			return nil, false, fmt.Errorf("%w: %v", ErrInvalidIllumination, illuminationLimit)
+		}
+	}
+
+	for i, zone := range rawConf.Zones {
+		switch zone.Model {
+		case "", modelDiff:
+		case modelBackground:
+			if zone.LearningRate <= 0 || zone.LearningRate > 100 {
+				return nil, false, fmt.Errorf("zone %d: %w: %v",
+					i, ErrInvalidLearningRate, zone.LearningRate)
+			}
+		default:
+			return nil, false, fmt.Errorf("zone %d: %w: %v", i, ErrInvalidModel, zone.Model)
+		}
+		if err := validateBlobLimits(zone); err != nil {
+			return nil, false, fmt.Errorf("zone %d: %w", i, err)
+		}
+	}
+
 	return &config{
 		monitorID:       c.ID(),
-		logLevel:        c.LogLevel(),
-		hwaccel:         c.Hwaccel(),
 		timestampOffset: timestampOffset,
 		feedRate:        rawConf.FeedRate,
 		duration:        duration,
 		scale:           scale,
 		recDuration:     recDuration,
 		zones:           rawConf.Zones,
+
+		illuminationLimit: illuminationLimit,
+		noiseFilter:       rawConf.NoiseFilter == "true",
 	}, enable, nil
 }
 
+func validateBlobLimits(z zoneConfig) error {
+	if z.MinBlobSize < 0 || z.MaxBlobSize < 0 || z.MinBlobAspect < 0 || z.MaxBlobAspect < 0 {
+		return fmt.Errorf("%w: negative value", ErrInvalidBlobLimits)
+	}
+	if z.MaxBlobSize != 0 && z.MinBlobSize > z.MaxBlobSize {
+		return fmt.Errorf("%w: min size is larger than max size", ErrInvalidBlobLimits)
+	}
+	if z.MaxBlobAspect != 0 && z.MinBlobAspect > z.MaxBlobAspect {
+		return fmt.Errorf("%w: min aspect is larger than max aspect", ErrInvalidBlobLimits)
+	}
+	return nil
+}
+
 func parseTimestampOffset(rawOffset string) (time.Duration, error) {
 	if rawOffset == "" {
 		return 0, nil
@@ -117,4 +179,19 @@ type zoneConfig struct {
 	ThresholdMin float64 `json:"thresholdMin"`
 	ThresholdMax float64 `json:"thresholdMax"`
 	Area         area    `json:"area"`
+
+	// "diff" compares each frame to the previous frame,
+	// "background" compares to a running average of the frames.
+	Model string `json:"model,omitempty"`
+
+	// Percent the background moves towards each frame.
+	LearningRate float64 `json:"learningRate,omitempty"`
+
+	// Blob size in percent of the frame.
+	MinBlobSize float64 `json:"minBlobSize,omitempty"`
+	MaxBlobSize float64 `json:"maxBlobSize,omitempty"`
+
+	// Blob width divided by height.
+	MinBlobAspect float64 `json:"minBlobAspect,omitempty"`
+	MaxBlobAspect float64 `json:"maxBlobAspect,omitempty"`
 }
@@ -20,13 +20,21 @@ func TestParseConfig(t *testing.T) {
 			"feedRate":   "5",
 			"frameScale": "full",
 			"duration":   "6",
+			"illuminationLimit": "16",
+			"noiseFilter": "true",
 			"zones":[
 				{
 					"enable": true,
 					"sensitivity": 7,
 					"thresholdMin": 8,
 					"thresholdMax": 9,
-					"area":[[10,11],[12,13],[14,15]]
+					"area":[[10,11],[12,13],[14,15]],
+					"model": "background",
+					"learningRate": 17,
+					"minBlobSize": 1,
+					"maxBlobSize": 50,
+					"minBlobAspect": 0.2,
+					"maxBlobAspect": 5
 				}
 			]
 		}`
@@ -44,20 +52,26 @@ func TestParseConfig(t *testing.T) {
 
 		expected := config{
 			monitorID:       "1",
-			logLevel:        "2",
-			hwaccel:         "3",
 			timestampOffset: 4000000,
 			feedRate:        "5",
 			duration:        200 * time.Millisecond,
 			recDuration:     6 * time.Second,
 			scale:           1,
 			zones: []zoneConfig{{
-				Enable:       true,
-				Sensitivity:  7,
-				ThresholdMin: 8,
-				ThresholdMax: 9,
-				Area:         []ffmpeg.Point{{10, 11}, {12, 13}, {14, 15}},
+				Enable:        true,
+				Sensitivity:   7,
+				ThresholdMin:  8,
+				ThresholdMax:  9,
+				Area:          []ffmpeg.Point{{10, 11}, {12, 13}, {14, 15}},
+				Model:         "background",
+				LearningRate:  17,
+				MinBlobSize:   1,
+				MaxBlobSize:   50,
+				MinBlobAspect: 0.2,
+				MaxBlobAspect: 5,
 			}},
+			illuminationLimit: 16,
+			noiseFilter:       true,
 		}
 		require.Equal(t, expected, *actual)
 	})
@@ -97,6 +111,34 @@ func TestParseConfig(t *testing.T) {
 		"durationErr": {
 			"motion": `{"enable": "true", "feedRate":"0", "duration":"nil"}`,
 		},
+		"illuminationLimitErr": {
+			"motion": `{"enable": "true", "feedRate":"0", "duration":"0",
+				"illuminationLimit":"nil"}`,
+		},
+		"illuminationLimitRangeErr": {
+			"motion": `{"enable": "true", "feedRate":"0", "duration":"0",
+				"illuminationLimit":"101"}`,
+		},
+		"modelErr": {
+			"motion": `{"enable": "true", "feedRate":"0", "duration":"0",
+				"zones":[{"model":"nil"}]}`,
+		},
+		"learningRateErr": {
+			"motion": `{"enable": "true", "feedRate":"0", "duration":"0",
+				"zones":[{"model":"background"}]}`,
+		},
+		"blobNegativeErr": {
+			"motion": `{"enable": "true", "feedRate":"0", "duration":"0",
+				"zones":[{"minBlobSize":-1}]}`,
+		},
+		"blobSizeErr": {
+			"motion": `{"enable": "true", "feedRate":"0", "duration":"0",
+				"zones":[{"minBlobSize":2, "maxBlobSize":1}]}`,
+		},
+		"blobAspectErr": {
+			"motion": `{"enable": "true", "feedRate":"0", "duration":"0",
+				"zones":[{"minBlobAspect":2, "maxBlobAspect":1}]}`,
+		},
 	}
 	for name, conf := range cases {
 		t.Run(name, func(t *testing.T) {
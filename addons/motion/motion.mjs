@@ -20,6 +20,8 @@ function _motion(hls) {
 			"full"
 		),
 		duration: fieldTemplate.integer("Trigger duration (sec)", "", "120"),
+		illuminationLimit: fieldTemplate.integer("Illumination limit (%)", "", "0"),
+		noiseFilter: fieldTemplate.toggle("Noise filter", "false"),
 		zones: zones(hls),
 	};
 
@@ -112,6 +114,12 @@ function zones(hls) {
 		$sensitivity,
 		$thresholdMin,
 		$thresholdMax,
+		$model,
+		$learningRate,
+		$minBlobSize,
+		$maxBlobSize,
+		$minBlobAspect,
+		$maxBlobAspect,
 		$preview,
 		$feed,
 		$feedOverlay,
@@ -176,6 +184,66 @@ function zones(hls) {
 					/>
 				</div>
 			</li>
+			<li class="form-field">
+				<label class="form-field-label" for="motion-modal-model">Model</label>
+				<div class="form-field-select-container">
+					<select id="motion-modal-model" class="js-model form-field-select">
+						<option>diff</option>
+						<option>background</option>
+					</select>
+				</div>
+			</li>
+			<li class="form-field">
+				<label for="motion-modal-learning-rate" class="form-field-label"
+					>Learning rate</label
+				>
+				<input
+					id="motion-modal-learning-rate"
+					class="js-learning-rate settings-input-text"
+					type="number"
+					min="0"
+					max="100"
+					step="any"
+				/>
+			</li>
+			<li class="form-field">
+				<label class="form-field-label">Object size Min-Max (%)</label>
+				<div style="display: flex; width: 100%;">
+					<input
+						class="js-min-blob-size settings-input-text"
+						style="margin-right: 1rem;"
+						type="number"
+						min="0"
+						max="100"
+						step="any"
+					/>
+					<input
+						class="js-max-blob-size settings-input-text"
+						type="number"
+						min="0"
+						max="100"
+						step="any"
+					/>
+				</div>
+			</li>
+			<li class="form-field">
+				<label class="form-field-label">Aspect ratio Min-Max</label>
+				<div style="display: flex; width: 100%;">
+					<input
+						class="js-min-blob-aspect settings-input-text"
+						style="margin-right: 1rem;"
+						type="number"
+						min="0"
+						step="any"
+					/>
+					<input
+						class="js-max-blob-aspect settings-input-text"
+						type="number"
+						min="0"
+						step="any"
+					/>
+				</div>
+			</li>
 			<li class="form-field">
 				<label class="form-field-label" for="modal-preview">Preview</label>
 				<div class="form-field-select-container">
@@ -224,6 +292,36 @@ function zones(hls) {
 			}
 		});
 
+		$model = $modalContent.querySelector(".js-model");
+		$model.addEventListener("change", () => {
+			selectedZone.model = $model.value;
+			if (!selectedZone.learningRate) {
+				selectedZone.learningRate = Number.parseFloat($learningRate.value);
+			}
+		});
+		$learningRate = $modalContent.querySelector(".js-learning-rate");
+		$learningRate.addEventListener("change", () => {
+			const learningRate = Number.parseFloat($learningRate.value);
+			if (learningRate > 0 && learningRate <= 100) {
+				selectedZone.learningRate = learningRate;
+			}
+		});
+
+		const blobInput = (className, key) => {
+			const $input = $modalContent.querySelector(className);
+			$input.addEventListener("change", () => {
+				const value = Number.parseFloat($input.value);
+				if (value >= 0) {
+					selectedZone[key] = value;
+				}
+			});
+			return $input;
+		};
+		$minBlobSize = blobInput(".js-min-blob-size", "minBlobSize");
+		$maxBlobSize = blobInput(".js-max-blob-size", "maxBlobSize");
+		$minBlobAspect = blobInput(".js-min-blob-aspect", "minBlobAspect");
+		$maxBlobAspect = blobInput(".js-max-blob-aspect", "maxBlobAspect");
+
 		$preview = $modalContent.querySelector(".js-preview");
 		$preview.addEventListener("change", () => {
 			selectedZone.preview = $preview.value === "true";
@@ -273,6 +371,12 @@ function zones(hls) {
 		$sensitivity.value = selectedZone.sensitivity.toString();
 		$thresholdMin.value = selectedZone.thresholdMin.toString();
 		$thresholdMax.value = selectedZone.thresholdMax.toString();
+		$model.value = selectedZone.model || "diff";
+		$learningRate.value = (selectedZone.learningRate || 5).toString();
+		$minBlobSize.value = (selectedZone.minBlobSize || 0).toString();
+		$maxBlobSize.value = (selectedZone.maxBlobSize || 0).toString();
+		$minBlobAspect.value = (selectedZone.minBlobAspect || 0).toString();
+		$maxBlobAspect.value = (selectedZone.maxBlobAspect || 0).toString();
 		$preview.value = selectedZone.preview.toString();
 
 		renderPoints(selectedZone);
@@ -398,6 +502,8 @@ function zones(hls) {
 			sensitivity: 8,
 			thresholdMin: 10,
 			thresholdMax: 100,
+			model: "diff",
+			learningRate: 5,
 			area: [
 				[50, 15],
 				[85, 15],
@@ -8,16 +8,10 @@ import (
 
 type zones []*zone
 
-func (z zones) analyze(frame1, frame2, diff []uint8, onActive func(int, float64)) {
-	diffFrames(frame1, frame2, diff)
-	for i, zone := range z {
-		if zone == nil {
-			continue
-		}
-		score, isActive := zone.checkDiff(diff)
-		// score, active := zone.compareFrames(frame1, frame2)
-		if isActive {
-			onActive(i, score)
+func (z zones) resetBackground(frame []uint8) {
+	for _, zone := range z {
+		if zone != nil && zone.background != nil {
+			zone.resetBackground(frame)
 		}
 	}
 }
@@ -34,12 +28,26 @@ type zone struct {
 	// Odd indexes are n unmasked pixels in a row.
 	maskIndex []int
 
+	// True for pixels inside the zone.
+	inside []bool
+
 	zoneSize  int
 	frameSize int
 
 	sensitivity  uint8
 	thresholdMin float64
 	thresholdMax float64
+
+	// Running average of the frames, nil if the zone
+	// compares each frame to the previous frame.
+	background   []float32
+	learningRate float32
+
+	// Blob limits, zero disables the limit.
+	minBlobSize   float64
+	maxBlobSize   float64
+	minBlobAspect float64
+	maxBlobAspect float64
 }
 
 func newZone(width int, height int, config zoneConfig) *zone {
@@ -65,17 +73,74 @@ func newZone(width int, height int, config zoneConfig) *zone {
 		}
 	}
 
-	return &zone{
-		maskIndex:    index,
-		zoneSize:     zoneSize,
-		frameSize:    width * height,
-		sensitivity:  uint8(math.Round(config.Sensitivity * 2.56)),
-		thresholdMin: config.ThresholdMin,
-		thresholdMax: config.ThresholdMax,
+	inside := make([]bool, len(mask))
+	for i, maskPixel := range mask {
+		inside[i] = !maskPixel
+	}
+
+	z := &zone{
+		maskIndex:     index,
+		inside:        inside,
+		zoneSize:      zoneSize,
+		frameSize:     width * height,
+		sensitivity:   uint8(math.Round(config.Sensitivity * 2.56)),
+		thresholdMin:  config.ThresholdMin,
+		thresholdMax:  config.ThresholdMax,
+		minBlobSize:   config.MinBlobSize,
+		maxBlobSize:   config.MaxBlobSize,
+		minBlobAspect: config.MinBlobAspect,
+		maxBlobAspect: config.MaxBlobAspect,
+	}
+	if config.Model == modelBackground {
+		z.background = make([]float32, width*height)
+		z.learningRate = float32(config.LearningRate / 100)
+	}
+	return z
+}
+
+// hasBlobFilter returns true if any blob limit is set, the
+// zone is only active if at least one blob is within the limits.
+func (z *zone) hasBlobFilter() bool {
+	return z.minBlobSize != 0 || z.maxBlobSize != 0 ||
+		z.minBlobAspect != 0 || z.maxBlobAspect != 0
+}
+
+func (z *zone) resetBackground(frame []uint8) {
+	for i, v := range frame {
+		z.background[i] = float32(v)
+	}
+}
+
+// backgroundDiff writes the difference between the frame and the
+// background to diff and moves the background towards the frame.
+// Pixels outside the zone are set to zero.
+func (z *zone) backgroundDiff(frame []uint8, diff []uint8) {
+	var pos int
+	var check bool
+	for _, index := range z.maskIndex {
+		if check {
+			for i := 0; i < index; i++ {
+				bg := z.background[pos]
+				delta := float32(frame[pos]) - bg
+				if delta < 0 {
+					diff[pos] = uint8(-delta)
+				} else {
+					diff[pos] = uint8(delta)
+				}
+				z.background[pos] = bg + delta*z.learningRate
+				pos++
+			}
+		} else {
+			for i := 0; i < index; i++ {
+				diff[pos] = 0
+				pos++
+			}
+		}
+		check = !check
 	}
 }
 
-func (z zone) checkDiff(diff []uint8) (float64, bool) {
+func (z *zone) checkDiff(diff []uint8) (float64, bool) {
 	var nChangedPixels int
 	var pos int
 	var check bool
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"testing"
 
+	"nvr/pkg/ffmpeg"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -128,13 +130,42 @@ func TestCompareFrames(t *testing.T) {
 	}
 }
 
+func TestBackgroundDiff(t *testing.T) {
+	z := newZone(2, 2, zoneConfig{
+		Sensitivity:  8,
+		ThresholdMax: 100,
+		Area:         area{{0, 0}, {50, 0}, {50, 100}, {0, 100}},
+		Model:        modelBackground,
+		LearningRate: 50,
+	})
+	z.resetBackground([]uint8{
+		100, 100,
+		100, 100,
+	})
+
+	diff := make([]uint8, 4)
+	z.backgroundDiff([]uint8{
+		200, 200,
+		0, 0,
+	}, diff)
+	require.Equal(t, []uint8{
+		100, 0,
+		100, 0,
+	}, diff)
+
+	// Only pixels inside the zone are learned.
+	require.Equal(t, []float32{
+		150, 100,
+		50, 100,
+	}, z.background)
+}
+
 func BenchmarkDetector(b *testing.B) {
 	width := 500
 	height := 500
 	frameSize := width * height
 	frame1 := bytes.Repeat([]byte{0}, frameSize)
 	frame2 := bytes.Repeat([]byte{255}, frameSize)
-	diff := make([]byte, frameSize)
 
 	newTestZone := func(area area) *zone {
 		return newZone(
@@ -159,15 +190,22 @@ func BenchmarkDetector(b *testing.B) {
 		newTestZone(area{{50, 25}, {75, 50}, {50, 75}, {25, 50}}),
 	}
 
+	a := newAnalyzer(zones, width, height, config{})
+	a.analyze(frame1, nil)
+
 	var zone int
 	var score float64
 	var active bool
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		onActive := func(zone int, s float64) {
+		onActive := func(zone int, s float64, _ []ffmpeg.Rect) {
 			score = s
 		}
-		zones.analyze(frame1, frame2, diff, onActive)
+		if i%2 == 0 {
+			a.analyze(frame2, onActive)
+		} else {
+			a.analyze(frame1, onActive)
+		}
 	}
 	_, _, _ = zone, score, active
 }
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package mqtt
+
+import (
+	"encoding/json"
+	"nvr/pkg/log"
+	"strings"
+)
+
+// discoveryDevice groups the entities of a monitor in Home Assistant.
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// discoveryConfig is a Home Assistant MQTT discovery payload.
+// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	Device            discoveryDevice `json:"device"`
+	AvailabilityTopic string          `json:"availability_topic"`
+
+	DeviceClass         string `json:"device_class,omitempty"`
+	StateTopic          string `json:"state_topic,omitempty"`
+	CommandTopic        string `json:"command_topic,omitempty"`
+	ValueTemplate       string `json:"value_template,omitempty"`
+	JSONAttributesTopic string `json:"json_attributes_topic,omitempty"`
+	PayloadOn           string `json:"payload_on,omitempty"`
+	PayloadOff          string `json:"payload_off,omitempty"`
+	OffDelay            int    `json:"off_delay,omitempty"`
+	Icon                string `json:"icon,omitempty"`
+}
+
+// Seconds the detection sensor stays on after an event.
+const detectionOffDelay = 10
+
+// discoveryMessages returns the discovery payloads by topic.
+func (b *bridge) discoveryMessages(monitorID string, name string) map[string]discoveryConfig {
+	nodeID := sanitizeID(b.config.TopicPrefix + "_" + monitorID)
+	if name == "" {
+		name = monitorID
+	}
+	device := discoveryDevice{
+		Identifiers:  []string{nodeID},
+		Name:         name,
+		Manufacturer: "nvr",
+		Model:        "Monitor",
+	}
+	availability := b.topic("", "status")
+
+	entity := func(objectID string, entityName string) discoveryConfig {
+		return discoveryConfig{
+			Name:              name + " " + entityName,
+			UniqueID:          nodeID + "_" + objectID,
+			Device:            device,
+			AvailabilityTopic: availability,
+		}
+	}
+	topic := func(component string, objectID string) string {
+		return b.config.DiscoveryPrefix + "/" + component + "/" + nodeID + "/" + objectID + "/config"
+	}
+
+	detection := entity("detection", "detection")
+	detection.DeviceClass = "motion"
+	detection.StateTopic = b.topic(monitorID, "event")
+	detection.ValueTemplate = "ON"
+	detection.JSONAttributesTopic = b.topic(monitorID, "event")
+	detection.OffDelay = detectionOffDelay
+
+	recording := entity("recording", "recording")
+	recording.StateTopic = b.topic(monitorID, "recording")
+	recording.Icon = "mdi:record-rec"
+
+	connectivity := entity("state", "state")
+	connectivity.DeviceClass = "connectivity"
+	connectivity.StateTopic = b.topic(monitorID, "state")
+	connectivity.PayloadOn = payloadOnline
+	connectivity.PayloadOff = payloadOffline
+
+	publishEvents := entity("publish_events", "publish events")
+	publishEvents.StateTopic = b.topic(monitorID, "publish_events")
+	publishEvents.CommandTopic = b.topic(monitorID, "publish_events/set")
+	publishEvents.Icon = "mdi:publish"
+
+	restart := entity("restart", "restart")
+	restart.DeviceClass = "restart"
+	restart.CommandTopic = b.topic(monitorID, "restart")
+
+	return map[string]discoveryConfig{
+		topic("binary_sensor", "detection"): detection,
+		topic("binary_sensor", "recording"): recording,
+		topic("binary_sensor", "state"):     connectivity,
+		topic("switch", "publish_events"):   publishEvents,
+		topic("button", "restart"):          restart,
+	}
+}
+
+func (b *bridge) publishDiscovery(monitorID string, name string) {
+	if b.config.DiscoveryPrefix == "" {
+		return
+	}
+	for topic, config := range b.discoveryMessages(monitorID, name) {
+		payload, err := json.Marshal(config)
+		if err != nil {
+			b.logf(log.LevelError, "marshal discovery: %v", err)
+			continue
+		}
+		b.publish(topic, payload, true)
+	}
+}
+
+// sanitizeID replaces characters that aren't allowed in discovery IDs.
+func sanitizeID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, id)
+}
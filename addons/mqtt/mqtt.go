@@ -0,0 +1,472 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/mqtt"
+	"nvr/pkg/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var addon struct {
+	bridge *bridge
+}
+
+func init() {
+	nvr.RegisterLogSource([]string{"mqtt"})
+	nvr.RegisterAppRunHook(func(ctx context.Context, app *nvr.App) error {
+		configPath := filepath.Join(app.Env.ConfigDir, "mqtt.json")
+		config, err := readConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("mqtt: config: %w: %v", err, configPath)
+		}
+
+		logf := func(level log.Level, format string, a ...interface{}) {
+			app.Logger.Log(log.Entry{
+				Level: level,
+				Src:   "mqtt",
+				Msg:   fmt.Sprintf(format, a...),
+			})
+		}
+		publishEventsPath := filepath.Join(app.Env.ConfigDir, "mqtt_publish_events.json")
+		addon.bridge, err = newBridge(*config, app.MonitorManager, logf, publishEventsPath)
+		if err != nil {
+			return fmt.Errorf("mqtt: %w", err)
+		}
+
+		app.WG.Add(1)
+		go func() {
+			addon.bridge.run(ctx)
+			app.WG.Done()
+		}()
+		return nil
+	})
+	nvr.RegisterMonitorStartHook(func(ctx context.Context, m *monitor.Monitor) {
+		if addon.bridge != nil {
+			addon.bridge.onMonitorStart(ctx, m.Config)
+		}
+	})
+	nvr.RegisterMonitorEventHook(func(r *monitor.Recorder, event *storage.Event) {
+		if addon.bridge != nil {
+			addon.bridge.onEvent(r.Config.ID(), *event)
+		}
+	})
+	nvr.RegisterMonitorRecStartHook(func(r *monitor.Recorder, _ string) {
+		if addon.bridge != nil {
+			addon.bridge.onRecStart(r.Config.ID())
+		}
+	})
+	nvr.RegisterMonitorRecFailedHook(func(r *monitor.Recorder, _ error) {
+		if addon.bridge != nil {
+			addon.bridge.onRecFailed(r.Config.ID())
+		}
+	})
+	nvr.RegisterMonitorRecSavedHook(
+		func(r *monitor.Recorder, recPath string, data storage.RecordingData) {
+			if addon.bridge != nil {
+				addon.bridge.onRecSaved(r.Config.ID(), recPath, data)
+			}
+		},
+	)
+}
+
+// Config global mqtt configuration.
+type Config struct {
+	Address  string `json:"address"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ClientID string `json:"clientId"`
+
+	// Topics are prefixed with "<topicPrefix>/".
+	TopicPrefix string `json:"topicPrefix"`
+
+	// Home Assistant discovery prefix, empty disables discovery.
+	DiscoveryPrefix string `json:"discoveryPrefix"`
+}
+
+var defaultConfig = Config{
+	Address:         "127.0.0.1:1883",
+	ClientID:        "nvr",
+	TopicPrefix:     "nvr",
+	DiscoveryPrefix: "homeassistant",
+}
+
+// ErrInvalidConfig invalid config.
+var ErrInvalidConfig = errors.New("invalid config")
+
+func readConfig(configPath string) (*Config, error) {
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		data, _ := json.MarshalIndent(defaultConfig, "", "    ")
+		if err := os.WriteFile(configPath, data, 0o600); err != nil {
+			return nil, fmt.Errorf("generate config: %w", err)
+		}
+	}
+
+	file, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(file, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("%w: address missing", ErrInvalidConfig)
+	}
+	if config.TopicPrefix == "" {
+		return nil, fmt.Errorf("%w: topicPrefix missing", ErrInvalidConfig)
+	}
+	if config.Password != "" && config.Username == "" {
+		return nil, fmt.Errorf("%w: password without username", ErrInvalidConfig)
+	}
+	if config.ClientID == "" {
+		config.ClientID = defaultConfig.ClientID
+	}
+	return &config, nil
+}
+
+type manager interface {
+	MonitorConfigs() monitor.RawConfigs
+	RestartMonitor(string) error
+	TriggerEvent(string, storage.Event) error
+}
+
+type logFunc func(log.Level, string, ...interface{})
+
+// Payloads.
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	payloadOn      = "ON"
+	payloadOff     = "OFF"
+)
+
+// bridge publishes monitor state and events and handles commands.
+type bridge struct {
+	config  Config
+	manager manager
+	logf    logFunc
+
+	mu                sync.Mutex
+	client            *mqtt.Client // Nil while disconnected.
+	states            map[string]string
+	publishEvents     map[string]bool
+	publishEventsPath string
+
+	reconnectDelay time.Duration
+}
+
+func newBridge(config Config, m manager, logf logFunc, publishEventsPath string) (*bridge, error) {
+	publishEvents := make(map[string]bool)
+	file, err := os.ReadFile(publishEventsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read publish events state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(file, &publishEvents); err != nil {
+			return nil, fmt.Errorf("unmarshal publish events state: %w", err)
+		}
+	}
+
+	return &bridge{
+		config:            config,
+		manager:           m,
+		logf:              logf,
+		states:            make(map[string]string),
+		publishEvents:     publishEvents,
+		publishEventsPath: publishEventsPath,
+
+		reconnectDelay: 5 * time.Second,
+	}, nil
+}
+
+func (b *bridge) topic(monitorID string, name string) string {
+	if monitorID == "" {
+		return b.config.TopicPrefix + "/" + name
+	}
+	return b.config.TopicPrefix + "/" + monitorID + "/" + name
+}
+
+// run connects to the broker and reconnects until the context is canceled.
+func (b *bridge) run(ctx context.Context) {
+	for {
+		err := b.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		b.logf(log.LevelError, "connection lost: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.reconnectDelay):
+		}
+	}
+}
+
+func (b *bridge) connect(ctx context.Context) error {
+	statusTopic := b.topic("", "status")
+
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(dialCtx, mqtt.ClientConfig{
+		Address:  b.config.Address,
+		ClientID: b.config.ClientID,
+		Username: b.config.Username,
+		Password: b.config.Password,
+		Will: &mqtt.Message{
+			Topic:   statusTopic,
+			Payload: []byte(payloadOffline),
+			Retain:  true,
+		},
+		OnMessage: b.onMessage,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	err = client.Subscribe(
+		b.topic("+", "trigger"),
+		b.topic("+", "restart"),
+		b.topic("+", "publish_events/set"),
+	)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+
+	b.setClient(client)
+	b.logf(log.LevelInfo, "connected to %v", b.config.Address)
+
+	b.publish(statusTopic, []byte(payloadOnline), true)
+	b.publishAll()
+
+	select {
+	case <-ctx.Done():
+		b.publish(statusTopic, []byte(payloadOffline), true)
+		b.setClient(nil)
+		return nil
+	case <-client.Done():
+		b.setClient(nil)
+		return client.Err()
+	}
+}
+
+func (b *bridge) setClient(client *mqtt.Client) {
+	b.mu.Lock()
+	b.client = client
+	b.mu.Unlock()
+}
+
+// publish drops the message if disconnected.
+func (b *bridge) publish(topic string, payload []byte, retain bool) {
+	b.mu.Lock()
+	client := b.client
+	b.mu.Unlock()
+	if client == nil {
+		return
+	}
+	if err := client.Publish(topic, payload, retain); err != nil {
+		b.logf(log.LevelError, "publish %v: %v", topic, err)
+	}
+}
+
+// publishAll publishes discovery and state of all monitors.
+func (b *bridge) publishAll() {
+	for id, rawConf := range b.manager.MonitorConfigs() {
+		conf := monitor.NewConfig(rawConf)
+		b.publishDiscovery(id, conf.Name())
+
+		b.mu.Lock()
+		state, exist := b.states[id]
+		publishEvents := b.publishesEvents(id)
+		b.mu.Unlock()
+
+		if !exist {
+			state = payloadOffline
+		}
+		b.publish(b.topic(id, "state"), []byte(state), true)
+		b.publish(b.topic(id, "publish_events"), []byte(onOff(publishEvents)), true)
+	}
+}
+
+func (b *bridge) onMonitorStart(ctx context.Context, c monitor.Config) {
+	id := c.ID()
+	b.setState(id, payloadOnline)
+	b.publishDiscovery(id, c.Name())
+
+	go func() {
+		<-ctx.Done()
+		b.setState(id, payloadOffline)
+	}()
+}
+
+func (b *bridge) setState(monitorID string, state string) {
+	b.mu.Lock()
+	b.states[monitorID] = state
+	b.mu.Unlock()
+	b.publish(b.topic(monitorID, "state"), []byte(state), true)
+}
+
+// publishesEvents events are published by default. The switch only
+// affects MQTT, alerts and recording are unaffected. Caller must hold lock.
+func (b *bridge) publishesEvents(monitorID string) bool {
+	enabled, exist := b.publishEvents[monitorID]
+	return !exist || enabled
+}
+
+// setPublishEvents saves and publishes the publish events state.
+func (b *bridge) setPublishEvents(monitorID string, enabled bool) {
+	b.mu.Lock()
+	b.publishEvents[monitorID] = enabled
+	data, _ := json.MarshalIndent(b.publishEvents, "", "    ")
+	err := os.WriteFile(b.publishEventsPath, data, 0o600)
+	b.mu.Unlock()
+	if err != nil {
+		b.logf(log.LevelError, "save publish events state: %v", err)
+	}
+	b.publish(b.topic(monitorID, "publish_events"), []byte(onOff(enabled)), true)
+}
+
+// eventMessage durations are in seconds.
+type eventMessage struct {
+	MonitorID  string              `json:"monitorID"`
+	Time       time.Time           `json:"time"`
+	Label      string              `json:"label"`
+	Score      float64             `json:"score"`
+	Duration   float64             `json:"duration"`
+	Detections []storage.Detection `json:"detections"`
+}
+
+// onEvent publishes the event if publishing is enabled for the monitor.
+func (b *bridge) onEvent(monitorID string, event storage.Event) {
+	b.mu.Lock()
+	enabled := b.publishesEvents(monitorID)
+	b.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	var best storage.Detection
+	for _, d := range event.Detections {
+		if d.Score > best.Score || best.Label == "" {
+			best = d
+		}
+	}
+	detections := event.Detections
+	if detections == nil {
+		detections = []storage.Detection{}
+	}
+
+	payload, err := json.Marshal(eventMessage{
+		MonitorID:  monitorID,
+		Time:       event.Time,
+		Label:      best.Label,
+		Score:      best.Score,
+		Duration:   event.Duration.Seconds(),
+		Detections: detections,
+	})
+	if err != nil {
+		b.logf(log.LevelError, "marshal event: %v", err)
+		return
+	}
+	b.publish(b.topic(monitorID, "event"), payload, false)
+}
+
+func (b *bridge) onRecStart(monitorID string) {
+	b.publish(b.topic(monitorID, "recording"), []byte(payloadOn), true)
+}
+
+func (b *bridge) onRecFailed(monitorID string) {
+	b.publish(b.topic(monitorID, "recording"), []byte(payloadOff), true)
+}
+
+type recordingMessage struct {
+	ID     string    `json:"id"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Events int       `json:"events"`
+}
+
+func (b *bridge) onRecSaved(monitorID string, recPath string, data storage.RecordingData) {
+	b.publish(b.topic(monitorID, "recording"), []byte(payloadOff), true)
+
+	payload, err := json.Marshal(recordingMessage{
+		ID:     filepath.Base(recPath),
+		Start:  data.Start,
+		End:    data.End,
+		Events: len(data.Events),
+	})
+	if err != nil {
+		b.logf(log.LevelError, "marshal recording: %v", err)
+		return
+	}
+	b.publish(b.topic(monitorID, "recording/saved"), payload, false)
+}
+
+// onMessage handles command topics "<prefix>/<monitorID>/<command>".
+func (b *bridge) onMessage(msg mqtt.Message) {
+	rest := strings.TrimPrefix(msg.Topic, b.config.TopicPrefix+"/")
+	monitorID, command, found := strings.Cut(rest, "/")
+	if !found || monitorID == "" {
+		return
+	}
+
+	switch command {
+	case "trigger":
+		var req monitor.TriggerRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			b.logf(log.LevelError, "trigger %v: unmarshal: %v", monitorID, err)
+			return
+		}
+		event, err := req.Event(time.Now())
+		if err != nil {
+			b.logf(log.LevelError, "trigger %v: %v", monitorID, err)
+			return
+		}
+		// The read loop must not block on the recorder.
+		go func() {
+			if err := b.manager.TriggerEvent(monitorID, event); err != nil {
+				b.logf(log.LevelError, "trigger %v: %v", monitorID, err)
+			}
+		}()
+
+	case "restart":
+		go func() {
+			if err := b.manager.RestartMonitor(monitorID); err != nil {
+				b.logf(log.LevelError, "restart %v: %v", monitorID, err)
+				return
+			}
+			b.logf(log.LevelInfo, "restarted %v", monitorID)
+		}()
+
+	case "publish_events/set":
+		switch string(msg.Payload) {
+		case payloadOn:
+			b.setPublishEvents(monitorID, true)
+		case payloadOff:
+			b.setPublishEvents(monitorID, false)
+		default:
+			b.logf(log.LevelError, "publish events %v: invalid payload: %q", monitorID, msg.Payload)
+		}
+	}
+}
+
+func onOff(v bool) string {
+	if v {
+		return payloadOn
+	}
+	return payloadOff
+}
@@ -0,0 +1,271 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/mqtt"
+	"nvr/pkg/mqtt/mqtttest"
+	"nvr/pkg/storage"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubManager struct {
+	mu        sync.Mutex
+	events    []storage.Event
+	restarted []string
+}
+
+func (m *stubManager) MonitorConfigs() monitor.RawConfigs {
+	return monitor.RawConfigs{"m1": {"id": "m1", "name": "door"}}
+}
+
+func (m *stubManager) RestartMonitor(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restarted = append(m.restarted, id)
+	return nil
+}
+
+func (m *stubManager) TriggerEvent(id string, event storage.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+func startTestBridge(t *testing.T) (*bridge, *stubManager, *mqtttest.Broker, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	broker := mqtttest.NewBroker()
+	go broker.Serve(l) //nolint:errcheck
+	t.Cleanup(func() { broker.Close() })
+
+	config := defaultConfig
+	config.Address = l.Addr().String()
+
+	m := &stubManager{}
+	publishEventsPath := filepath.Join(t.TempDir(), "publish_events.json")
+	logf := func(log.Level, string, ...interface{}) {}
+	b, err := newBridge(config, m, logf, publishEventsPath)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Wait for connection.
+	require.Eventually(t, func() bool {
+		msg, exist := broker.Retained("nvr/status")
+		return exist && string(msg.Payload) == payloadOnline
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return b, m, broker, config.Address
+}
+
+func newTestSubscriber(t *testing.T, address string, filter string) chan mqtt.Message {
+	t.Helper()
+	messages := make(chan mqtt.Message, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := mqtt.Dial(ctx, mqtt.ClientConfig{
+		Address:   address,
+		ClientID:  "test",
+		OnMessage: func(msg mqtt.Message) { messages <- msg },
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	require.NoError(t, c.Subscribe(filter))
+	return messages
+}
+
+func waitForMessage(t *testing.T, messages chan mqtt.Message, topic string) mqtt.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if msg.Topic == topic {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %v", topic)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	t.Run("publishAll", func(t *testing.T) {
+		_, _, broker, _ := startTestBridge(t)
+
+		msg, exist := broker.Retained("nvr/m1/state")
+		require.True(t, exist)
+		require.Equal(t, payloadOffline, string(msg.Payload))
+
+		msg, exist = broker.Retained("nvr/m1/publish_events")
+		require.True(t, exist)
+		require.Equal(t, payloadOn, string(msg.Payload))
+
+		msg, exist = broker.Retained("homeassistant/switch/nvr_m1/publish_events/config")
+		require.True(t, exist)
+		var config discoveryConfig
+		require.NoError(t, json.Unmarshal(msg.Payload, &config))
+		require.Equal(t, "nvr/m1/publish_events/set", config.CommandTopic)
+		require.Equal(t, "door publish events", config.Name)
+	})
+	t.Run("event", func(t *testing.T) {
+		b, _, _, address := startTestBridge(t)
+		messages := newTestSubscriber(t, address, "nvr/m1/event")
+
+		b.onEvent("m1", storage.Event{
+			Time:       time.Unix(1, 0).UTC(),
+			Detections: []storage.Detection{{Label: "a", Score: 10}, {Label: "b", Score: 20}},
+			Duration:   time.Second,
+		})
+		msg := waitForMessage(t, messages, "nvr/m1/event")
+
+		var event eventMessage
+		require.NoError(t, json.Unmarshal(msg.Payload, &event))
+		require.Equal(t, "m1", event.MonitorID)
+		require.Equal(t, "b", event.Label)
+		require.Equal(t, float64(20), event.Score)
+		require.Equal(t, float64(1), event.Duration)
+	})
+	t.Run("recording", func(t *testing.T) {
+		b, _, broker, _ := startTestBridge(t)
+		recordingState := func() string {
+			msg, _ := broker.Retained("nvr/m1/recording")
+			return string(msg.Payload)
+		}
+
+		b.onRecStart("m1")
+		require.Eventually(t, func() bool {
+			return recordingState() == payloadOn
+		}, 5*time.Second, 10*time.Millisecond)
+
+		b.onRecFailed("m1")
+		require.Eventually(t, func() bool {
+			return recordingState() == payloadOff
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+	t.Run("publishEventsOff", func(t *testing.T) {
+		b, _, broker, address := startTestBridge(t)
+		messages := newTestSubscriber(t, address, "nvr/#")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c, err := mqtt.Dial(ctx, mqtt.ClientConfig{Address: address, ClientID: "pub"})
+		require.NoError(t, err)
+		defer c.Close()
+		require.NoError(t, c.Publish("nvr/m1/publish_events/set", []byte(payloadOff), false))
+
+		require.Eventually(t, func() bool {
+			msg, exist := broker.Retained("nvr/m1/publish_events")
+			return exist && string(msg.Payload) == payloadOff
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// The state is saved.
+		raw, err := os.ReadFile(b.publishEventsPath)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"m1":false}`, string(raw))
+
+		b.onEvent("m1", storage.Event{Time: time.Now()})
+		b.onRecStart("m1")
+		msg := waitForMessage(t, messages, "nvr/m1/recording")
+		require.Equal(t, payloadOn, string(msg.Payload))
+		for len(messages) > 0 {
+			require.NotEqual(t, "nvr/m1/event", (<-messages).Topic)
+		}
+	})
+	t.Run("commands", func(t *testing.T) {
+		_, m, _, address := startTestBridge(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c, err := mqtt.Dial(ctx, mqtt.ClientConfig{Address: address, ClientID: "pub"})
+		require.NoError(t, err)
+		defer c.Close()
+
+		trigger := []byte(`{"label":"door","score":100,"recDuration":30}`)
+		require.NoError(t, c.Publish("nvr/m1/trigger", trigger, false))
+		require.NoError(t, c.Publish("nvr/m1/restart", nil, false))
+
+		require.Eventually(t, func() bool {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			return len(m.events) == 1 && len(m.restarted) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		require.Equal(t, "door", m.events[0].Detections[0].Label)
+		require.Equal(t, 30*time.Second, m.events[0].RecDuration)
+		require.Equal(t, []string{"m1"}, m.restarted)
+	})
+	t.Run("monitorState", func(t *testing.T) {
+		b, _, broker, _ := startTestBridge(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		b.onMonitorStart(ctx, monitor.NewConfig(monitor.RawConfig{"id": "m1"}))
+
+		require.Eventually(t, func() bool {
+			msg, exist := broker.Retained("nvr/m1/state")
+			return exist && string(msg.Payload) == payloadOnline
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		require.Eventually(t, func() bool {
+			msg, exist := broker.Retained("nvr/m1/state")
+			return exist && string(msg.Payload) == payloadOffline
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestSanitizeID(t *testing.T) {
+	require.Equal(t, "nvr_a_b-c", sanitizeID("nvr/a b-c"))
+}
+
+func TestReadConfig(t *testing.T) {
+	t.Run("generate", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "mqtt.json")
+		config, err := readConfig(configPath)
+		require.NoError(t, err)
+		require.Equal(t, defaultConfig, *config)
+
+		_, err = os.Stat(configPath)
+		require.NoError(t, err)
+	})
+	t.Run("addressMissing", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "mqtt.json")
+		err := os.WriteFile(configPath, []byte(`{"topicPrefix":"nvr"}`), 0o600)
+		require.NoError(t, err)
+
+		_, err = readConfig(configPath)
+		require.ErrorIs(t, err, ErrInvalidConfig)
+	})
+	t.Run("passwordWithoutUsername", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "mqtt.json")
+		raw := `{"address":"127.0.0.1:1883","topicPrefix":"nvr","password":"x"}`
+		err := os.WriteFile(configPath, []byte(raw), 0o600)
+		require.NoError(t, err)
+
+		_, err = readConfig(configPath)
+		require.ErrorIs(t, err, ErrInvalidConfig)
+	})
+}
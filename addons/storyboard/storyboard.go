@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storyboard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register jpeg decoder.
+	"math"
+	"net/http"
+	"nvr"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	nvr.RegisterLogSource([]string{"storybrd"})
+	nvr.RegisterMonitorRecSavedHook(onRecSaved)
+	nvr.RegisterTplHook(modifyTemplates)
+
+	nvr.RegisterAppRunHook(func(_ context.Context, app *nvr.App) error {
+		app.Router.Handle(
+			"/api/recording/storyboard/",
+			app.Auth.User(handleFile(app.Env.RecordingsDir(), 26, vttExt)),
+		)
+		app.Router.Handle(
+			"/api/recording/sprite/",
+			app.Auth.User(handleFile(app.Env.RecordingsDir(), 22, spriteExt)),
+		)
+		return nil
+	})
+}
+
+const (
+	vttExt    = ".vtt"
+	spriteExt = ".sprite.jpeg"
+)
+
+// handleFile serves the recording file with the extension.
+// The recording ID is the URL path after prefixLength.
+func handleFile(recordingsDir string, prefixLength int, ext string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		recID := r.URL.Path[prefixLength:]
+		recPath, err := storage.RecordingIDToPath(recID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		path := filepath.Join(recordingsDir, recPath+ext)
+
+		// ServeFile will sanitize ".."
+		http.ServeFile(w, r, path)
+	})
+}
+
+func modifyTemplates(pageFiles map[string]string) error {
+	js, exists := pageFiles["settings.js"]
+	if !exists {
+		return fmt.Errorf("storyboard: settings.js: %w", os.ErrNotExist)
+	}
+
+	pageFiles["settings.js"] = modifySettingsjs(js)
+	return nil
+}
+
+func modifySettingsjs(tpl string) string {
+	const target = "logLevel: fieldTemplate.select("
+
+	const javascript = `
+		storyboardInterval: fieldTemplate.integer(
+			"Storyboard interval (s)",
+			"` + defaultInterval + `",
+			"` + defaultInterval + `"
+		),`
+
+	return strings.ReplaceAll(tpl, target, javascript+target)
+}
+
+func onRecSaved(r *monitor.Recorder, recPath string, recData storage.RecordingData) {
+	id := r.Config.ID()
+	logf := func(level log.Level, format string, a ...interface{}) {
+		msg := fmt.Sprintf(format, a...)
+		r.Logger.Log(log.Entry{
+			Level:     level,
+			Src:       "storybrd",
+			MonitorID: id,
+			Msg:       r.Env.CensorLog(msg),
+		})
+	}
+
+	err := recSaved(r, logf, recPath, recData)
+	if err != nil {
+		logf(log.LevelError, err.Error())
+	}
+}
+
+func recSaved(
+	r *monitor.Recorder,
+	logf log.Func,
+	recPath string,
+	recData storage.RecordingData,
+) error {
+	recDuration := recData.End.Sub(recData.Start)
+	if recDuration <= 0 {
+		return nil
+	}
+
+	interval := parseInterval(r.Config.Get("storyboardInterval"))
+	layout := newLayout(recDuration, interval)
+
+	video, err := storage.NewVideoReader(recPath, nil)
+	if err != nil {
+		return fmt.Errorf("video reader: %w", err)
+	}
+	defer video.Close()
+
+	tempPath := recPath + ".sprite_tmp"
+	spritePath := recPath + spriteExt
+	vttPath := recPath + vttExt
+
+	// No-op after the temp file is renamed.
+	defer os.Remove(tempPath)
+
+	args := genArgs(r.Config.LogLevel(), tempPath, layout)
+
+	logf(log.LevelInfo, "generating: %v", strings.Join(args, " "))
+	cmd := exec.Command(r.Env.FFmpegBin, args...)
+	cmd.Stdin = video
+
+	logFunc := func(msg string) {
+		logf(log.FFmpegLevel(r.Config.LogLevel()), "process: %v", msg)
+	}
+
+	process := r.NewProcess(cmd).
+		StdoutLogger(logFunc).
+		StderrLogger(logFunc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), recDuration)
+	defer cancel()
+
+	if err := process.Start(ctx); err != nil {
+		return fmt.Errorf("could not generate sprite: %w %v", err, args)
+	}
+
+	sprite, err := os.ReadFile(tempPath)
+	if err != nil {
+		return fmt.Errorf("read sprite: %w", err)
+	}
+	spriteConfig, _, err := image.DecodeConfig(bytes.NewReader(sprite))
+	if err != nil {
+		return fmt.Errorf("decode sprite: %w", err)
+	}
+
+	recID := filepath.Base(recPath)
+	vtt := genVTT(recID, layout, spriteConfig.Width, spriteConfig.Height)
+	if err := os.WriteFile(vttPath, vtt, 0o600); err != nil {
+		return fmt.Errorf("write vtt: %w", err)
+	}
+
+	if err := os.Rename(tempPath, spritePath); err != nil {
+		return fmt.Errorf("could not rename temp file: %w", err)
+	}
+	logf(log.LevelInfo, "done: %v", filepath.Base(spritePath))
+
+	return nil
+}
+
+const (
+	defaultInterval = "10"
+	maxTiles        = 100
+	maxColumns      = 10
+	tileWidth       = 160
+)
+
+// parseInterval returns the interval between frames.
+func parseInterval(raw string) time.Duration {
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 {
+		seconds, _ = strconv.Atoi(defaultInterval)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// layout of the sprite sheet.
+type layout struct {
+	duration time.Duration
+	interval time.Duration
+	tiles    int
+	columns  int
+	rows     int
+}
+
+// newLayout the interval is increased if the
+// recording would exceed the maximum number of tiles.
+func newLayout(duration time.Duration, interval time.Duration) layout {
+	if duration > interval*maxTiles {
+		interval = time.Duration(math.Ceil(
+			duration.Seconds()/maxTiles)) * time.Second
+	}
+
+	tiles := int(math.Ceil(float64(duration) / float64(interval)))
+	columns := tiles
+	if columns > maxColumns {
+		columns = maxColumns
+	}
+	rows := int(math.Ceil(float64(tiles) / float64(columns)))
+
+	return layout{
+		duration: duration,
+		interval: interval,
+		tiles:    tiles,
+		columns:  columns,
+		rows:     rows,
+	}
+}
+
+func genArgs(logLevel string, outputPath string, l layout) []string {
+	fps := "1/" + strconv.Itoa(int(l.interval.Seconds()))
+	tile := strconv.Itoa(l.columns) + "x" + strconv.Itoa(l.rows)
+
+	return []string{
+		"-n", "-loglevel", logLevel,
+		"-threads", "1", "-discard", "nokey",
+		"-i", "-", "-an",
+		"-vf", "fps=" + fps + ",scale=" + strconv.Itoa(tileWidth) + ":-2,tile=" + tile,
+		"-frames:v", "1", "-c:v", "mjpeg", "-q:v", "5",
+		"-f", "image2", outputPath,
+	}
+}
+
+// genVTT generates a WebVTT file that maps
+// each interval to a tile in the sprite sheet.
+func genVTT(recID string, l layout, spriteWidth int, spriteHeight int) []byte {
+	w := spriteWidth / l.columns
+	h := spriteHeight / l.rows
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < l.tiles; i++ {
+		start := time.Duration(i) * l.interval
+		end := start + l.interval
+		if end > l.duration {
+			end = l.duration
+		}
+		x := (i % l.columns) * w
+		y := (i / l.columns) * h
+
+		fmt.Fprintf(&b, "\n%v --> %v\n../sprite/%v#xywh=%d,%d,%d,%d\n",
+			formatTimestamp(start), formatTimestamp(end), recID, x, y, w, h)
+	}
+	return []byte(b.String())
+}
+
+// formatTimestamp formats duration as "hh:mm:ss.ttt".
+func formatTimestamp(d time.Duration) string {
+	hours := d / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+	seconds := (d % time.Minute) / time.Second
+	millis := (d % time.Second) / time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, seconds, millis)
+}
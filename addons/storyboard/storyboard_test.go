@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storyboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLayout(t *testing.T) {
+	cases := map[string]struct {
+		duration time.Duration
+		interval time.Duration
+		expected layout
+	}{
+		"short": {
+			25 * time.Second, 10 * time.Second,
+			layout{25 * time.Second, 10 * time.Second, 3, 3, 1},
+		},
+		"rows": {
+			15 * time.Minute, 10 * time.Second,
+			layout{15 * time.Minute, 10 * time.Second, 90, 10, 9},
+		},
+		"maxTiles": {
+			time.Hour, 10 * time.Second,
+			layout{time.Hour, 36 * time.Second, 100, 10, 10},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, newLayout(tc.duration, tc.interval))
+		})
+	}
+}
+
+func TestGenArgs(t *testing.T) {
+	actual := genArgs("1", "2", newLayout(time.Minute, 10*time.Second))
+	expected := []string{
+		"-n", "-loglevel", "1",
+		"-threads", "1", "-discard", "nokey",
+		"-i", "-", "-an",
+		"-vf", "fps=1/10,scale=160:-2,tile=6x1",
+		"-frames:v", "1", "-c:v", "mjpeg", "-q:v", "5",
+		"-f", "image2", "2",
+	}
+	require.Equal(t, expected, actual)
+}
+
+func TestGenVTT(t *testing.T) {
+	l := newLayout(25*time.Second, 10*time.Second)
+	l.columns = 2
+	l.rows = 2
+
+	actual := string(genVTT("x", l, 320, 180))
+	expected := `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+../sprite/x#xywh=0,0,160,90
+
+00:00:10.000 --> 00:00:20.000
+../sprite/x#xywh=160,0,160,90
+
+00:00:20.000 --> 00:00:25.000
+../sprite/x#xywh=0,90,160,90
+`
+	require.Equal(t, expected, actual)
+}
+
+func TestParseInterval(t *testing.T) {
+	require.Equal(t, 5*time.Second, parseInterval("5"))
+	require.Equal(t, 10*time.Second, parseInterval(""))
+	require.Equal(t, 10*time.Second, parseInterval("-1"))
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	d := time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond
+	require.Equal(t, "01:02:03.004", formatTimestamp(d))
+}
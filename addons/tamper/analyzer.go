@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tamper
+
+import (
+	"math"
+	"time"
+)
+
+// Frames are sampled at 1 fps and scaled to this size.
+const (
+	frameWidth  = 64
+	frameHeight = 48
+	frameSize   = frameWidth * frameHeight
+)
+
+// Tamper kinds, the event label is "tamper:<kind>".
+const (
+	kindCovered   = "covered"
+	kindDefocused = "defocused"
+	kindMoved     = "moved"
+)
+
+var kinds = []string{kindCovered, kindDefocused, kindMoved}
+
+const (
+	// Images with a lower standard deviation are near-uniform.
+	uniformLimit = 6
+
+	// Fraction of the baseline edge energy below which the image is defocused.
+	defocusLimit = 0.4
+
+	// Minimum pixel change from the reference and the fraction
+	// of changed pixels before the scene is considered changed.
+	changeSensitivity = 40
+	changeLimit       = 0.6
+
+	// How fast the reference and baseline adapt to slow changes.
+	learningRate = 1.0 / 60
+
+	// Number of frames learned before defocus and scene changes are checked.
+	warmupFrames = 10
+)
+
+// condition tracks a tamper kind.
+type condition struct {
+	since  time.Time // Zero if not present.
+	active bool      // Present for the duration and reported.
+}
+
+// analyzer compares each frame to a reference
+// that slowly adapts to lighting changes.
+type analyzer struct {
+	duration time.Duration
+
+	frames       int
+	reference    []float32
+	refMean      float64
+	edgeBaseline float64
+
+	conditions map[string]*condition
+}
+
+func newAnalyzer(duration time.Duration) *analyzer {
+	conditions := make(map[string]*condition, len(kinds))
+	for _, kind := range kinds {
+		conditions[kind] = &condition{}
+	}
+	return &analyzer{
+		duration:   duration,
+		reference:  make([]float32, frameSize),
+		conditions: conditions,
+	}
+}
+
+// analyze returns the tamper kinds that have been present for the
+// duration and the kinds that are no longer present after being raised.
+func (a *analyzer) analyze(frame []uint8, now time.Time) (raised []string, cleared []string) {
+	mean, stdDev := meanStdDev(frame)
+	edges := edgeEnergy(frame)
+
+	covered := stdDev < uniformLimit
+	warm := a.frames >= warmupFrames
+	present := map[string]bool{
+		kindCovered:   covered,
+		kindDefocused: !covered && warm && edges < a.edgeBaseline*defocusLimit,
+		kindMoved:     !covered && warm && a.changedFraction(frame, mean) > changeLimit,
+	}
+
+	anyPresent := false
+	for _, kind := range kinds {
+		c := a.conditions[kind]
+		if !present[kind] {
+			if c.active {
+				cleared = append(cleared, kind)
+			}
+			*c = condition{}
+			continue
+		}
+		anyPresent = true
+
+		if c.since.IsZero() {
+			c.since = now
+		}
+		if !c.active && now.Sub(c.since) >= a.duration {
+			c.active = true
+			raised = append(raised, kind)
+		}
+	}
+
+	// The new view becomes the reference once the move is reported.
+	if a.conditions[kindMoved].active {
+		*a.conditions[kindMoved] = condition{}
+		a.frames = 0
+		anyPresent = false
+	}
+
+	// Don't learn the tampered image.
+	if !anyPresent {
+		a.learn(frame, mean, edges)
+	}
+	return raised, cleared
+}
+
+func (a *analyzer) learn(frame []uint8, mean float64, edges float64) {
+	if a.frames == 0 {
+		for i, v := range frame {
+			a.reference[i] = float32(v)
+		}
+		a.refMean = mean
+		a.edgeBaseline = edges
+		a.frames++
+		return
+	}
+
+	for i, v := range frame {
+		a.reference[i] += (float32(v) - a.reference[i]) * learningRate
+	}
+	a.refMean += (mean - a.refMean) * learningRate
+	a.edgeBaseline += (edges - a.edgeBaseline) * learningRate
+	if a.frames < warmupFrames {
+		a.frames++
+	}
+}
+
+// changedFraction returns the fraction of pixels that differ from the
+// reference. Both images are mean adjusted to ignore brightness changes.
+func (a *analyzer) changedFraction(frame []uint8, mean float64) float64 {
+	offset := float32(mean - a.refMean)
+	changed := 0
+	for i, v := range frame {
+		diff := float32(v) - a.reference[i] - offset
+		if diff > changeSensitivity || diff < -changeSensitivity {
+			changed++
+		}
+	}
+	return float64(changed) / float64(len(frame))
+}
+
+func meanStdDev(frame []uint8) (float64, float64) {
+	var sum float64
+	for _, v := range frame {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(frame))
+
+	var variance float64
+	for _, v := range frame {
+		d := float64(v) - mean
+		variance += d * d
+	}
+	return mean, math.Sqrt(variance / float64(len(frame)))
+}
+
+// edgeEnergy returns the mean squared difference between neighboring pixels.
+// Blurring spreads edges over more pixels, which lowers the squared sum.
+func edgeEnergy(frame []uint8) float64 {
+	var sum int
+	for y := 0; y < frameHeight-1; y++ {
+		row := y * frameWidth
+		for x := 0; x < frameWidth-1; x++ {
+			i := row + x
+			dx := int(frame[i+1]) - int(frame[i])
+			dy := int(frame[i+frameWidth]) - int(frame[i])
+			sum += dx*dx + dy*dy
+		}
+	}
+	return float64(sum) / float64((frameWidth-1)*(frameHeight-1))
+}
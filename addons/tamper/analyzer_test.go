@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tamper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// checker returns a frame with 8x8 blocks of dark and light pixels.
+func checker(dark, light uint8, inverted bool) []uint8 {
+	frame := make([]uint8, frameSize)
+	for y := 0; y < frameHeight; y++ {
+		for x := 0; x < frameWidth; x++ {
+			isLight := (x/8+y/8)%2 == 0
+			if isLight != inverted {
+				frame[y*frameWidth+x] = light
+			} else {
+				frame[y*frameWidth+x] = dark
+			}
+		}
+	}
+	return frame
+}
+
+func uniform(v uint8) []uint8 {
+	frame := make([]uint8, frameSize)
+	for i := range frame {
+		frame[i] = v
+	}
+	return frame
+}
+
+// blur applies a 3x3 box blur n times.
+func blur(frame []uint8, n int) []uint8 {
+	src := append([]uint8{}, frame...)
+	dst := make([]uint8, frameSize)
+	for ; n > 0; n-- {
+		for y := 0; y < frameHeight; y++ {
+			for x := 0; x < frameWidth; x++ {
+				sum, count := 0, 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := x+dx, y+dy
+						if nx < 0 || ny < 0 || nx >= frameWidth || ny >= frameHeight {
+							continue
+						}
+						sum += int(src[ny*frameWidth+nx])
+						count++
+					}
+				}
+				dst[y*frameWidth+x] = uint8(sum / count)
+			}
+		}
+		src, dst = dst, src
+	}
+	return src
+}
+
+func TestMeanStdDev(t *testing.T) {
+	mean, stdDev := meanStdDev(checker(50, 150, false))
+	require.Equal(t, 100.0, mean)
+	require.Equal(t, 50.0, stdDev)
+
+	mean, stdDev = meanStdDev(uniform(7))
+	require.Equal(t, 7.0, mean)
+	require.Equal(t, 0.0, stdDev)
+}
+
+func TestEdgeEnergy(t *testing.T) {
+	require.Equal(t, 0.0, edgeEnergy(uniform(100)))
+
+	sharp := edgeEnergy(checker(50, 200, false))
+	blurred := edgeEnergy(blur(checker(50, 200, false), 3))
+	require.Less(t, blurred, sharp*defocusLimit)
+}
+
+func TestAnalyzer(t *testing.T) {
+	scene := checker(50, 200, false)
+	now := time.Unix(1000, 0)
+	at := func(s int) time.Time {
+		return now.Add(time.Duration(s) * time.Second)
+	}
+
+	// newWarmAnalyzer returns a analyzer that has learned the scene.
+	newWarmAnalyzer := func() (*analyzer, int) {
+		a := newAnalyzer(2 * time.Second)
+		s := 0
+		for ; s < warmupFrames; s++ {
+			raised, cleared := a.analyze(scene, at(s))
+			require.Empty(t, raised)
+			require.Empty(t, cleared)
+		}
+		return a, s
+	}
+
+	t.Run("covered", func(t *testing.T) {
+		a, s := newWarmAnalyzer()
+		black := uniform(3)
+
+		raised, _ := a.analyze(black, at(s))
+		require.Empty(t, raised)
+		raised, _ = a.analyze(black, at(s+1))
+		require.Empty(t, raised)
+		raised, _ = a.analyze(black, at(s+2))
+		require.Equal(t, []string{kindCovered}, raised)
+
+		// Only reported once.
+		raised, _ = a.analyze(black, at(s+3))
+		require.Empty(t, raised)
+
+		raised, cleared := a.analyze(scene, at(s+4))
+		require.Empty(t, raised)
+		require.Equal(t, []string{kindCovered}, cleared)
+	})
+	t.Run("shortCover", func(t *testing.T) {
+		a, s := newWarmAnalyzer()
+		a.analyze(uniform(3), at(s))
+		a.analyze(scene, at(s+1))
+		raised, cleared := a.analyze(uniform(3), at(s+2))
+		require.Empty(t, raised)
+		require.Empty(t, cleared)
+	})
+	t.Run("defocused", func(t *testing.T) {
+		a, s := newWarmAnalyzer()
+		blurred := blur(scene, 3)
+
+		var raised []string
+		for i := 0; i <= 2; i++ {
+			raised, _ = a.analyze(blurred, at(s+i))
+		}
+		require.Equal(t, []string{kindDefocused}, raised)
+
+		_, cleared := a.analyze(scene, at(s+3))
+		require.Equal(t, []string{kindDefocused}, cleared)
+	})
+	t.Run("moved", func(t *testing.T) {
+		a, s := newWarmAnalyzer()
+		moved := checker(50, 200, true)
+
+		var raised []string
+		for i := 0; i <= 2; i++ {
+			raised, _ = a.analyze(moved, at(s+i))
+		}
+		require.Equal(t, []string{kindMoved}, raised)
+
+		// The new view becomes the reference.
+		for i := 3; i < 3+warmupFrames+2; i++ {
+			raised, cleared := a.analyze(moved, at(s+i))
+			require.Empty(t, raised)
+			require.Empty(t, cleared)
+		}
+	})
+	t.Run("brightnessChange", func(t *testing.T) {
+		a, s := newWarmAnalyzer()
+		brighter := checker(100, 250, false)
+		for i := 0; i < 5; i++ {
+			raised, _ := a.analyze(brighter, at(s+i))
+			require.Empty(t, raised)
+		}
+	})
+	t.Run("warmup", func(t *testing.T) {
+		a := newAnalyzer(0)
+		a.analyze(scene, at(0))
+		raised, _ := a.analyze(checker(50, 200, true), at(1))
+		require.Empty(t, raised)
+	})
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tamper
+
+import (
+	"context"
+	"fmt"
+	"nvr"
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"strconv"
+	"time"
+)
+
+func init() {
+	nvr.RegisterMonitorInputProcessHook(onInputProcessStart)
+	nvr.RegisterLogSource([]string{"tamper"})
+	nvr.RegisterTplHook(modifyTemplates)
+}
+
+// Label prefix of the events.
+const labelPrefix = "tamper:"
+
+func onInputProcessStart(ctx context.Context, i *monitor.InputProcess, _ *[]string) {
+	if i.Config.SubInputEnabled() != i.IsSubInput() {
+		return
+	}
+
+	id := i.Config.ID()
+	logf := func(level log.Level, format string, a ...interface{}) {
+		i.Logger.Log(log.Entry{
+			Level:     level,
+			Src:       "tamper",
+			MonitorID: id,
+			Msg:       fmt.Sprintf(format, a...),
+		})
+	}
+
+	config, enable, err := parseConfig(i.Config)
+	if err != nil {
+		logf(log.LevelError, "could not parse config: %v", err)
+		return
+	}
+	if !enable {
+		return
+	}
+
+	i.WG.Add(1)
+	go start(ctx, i, *config, logf)
+}
+
+func start(
+	ctx context.Context,
+	i *monitor.InputProcess,
+	config config,
+	logf log.Func,
+) {
+	defer i.WG.Done()
+
+	// Wait for the monitor to start.
+	select {
+	case <-time.After(10 * time.Second):
+	case <-ctx.Done():
+		return
+	}
+
+	// The analyzer is kept between restarts to keep the reference.
+	d := newDetector(i.SendEvent, config, logf)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		frames, err := i.SubscribeFrames(ctx, frameConfig)
+		if err != nil {
+			logf(log.LevelError, "subscribe frames: %v", err)
+		} else {
+			logf(log.LevelInfo, "started")
+			d.run(frames)
+		}
+
+		select {
+		case <-time.After(3 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+var frameConfig = monitor.FrameConfig{
+	Filter:    "fps=fps=1,scale=" + strconv.Itoa(frameWidth) + ":" + strconv.Itoa(frameHeight),
+	PixFmt:    "gray",
+	FrameSize: frameSize,
+}
+
+type detector struct {
+	sendEvent monitor.SendEventFunc
+	logf      log.Func
+	config    config
+	analyzer  *analyzer
+}
+
+func newDetector(sendEvent monitor.SendEventFunc, c config, logf log.Func) *detector {
+	return &detector{
+		sendEvent: sendEvent,
+		logf:      logf,
+		config:    c,
+		analyzer:  newAnalyzer(c.duration),
+	}
+}
+
+// run analyzes the frames until the channel is closed.
+func (d *detector) run(frames <-chan monitor.Frame) {
+	for frame := range frames {
+		raised, cleared := d.analyzer.analyze(frame.Data, frame.Time)
+		for _, kind := range cleared {
+			d.logf(log.LevelInfo, "cleared: %v", kind)
+		}
+		for _, kind := range raised {
+			d.logf(log.LevelError, "camera tampering detected: %v", kind)
+			err := d.sendEvent(storage.Event{
+				Time: frame.Time.Add(-d.config.timestampOffset),
+				Detections: []storage.Detection{{
+					Label: labelPrefix + kind,
+					Score: 100,
+				}},
+				Duration:    time.Second,
+				RecDuration: d.config.recDuration,
+			})
+			if err != nil {
+				d.logf(log.LevelError, "send event: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tamper
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"nvr/pkg/log"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector(t *testing.T) {
+	var events []storage.Event
+	sendEvent := func(e storage.Event) error {
+		events = append(events, e)
+		return nil
+	}
+	var logs []string
+	logf := func(_ log.Level, format string, a ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, a...))
+	}
+	c := config{
+		timestampOffset: time.Millisecond,
+		recDuration:     time.Minute,
+	}
+	d := newDetector(sendEvent, c, logf)
+
+	now := time.Unix(1000, 0)
+	frames := make(chan monitor.Frame, 2)
+	frames <- monitor.Frame{Time: now, Data: uniform(0)}
+	frames <- monitor.Frame{Time: now.Add(time.Second), Data: checker(50, 200, false)}
+	close(frames)
+	d.run(frames)
+
+	expected := []storage.Event{{
+		Time: now.Add(-time.Millisecond),
+		Detections: []storage.Detection{{
+			Label: "tamper:covered",
+			Score: 100,
+		}},
+		Duration:    time.Second,
+		RecDuration: time.Minute,
+	}}
+	require.Equal(t, expected, events)
+	require.Equal(t, []string{
+		"camera tampering detected: covered",
+		"cleared: covered",
+	}, logs)
+}
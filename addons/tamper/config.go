@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tamper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr/pkg/monitor"
+	"strconv"
+	"time"
+)
+
+type config struct {
+	monitorID       string
+	timestampOffset time.Duration
+	duration        time.Duration
+	recDuration     time.Duration
+}
+
+// rawConfig monitor config, durations are in seconds.
+type rawConfig struct {
+	Enable      string `json:"enable"`
+	Duration    string `json:"duration"`
+	RecDuration string `json:"recDuration"`
+}
+
+// ErrInvalidDuration invalid duration.
+var ErrInvalidDuration = errors.New("invalid duration")
+
+func parseConfig(c monitor.Config) (*config, bool, error) {
+	tamper := c.Get("tamper")
+	if tamper == "" {
+		return nil, false, nil
+	}
+
+	var rawConf rawConfig
+	if err := json.Unmarshal([]byte(tamper), &rawConf); err != nil {
+		return nil, false, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	enable := rawConf.Enable == "true"
+	if !enable {
+		return nil, false, nil
+	}
+
+	timestampOffset, err := parseTimestampOffset(c.TimestampOffset())
+	if err != nil {
+		return nil, false, err
+	}
+
+	duration, err := parseSeconds(rawConf.Duration, 10)
+	if err != nil || duration < 0 {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidDuration, rawConf.Duration)
+	}
+
+	recDuration, err := parseSeconds(rawConf.RecDuration, 30)
+	if err != nil || recDuration <= 0 {
+		return nil, false, fmt.Errorf("%w: recDuration: %v", ErrInvalidDuration, rawConf.RecDuration)
+	}
+
+	return &config{
+		monitorID:       c.ID(),
+		timestampOffset: timestampOffset,
+		duration:        duration,
+		recDuration:     recDuration,
+	}, true, nil
+}
+
+// parseSeconds parses a integer in seconds, empty returns the default value.
+func parseSeconds(raw string, defaultValue int) (time.Duration, error) {
+	seconds := defaultValue
+	if raw != "" {
+		var err error
+		seconds, err = strconv.Atoi(raw)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func parseTimestampOffset(rawOffset string) (time.Duration, error) {
+	if rawOffset == "" {
+		return 0, nil
+	}
+	timestampOffset, err := strconv.Atoi(rawOffset)
+	if err != nil {
+		return 0, fmt.Errorf("parse timestamp offset %w", err)
+	}
+	return time.Duration(timestampOffset) * time.Millisecond, nil
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tamper
+
+import (
+	"testing"
+	"time"
+
+	"nvr/pkg/monitor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	newConfig := func(tamper string) monitor.Config {
+		return monitor.NewConfig(monitor.RawConfig{
+			"id":              "1",
+			"timestampOffset": "2",
+			"tamper":          tamper,
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		actual, enable, err := parseConfig(newConfig(
+			`{"enable": "true", "duration": "3", "recDuration": "4"}`,
+		))
+		require.NoError(t, err)
+		require.True(t, enable)
+
+		expected := config{
+			monitorID:       "1",
+			timestampOffset: 2 * time.Millisecond,
+			duration:        3 * time.Second,
+			recDuration:     4 * time.Second,
+		}
+		require.Equal(t, expected, *actual)
+	})
+	t.Run("defaults", func(t *testing.T) {
+		actual, _, err := parseConfig(newConfig(`{"enable": "true"}`))
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Second, actual.duration)
+		require.Equal(t, 30*time.Second, actual.recDuration)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		_, enable, err := parseConfig(newConfig(`{"enable": "false"}`))
+		require.NoError(t, err)
+		require.False(t, enable)
+	})
+	t.Run("empty", func(t *testing.T) {
+		_, enable, err := parseConfig(newConfig(""))
+		require.NoError(t, err)
+		require.False(t, enable)
+	})
+	t.Run("unmarshalErr", func(t *testing.T) {
+		_, _, err := parseConfig(newConfig("{"))
+		require.Error(t, err)
+	})
+	t.Run("invalidDuration", func(t *testing.T) {
+		_, _, err := parseConfig(newConfig(`{"enable": "true", "duration": "-1"}`))
+		require.ErrorIs(t, err, ErrInvalidDuration)
+	})
+	t.Run("invalidRecDuration", func(t *testing.T) {
+		_, _, err := parseConfig(newConfig(`{"enable": "true", "recDuration": "x"}`))
+		require.ErrorIs(t, err, ErrInvalidDuration)
+	})
+}
@@ -0,0 +1,84 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr/pkg/monitor"
+	"strconv"
+	"time"
+)
+
+// Actions when a segment check fails.
+const (
+	actionRestart = "restart"
+	actionLog     = "log"
+)
+
+type config struct {
+	// Zero disables the check.
+	minFPS              float64
+	maxKeyframeInterval time.Duration
+
+	frozenImage bool
+	action      string
+}
+
+// rawConfig monitor config, the keyframe interval is in seconds.
+type rawConfig struct {
+	MinFPS              string `json:"minFps"`
+	MaxKeyframeInterval string `json:"maxKeyframeInterval"`
+	FrozenImage         string `json:"frozenImage"`
+	Action              string `json:"action"`
+}
+
+// Config errors.
+var (
+	ErrInvalidMinFPS   = errors.New("invalid min fps")
+	ErrInvalidInterval = errors.New("invalid keyframe interval")
+	ErrInvalidAction   = errors.New("invalid action")
+)
+
+// parseConfig returns the default config if the monitor doesn't have one.
+func parseConfig(c monitor.Config) (*config, error) {
+	var rawConf rawConfig
+	if raw := c.Get("watchdog"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &rawConf); err != nil {
+			return nil, fmt.Errorf("unmarshal config: %w", err)
+		}
+	}
+
+	var minFPS float64
+	if rawConf.MinFPS != "" {
+		var err error
+		minFPS, err = strconv.ParseFloat(rawConf.MinFPS, 64)
+		if err != nil || minFPS < 0 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMinFPS, rawConf.MinFPS)
+		}
+	}
+
+	var maxKeyframeInterval time.Duration
+	if rawConf.MaxKeyframeInterval != "" {
+		seconds, err := strconv.ParseFloat(rawConf.MaxKeyframeInterval, 64)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInterval, rawConf.MaxKeyframeInterval)
+		}
+		maxKeyframeInterval = time.Duration(seconds * float64(time.Second))
+	}
+
+	action := rawConf.Action
+	switch action {
+	case "":
+		action = actionRestart
+	case actionRestart, actionLog:
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAction, action)
+	}
+
+	return &config{
+		minFPS:              minFPS,
+		maxKeyframeInterval: maxKeyframeInterval,
+		frozenImage:         rawConf.FrozenImage == "true",
+		action:              action,
+	}, nil
+}
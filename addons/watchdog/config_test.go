@@ -0,0 +1,55 @@
+package watchdog
+
+import (
+	"testing"
+	"time"
+
+	"nvr/pkg/monitor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	newConfig := func(watchdog string) monitor.Config {
+		return monitor.NewConfig(monitor.RawConfig{"watchdog": watchdog})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		actual, err := parseConfig(newConfig(""))
+		require.NoError(t, err)
+		require.Equal(t, config{action: actionRestart}, *actual)
+	})
+	t.Run("ok", func(t *testing.T) {
+		actual, err := parseConfig(newConfig(`{
+			"minFps": "5",
+			"maxKeyframeInterval": "2.5",
+			"frozenImage": "true",
+			"action": "log"
+		}`))
+		require.NoError(t, err)
+
+		expected := config{
+			minFPS:              5,
+			maxKeyframeInterval: 2500 * time.Millisecond,
+			frozenImage:         true,
+			action:              actionLog,
+		}
+		require.Equal(t, expected, *actual)
+	})
+	t.Run("unmarshalErr", func(t *testing.T) {
+		_, err := parseConfig(newConfig("{"))
+		require.Error(t, err)
+	})
+	t.Run("invalidMinFPS", func(t *testing.T) {
+		_, err := parseConfig(newConfig(`{"minFps": "x"}`))
+		require.ErrorIs(t, err, ErrInvalidMinFPS)
+	})
+	t.Run("invalidInterval", func(t *testing.T) {
+		_, err := parseConfig(newConfig(`{"maxKeyframeInterval": "-1"}`))
+		require.ErrorIs(t, err, ErrInvalidInterval)
+	})
+	t.Run("invalidAction", func(t *testing.T) {
+		_, err := parseConfig(newConfig(`{"action": "x"}`))
+		require.ErrorIs(t, err, ErrInvalidAction)
+	})
+}
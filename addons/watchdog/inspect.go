@@ -0,0 +1,161 @@
+package watchdog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"nvr/pkg/video/gortsplib/pkg/h264"
+	"nvr/pkg/video/hls"
+	"time"
+)
+
+// Number of consecutive failed segments before a check is reported.
+const failedSegments = 3
+
+// Keyframes are compared to the keyframes of this many previous segments.
+// Encoders alternate the IDR picture ID, consecutive keyframes of a
+// frozen image are not always identical.
+const keyframeHistory = 4
+
+// segmentStats video statistics of a segment.
+type segmentStats struct {
+	frames   int
+	duration time.Duration
+
+	// Largest time between keyframes, including the time
+	// since the last keyframe of the previous segment.
+	maxKeyframeGap time.Duration
+
+	// Hash of the IDR slices of the first keyframe, zero if there are none.
+	keyframeHash uint64
+}
+
+// inspector checks the video samples of each segment.
+type inspector struct {
+	config config
+
+	lastKeyframe int64 // DTS, zero before the first keyframe.
+	prevHashes   []uint64
+
+	lowFPS        int
+	slowKeyframes int
+	frozen        int
+}
+
+func newInspector(c config) *inspector {
+	return &inspector{config: c}
+}
+
+// inspect returns the reasons for the checks that have failed for
+// the required number of segments. A check is reported once until
+// it passes again.
+func (in *inspector) inspect(seg *hls.Segment) []string {
+	stats := in.parseSegment(seg)
+	if stats.frames == 0 || stats.duration == 0 {
+		return nil
+	}
+
+	var reasons []string
+	report := func(counter *int, failed bool, reason string) {
+		if !failed {
+			*counter = 0
+			return
+		}
+		*counter++
+		if *counter == failedSegments {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	c := in.config
+	if c.minFPS != 0 {
+		fps := float64(stats.frames) / stats.duration.Seconds()
+		report(&in.lowFPS, fps < c.minFPS, fmt.Sprintf(
+			"low framerate: %.1f fps, expected at least %v", fps, c.minFPS))
+	}
+
+	if c.maxKeyframeInterval != 0 {
+		report(&in.slowKeyframes, stats.maxKeyframeGap > c.maxKeyframeInterval, fmt.Sprintf(
+			"keyframe interval: %v, expected at most %v",
+			stats.maxKeyframeGap.Round(time.Millisecond), c.maxKeyframeInterval))
+	}
+
+	if c.frozenImage && stats.keyframeHash != 0 {
+		report(&in.frozen, in.isRepeated(stats.keyframeHash), fmt.Sprintf(
+			"frozen image: identical keyframes in %v segments", failedSegments))
+	}
+	if stats.keyframeHash != 0 {
+		in.prevHashes = append(in.prevHashes, stats.keyframeHash)
+		if len(in.prevHashes) > keyframeHistory {
+			in.prevHashes = in.prevHashes[1:]
+		}
+	}
+
+	return reasons
+}
+
+func (in *inspector) isRepeated(hash uint64) bool {
+	for _, prev := range in.prevHashes {
+		if prev == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (in *inspector) parseSegment(seg *hls.Segment) segmentStats {
+	var stats segmentStats
+	var lastDTS int64
+	for _, part := range seg.Parts {
+		for _, sample := range part.VideoSamples {
+			stats.frames++
+			stats.duration += sample.Duration
+			lastDTS = sample.DTS
+
+			if !sample.IdrPresent {
+				continue
+			}
+			if in.lastKeyframe != 0 {
+				gap := time.Duration(sample.DTS - in.lastKeyframe)
+				if gap > stats.maxKeyframeGap {
+					stats.maxKeyframeGap = gap
+				}
+			}
+			in.lastKeyframe = sample.DTS
+
+			if stats.keyframeHash == 0 {
+				stats.keyframeHash = hashIDR(sample.AVCC)
+			}
+		}
+	}
+
+	// Segment without a keyframe at the end.
+	if in.lastKeyframe != 0 {
+		gap := time.Duration(lastDTS - in.lastKeyframe)
+		if gap > stats.maxKeyframeGap {
+			stats.maxKeyframeGap = gap
+		}
+	}
+	return stats
+}
+
+// hashIDR returns the hash of the IDR slice NAL units. Parameter sets and
+// SEI units are skipped because they may contain timestamps.
+func hashIDR(avcc []byte) uint64 {
+	nalus, err := h264.AVCCUnmarshal(avcc)
+	if err != nil {
+		return 0
+	}
+	h := fnv.New64a()
+	found := false
+	for _, nalu := range nalus {
+		if len(nalu) == 0 || h264.NALUType(nalu[0]&0x1F) != h264.NALUTypeIDR {
+			continue
+		}
+		h.Write(nalu) //nolint:errcheck
+		found = true
+	}
+	if !found {
+		return 0
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,134 @@
+package watchdog
+
+import (
+	"testing"
+	"time"
+
+	"nvr/pkg/video/gortsplib/pkg/h264"
+	"nvr/pkg/video/hls"
+
+	"github.com/stretchr/testify/require"
+)
+
+// idrAVCC returns a access unit with parameter sets and a IDR slice.
+func idrAVCC(content byte) []byte {
+	return h264.AVCCMarshal([][]byte{
+		{byte(h264.NALUTypeSPS), 1},
+		{byte(h264.NALUTypeSEI), content + 100},
+		{byte(h264.NALUTypeIDR), content, content},
+	})
+}
+
+// testSegment returns a segment with the given number of frames per
+// second. The first frame is a keyframe unless keyframe is nil.
+func testSegment(id uint64, start time.Time, fps int, duration time.Duration, keyframe []byte) *hls.Segment {
+	frameDuration := time.Second / time.Duration(fps)
+	frames := int(duration / frameDuration)
+
+	part := &hls.MuxerPart{}
+	dts := start.UnixNano()
+	for i := 0; i < frames; i++ {
+		sample := &hls.VideoSample{
+			DTS:      dts,
+			AVCC:     h264.AVCCMarshal([][]byte{{byte(h264.NALUTypeNonIDR), 1}}),
+			Duration: frameDuration,
+		}
+		if i == 0 && keyframe != nil {
+			sample.AVCC = keyframe
+			sample.IdrPresent = true
+		}
+		part.VideoSamples = append(part.VideoSamples, sample)
+		dts += int64(frameDuration)
+	}
+	return &hls.Segment{
+		ID:        id,
+		StartTime: start,
+		Parts:     []*hls.MuxerPart{part},
+	}
+}
+
+func TestHashIDR(t *testing.T) {
+	require.Equal(t, hashIDR(idrAVCC(1)), hashIDR(idrAVCC(1)))
+	require.NotEqual(t, hashIDR(idrAVCC(1)), hashIDR(idrAVCC(2)))
+
+	// Only the IDR slice is hashed.
+	withSEI := h264.AVCCMarshal([][]byte{
+		{byte(h264.NALUTypeSEI), 9},
+		{byte(h264.NALUTypeIDR), 1, 1},
+	})
+	require.Equal(t, hashIDR(idrAVCC(1)), hashIDR(withSEI))
+
+	noIDR := h264.AVCCMarshal([][]byte{{byte(h264.NALUTypeNonIDR), 1}})
+	require.Equal(t, uint64(0), hashIDR(noIDR))
+	require.Equal(t, uint64(0), hashIDR([]byte{1}))
+}
+
+func TestInspector(t *testing.T) {
+	start := time.Unix(1000, 0)
+	at := func(i int) time.Time {
+		return start.Add(time.Duration(i) * 2 * time.Second)
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		in := newInspector(config{
+			minFPS:              10,
+			maxKeyframeInterval: 2 * time.Second,
+			frozenImage:         true,
+		})
+		for i := 0; i < 10; i++ {
+			seg := testSegment(uint64(i), at(i), 10, 2*time.Second, idrAVCC(byte(i)))
+			require.Empty(t, in.inspect(seg))
+		}
+	})
+	t.Run("lowFPS", func(t *testing.T) {
+		in := newInspector(config{minFPS: 10})
+		require.Empty(t, in.inspect(testSegment(0, at(0), 2, 2*time.Second, idrAVCC(0))))
+		require.Empty(t, in.inspect(testSegment(1, at(1), 2, 2*time.Second, idrAVCC(1))))
+		require.Equal(t,
+			[]string{"low framerate: 2.0 fps, expected at least 10"},
+			in.inspect(testSegment(2, at(2), 2, 2*time.Second, idrAVCC(2))),
+		)
+
+		// Reported once.
+		require.Empty(t, in.inspect(testSegment(3, at(3), 2, 2*time.Second, idrAVCC(3))))
+
+		// Reset.
+		require.Empty(t, in.inspect(testSegment(4, at(4), 10, 2*time.Second, idrAVCC(4))))
+		require.Empty(t, in.inspect(testSegment(5, at(5), 2, 2*time.Second, idrAVCC(5))))
+	})
+	t.Run("keyframeInterval", func(t *testing.T) {
+		in := newInspector(config{maxKeyframeInterval: 3 * time.Second})
+		var reasons []string
+		for i := 0; i < 6; i++ {
+			var keyframe []byte
+			if i%2 == 0 {
+				keyframe = idrAVCC(byte(i))
+			}
+			reasons = append(reasons, in.inspect(testSegment(uint64(i), at(i), 10, 2*time.Second, keyframe))...)
+		}
+		require.Equal(t, []string{"keyframe interval: 3.9s, expected at most 3s"}, reasons)
+	})
+	t.Run("frozen", func(t *testing.T) {
+		in := newInspector(config{frozenImage: true})
+
+		// Alternating IDR picture IDs.
+		var reasons []string
+		for i := 0; i < 6; i++ {
+			keyframe := idrAVCC(byte(i % 2))
+			reasons = append(reasons, in.inspect(testSegment(uint64(i), at(i), 10, 2*time.Second, keyframe))...)
+		}
+		require.Equal(t, []string{"frozen image: identical keyframes in 3 segments"}, reasons)
+	})
+	t.Run("frozenDisabled", func(t *testing.T) {
+		in := newInspector(config{})
+		for i := 0; i < 6; i++ {
+			require.Empty(t, in.inspect(testSegment(uint64(i), at(i), 10, 2*time.Second, idrAVCC(1))))
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		in := newInspector(config{minFPS: 10})
+		for i := 0; i < 6; i++ {
+			require.Empty(t, in.inspect(&hls.Segment{}))
+		}
+	})
+}
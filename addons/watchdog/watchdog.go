@@ -2,6 +2,8 @@ package watchdog
 
 // Watchdog detects and restarts frozen processes.
 // Freeze is detected by polling the output HLS manifest for file updates.
+// The video samples of each segment are inspected for frozen images,
+// low framerates and long keyframe intervals.
 
 import (
 	"context"
@@ -9,12 +11,14 @@ import (
 	"nvr"
 	"nvr/pkg/log"
 	"nvr/pkg/monitor"
+	"nvr/pkg/video/hls"
 	"time"
 )
 
 func init() {
 	nvr.RegisterMonitorInputProcessHook(onInputProcessStart)
 	nvr.RegisterLogSource([]string{"watchdog"})
+	nvr.RegisterTplHook(modifyTemplates)
 }
 
 const defaultInterval = 15 * time.Second
@@ -33,6 +37,13 @@ func onInputProcessStart(ctx context.Context, i *monitor.InputProcess, _ *[]stri
 		})
 	}
 
+	// The freeze detection doesn't depend on the config.
+	conf, err := parseConfig(i.Config)
+	if err != nil {
+		logf(log.LevelError, "could not parse config, using defaults: %v", err)
+		conf = &config{action: actionRestart}
+	}
+
 	muxer := func(ctx context.Context) (muxer, error) {
 		return i.HLSMuxer(ctx)
 	}
@@ -40,6 +51,7 @@ func onInputProcessStart(ctx context.Context, i *monitor.InputProcess, _ *[]stri
 	d := &watchdog{
 		muxer:    muxer,
 		interval: defaultInterval,
+		config:   *conf,
 		onFreeze: i.Cancel,
 		logf:     logf,
 	}
@@ -48,11 +60,13 @@ func onInputProcessStart(ctx context.Context, i *monitor.InputProcess, _ *[]stri
 
 type muxer interface {
 	WaitForSegFinalized()
+	NextSegment(prevID uint64) (*hls.Segment, error)
 }
 
 type watchdog struct {
 	muxer    func(context.Context) (muxer, error)
 	interval time.Duration
+	config   config
 	onFreeze func()
 	logf     func(log.Level, string, ...interface{})
 }
@@ -65,6 +79,8 @@ func (d *watchdog) start(ctx context.Context) {
 		return
 	}
 
+	go d.inspectSegments(ctx)
+
 	keepAlive := make(chan struct{})
 	go func() {
 		for {
@@ -99,3 +115,55 @@ func (d *watchdog) start(ctx context.Context) {
 		}
 	}
 }
+
+// inspectSegments inspects new segments until the context is canceled
+// or a check fails and the process is restarted.
+func (d *watchdog) inspectSegments(ctx context.Context) {
+	in := newInspector(d.config)
+
+	// Segments from before the warmup may be from the previous process.
+	start := time.Now()
+	var prevID uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		seg, err := d.nextSegment(ctx, prevID)
+		if err != nil {
+			select {
+			case <-time.After(1 * time.Second):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		prevID = seg.ID
+		if seg.StartTime.Before(start) {
+			continue
+		}
+
+		reasons := in.inspect(seg)
+		if len(reasons) == 0 {
+			continue
+		}
+		for _, reason := range reasons {
+			d.logf(log.LevelError, "%v", reason)
+		}
+		if d.config.action == actionRestart && ctx.Err() == nil {
+			d.logf(log.LevelError, "restarting..")
+			d.onFreeze()
+			return
+		}
+	}
+}
+
+func (d *watchdog) nextSegment(ctx context.Context, prevID uint64) (*hls.Segment, error) {
+	muxer, err := d.muxer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return muxer.NextSegment(prevID)
+}
@@ -2,19 +2,36 @@ package watchdog
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"nvr/pkg/log"
+	"nvr/pkg/video/hls"
 
 	"github.com/stretchr/testify/require"
 )
 
-type stubMuxer struct{}
+type stubMuxer struct {
+	segments chan *hls.Segment
+}
 
 func (m *stubMuxer) WaitForSegFinalized() {}
 
+var errNoSegments = errors.New("no segments")
+
+func (m *stubMuxer) NextSegment(uint64) (*hls.Segment, error) {
+	if m.segments == nil {
+		return nil, errNoSegments
+	}
+	seg, ok := <-m.segments
+	if !ok {
+		return nil, errNoSegments
+	}
+	return seg, nil
+}
+
 func newStubMuxer(err error) func(context.Context) (muxer, error) {
 	return func(context.Context) (muxer, error) {
 		return &stubMuxer{}, err
@@ -30,6 +47,7 @@ func newTestWatchdog(t *testing.T) (watchdog, chan string) {
 	d := watchdog{
 		interval: 10 * time.Millisecond,
 		muxer:    newStubMuxer(nil),
+		config:   config{frozenImage: true, action: actionRestart},
 		onFreeze: func() {},
 		logf:     logFunc,
 	}
@@ -61,3 +79,61 @@ func TestWatchdog(t *testing.T) {
 		d.start(ctx)
 	})
 }
+
+func TestInspectSegments(t *testing.T) {
+	newSegments := func(start time.Time) chan *hls.Segment {
+		segments := make(chan *hls.Segment, 5)
+		for id := uint64(1); id <= 5; id++ {
+			segments <- testSegment(id, start, 10, 2*time.Second, idrAVCC(1))
+		}
+		close(segments)
+		return segments
+	}
+
+	t.Run("restart", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, logs := newTestWatchdog(t)
+		m := &stubMuxer{segments: newSegments(time.Now().Add(time.Hour))}
+		d.muxer = func(context.Context) (muxer, error) { return m, nil }
+
+		restarted := make(chan struct{})
+		d.onFreeze = func() { close(restarted) }
+
+		go d.inspectSegments(ctx)
+		require.Equal(t, "frozen image: identical keyframes in 3 segments", <-logs)
+		require.Equal(t, "restarting..", <-logs)
+		<-restarted
+	})
+	t.Run("log", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, logs := newTestWatchdog(t)
+		d.config.action = actionLog
+		m := &stubMuxer{segments: newSegments(time.Now().Add(time.Hour))}
+		d.muxer = func(context.Context) (muxer, error) { return m, nil }
+		d.onFreeze = func() { t.Error("should not restart") }
+
+		go d.inspectSegments(ctx)
+		require.Equal(t, "frozen image: identical keyframes in 3 segments", <-logs)
+		require.Eventually(t, func() bool {
+			return len(m.segments) == 0
+		}, time.Second, time.Millisecond)
+	})
+	t.Run("oldSegments", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d, _ := newTestWatchdog(t)
+		m := &stubMuxer{segments: newSegments(time.Now().Add(-time.Hour))}
+		d.muxer = func(context.Context) (muxer, error) { return m, nil }
+		d.onFreeze = func() { t.Error("should not restart") }
+
+		go d.inspectSegments(ctx)
+		require.Eventually(t, func() bool {
+			return len(m.segments) == 0
+		}, time.Second, time.Millisecond)
+	})
+}
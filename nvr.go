@@ -13,6 +13,8 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"nvr/pkg/eventfeed"
+	"nvr/pkg/eventstore"
 	"nvr/pkg/group"
 	"nvr/pkg/log"
 	"nvr/pkg/monitor"
@@ -187,7 +189,7 @@ func Run() error {
 
 	/*** The end of Un-register OS-NVR ***/
 
-	app.monitorManager.StopMonitors()
+	app.MonitorManager.StopMonitors()
 	app.logf(log.LevelInfo, "Monitors stopped.")
 
 	cancel()
@@ -207,8 +209,10 @@ type App struct {
 	WG             *sync.WaitGroup
 	Logger         *log.Logger
 	logStore       *log.Store
+	eventStore     *eventstore.Store
+	eventFeed      *eventfeed.Feed
 	Env            storage.ConfigEnv
-	monitorManager *monitor.Manager
+	MonitorManager *monitor.Manager
 	Auth           auth.Authenticator
 	Storage        *storage.Manager
 	videoServer    *video.Server
@@ -248,6 +252,14 @@ func newApp(envPath string, wg *sync.WaitGroup, hooks *hookList) (*App, error) {
 		return nil, fmt.Errorf("could not create log store: %w", err)
 	}
 
+	// Events.
+	eventDir := filepath.Join(env.StorageDir, "events")
+	eventStore, err := eventstore.NewStore(eventDir, wg, logger, general.DiskSpace)
+	if err != nil {
+		return nil, fmt.Errorf("could not create event store: %w", err)
+	}
+	eventFeed := eventfeed.NewFeed(wg)
+
 	// Video server.
 	videoServer := video.NewServer(logger, wg, *env)
 
@@ -258,7 +270,7 @@ func newApp(envPath string, wg *sync.WaitGroup, hooks *hookList) (*App, error) {
 		*env,
 		logger,
 		videoServer,
-		hooks.monitor(),
+		eventHooks(hooks.monitor(), eventStore, eventFeed),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("could not create monitor manager: %w", err)
@@ -285,6 +297,7 @@ func newApp(envPath string, wg *sync.WaitGroup, hooks *hookList) (*App, error) {
 	// Storage.
 	storageManager := storage.NewManager(env.StorageDir, general, logger)
 	crawler := storage.NewCrawler(os.DirFS(storageManager.RecordingsDir()))
+	crawler.SetMaxRecordingLength(monitorManager.MaxVideoLength)
 
 	// Time zone.
 	timeZone, err := system.TimeZone()
@@ -351,6 +364,7 @@ func newApp(envPath string, wg *sync.WaitGroup, hooks *hookList) (*App, error) {
 	router.Handle("/api/monitor/restart", a.Admin(web.MonitorRestart(monitorManager)))
 	router.Handle("/api/monitor/set", a.Admin(web.MonitorSet(monitorManager)))
 	router.Handle("/api/monitor/delete", a.Admin(web.MonitorDelete(monitorManager)))
+	router.Handle("/api/monitor/trigger", web.MonitorTrigger(monitorManager, a))
 
 	router.Handle("/api/group/configs", a.User(web.GroupConfigs(groupManager)))
 	router.Handle("/api/group/set", a.Admin(a.CSRF(web.GroupSet(groupManager))))
@@ -360,6 +374,13 @@ func newApp(envPath string, wg *sync.WaitGroup, hooks *hookList) (*App, error) {
 	router.Handle("/api/recording/thumbnail/", a.User(web.RecordingThumbnail(env.RecordingsDir())))
 	router.Handle("/api/recording/video/", a.User(web.RecordingVideo(logger, env.RecordingsDir())))
 	router.Handle("/api/recording/query", a.User(web.RecordingQuery(crawler, logger)))
+	router.Handle("/api/recording/search", a.User(web.RecordingSearch(crawler, logger)))
+	router.Handle("/api/recording/coverage", a.User(web.RecordingCoverage(crawler, logger)))
+	router.Handle("/api/recording/export", a.User(web.RecordingExport(crawler, logger, env.RecordingsDir())))
+	router.Handle("/api/recording/import", a.Admin(a.CSRF(web.RecordingImport(logger, env.RecordingsDir(), env.TempDir, env.FFmpegBin))))
+
+	router.Handle("/api/event/feed", a.User(web.EventFeed(eventFeed, a)))
+	router.Handle("/api/event/query", a.User(web.EventQuery(eventStore)))
 
 	router.Handle("/api/log/feed", a.Admin(web.LogFeed(logger, a)))
 	router.Handle("/api/log/query", a.Admin(web.LogQuery(logStore)))
@@ -369,8 +390,10 @@ func newApp(envPath string, wg *sync.WaitGroup, hooks *hookList) (*App, error) {
 		WG:             wg,
 		Logger:         logger,
 		logStore:       logStore,
+		eventStore:     eventStore,
+		eventFeed:      eventFeed,
 		Env:            *env,
-		monitorManager: monitorManager,
+		MonitorManager: monitorManager,
 		Auth:           a,
 		Storage:        storageManager,
 		videoServer:    videoServer,
@@ -388,9 +411,12 @@ func (app *App) run(ctx context.Context) error {
 		return fmt.Errorf("could not start logger: %w", err)
 	}
 
+	app.eventFeed.Start(ctx)
+
 	app.Logger.LogToWriter(ctx, os.Stdout)
 	app.logStore.SaveLogs(ctx, app.Logger)
 	app.logStore.PurgeLoop(ctx, app.Logger)
+	app.eventStore.Start(ctx)
 	time.Sleep(10 * time.Millisecond)
 
 	if err := hooks.appRun(ctx, app); err != nil {
@@ -407,7 +433,7 @@ func (app *App) run(ctx context.Context) error {
 		return fmt.Errorf("could not start video server: %w", err)
 	}
 
-	app.monitorManager.StartMonitors()
+	app.MonitorManager.StartMonitors()
 
 	go app.Storage.PurgeLoop(ctx, 10*time.Minute)
 
@@ -415,6 +441,71 @@ func (app *App) run(ctx context.Context) error {
 	return app.server.ListenAndServe()
 }
 
+// eventHooks saves every event and recording to the event
+// store and publishes them and the recording status to the feed.
+func eventHooks(
+	h *monitor.Hooks,
+	eventStore *eventstore.Store,
+	eventFeed *eventfeed.Feed,
+) *monitor.Hooks {
+	logError := func(r *monitor.Recorder, format string, a ...interface{}) {
+		r.Logger.Log(log.Entry{
+			Level:     log.LevelError,
+			Src:       "app",
+			MonitorID: r.Config.ID(),
+			Msg:       fmt.Sprintf(format, a...),
+		})
+	}
+
+	eventHook := h.Event
+	h.Event = func(r *monitor.Recorder, event *storage.Event) {
+		eventHook(r, event)
+		if err := eventStore.SaveEvent(r.Config.ID(), *event); err != nil {
+			logError(r, "could not save event: %v", err)
+		}
+		eventFeed.Publish(eventfeed.Message{
+			Type:      eventfeed.TypeEvent,
+			MonitorID: r.Config.ID(),
+			Event:     event,
+		})
+	}
+
+	recStartHook := h.RecStart
+	h.RecStart = func(r *monitor.Recorder, recID string) {
+		recStartHook(r, recID)
+		eventFeed.Publish(eventfeed.Message{
+			Type:        eventfeed.TypeRecordingStarted,
+			MonitorID:   r.Config.ID(),
+			RecordingID: recID,
+		})
+	}
+
+	recFailedHook := h.RecFailed
+	h.RecFailed = func(r *monitor.Recorder, err error) {
+		recFailedHook(r, err)
+		eventFeed.Publish(eventfeed.Message{
+			Type:      eventfeed.TypeRecordingFailed,
+			MonitorID: r.Config.ID(),
+			Error:     err.Error(),
+		})
+	}
+
+	recSavedHook := h.RecSaved
+	h.RecSaved = func(r *monitor.Recorder, recPath string, recData storage.RecordingData) {
+		recID := filepath.Base(recPath)
+		if err := eventStore.SaveRecording(r.Config.ID(), recID, recData); err != nil {
+			logError(r, "could not save recording event: %v", err)
+		}
+		eventFeed.Publish(eventfeed.Message{
+			Type:        eventfeed.TypeRecordingSaved,
+			MonitorID:   r.Config.ID(),
+			RecordingID: recID,
+		})
+		recSavedHook(r, recPath, recData)
+	}
+	return h
+}
+
 func (app *App) logf(level log.Level, format string, a ...interface{}) {
 	app.Logger.Log(log.Entry{
 		Level: level,
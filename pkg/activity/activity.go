@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package activity lets addons signal activity on a monitor
+// to each other, the motion addon can wake object detection.
+package activity
+
+import "sync"
+
+// Signal fans out activity reports to subscribers by monitor ID.
+type Signal struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+// NewSignal creates a signal.
+func NewSignal() *Signal {
+	return &Signal{
+		subs: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Default signal shared by all addons.
+var Default = NewSignal()
+
+// Report activity on the monitor. Never blocks, reports are
+// coalesced if the subscriber hasn't received the previous one.
+func (s *Signal) Report(monitorID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subs[monitorID] {
+		select {
+		case sub <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// CancelFunc removes the subscription.
+type CancelFunc func()
+
+// Subscribe to activity on the monitor.
+func (s *Signal) Subscribe(monitorID string) (<-chan struct{}, CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := make(chan struct{}, 1)
+	if s.subs[monitorID] == nil {
+		s.subs[monitorID] = make(map[chan struct{}]struct{})
+	}
+	s.subs[monitorID][sub] = struct{}{}
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.subs[monitorID], sub)
+		if len(s.subs[monitorID]) == 0 {
+			delete(s.subs, monitorID)
+		}
+	}
+	return sub, cancel
+}
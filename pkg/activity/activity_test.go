@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package activity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignal(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		s := NewSignal()
+		a, cancelA := s.Subscribe("a")
+		defer cancelA()
+		b, cancelB := s.Subscribe("b")
+		defer cancelB()
+
+		s.Report("a")
+		require.Len(t, a, 1)
+		require.Len(t, b, 0)
+	})
+	t.Run("coalesce", func(t *testing.T) {
+		s := NewSignal()
+		a, cancel := s.Subscribe("a")
+		defer cancel()
+
+		s.Report("a")
+		s.Report("a")
+		require.Len(t, a, 1)
+		<-a
+		require.Len(t, a, 0)
+	})
+	t.Run("cancel", func(t *testing.T) {
+		s := NewSignal()
+		a, cancel := s.Subscribe("a")
+		cancel()
+
+		s.Report("a")
+		require.Len(t, a, 0)
+		require.Empty(t, s.subs)
+	})
+	t.Run("noSubscribers", func(t *testing.T) {
+		NewSignal().Report("a")
+	})
+}
@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package eventfeed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"nvr/pkg/storage"
+)
+
+// Type message type.
+type Type string
+
+// Message types.
+const (
+	TypeEvent            Type = "event"
+	TypeRecordingStarted Type = "recordingStarted"
+	TypeRecordingSaved   Type = "recordingSaved"
+	TypeRecordingFailed  Type = "recordingFailed"
+)
+
+// Message feed message.
+type Message struct {
+	Type      Type      `json:"type"`
+	Time      time.Time `json:"time"`
+	MonitorID string    `json:"monitorID"`
+
+	// Only set for events.
+	Event *storage.Event `json:"event,omitempty"`
+
+	// Not set for events or failed recordings that never started.
+	RecordingID string `json:"recordingID,omitempty"`
+
+	// Only set for failed recordings.
+	Error string `json:"error,omitempty"`
+}
+
+// Feed broadcasts events and recording status to subscribers.
+type Feed struct {
+	feed  chan Message      // feed of messages.
+	sub   chan chan Message // subscribe requests.
+	unsub chan chan Message // unsubscribe requests.
+
+	wg  *sync.WaitGroup
+	Ctx context.Context
+}
+
+// NewFeed returns new Feed.
+func NewFeed(wg *sync.WaitGroup) *Feed {
+	return &Feed{
+		feed:  make(chan Message),
+		sub:   make(chan chan Message),
+		unsub: make(chan chan Message),
+
+		wg: wg,
+	}
+}
+
+// subscriberBuffer prevents a slow subscriber from blocking recorders.
+const subscriberBuffer = 100
+
+// Start feed.
+func (f *Feed) Start(ctx context.Context) {
+	f.Ctx = ctx
+
+	f.wg.Add(1)
+	go func() {
+		subs := map[chan Message]struct{}{}
+		for {
+			select {
+			case <-ctx.Done():
+				// Only exit if everyone has unsubscribed.
+				if len(subs) == 0 {
+					f.wg.Done()
+					return
+				}
+				time.Sleep(50 * time.Millisecond)
+
+			case ch := <-f.sub:
+				subs[ch] = struct{}{}
+
+			case ch := <-f.unsub:
+				close(ch)
+				delete(subs, ch)
+
+			case msg := <-f.feed:
+				for ch := range subs {
+					select {
+					case ch <- msg:
+					default: // Drop message if the subscriber is full.
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Publish message to all subscribers.
+func (f *Feed) Publish(msg Message) {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	if msg.Event != nil {
+		// Frames are not sent to subscribers.
+		event := *msg.Event
+		event.Frame = nil
+		msg.Event = &event
+	}
+
+	select {
+	case <-f.Ctx.Done():
+	case f.feed <- msg:
+	}
+}
+
+// CancelFunc cancels feed subsciption.
+type CancelFunc func()
+
+// Subscribe returns a new chan with the feed and a CancelFunc.
+func (f *Feed) Subscribe() (<-chan Message, CancelFunc) {
+	feed := make(chan Message, subscriberBuffer)
+
+	select {
+	case <-f.Ctx.Done():
+		close(feed)
+		return feed, func() {}
+	case f.sub <- feed:
+	}
+
+	cancel := func() {
+		f.unSubscribe(feed)
+	}
+	return feed, cancel
+}
+
+func (f *Feed) unSubscribe(feed chan Message) {
+	// Read feed until unsub request is accepted.
+	for {
+		select {
+		case f.unsub <- feed:
+			return
+		case <-feed:
+		}
+	}
+}
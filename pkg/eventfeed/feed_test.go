@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package eventfeed
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFeed(t *testing.T) (*Feed, context.CancelFunc, *sync.WaitGroup) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	feed := NewFeed(wg)
+	feed.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	return feed, cancel, wg
+}
+
+func TestFeed(t *testing.T) {
+	t.Run("publish", func(t *testing.T) {
+		feed, _, _ := newTestFeed(t)
+
+		feed1, cancel1 := feed.Subscribe()
+		defer cancel1()
+		feed2, cancel2 := feed.Subscribe()
+		defer cancel2()
+
+		msg := Message{
+			Type:        TypeRecordingStarted,
+			Time:        time.Unix(1, 0),
+			MonitorID:   "m1",
+			RecordingID: "x",
+		}
+		feed.Publish(msg)
+		require.Equal(t, msg, <-feed1)
+		require.Equal(t, msg, <-feed2)
+	})
+	t.Run("event", func(t *testing.T) {
+		feed, _, _ := newTestFeed(t)
+
+		sub, cancel := feed.Subscribe()
+		defer cancel()
+
+		frame := &storage.Frame{Image: image.NewGray(image.Rect(0, 0, 1, 1))}
+		event := &storage.Event{
+			Detections: []storage.Detection{{Label: "a"}},
+			Frame:      frame,
+		}
+		feed.Publish(Message{Type: TypeEvent, MonitorID: "m1", Event: event})
+
+		msg := <-sub
+		require.False(t, msg.Time.IsZero())
+		require.Nil(t, msg.Event.Frame)
+		require.Equal(t, event.Detections, msg.Event.Detections)
+		require.Equal(t, frame, event.Frame, "original event modified")
+	})
+	t.Run("slowSubscriber", func(t *testing.T) {
+		feed, _, _ := newTestFeed(t)
+
+		slow, cancelSlow := feed.Subscribe()
+		defer cancelSlow()
+
+		for i := 0; i < subscriberBuffer+10; i++ {
+			feed.Publish(Message{Type: TypeEvent})
+		}
+		require.Len(t, slow, subscriberBuffer)
+	})
+	t.Run("cancel", func(t *testing.T) {
+		feed, _, _ := newTestFeed(t)
+
+		sub, cancel := feed.Subscribe()
+		feed.Publish(Message{})
+		cancel()
+
+		// The channel is closed after the pending messages are drained.
+		for range sub {
+		}
+	})
+	t.Run("canceledContext", func(t *testing.T) {
+		feed, cancel, wg := newTestFeed(t)
+		cancel()
+		wg.Wait()
+
+		sub, _ := feed.Subscribe()
+		_, ok := <-sub
+		require.False(t, ok)
+
+		// Should not block.
+		feed.Publish(Message{})
+	})
+}
@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvr/pkg/log"
+	"nvr/pkg/storage"
+	"sync"
+	"time"
+)
+
+// Events and recordings are saved as entries in a log store.
+// The source is the record kind and the message is the json payload.
+const (
+	srcEvent     = "event"
+	srcRecording = "rec"
+)
+
+// Number of records that can be queued before they're dropped.
+const queueSize = 100
+
+// Recordings are saved shortly after their events, recordings saved
+// more than this long after the last event aren't searched.
+const recordingLookahead = log.UnixMicro(24 * time.Hour / time.Microsecond)
+
+// Entry stored event.
+type Entry struct {
+	// Unique timestamp, may be a few microseconds
+	// later than the event if events arrive at once.
+	Time       log.UnixMicro       `json:"time"`
+	MonitorID  string              `json:"monitorID"`
+	Detections []storage.Detection `json:"detections"`
+	Duration   time.Duration       `json:"duration"`
+
+	// Recording that the event was saved to, empty if none.
+	RecordingID string `json:"recordingID"`
+}
+
+// eventPayload is the message of event records.
+type eventPayload struct {
+	Time       time.Time           `json:"time"`
+	Detections []storage.Detection `json:"detections"`
+	Duration   time.Duration       `json:"duration"`
+}
+
+// recordingPayload is the message of recording records.
+type recordingPayload struct {
+	ID    string    `json:"id"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Store append only event store. Events are saved when they
+// are received and recordings are saved when they are saved.
+// Events are linked to their recordings when queried.
+type Store struct {
+	logs   *log.Store
+	logger log.ILogger
+	queue  chan log.Entry
+	wg     *sync.WaitGroup
+}
+
+// NewStore new event store.
+func NewStore(
+	dir string,
+	wg *sync.WaitGroup,
+	logger log.ILogger,
+	getDiskSpace func() (int64, error),
+) (*Store, error) {
+	logs, err := log.NewStore(dir, wg, getDiskSpace)
+	if err != nil {
+		return nil, fmt.Errorf("new store: %w", err)
+	}
+	return &Store{
+		logs:   logs,
+		logger: logger,
+		queue:  make(chan log.Entry, queueSize),
+		wg:     wg,
+	}, nil
+}
+
+// Start saves the queued records and purges old events until the
+// context is canceled. Queued records are saved before returning.
+func (s *Store) Start(ctx context.Context) {
+	s.logs.PurgeLoop(ctx, s.logger)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				for {
+					select {
+					case entry := <-s.queue:
+						s.save(entry)
+					default:
+						s.logs.Close()
+						return
+					}
+				}
+			case entry := <-s.queue:
+				s.save(entry)
+			}
+		}
+	}()
+}
+
+func (s *Store) save(entry log.Entry) {
+	if err := s.logs.Save(entry); err != nil {
+		s.logger.Log(log.Entry{
+			Level:     log.LevelError,
+			Src:       "app",
+			MonitorID: entry.MonitorID,
+			Msg:       fmt.Sprintf("could not save %v: %v", entry.Src, err),
+		})
+	}
+}
+
+// ErrQueueFull the record was dropped.
+var ErrQueueFull = errors.New("queue full")
+
+// enqueue doesn't block, the records are saved by Start.
+func (s *Store) enqueue(t time.Time, src string, monitorID string, payload []byte) error {
+	entry := log.Entry{
+		Level:     log.LevelInfo,
+		Src:       src,
+		MonitorID: monitorID,
+		Msg:       string(payload),
+		Time:      log.UnixMicro(t.UnixMicro()),
+	}
+	select {
+	case s.queue <- entry:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// SaveEvent queues the event to be saved.
+func (s *Store) SaveEvent(monitorID string, event storage.Event) error {
+	payload, err := json.Marshal(eventPayload{
+		Time:       event.Time,
+		Detections: event.Detections,
+		Duration:   event.Duration,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	return s.enqueue(event.Time, srcEvent, monitorID, payload)
+}
+
+// SaveRecording queues a reference to a recording that
+// contains the events between the start and end time.
+func (s *Store) SaveRecording(monitorID string, recordingID string, data storage.RecordingData) error {
+	payload, err := json.Marshal(recordingPayload{
+		ID:    recordingID,
+		Start: data.Start,
+		End:   data.End,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal recording: %w", err)
+	}
+	return s.enqueue(time.Now(), srcRecording, monitorID, payload)
+}
+
+// Query event query.
+type Query struct {
+	// Only return events before this time. Zero means no limit.
+	End log.UnixMicro
+
+	// Only return events at or after this time. Zero means no limit.
+	Start log.UnixMicro
+
+	Monitors []string
+
+	// Only return events with at least one detection with one of these labels.
+	Labels []string
+
+	Limit int
+}
+
+// Query returns events matching the query, newest first.
+func (s *Store) Query(q Query) ([]Entry, error) {
+	entries := []Entry{}
+	eventTimes := []time.Time{}
+	logQuery := log.Query{
+		Time:     q.End,
+		Sources:  []string{srcEvent},
+		Monitors: q.Monitors,
+	}
+	err := s.logs.Scan(logQuery, func(e log.Entry) bool {
+		if q.Start != 0 && e.Time < q.Start {
+			return false
+		}
+		var payload eventPayload
+		if err := json.Unmarshal([]byte(e.Msg), &payload); err != nil {
+			s.logWarning("unmarshal event %v: %v", e.Time, err)
+			return true
+		}
+		if !hasLabel(payload.Detections, q.Labels) {
+			return true
+		}
+		entries = append(entries, Entry{
+			Time:       e.Time,
+			MonitorID:  e.MonitorID,
+			Detections: payload.Detections,
+			Duration:   payload.Duration,
+		})
+		eventTimes = append(eventTimes, payload.Time)
+		return q.Limit == 0 || len(entries) < q.Limit
+	})
+	if errors.Is(err, log.ErrChunkRead) {
+		s.logWarning("%v", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return entries, nil
+	}
+
+	recordings, err := s.recordingsBetween(entries[len(entries)-1].Time, entries[0].Time)
+	if err != nil {
+		return nil, fmt.Errorf("recordings: %w", err)
+	}
+	for i, entry := range entries {
+		entries[i].RecordingID = findRecording(recordings[entry.MonitorID], eventTimes[i])
+	}
+
+	return entries, nil
+}
+
+func (s *Store) logWarning(format string, a ...interface{}) {
+	s.logger.Log(log.Entry{
+		Level: log.LevelWarning,
+		Src:   "app",
+		Msg:   "event store: " + fmt.Sprintf(format, a...),
+	})
+}
+
+// hasLabel returns true if any detection has one of the labels or if labels is empty.
+func hasLabel(detections []storage.Detection, labels []string) bool {
+	if len(labels) == 0 {
+		return true
+	}
+	for _, d := range detections {
+		if log.StringInStrings(d.Label, labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingsBetween returns the recordings, by monitor ID, that
+// were saved after the first event and before the lookahead.
+func (s *Store) recordingsBetween(
+	first log.UnixMicro,
+	last log.UnixMicro,
+) (map[string][]recordingPayload, error) {
+	recordings := make(map[string][]recordingPayload)
+	logQuery := log.Query{
+		Time:    last + recordingLookahead,
+		Sources: []string{srcRecording},
+	}
+	err := s.logs.Scan(logQuery, func(e log.Entry) bool {
+		if e.Time < first {
+			return false
+		}
+		var payload recordingPayload
+		if err := json.Unmarshal([]byte(e.Msg), &payload); err != nil {
+			s.logWarning("unmarshal recording %v: %v", e.Time, err)
+			return true
+		}
+		recordings[e.MonitorID] = append(recordings[e.MonitorID], payload)
+		return true
+	})
+	if errors.Is(err, log.ErrChunkRead) {
+		s.logWarning("%v", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return recordings, nil
+}
+
+// findRecording returns the ID of the recording that contains the time.
+func findRecording(recordings []recordingPayload, t time.Time) string {
+	for _, rec := range recordings {
+		if !t.Before(rec.Start) && t.Before(rec.End) {
+			return rec.ID
+		}
+	}
+	return ""
+}
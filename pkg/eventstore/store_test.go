@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package eventstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"nvr/pkg/log"
+	"nvr/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *stubLogger) Log(entry log.Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, entry.Msg)
+}
+
+// newTestStore returns a started store and a function that
+// stops the store after the queued records have been saved.
+func newTestStore(t *testing.T, dir string) (*Store, func()) {
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	wg := &sync.WaitGroup{}
+	store, err := NewStore(dir, wg, &stubLogger{}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store.Start(ctx)
+	stop := func() {
+		cancel()
+		wg.Wait()
+	}
+	t.Cleanup(stop)
+	return store, stop
+}
+
+func newTestEvent(t time.Time, labels ...string) storage.Event {
+	event := storage.Event{Time: t, Duration: time.Second}
+	for _, label := range labels {
+		event.Detections = append(event.Detections, storage.Detection{
+			Label: label,
+			Score: 50,
+		})
+	}
+	return event
+}
+
+func toMicro(t time.Time) log.UnixMicro {
+	return log.UnixMicro(t.UnixMicro())
+}
+
+func TestQuery(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	t1, t2, t3 := now.Add(-3*time.Second), now.Add(-2*time.Second), now.Add(-1*time.Second)
+
+	store, stop := newTestStore(t, "")
+	require.NoError(t, store.SaveEvent("m1", newTestEvent(t1, "person")))
+	require.NoError(t, store.SaveEvent("m2", newTestEvent(t2, "car")))
+	require.NoError(t, store.SaveEvent("m1", newTestEvent(t3, "car", "person")))
+	stop()
+
+	entry1 := Entry{
+		Time:       toMicro(t1),
+		MonitorID:  "m1",
+		Detections: []storage.Detection{{Label: "person", Score: 50}},
+		Duration:   time.Second,
+	}
+	entry2 := Entry{
+		Time:       toMicro(t2),
+		MonitorID:  "m2",
+		Detections: []storage.Detection{{Label: "car", Score: 50}},
+		Duration:   time.Second,
+	}
+	entry3 := Entry{
+		Time:      toMicro(t3),
+		MonitorID: "m1",
+		Detections: []storage.Detection{
+			{Label: "car", Score: 50},
+			{Label: "person", Score: 50},
+		},
+		Duration: time.Second,
+	}
+
+	cases := map[string]struct {
+		input    Query
+		expected []Entry
+	}{
+		"all":          {Query{}, []Entry{entry3, entry2, entry1}},
+		"limit":        {Query{Limit: 2}, []Entry{entry3, entry2}},
+		"monitor":      {Query{Monitors: []string{"m1"}}, []Entry{entry3, entry1}},
+		"label":        {Query{Labels: []string{"person"}}, []Entry{entry3, entry1}},
+		"labels":       {Query{Labels: []string{"car", "x"}}, []Entry{entry3, entry2}},
+		"monitorLabel": {Query{Monitors: []string{"m2"}, Labels: []string{"person"}}, []Entry{}},
+		"end":          {Query{End: toMicro(t3)}, []Entry{entry2, entry1}},
+		"start":        {Query{Start: toMicro(t2)}, []Entry{entry3, entry2}},
+		"startEnd":     {Query{Start: toMicro(t2), End: toMicro(t3)}, []Entry{entry2}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			entries, err := store.Query(tc.input)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, entries)
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		store, _ := newTestStore(t, "")
+		entries, err := store.Query(Query{})
+		require.NoError(t, err)
+		require.Equal(t, []Entry{}, entries)
+	})
+}
+
+func TestRecordingID(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	store, stop := newTestStore(t, "")
+
+	require.NoError(t, store.SaveEvent("m1", newTestEvent(now.Add(-10*time.Second))))
+	require.NoError(t, store.SaveEvent("m2", newTestEvent(now.Add(-9*time.Second))))
+	require.NoError(t, store.SaveEvent("m1", newTestEvent(now.Add(-5*time.Second))))
+	require.NoError(t, store.SaveEvent("m1", newTestEvent(now.Add(-1*time.Second))))
+
+	require.NoError(t, store.SaveRecording("m1", "rec1", storage.RecordingData{
+		Start: now.Add(-11 * time.Second),
+		End:   now.Add(-5 * time.Second),
+	}))
+	require.NoError(t, store.SaveRecording("m1", "rec2", storage.RecordingData{
+		Start: now.Add(-5 * time.Second),
+		End:   now.Add(-2 * time.Second),
+	}))
+	stop()
+
+	entries, err := store.Query(Query{})
+	require.NoError(t, err)
+
+	var recordingIDs []string
+	for _, e := range entries {
+		recordingIDs = append(recordingIDs, e.RecordingID)
+	}
+	require.Equal(t, []string{"", "rec2", "", "rec1"}, recordingIDs)
+}
+
+func TestSave(t *testing.T) {
+	t.Run("uniqueTime", func(t *testing.T) {
+		now := time.Now()
+		store, stop := newTestStore(t, "")
+		require.NoError(t, store.SaveEvent("m1", newTestEvent(now)))
+		require.NoError(t, store.SaveEvent("m2", newTestEvent(now)))
+		require.NoError(t, store.SaveEvent("m3", newTestEvent(now.Add(-time.Second))))
+		stop()
+
+		entries, err := store.Query(Query{})
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		require.Equal(t, toMicro(now)+2, entries[0].Time)
+		require.Equal(t, toMicro(now)+1, entries[1].Time)
+		require.Equal(t, toMicro(now), entries[2].Time)
+	})
+	t.Run("reopen", func(t *testing.T) {
+		now := time.Now()
+		dir := t.TempDir()
+
+		store, stop := newTestStore(t, dir)
+		require.NoError(t, store.SaveEvent("m1", newTestEvent(now, "a")))
+		stop()
+
+		store, stop = newTestStore(t, dir)
+		require.NoError(t, store.SaveEvent("m2", newTestEvent(now, "b")))
+		stop()
+
+		entries, err := store.Query(Query{})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, "m2", entries[0].MonitorID)
+		require.Equal(t, "b", entries[0].Detections[0].Label)
+		require.Equal(t, toMicro(now)+1, entries[0].Time)
+		require.Equal(t, "m1", entries[1].MonitorID)
+		require.Equal(t, "a", entries[1].Detections[0].Label)
+	})
+	t.Run("multipleChunks", func(t *testing.T) {
+		// Chunks are about 28 hours long.
+		t1 := time.UnixMicro(1)
+		t2 := t1.Add(48 * time.Hour)
+		t3 := t1.Add(96 * time.Hour)
+
+		store, stop := newTestStore(t, "")
+		require.NoError(t, store.SaveEvent("m1", newTestEvent(t1)))
+		require.NoError(t, store.SaveEvent("m1", newTestEvent(t2)))
+		require.NoError(t, store.SaveEvent("m1", newTestEvent(t3)))
+		stop()
+
+		entries, err := store.Query(Query{})
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		require.Equal(t, toMicro(t3), entries[0].Time)
+		require.Equal(t, toMicro(t1), entries[2].Time)
+
+		entries, err = store.Query(Query{End: toMicro(t3), Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, toMicro(t2), entries[0].Time)
+
+		entries, err = store.Query(Query{Start: toMicro(t2)})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+	})
+	t.Run("saveErr", func(t *testing.T) {
+		logger := &stubLogger{}
+		store, stop := newTestStore(t, "")
+		store.logger = logger
+		require.NoError(t, store.SaveEvent("0123456789012345678901234", newTestEvent(time.Now())))
+		stop()
+
+		require.Equal(t, []string{"could not save event: encode: encode entry: monitor ID too long"}, logger.msgs)
+	})
+	t.Run("queueFull", func(t *testing.T) {
+		store, err := NewStore(t.TempDir(), &sync.WaitGroup{}, &stubLogger{}, nil)
+		require.NoError(t, err)
+
+		// The store isn't started.
+		for i := 0; i < queueSize; i++ {
+			require.NoError(t, store.SaveEvent("m1", newTestEvent(time.Now())))
+		}
+		require.ErrorIs(t, store.SaveEvent("m1", newTestEvent(time.Now())), ErrQueueFull)
+	})
+}
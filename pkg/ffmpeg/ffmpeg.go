@@ -179,6 +179,12 @@ func HWaccels(bin string) ([]string, error) {
 // Rect top, left, bottom, right.
 type Rect [4]int
 
+// Center returns the x and y coordinates of the rectangle center.
+func (r Rect) Center() (float64, float64) {
+	top, left, bottom, right := r[0], r[1], r[2], r[3]
+	return float64(left+right) / 2, float64(top+bottom) / 2
+}
+
 // Point on image.
 type Point [2]int
 
@@ -204,12 +210,12 @@ func (p Polygon) ToAbs(w, h int) Polygon {
 func CreateMask(w int, h int, poly Polygon) image.Image {
 	img := image.NewAlpha(image.Rect(0, 0, w, h))
 
-	for y := 0; y < w; y++ {
-		for x := 0; x < h; x++ {
-			if VertexInsidePoly(y, x, poly) {
-				img.Set(y, x, color.Alpha{255})
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			if VertexInsidePoly(x, y, poly) {
+				img.Set(x, y, color.Alpha{255})
 			} else {
-				img.Set(y, x, color.Alpha{0})
+				img.Set(x, y, color.Alpha{0})
 			}
 		}
 	}
@@ -221,12 +227,12 @@ func CreateMask(w int, h int, poly Polygon) image.Image {
 func CreateInvertedMask(w int, h int, poly Polygon) image.Image {
 	img := image.NewAlpha(image.Rect(0, 0, w, h))
 
-	for y := 0; y < w; y++ {
-		for x := 0; x < h; x++ {
-			if VertexInsidePoly(y, x, poly) {
-				img.Set(y, x, color.Alpha{0})
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			if VertexInsidePoly(x, y, poly) {
+				img.Set(x, y, color.Alpha{0})
 			} else {
-				img.Set(y, x, color.Alpha{255})
+				img.Set(x, y, color.Alpha{255})
 			}
 		}
 	}
@@ -234,7 +240,7 @@ func CreateInvertedMask(w int, h int, poly Polygon) image.Image {
 }
 
 // VertexInsidePoly returns true if point is inside polygon.
-func VertexInsidePoly(y int, x int, poly Polygon) bool {
+func VertexInsidePoly(x int, y int, poly Polygon) bool {
 	inside := false
 	j := len(poly) - 1
 	for i := 0; i < len(poly); i++ {
@@ -243,7 +249,7 @@ func VertexInsidePoly(y int, x int, poly Polygon) bool {
 		xj := poly[j][0]
 		yj := poly[j][1]
 
-		if ((yi > x) != (yj > x)) && (y < (xj-xi)*(x-yi)/(yj-yi)+xi) {
+		if ((yi > y) != (yj > y)) && (x < (xj-xi)*(y-yi)/(yj-yi)+xi) {
 			inside = !inside
 		}
 		j = i
@@ -141,6 +141,19 @@ func TestPolygonToAbs(t *testing.T) {
 	require.Equal(t, "[[20 20] [60 40] [100 60]]", actual)
 }
 
+func TestRectCenter(t *testing.T) {
+	x, y := Rect{10, 20, 30, 45}.Center()
+	require.Equal(t, 32.5, x)
+	require.Equal(t, 20.0, y)
+}
+
+func TestVertexInsidePoly(t *testing.T) {
+	// Wide rectangle, x is the first coordinate.
+	poly := Polygon{{0, 0}, {100, 0}, {100, 10}, {0, 10}}
+	require.True(t, VertexInsidePoly(50, 5, poly))
+	require.False(t, VertexInsidePoly(5, 50, poly))
+}
+
 func TestCreateMask(t *testing.T) {
 	cases := map[string]struct {
 		input    Polygon
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -54,9 +55,12 @@ const (
 	idMaxLength  = 24
 )
 
-// Store custom log store.
+// Store custom log store. The store is also used for
+// other records by encoding them in the message.
 type Store struct {
-	logDir  string
+	logDir string
+
+	mu      sync.Mutex
 	encoder *chunkEncoder
 
 	// Keep track of the previous entry time to ensure
@@ -115,13 +119,11 @@ func (s *Store) SaveLogs(ctx context.Context, logger *Logger) {
 		for {
 			select {
 			case <-ctx.Done():
-				if s.encoder != nil {
-					s.encoder.close()
-				}
+				s.Close()
 				s.wg.Done()
 				return
 			case log := <-feed:
-				err := s.saveLog(log)
+				err := s.Save(log)
 				if err != nil {
 					fmt.Printf("could not save log: %v %v\n", log.Msg, err)
 				}
@@ -131,7 +133,7 @@ func (s *Store) SaveLogs(ctx context.Context, logger *Logger) {
 }
 
 // PurgeLoop purges logs every hour.
-func (s *Store) PurgeLoop(ctx context.Context, logger *Logger) {
+func (s *Store) PurgeLoop(ctx context.Context, logger ILogger) {
 	s.wg.Add(1)
 	go func() {
 		for {
@@ -144,7 +146,8 @@ func (s *Store) PurgeLoop(ctx context.Context, logger *Logger) {
 					logger.Log(Entry{
 						Level: LevelError,
 						Src:   "app",
-						Msg:   fmt.Sprintf("could not purge logs: %v", err),
+						Msg: fmt.Sprintf("could not purge %v: %v",
+							filepath.Base(s.logDir), err),
 					})
 				}
 			}
@@ -152,7 +155,30 @@ func (s *Store) PurgeLoop(ctx context.Context, logger *Logger) {
 	}()
 }
 
+// Save saves a single entry. The entry time is increased
+// if it isn't later than the previous entry.
+func (s *Store) Save(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLog(entry)
+}
+
+// Close closes the current chunk, the next save will reopen it.
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.encoder != nil {
+		s.encoder.close()
+		s.encoder = nil
+	}
+}
+
 func (s *Store) saveLog(entry Entry) error {
+	// The time is increased before the chunk is selected
+	// to keep the entry in the chunk of its time.
+	if entry.Time <= s.prevEntryTime {
+		entry.Time = s.prevEntryTime + 1
+	}
 	chunkID, err := timeToID(entry.Time)
 	if err != nil {
 		return fmt.Errorf("time to ID: %w", err)
@@ -193,29 +219,52 @@ type Query struct {
 
 // Query logs in database.
 func (s *Store) Query(q Query) ([]Entry, error) {
+	var entries []Entry
+	err := s.Scan(q, func(entry Entry) bool {
+		entries = append(entries, entry)
+		return q.Limit == 0 || len(entries) < q.Limit
+	})
+	if errors.Is(err, ErrChunkRead) {
+		s.logf("%v", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ErrChunkRead chunk could not be read.
+var ErrChunkRead = errors.New("read chunk")
+
+// Scan calls fn for each entry that matches the query, newest first, until
+// fn returns false. The limit is ignored. A chunk that can't be read is
+// skipped and the first such error is returned after the scan.
+func (s *Store) Scan(q Query, fn func(Entry) bool) error {
 	chunkIDs, err := s.listChunksBefore(q.Time)
 	if err != nil {
-		return nil, fmt.Errorf("list chunks before: %w", err)
+		return fmt.Errorf("list chunks before: %w", err)
 	}
 
-	var entries []Entry
+	var chunkErr error
 	for i := len(chunkIDs) - 1; i >= 0; i-- {
 		chunkID := chunkIDs[i]
-		err := s.queryChunk(q, &entries, chunkID)
-		if err != nil {
-			s.logf("query chunk %q: %v", chunkID, err)
+		done, err := s.queryChunk(q, fn, chunkID)
+		if err != nil && chunkErr == nil {
+			chunkErr = fmt.Errorf("%w: query %q: %v", ErrChunkRead, chunkID, err)
+		}
+		if done {
+			break
 		}
 		// Time is only relevant for the first iteration.
 		q.Time = 0
 	}
-
-	return entries, nil
+	return chunkErr
 }
 
-func (s *Store) queryChunk(q Query, entries *[]Entry, chunkID string) error {
+// queryChunk returns true if fn returned false.
+func (s *Store) queryChunk(q Query, fn func(Entry) bool, chunkID string) (bool, error) {
 	decoder, err := newChunkDecoder(s.logDir, chunkID)
 	if err != nil {
-		return fmt.Errorf("create decoder: %w", err)
+		return false, fmt.Errorf("create decoder: %w", err)
 	}
 	defer decoder.close()
 
@@ -223,19 +272,19 @@ func (s *Store) queryChunk(q Query, entries *[]Entry, chunkID string) error {
 	if q.Time != 0 {
 		index, err = decoder.search(q.Time)
 		if err != nil {
-			return fmt.Errorf("seek: %w", err)
+			return false, fmt.Errorf("seek: %w", err)
 		}
 		index--
 	}
 
-	for index >= 0 && (q.Limit == 0 || len(*entries) < q.Limit) {
+	for index >= 0 {
 		entry, _, err := decoder.decode(index)
 		if err != nil {
-			return err
+			return false, err
 		}
 		if entry == nil {
 			// Last entry.
-			return nil
+			return false, nil
 		}
 		index--
 
@@ -248,10 +297,12 @@ func (s *Store) queryChunk(q Query, entries *[]Entry, chunkID string) error {
 			}
 			continue
 		}
-		*entries = append(*entries, *entry)
+		if !fn(*entry) {
+			return true, nil
+		}
 	}
 
-	return nil
+	return false, nil
 }
 
 func (s *Store) listChunksBefore(time UnixMicro) ([]string, error) {
@@ -570,6 +621,7 @@ func (c *chunkEncoder) close() {
 var (
 	ErrSrcTooLong       = errors.New("source too long")
 	ErrMonitorIDTooLong = errors.New("monitor ID too long")
+	ErrMsgTooLong       = errors.New("message too long")
 )
 
 func encodeEntry(buf []byte, entry Entry, msgFile io.Writer, msgOffset *uint32) error {
@@ -583,6 +635,10 @@ func encodeEntry(buf []byte, entry Entry, msgFile io.Writer, msgOffset *uint32)
 		return ErrMonitorIDTooLong
 	}
 
+	if len(entry.Msg) > math.MaxUint16 {
+		return ErrMsgTooLong
+	}
+
 	// Write message and newline.
 	_, err := msgFile.Write(append([]byte(entry.Msg), byte('\n')))
 	if err != nil {
@@ -252,6 +252,46 @@ func TestQuery(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, expected, actual)
 	})
+	t.Run("orderChunk", func(t *testing.T) {
+		store := newTestStore(t, "")
+		require.NoError(t, store.Save(Entry{Time: chunkDuration - 1}))
+		require.NoError(t, store.Save(Entry{Time: chunkDuration - 1}))
+
+		// The increased time is in the next chunk.
+		chunks, err := store.listChunks()
+		require.NoError(t, err)
+		require.Equal(t, []string{"00000", "00001"}, chunks)
+	})
+	t.Run("partialEntry", func(t *testing.T) {
+		logDir := t.TempDir()
+
+		store := newTestStore(t, logDir)
+		require.NoError(t, store.Save(Entry{Time: 1, Msg: "a"}))
+		store.Close()
+
+		dataPath, _ := chunkIDToPaths(logDir, "00000")
+		file, err := os.OpenFile(dataPath, os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = file.Write([]byte{1, 2, 3})
+		require.NoError(t, err)
+		file.Close()
+
+		store = newTestStore(t, logDir)
+		require.NoError(t, store.Save(Entry{Time: 2, Msg: "b"}))
+
+		expected := []Entry{
+			{Time: 2, Msg: "b"},
+			{Time: 1, Msg: "a"},
+		}
+		actual, err := store.Query(Query{})
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	})
+	t.Run("msgTooLong", func(t *testing.T) {
+		store := newTestStore(t, "")
+		err := store.Save(Entry{Time: 1, Msg: string(make([]byte, 1<<16))})
+		require.ErrorIs(t, err, ErrMsgTooLong)
+	})
 	t.Run("search", func(t *testing.T) {
 		store := newTestStore(t, "")
 
@@ -304,6 +344,35 @@ func TestQuery(t *testing.T) {
 	})
 }
 
+func TestScan(t *testing.T) {
+	store := newTestStore(t, "")
+	for _, time := range []UnixMicro{1, 2, chunkDuration, chunkDuration + 1} {
+		require.NoError(t, store.Save(Entry{Src: "s1", Time: time}))
+		require.NoError(t, store.Save(Entry{Src: "s2", Time: time}))
+	}
+
+	var times []UnixMicro
+	err := store.Scan(Query{Sources: []string{"s1"}}, func(entry Entry) bool {
+		times = append(times, entry.Time)
+		return entry.Time > chunkDuration
+	})
+	require.NoError(t, err)
+	require.Equal(t, []UnixMicro{chunkDuration + 2, chunkDuration}, times)
+
+	t.Run("chunkErr", func(t *testing.T) {
+		dataPath, _ := chunkIDToPaths(store.logDir, "00001")
+		require.NoError(t, os.WriteFile(dataPath, []byte{255}, 0o600))
+
+		var times []UnixMicro
+		err := store.Scan(Query{Sources: []string{"s1"}}, func(entry Entry) bool {
+			times = append(times, entry.Time)
+			return true
+		})
+		require.ErrorIs(t, err, ErrChunkRead)
+		require.Equal(t, []UnixMicro{3, 1}, times)
+	})
+}
+
 func TestNewStore(t *testing.T) {
 	t.Run("mkdir", func(t *testing.T) {
 		tempDir := t.TempDir()
@@ -47,7 +47,8 @@ func (c Config) InputOpts() string {
 	return c.v["inputOptions"]
 }
 
-func (c Config) audioEnabled() bool {
+// AudioEnabled returns true if the audio track is kept.
+func (c Config) AudioEnabled() bool {
 	switch c.v["audioEncoder"] {
 	case "":
 		return false
@@ -91,6 +92,12 @@ func (c Config) alwaysRecord() bool {
 	return c.v["alwaysRecord"] == "true"
 }
 
+// TriggerToken returns the token for external triggers.
+// External triggers are disabled if the token is empty.
+func (c Config) TriggerToken() string {
+	return c.v["triggerToken"]
+}
+
 // TimestampOffset returns the timestamp offset.
 func (c Config) TimestampOffset() string {
 	return c.v["timestampOffset"]
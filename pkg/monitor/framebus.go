@@ -0,0 +1,286 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// FrameConfig decoded frame format. Subscribers with
+// equal configs share a single decoder process.
+type FrameConfig struct {
+	// Video filter chain, "fps=fps=2,scale=iw/2:ih/2".
+	Filter string
+
+	// Output pixel format, "gray" or "rgb24".
+	// Raw output format if Audio is set, "s16le".
+	PixFmt string
+
+	// Size of a single frame in bytes.
+	FrameSize int
+
+	// Decode the audio track instead of the video track.
+	// Filter is used as a audio filter and each frame
+	// is a chunk of FrameSize bytes of samples.
+	Audio bool
+}
+
+// Frame decoded frame or audio chunk. Data is
+// shared between subscribers and must not be modified.
+type Frame struct {
+	Time time.Time
+	Data []byte
+
+	// Number of frames that were dropped right before
+	// this frame because the subscriber fell behind.
+	Dropped int
+}
+
+// Audio chunks are short, audio subscribers can fall
+// further behind before chunks are dropped.
+const (
+	frameBufferSize = 1
+	audioBufferSize = 50
+)
+
+// ErrInvalidFrameConfig invalid frame config.
+var ErrInvalidFrameConfig = errors.New("invalid frame config")
+
+type frameBus struct {
+	mu       sync.Mutex
+	decoders map[FrameConfig]*frameDecoder
+}
+
+type frameDecoder struct {
+	cancel context.CancelFunc
+	audio  bool
+
+	// Number of dropped frames by subscriber.
+	subs map[chan Frame]int
+}
+
+// decodeFunc decodes frames and calls onFrame for each
+// frame until the context is canceled or it crashes.
+type decodeFunc func(context.Context, *InputProcess, FrameConfig, func([]byte)) error
+
+// SubscribeFrames returns decoded frames from this input. Subscribers
+// with equal configs share a single FFmpeg process, which is started
+// by the first subscriber and stopped when the last subscriber leaves.
+// Frames are dropped if the subscriber falls behind, only the latest frame
+// is kept. Audio chunks are buffered and new chunks are dropped when the
+// buffer is full, the queued chunks are kept in order. The number of dropped
+// frames is reported in the next frame. The channel is closed when the
+// context is canceled.
+func (i *InputProcess) SubscribeFrames(ctx context.Context, c FrameConfig) (<-chan Frame, error) {
+	if c.PixFmt == "" || c.FrameSize <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFrameConfig, c)
+	}
+
+	bus := &i.frameBus
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if bus.decoders == nil {
+		bus.decoders = make(map[FrameConfig]*frameDecoder)
+	}
+
+	d, exist := bus.decoders[c]
+	if !exist {
+		decoderCtx, cancel := context.WithCancel(context.Background())
+		d = &frameDecoder{
+			cancel: cancel,
+			audio:  c.Audio,
+			subs:   make(map[chan Frame]int),
+		}
+		bus.decoders[c] = d
+
+		i.WG.Add(1)
+		go i.runDecoder(decoderCtx, c, d)
+	}
+
+	bufferSize := frameBufferSize
+	if c.Audio {
+		bufferSize = audioBufferSize
+	}
+	sub := make(chan Frame, bufferSize)
+	d.subs[sub] = 0
+
+	i.WG.Add(1)
+	go func() {
+		defer i.WG.Done()
+		<-ctx.Done()
+
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+
+		delete(d.subs, sub)
+		close(sub)
+		if len(d.subs) == 0 {
+			d.cancel()
+			delete(bus.decoders, c)
+		}
+	}()
+
+	return sub, nil
+}
+
+// publish sends the frame to all subscribers without blocking.
+func (i *InputProcess) publish(d *frameDecoder, frame Frame) {
+	i.frameBus.mu.Lock()
+	defer i.frameBus.mu.Unlock()
+
+	for sub, dropped := range d.subs {
+		frame.Dropped = dropped
+		select {
+		case sub <- frame:
+			d.subs[sub] = 0
+			continue
+		default:
+		}
+		if d.audio {
+			// Keep the queued chunks, the gap is reported in the next chunk.
+			d.subs[sub] = dropped + 1
+			continue
+		}
+		// Replace the old frame.
+		select {
+		case old := <-sub:
+			frame.Dropped += old.Dropped + 1
+		default:
+		}
+		select {
+		case sub <- frame:
+			d.subs[sub] = 0
+		default:
+			d.subs[sub] = frame.Dropped + 1
+		}
+	}
+}
+
+// runDecoder restarts the decoder until the context is canceled.
+func (i *InputProcess) runDecoder(ctx context.Context, c FrameConfig, d *frameDecoder) {
+	defer i.WG.Done()
+
+	onFrame := func(data []byte) {
+		i.publish(d, Frame{Time: time.Now(), Data: data})
+	}
+	for {
+		err := i.decodeFrames(ctx, i, c, onFrame)
+		if ctx.Err() != nil {
+			return
+		}
+		i.logf(log.LevelError, "%v frame decoder: crashed: %v", i.ProcessName(), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+// decodeFFmpeg decodes the RTSP stream to raw frames.
+func decodeFFmpeg(ctx context.Context, i *InputProcess, c FrameConfig, onFrame func([]byte)) error {
+	ctx2, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.Command(i.Env.FFmpegBin, i.decoderArgs(c)...)
+
+	logLevel := log.FFmpegLevel(i.Config.LogLevel())
+	logFunc := func(msg string) {
+		i.logf(logLevel, "%v frame decoder: %v", i.ProcessName(), msg)
+	}
+	process := i.newProcess(cmd).StderrLogger(logFunc)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("stdout: %w", err)
+	}
+
+	// Restart the process if it stops outputting frames.
+	watchdog := time.AfterFunc(10*time.Second, func() {
+		i.logf(log.LevelError, "%v frame decoder: watchdog: no frames, restarting",
+			i.ProcessName())
+		cancel()
+	})
+	defer watchdog.Stop()
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readFrames(stdout, c.FrameSize, func(data []byte) {
+			watchdog.Reset(10 * time.Second)
+			onFrame(data)
+		})
+		cancel()
+	}()
+
+	i.logf(log.LevelInfo, "starting %v frame decoder: %v", i.ProcessName(), cmd)
+
+	err = process.Start(ctx2) // Blocks until process exits.
+	if ctx.Err() != nil {
+		return nil //nolint:nilerr
+	}
+	if err != nil {
+		return fmt.Errorf("process: %w", err)
+	}
+
+	select {
+	case err := <-readErr:
+		return fmt.Errorf("read frames: %w", err)
+	default:
+		return fmt.Errorf("process: %w", io.EOF)
+	}
+}
+
+// readFrames reads frames of the given size until the reader returns a error.
+// A new buffer is allocated for each frame because frames are shared.
+func readFrames(r io.Reader, frameSize int, onFrame func([]byte)) error {
+	for {
+		buf := make([]byte, frameSize)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		onFrame(buf)
+	}
+}
+
+func (i *InputProcess) decoderArgs(c FrameConfig) []string {
+	// OUTPUT
+	// -y -threads 1 -loglevel error -hwaccel x -rtsp_transport tcp -i rtsp://x
+	//   -vf fps=fps=2,scale=iw/2:ih/2 -f rawvideo -pix_fmt gray -
+	//
+	// Audio output
+	// -y -threads 1 -loglevel error -rtsp_transport tcp -i rtsp://x
+	//   -vn -af aresample=8000 -f s16le -
+
+	conf := i.Config
+	args := []string{"-y", "-threads", "1", "-loglevel", conf.LogLevel()}
+
+	if conf.Hwaccel() != "" && !c.Audio {
+		args = append(args, ffmpeg.ParseArgs("-hwaccel "+conf.Hwaccel())...)
+	}
+
+	args = append(args, "-rtsp_transport", i.RTSPprotocol(), "-i", i.RTSPaddress())
+	if c.Audio {
+		args = append(args, "-vn")
+		if c.Filter != "" {
+			args = append(args, "-af", c.Filter)
+		}
+		return append(args, "-f", c.PixFmt, "-")
+	}
+
+	if c.Filter != "" {
+		args = append(args, "-vf", c.Filter)
+	}
+	args = append(args, "-f", "rawvideo", "-pix_fmt", c.PixFmt, "-")
+
+	return args
+}
@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"nvr/pkg/log"
+	"nvr/pkg/video"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stubDecoder counts started decoders and sends frames on request.
+type stubDecoder struct {
+	mu      sync.Mutex
+	started map[FrameConfig]int
+	frames  chan []byte
+	crash   chan error
+}
+
+func newStubDecoder() *stubDecoder {
+	return &stubDecoder{
+		started: make(map[FrameConfig]int),
+		frames:  make(chan []byte),
+		crash:   make(chan error),
+	}
+}
+
+func (s *stubDecoder) decode(ctx context.Context, _ *InputProcess, c FrameConfig, onFrame func([]byte)) error {
+	s.mu.Lock()
+	s.started[c]++
+	s.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case frame := <-s.frames:
+			onFrame(frame)
+		case err := <-s.crash:
+			return err
+		}
+	}
+}
+
+func (s *stubDecoder) numStarted(c FrameConfig) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started[c]
+}
+
+func newTestFrameInput(decoder *stubDecoder) *InputProcess {
+	return &InputProcess{
+		WG:           &sync.WaitGroup{},
+		logf:         func(log.Level, string, ...interface{}) {},
+		decodeFrames: decoder.decode,
+	}
+}
+
+func TestSubscribeFrames(t *testing.T) {
+	gray := FrameConfig{Filter: "fps=fps=1", PixFmt: "gray", FrameSize: 2}
+	rgb := FrameConfig{Filter: "fps=fps=1", PixFmt: "rgb24", FrameSize: 6}
+
+	t.Run("shared", func(t *testing.T) {
+		decoder := newStubDecoder()
+		i := newTestFrameInput(decoder)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		a, err := i.SubscribeFrames(ctx, gray)
+		require.NoError(t, err)
+		b, err := i.SubscribeFrames(ctx, gray)
+		require.NoError(t, err)
+
+		decoder.frames <- []byte{1, 2}
+		require.Equal(t, []byte{1, 2}, (<-a).Data)
+		require.Equal(t, []byte{1, 2}, (<-b).Data)
+		require.Equal(t, 1, decoder.numStarted(gray))
+	})
+	t.Run("separateConfigs", func(t *testing.T) {
+		decoder := newStubDecoder()
+		i := newTestFrameInput(decoder)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err := i.SubscribeFrames(ctx, gray)
+		require.NoError(t, err)
+		_, err = i.SubscribeFrames(ctx, rgb)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return decoder.numStarted(gray) == 1 && decoder.numStarted(rgb) == 1
+		}, time.Second, time.Millisecond)
+	})
+	t.Run("latestFrame", func(t *testing.T) {
+		decoder := newStubDecoder()
+		i := newTestFrameInput(decoder)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		a, err := i.SubscribeFrames(ctx, gray)
+		require.NoError(t, err)
+
+		// The slow subscriber only gets the latest frame.
+		decoder.frames <- []byte{1, 1}
+		decoder.frames <- []byte{2, 2}
+		decoder.frames <- []byte{3, 3}
+		require.Eventually(t, func() bool {
+			return len(a) == 1
+		}, time.Second, time.Millisecond)
+
+		// Wait for the last frame to be published.
+		decoder.frames <- []byte{4, 4}
+		require.Eventually(t, func() bool {
+			i.frameBus.mu.Lock()
+			defer i.frameBus.mu.Unlock()
+			return len(a) == 1
+		}, time.Second, time.Millisecond)
+		frame := <-a
+		require.Equal(t, []byte{4, 4}, frame.Data)
+		require.Equal(t, 3, frame.Dropped)
+	})
+	t.Run("audio", func(t *testing.T) {
+		decoder := newStubDecoder()
+		i := newTestFrameInput(decoder)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		audio := FrameConfig{Filter: "anull", PixFmt: "s16le", FrameSize: 1, Audio: true}
+		a, err := i.SubscribeFrames(ctx, audio)
+		require.NoError(t, err)
+
+		// The queued chunks are kept and new chunks are dropped.
+		for n := 0; n < audioBufferSize+2; n++ {
+			decoder.frames <- []byte{byte(n)}
+		}
+		require.Eventually(t, func() bool {
+			i.frameBus.mu.Lock()
+			defer i.frameBus.mu.Unlock()
+			for _, dropped := range i.frameBus.decoders[audio].subs {
+				return dropped == 2
+			}
+			return false
+		}, time.Second, time.Millisecond)
+
+		for n := 0; n < audioBufferSize; n++ {
+			chunk := <-a
+			require.Equal(t, []byte{byte(n)}, chunk.Data)
+			require.Equal(t, 0, chunk.Dropped)
+		}
+
+		// The gap is reported in the next chunk.
+		decoder.frames <- []byte{99}
+		chunk := <-a
+		require.Equal(t, []byte{99}, chunk.Data)
+		require.Equal(t, 2, chunk.Dropped)
+	})
+	t.Run("unsubscribe", func(t *testing.T) {
+		decoder := newStubDecoder()
+		i := newTestFrameInput(decoder)
+
+		ctx1, cancel1 := context.WithCancel(context.Background())
+		ctx2, cancel2 := context.WithCancel(context.Background())
+
+		a, err := i.SubscribeFrames(ctx1, gray)
+		require.NoError(t, err)
+		b, err := i.SubscribeFrames(ctx2, gray)
+		require.NoError(t, err)
+
+		cancel1()
+		_, ok := <-a
+		require.False(t, ok)
+
+		decoder.frames <- []byte{1, 2}
+		require.Equal(t, []byte{1, 2}, (<-b).Data)
+
+		// The decoder is stopped when the last subscriber leaves.
+		cancel2()
+		_, ok = <-b
+		require.False(t, ok)
+		i.WG.Wait()
+		require.Empty(t, i.frameBus.decoders)
+
+		// And started again by the next subscriber.
+		ctx3, cancel3 := context.WithCancel(context.Background())
+		defer cancel3()
+		_, err = i.SubscribeFrames(ctx3, gray)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return decoder.numStarted(gray) == 2
+		}, time.Second, time.Millisecond)
+	})
+	t.Run("restartOnCrash", func(t *testing.T) {
+		decoder := newStubDecoder()
+		i := newTestFrameInput(decoder)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		a, err := i.SubscribeFrames(ctx, gray)
+		require.NoError(t, err)
+		decoder.crash <- errors.New("mock")
+
+		// The subscription survives the crash.
+		require.Eventually(t, func() bool {
+			return decoder.numStarted(gray) == 2
+		}, 5*time.Second, time.Millisecond)
+		decoder.frames <- []byte{1, 2}
+		require.Equal(t, []byte{1, 2}, (<-a).Data)
+	})
+	t.Run("invalidConfig", func(t *testing.T) {
+		i := newTestFrameInput(newStubDecoder())
+		_, err := i.SubscribeFrames(context.Background(), FrameConfig{PixFmt: "gray"})
+		require.ErrorIs(t, err, ErrInvalidFrameConfig)
+	})
+}
+
+func TestReadFrames(t *testing.T) {
+	var frames [][]byte
+	err := readFrames(bytes.NewReader([]byte{1, 2, 3, 4, 5}), 2, func(frame []byte) {
+		frames = append(frames, frame)
+	})
+	require.Error(t, err)
+	require.Equal(t, [][]byte{{1, 2}, {3, 4}}, frames)
+}
+
+func TestDecoderArgs(t *testing.T) {
+	i := &InputProcess{
+		Config: NewConfig(RawConfig{
+			"logLevel": "1",
+			"hwaccel":  "2",
+		}),
+		serverPath: video.ServerPath{
+			RtspProtocol: "3",
+			RtspAddress:  "4",
+		},
+	}
+	actual := i.decoderArgs(FrameConfig{Filter: "5", PixFmt: "6", FrameSize: 1})
+	expected := []string{
+		"-y", "-threads", "1", "-loglevel", "1", "-hwaccel", "2",
+		"-rtsp_transport", "3", "-i", "4",
+		"-vf", "5", "-f", "rawvideo", "-pix_fmt", "6", "-",
+	}
+	require.Equal(t, expected, actual)
+
+	actual = i.decoderArgs(FrameConfig{Filter: "5", PixFmt: "6", FrameSize: 1, Audio: true})
+	expected = []string{
+		"-y", "-threads", "1", "-loglevel", "1",
+		"-rtsp_transport", "3", "-i", "4",
+		"-vn", "-af", "5", "-f", "6", "-",
+	}
+	require.Equal(t, expected, actual)
+}
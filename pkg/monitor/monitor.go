@@ -4,6 +4,7 @@ package monitor
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +32,12 @@ type StartInputHook func(context.Context, *InputProcess, *[]string)
 // EventHook is called on every event.
 type EventHook func(*Recorder, *storage.Event)
 
+// RecStartHook is called when a recording starts with the recording ID.
+type RecStartHook func(*Recorder, string)
+
+// RecFailedHook is called when a recording crashes or could not be saved.
+type RecFailedHook func(*Recorder, error)
+
 // RecSaveHook is called when recording is saved.
 type RecSaveHook func(*Recorder, *string)
 
@@ -44,6 +52,8 @@ type Hooks struct {
 	Start      StartHook
 	StartInput StartInputHook
 	Event      EventHook
+	RecStart   RecStartHook
+	RecFailed  RecFailedHook
 	RecSave    RecSaveHook
 	RecSaved   RecSavedHook
 	Migrate    MigationHook
@@ -227,6 +237,80 @@ func (m *Manager) MonitorDelete(id string) error {
 	return nil
 }
 
+// ErrNotRunning monitor is not running.
+var ErrNotRunning = errors.New("monitor is not running")
+
+// TriggerEvent sends event to a running monitor by ID.
+func (m *Manager) TriggerEvent(id string, event storage.Event) error {
+	m.mu.Lock()
+	monitor, exist := m.runningMonitors[id]
+	m.mu.Unlock()
+
+	if !exist {
+		if _, exist := m.MonitorConfigs()[id]; exist {
+			return ErrNotRunning
+		}
+		return ErrMonitorNotExist
+	}
+	if monitor.ctx == nil { // Disabled.
+		return ErrNotRunning
+	}
+	return monitor.SendEvent(event)
+}
+
+// TriggerRequest is an event from an external system.
+// Durations are in seconds.
+type TriggerRequest struct {
+	Label       string  `json:"label"`
+	Score       float64 `json:"score"`
+	Duration    float64 `json:"duration"`
+	RecDuration float64 `json:"recDuration"`
+}
+
+// ErrLabelMissing label missing.
+var ErrLabelMissing = errors.New("label missing")
+
+// Event converts the request into a validated event.
+func (r TriggerRequest) Event(now time.Time) (storage.Event, error) {
+	if r.Label == "" {
+		return storage.Event{}, ErrLabelMissing
+	}
+
+	seconds := func(v float64) time.Duration {
+		return time.Duration(v * float64(time.Second))
+	}
+	event := storage.Event{
+		Time: now,
+		Detections: []storage.Detection{{
+			Label: r.Label,
+			Score: r.Score,
+		}},
+		Duration:    seconds(r.Duration),
+		RecDuration: seconds(r.RecDuration),
+	}
+	if err := event.Validate(); err != nil {
+		return storage.Event{}, err
+	}
+	return event, nil
+}
+
+// ValidTriggerToken returns true if the token matches
+// the trigger token of the monitor.
+func (m *Manager) ValidTriggerToken(id string, token string) bool {
+	m.mu.Lock()
+	rawConf, exist := m.rawConfigs[id]
+	m.mu.Unlock()
+
+	if !exist {
+		return false
+	}
+	want := NewConfig(rawConf).TriggerToken()
+	if want == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(token)) == 1
+}
+
 // MonitorsInfo returns common information about the monitors.
 // This will be accessesable by normal users.
 func (m *Manager) MonitorsInfo() RawConfigs {
@@ -243,7 +327,7 @@ func (m *Manager) MonitorsInfo() RawConfigs {
 		}
 
 		audioEnabled := "false"
-		if c.audioEnabled() {
+		if c.AudioEnabled() {
 			audioEnabled = "true"
 		}
 
@@ -283,6 +367,24 @@ func (m *Manager) MonitorConfigs() RawConfigs {
 	return configs
 }
 
+// MaxVideoLength returns the longest configured video length.
+func (m *Manager) MaxVideoLength() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var longest time.Duration
+	for _, rawConf := range m.rawConfigs {
+		minutes, err := strconv.ParseFloat(rawConf["videoLength"], 64)
+		if err != nil {
+			continue
+		}
+		if length := time.Duration(minutes * float64(time.Minute)); length > longest {
+			longest = length
+		}
+	}
+	return longest
+}
+
 // monitors map.
 type monitors map[string]*Monitor
 
@@ -418,6 +520,9 @@ type InputProcess struct {
 	newVideoServerPath newVideoServerPathFunc
 	runInputProcess    runInputProcessFunc
 	newProcess         ffmpeg.NewProcessFunc
+
+	frameBus     frameBus
+	decodeFrames decodeFunc
 }
 
 type newVideoServerPathFunc func(context.Context, string, video.PathConf) (*video.ServerPath, error)
@@ -439,6 +544,7 @@ func newInputProcess(m *Monitor, isSubInput bool) *InputProcess {
 		newVideoServerPath: m.videoServer.NewPath,
 		runInputProcess:    runInputProcess,
 		newProcess:         ffmpeg.NewProcess,
+		decodeFrames:       decodeFFmpeg,
 	}
 
 	return i
@@ -593,7 +699,7 @@ func (i *InputProcess) generateArgs() string {
 	}
 	args += " -i " + i.input()
 
-	if c.audioEnabled() {
+	if c.AudioEnabled() {
 		args += " -c:a " + c.AudioEncoder()
 	} else {
 		args += " -an" // Skip audio.
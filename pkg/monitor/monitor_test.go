@@ -315,6 +315,17 @@ func TestMonitorConfigs(t *testing.T) {
 	require.Equal(t, actual, expected)
 }
 
+func TestMaxVideoLength(t *testing.T) {
+	manager := Manager{
+		rawConfigs: RawConfigs{
+			"1": {"videoLength": "15"},
+			"2": {"videoLength": "90"},
+			"3": {"videoLength": "x"},
+		},
+	}
+	require.Equal(t, 90*time.Minute, manager.MaxVideoLength())
+}
+
 func TestStartAllMonitors(t *testing.T) {
 	_, manager := newTestManager(t)
 	manager.StartMonitors()
@@ -329,6 +340,48 @@ func TestStopAllMonitors(t *testing.T) {
 	require.Zero(t, len(m.runningMonitors))
 }
 
+func TestTriggerEvent(t *testing.T) {
+	event := storage.Event{Time: time.Unix(1, 0), RecDuration: time.Second}
+	t.Run("ok", func(t *testing.T) {
+		eventChan := make(chan storage.Event, 1)
+		m := Manager{runningMonitors: monitors{
+			"1": {
+				ctx:      context.Background(),
+				recorder: &Recorder{eventChan: eventChan},
+			},
+		}}
+		require.NoError(t, m.TriggerEvent("1", event))
+		require.Equal(t, event, <-eventChan)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		m := Manager{runningMonitors: monitors{"1": {}}}
+		require.ErrorIs(t, m.TriggerEvent("1", event), ErrNotRunning)
+	})
+	t.Run("stopped", func(t *testing.T) {
+		m := Manager{
+			rawConfigs:      RawConfigs{"1": {"id": "1"}},
+			runningMonitors: monitors{},
+		}
+		require.ErrorIs(t, m.TriggerEvent("1", event), ErrNotRunning)
+	})
+	t.Run("notExist", func(t *testing.T) {
+		m := Manager{runningMonitors: monitors{}}
+		require.ErrorIs(t, m.TriggerEvent("x", event), ErrMonitorNotExist)
+	})
+}
+
+func TestValidTriggerToken(t *testing.T) {
+	m := Manager{rawConfigs: RawConfigs{
+		"1": {"id": "1", "triggerToken": "abc"},
+		"2": {"id": "2"},
+	}}
+	require.True(t, m.ValidTriggerToken("1", "abc"))
+	require.False(t, m.ValidTriggerToken("1", "abd"))
+	require.False(t, m.ValidTriggerToken("1", ""))
+	require.False(t, m.ValidTriggerToken("2", ""))
+	require.False(t, m.ValidTriggerToken("x", "abc"))
+}
+
 func TestRestartMonitor(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		_, manager := newTestManager(t)
@@ -381,6 +434,8 @@ func stubHooks() Hooks {
 		Start:      func(context.Context, *Monitor) {},
 		StartInput: func(context.Context, *InputProcess, *[]string) {},
 		Event:      func(*Recorder, *storage.Event) {},
+		RecStart:   func(*Recorder, string) {},
+		RecFailed:  func(*Recorder, error) {},
 		RecSave:    func(*Recorder, *string) {},
 		RecSaved:   func(*Recorder, string, storage.RecordingData) {},
 	}
@@ -101,8 +101,13 @@ func (r *Recorder) start(ctx context.Context) {
 
 		case event := <-r.eventChan: // Incomming events.
 			r.hooks.Event(r, &event)
+
+			// Frames are only kept for the hooks.
+			stored := event
+			stored.Frame = nil
+
 			r.eventsLock.Lock()
-			*r.events = append(*r.events, event)
+			*r.events = append(*r.events, stored)
 			r.eventsLock.Unlock()
 
 			end := event.Time.Add(event.RecDuration)
@@ -144,6 +149,7 @@ func (r *Recorder) runRecordingSession(ctx context.Context) {
 		if err != nil {
 			if !errors.Is(err, context.Canceled) {
 				r.logf(log.LevelError, "recording crashed: %v", err)
+				r.hooks.RecFailed(r, err)
 			}
 			select {
 			case <-ctx.Done():
@@ -210,6 +216,7 @@ func runRecording(ctx context.Context, r *Recorder) error {
 	videoLength := time.Duration(videoLengthFloat * float64(time.Minute))
 
 	r.logf(log.LevelInfo, "starting recording: %v", basePath)
+	r.hooks.RecStart(r, basePath)
 
 	videoTrack := muxer.VideoTrack()
 	audioTrack := muxer.AudioTrack()
@@ -381,13 +388,15 @@ func (r *Recorder) saveRecording(
 	}
 	json, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
-		r.logf(log.LevelError, "marshal event data: %w", err)
+		r.logf(log.LevelError, "marshal event data: %v", err)
+		r.hooks.RecFailed(r, fmt.Errorf("marshal event data: %w", err))
 		return
 	}
 
 	dataPath := filePath + ".json"
 	if err := os.WriteFile(dataPath, json, 0o600); err != nil {
 		r.logf(log.LevelError, "write event data: %v", err)
+		r.hooks.RecFailed(r, fmt.Errorf("write event data: %w", err))
 		return
 	}
 
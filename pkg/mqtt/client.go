@@ -0,0 +1,329 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"nvr/pkg/mqtt/internal/packet"
+	"sync"
+	"time"
+)
+
+// Message is a published application message.
+type Message = packet.Message
+
+// Packet errors.
+var (
+	ErrMalformedPacket = packet.ErrMalformed
+	ErrPacketTooLarge  = packet.ErrTooLarge
+)
+
+// ClientConfig client configuration.
+type ClientConfig struct {
+	Address  string // host:port
+	ClientID string
+	Username string
+	Password string
+
+	// Default 30 seconds.
+	KeepAlive time.Duration
+
+	// Published by the broker if the connection is lost.
+	Will *Message
+
+	// Called from the read loop for every received message.
+	OnMessage func(Message)
+}
+
+// Client is a minimal MQTT 3.1.1 client. Messages
+// are published and subscribed to with QoS 0.
+type Client struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	onMessage func(Message)
+	keepAlive time.Duration
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   uint16
+	subacks  map[uint16]chan struct{}
+	closed   bool
+	closeErr error
+	done     chan struct{}
+}
+
+// Connect return codes.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Client errors.
+var (
+	ErrConnectionRefused = errors.New("connection refused")
+	ErrClosed            = errors.New("client closed")
+	ErrTimeout           = errors.New("timeout")
+
+	// The protocol doesn't allow a password without a user name.
+	ErrPasswordWithoutUsername = errors.New("password without username")
+)
+
+const defaultKeepAlive = 30 * time.Second
+
+// Dial connects to the broker.
+func Dial(ctx context.Context, config ClientConfig) (*Client, error) {
+	if config.Password != "" && config.Username == "" {
+		return nil, ErrPasswordWithoutUsername
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	c, err := newClient(ctx, conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(ctx context.Context, conn net.Conn, config ClientConfig) (*Client, error) {
+	keepAlive := config.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAlive
+	}
+
+	c := &Client{
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		onMessage: config.OnMessage,
+		keepAlive: keepAlive,
+		subacks:   make(map[uint16]chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) //nolint:errcheck
+	}
+	if err := c.writePacket(connectPacket(config, keepAlive)); err != nil {
+		return nil, fmt.Errorf("write connect: %w", err)
+	}
+
+	p, err := packet.Read(c.reader)
+	if err != nil {
+		return nil, fmt.Errorf("read connack: %w", err)
+	}
+	if p.Type != packet.Connack || len(p.Body) != 2 {
+		return nil, fmt.Errorf("connack: %w", ErrMalformedPacket)
+	}
+	if code := p.Body[1]; code != 0 {
+		return nil, fmt.Errorf("%w: %v", ErrConnectionRefused, connackErrors[code])
+	}
+	conn.SetDeadline(time.Time{}) //nolint:errcheck
+
+	go c.readLoop()
+	go c.pingLoop()
+	return c, nil
+}
+
+func connectPacket(config ClientConfig, keepAlive time.Duration) packet.Packet {
+	flags := byte(packet.FlagCleanSession)
+	if config.Will != nil {
+		flags |= packet.FlagWill
+		if config.Will.Retain {
+			flags |= packet.FlagWillRetain
+		}
+	}
+	if config.Username != "" {
+		flags |= packet.FlagUsername
+	}
+	if config.Password != "" {
+		flags |= packet.FlagPassword
+	}
+
+	body := packet.AppendString(nil, "MQTT")
+	body = append(body, 4, flags) // Protocol level 4.
+	body = packet.AppendUint16(body, uint16(keepAlive/time.Second))
+	body = packet.AppendString(body, config.ClientID)
+	if config.Will != nil {
+		body = packet.AppendString(body, config.Will.Topic)
+		body = packet.AppendUint16(body, uint16(len(config.Will.Payload)))
+		body = append(body, config.Will.Payload...)
+	}
+	if config.Username != "" {
+		body = packet.AppendString(body, config.Username)
+	}
+	if config.Password != "" {
+		body = packet.AppendString(body, config.Password)
+	}
+	return packet.Packet{Type: packet.Connect, Body: body}
+}
+
+func (c *Client) writePacket(p packet.Packet) error {
+	buf, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+func (c *Client) readLoop() {
+	for {
+		// The broker must respond to pings within the keep alive period.
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2)) //nolint:errcheck
+
+		p, err := packet.Read(c.reader)
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+
+		switch p.Type {
+		case packet.Publish:
+			msg, packetID, qos, err := packet.ParsePublish(p)
+			if err != nil {
+				c.closeWithError(err)
+				return
+			}
+			if qos == 1 {
+				ack := packet.Packet{Type: packet.Puback, Body: packet.AppendUint16(nil, packetID)}
+				if err := c.writePacket(ack); err != nil {
+					c.closeWithError(err)
+					return
+				}
+			}
+			if c.onMessage != nil {
+				c.onMessage(msg)
+			}
+		case packet.Suback:
+			d := &packet.Decoder{Buf: p.Body}
+			packetID := d.Uint16()
+			c.mu.Lock()
+			if ch, exist := c.subacks[packetID]; exist {
+				close(ch)
+				delete(c.subacks, packetID)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.writePacket(packet.Packet{Type: packet.Pingreq}); err != nil {
+				c.closeWithError(err)
+				return
+			}
+		}
+	}
+}
+
+// Publish publishes a message with QoS 0.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	return c.writePacket(packet.NewPublish(Message{
+		Topic:   topic,
+		Payload: payload,
+		Retain:  retain,
+	}))
+}
+
+const subscribeTimeout = 10 * time.Second
+
+// Subscribe subscribes to topic filters with QoS 0
+// and waits for the broker to acknowledge.
+func (c *Client) Subscribe(filters ...string) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	packetID := c.nextID
+	ack := make(chan struct{})
+	c.subacks[packetID] = ack
+	c.mu.Unlock()
+
+	body := packet.AppendUint16(nil, packetID)
+	for _, filter := range filters {
+		body = packet.AppendString(body, filter)
+		body = append(body, 0) // QoS.
+	}
+	if err := c.writePacket(packet.Packet{Type: packet.Subscribe, Flags: 0x02, Body: body}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	case <-time.After(subscribeTimeout):
+		return fmt.Errorf("subscribe: %w", ErrTimeout)
+	}
+}
+
+// Close disconnects from the broker. The will message is discarded.
+func (c *Client) Close() error {
+	if c.isClosed() {
+		return nil
+	}
+	c.writePacket(packet.Packet{Type: packet.Disconnect}) //nolint:errcheck
+	c.closeWithError(ErrClosed)
+	return nil
+}
+
+func (c *Client) closeWithError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeErr = err
+	c.conn.Close()
+	close(c.done)
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Done is closed when the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection was closed.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
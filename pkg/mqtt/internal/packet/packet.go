@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package packet encodes and decodes MQTT 3.1.1 control packets.
+package packet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types.
+const (
+	Connect     = 1
+	Connack     = 2
+	Publish     = 3
+	Puback      = 4
+	Subscribe   = 8
+	Suback      = 9
+	Unsubscribe = 10
+	Unsuback    = 11
+	Pingreq     = 12
+	Pingresp    = 13
+	Disconnect  = 14
+)
+
+// Connect flags.
+const (
+	FlagCleanSession = 0x02
+	FlagWill         = 0x04
+	FlagWillRetain   = 0x20
+	FlagPassword     = 0x40
+	FlagUsername     = 0x80
+)
+
+// Maximum remaining length allowed by the protocol.
+const maxRemainingLength = 268435455
+
+// Packet errors.
+var (
+	ErrMalformed = errors.New("malformed packet")
+	ErrTooLarge  = errors.New("packet too large")
+)
+
+// Packet is a raw control packet.
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// Read reads a single packet.
+func Read(r *bufio.Reader) (Packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return Packet{}, err
+	}
+
+	var length int
+	for i := 0; ; i++ {
+		if i == 4 {
+			return Packet{}, fmt.Errorf("remaining length: %w", ErrMalformed)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+		length |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Packet{}, err
+	}
+	return Packet{
+		Type:  header >> 4,
+		Flags: header & 0x0f,
+		Body:  body,
+	}, nil
+}
+
+// Marshal returns the encoded packet.
+func (p Packet) Marshal() ([]byte, error) {
+	length := len(p.Body)
+	if length > maxRemainingLength {
+		return nil, ErrTooLarge
+	}
+
+	buf := make([]byte, 0, 5+length)
+	buf = append(buf, p.Type<<4|p.Flags&0x0f)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, p.Body...), nil
+}
+
+// AppendUint16 appends a big endian integer.
+func AppendUint16(buf []byte, v uint16) []byte {
+	return binary.BigEndian.AppendUint16(buf, v)
+}
+
+// AppendString appends a length prefixed string.
+func AppendString(buf []byte, s string) []byte {
+	buf = AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// Decoder reads fields from a packet body.
+// Reading past the end sets Err and returns zero values.
+type Decoder struct {
+	Buf []byte
+	Err error
+}
+
+// Bytes reads n bytes.
+func (d *Decoder) Bytes(n int) []byte {
+	if d.Err != nil {
+		return nil
+	}
+	if n > len(d.Buf) {
+		d.Err = ErrMalformed
+		return nil
+	}
+	b := d.Buf[:n]
+	d.Buf = d.Buf[n:]
+	return b
+}
+
+// Byte reads a single byte.
+func (d *Decoder) Byte() byte {
+	if b := d.Bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// Uint16 reads a big endian integer.
+func (d *Decoder) Uint16() uint16 {
+	if b := d.Bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// String reads a length prefixed string.
+func (d *Decoder) String() string {
+	return string(d.Bytes(int(d.Uint16())))
+}
+
+// Message is a published application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// NewPublish returns a QoS 0 publish packet.
+func NewPublish(msg Message) Packet {
+	var flags byte
+	if msg.Retain {
+		flags |= 0x01
+	}
+	body := AppendString(nil, msg.Topic)
+	body = append(body, msg.Payload...)
+	return Packet{Type: Publish, Flags: flags, Body: body}
+}
+
+// ParsePublish returns the message and the packet ID if QoS is above zero.
+func ParsePublish(p Packet) (Message, uint16, byte, error) {
+	d := &Decoder{Buf: p.Body}
+	msg := Message{
+		Topic:  d.String(),
+		Retain: p.Flags&0x01 != 0,
+	}
+	qos := (p.Flags >> 1) & 0x03
+	var packetID uint16
+	if qos > 0 {
+		packetID = d.Uint16()
+	}
+	if d.Err != nil || qos > 2 {
+		return Message{}, 0, 0, fmt.Errorf("publish: %w", ErrMalformed)
+	}
+	msg.Payload = d.Buf
+	return msg, packetID, qos, nil
+}
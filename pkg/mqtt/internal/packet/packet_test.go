@@ -0,0 +1,23 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package packet
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacket(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384} {
+		p := Packet{Type: Publish, Flags: 1, Body: make([]byte, size)}
+		buf, err := p.Marshal()
+		require.NoError(t, err)
+
+		got, err := Read(bufio.NewReader(bytes.NewReader(buf)))
+		require.NoError(t, err)
+		require.Equal(t, p, got)
+	}
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package mqtt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"nvr/pkg/mqtt/mqtttest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBroker(t *testing.T) (*mqtttest.Broker, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := mqtttest.NewBroker()
+	go b.Serve(l) //nolint:errcheck
+	t.Cleanup(func() { b.Close() })
+	return b, l.Addr().String()
+}
+
+func newTestClient(
+	t *testing.T,
+	address string,
+	config ClientConfig,
+) (*Client, chan Message) {
+	t.Helper()
+	messages := make(chan Message, 10)
+	config.Address = address
+	config.OnMessage = func(msg Message) { messages <- msg }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c, messages
+}
+
+func receive(t *testing.T, messages chan Message) Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+		return Message{}
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Run("publishSubscribe", func(t *testing.T) {
+		_, address := newTestBroker(t)
+		sub, messages := newTestClient(t, address, ClientConfig{ClientID: "sub"})
+		pub, _ := newTestClient(t, address, ClientConfig{ClientID: "pub"})
+
+		require.NoError(t, sub.Subscribe("a/+/c", "b/#"))
+		require.NoError(t, pub.Publish("a/b/c", []byte("1"), false))
+		require.NoError(t, pub.Publish("x", []byte("2"), false))
+		require.NoError(t, pub.Publish("b/c/d", []byte("3"), false))
+
+		require.Equal(t, Message{Topic: "a/b/c", Payload: []byte("1")}, receive(t, messages))
+		require.Equal(t, Message{Topic: "b/c/d", Payload: []byte("3")}, receive(t, messages))
+	})
+	t.Run("retained", func(t *testing.T) {
+		b, address := newTestBroker(t)
+		pub, _ := newTestClient(t, address, ClientConfig{ClientID: "pub"})
+		require.NoError(t, pub.Publish("a", []byte("1"), true))
+
+		sub, messages := newTestClient(t, address, ClientConfig{ClientID: "sub"})
+
+		// Wait for the broker to store the message.
+		require.Eventually(t, func() bool {
+			_, exist := b.Retained("a")
+			return exist
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, sub.Subscribe("a"))
+		expected := Message{Topic: "a", Payload: []byte("1"), Retain: true}
+		require.Equal(t, expected, receive(t, messages))
+	})
+	t.Run("will", func(t *testing.T) {
+		b, address := newTestBroker(t)
+		will := &Message{Topic: "status", Payload: []byte("offline"), Retain: true}
+		c, _ := newTestClient(t, address, ClientConfig{ClientID: "c", Will: will})
+
+		// Connection lost without disconnect packet.
+		c.conn.Close()
+
+		require.Eventually(t, func() bool {
+			msg, exist := b.Retained("status")
+			return exist && string(msg.Payload) == "offline"
+		}, 5*time.Second, 10*time.Millisecond)
+		<-c.Done()
+	})
+	t.Run("closeDiscardsWill", func(t *testing.T) {
+		b, address := newTestBroker(t)
+		will := &Message{Topic: "status", Payload: []byte("offline"), Retain: true}
+		c, _ := newTestClient(t, address, ClientConfig{ClientID: "c", Will: will})
+		require.NoError(t, c.Close())
+		require.ErrorIs(t, c.Err(), ErrClosed)
+		require.ErrorIs(t, c.Publish("a", nil, false), ErrClosed)
+
+		time.Sleep(50 * time.Millisecond)
+		_, exist := b.Retained("status")
+		require.False(t, exist)
+	})
+	t.Run("badCredentials", func(t *testing.T) {
+		b, address := newTestBroker(t)
+		b.Username = "user"
+		b.Password = "pass"
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := Dial(ctx, ClientConfig{Address: address, Username: "user", Password: "x"})
+		require.ErrorIs(t, err, ErrConnectionRefused)
+
+		c, err := Dial(ctx, ClientConfig{Address: address, Username: "user", Password: "pass"})
+		require.NoError(t, err)
+		c.Close()
+	})
+	t.Run("passwordWithoutUsername", func(t *testing.T) {
+		_, address := newTestBroker(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := Dial(ctx, ClientConfig{Address: address, Password: "pass"})
+		require.ErrorIs(t, err, ErrPasswordWithoutUsername)
+	})
+}
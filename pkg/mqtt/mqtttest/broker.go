@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package mqtttest provides a MQTT broker for testing.
+package mqtttest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"nvr/pkg/mqtt/internal/packet"
+	"strings"
+	"sync"
+)
+
+// Message is a published application message.
+type Message = packet.Message
+
+// Broker is a minimal in-process MQTT 3.1.1 broker. It supports
+// QoS 0, retained messages, will messages and topic wildcards.
+type Broker struct {
+	// Credentials are not checked if Username is empty.
+	Username string
+	Password string
+
+	mu       sync.Mutex
+	clients  map[*brokerClient]struct{}
+	retained map[string]Message
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// NewBroker creates a new broker.
+func NewBroker() *Broker {
+	return &Broker{
+		clients:  make(map[*brokerClient]struct{}),
+		retained: make(map[string]Message),
+	}
+}
+
+// Serve accepts connections until the listener is closed.
+func (b *Broker) Serve(l net.Listener) error {
+	b.mu.Lock()
+	b.listener = l
+	b.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.handleConn(conn)
+		}()
+	}
+}
+
+// Close closes the listener and all client connections.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	var err error
+	if b.listener != nil {
+		err = b.listener.Close()
+	}
+	for c := range b.clients {
+		c.conn.Close()
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return err
+}
+
+// Retained returns the retained message of a topic.
+func (b *Broker) Retained(topic string) (Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg, exist := b.retained[topic]
+	return msg, exist
+}
+
+type brokerClient struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters []string
+	will    *Message
+}
+
+func (c *brokerClient) writePacket(p packet.Packet) error {
+	buf, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+func (b *Broker) handleConn(conn net.Conn) { //nolint:funlen
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	p, err := packet.Read(reader)
+	if err != nil || p.Type != packet.Connect {
+		return
+	}
+	c, code := b.parseConnect(conn, p)
+	if err := c.writePacket(packet.Packet{Type: packet.Connack, Body: []byte{0, code}}); err != nil {
+		return
+	}
+	if code != 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.clients[c] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		if c.will != nil {
+			b.publish(*c.will)
+		}
+	}()
+
+	for {
+		p, err := packet.Read(reader)
+		if err != nil {
+			return
+		}
+
+		switch p.Type {
+		case packet.Publish:
+			msg, packetID, qos, err := packet.ParsePublish(p)
+			if err != nil {
+				return
+			}
+			if qos == 1 {
+				ack := packet.Packet{Type: packet.Puback, Body: packet.AppendUint16(nil, packetID)}
+				if err := c.writePacket(ack); err != nil {
+					return
+				}
+			}
+			b.publish(msg)
+
+		case packet.Subscribe:
+			if !b.subscribe(c, p) {
+				return
+			}
+
+		case packet.Unsubscribe:
+			d := &packet.Decoder{Buf: p.Body}
+			packetID := d.Uint16()
+			for len(d.Buf) > 0 && d.Err == nil {
+				filter := d.String()
+				b.mu.Lock()
+				c.filters = removeString(c.filters, filter)
+				b.mu.Unlock()
+			}
+			if d.Err != nil {
+				return
+			}
+			ack := packet.Packet{Type: packet.Unsuback, Body: packet.AppendUint16(nil, packetID)}
+			if err := c.writePacket(ack); err != nil {
+				return
+			}
+
+		case packet.Pingreq:
+			if err := c.writePacket(packet.Packet{Type: packet.Pingresp}); err != nil {
+				return
+			}
+
+		case packet.Disconnect:
+			c.will = nil
+			return
+		}
+	}
+}
+
+// parseConnect returns the client and the connack return code.
+func (b *Broker) parseConnect(conn net.Conn, p packet.Packet) (*brokerClient, byte) {
+	c := &brokerClient{conn: conn}
+
+	d := &packet.Decoder{Buf: p.Body}
+	protocol := d.String()
+	level := d.Byte()
+	flags := d.Byte()
+	d.Uint16()     // Keep alive.
+	_ = d.String() // Client ID.
+
+	if flags&packet.FlagWill != 0 {
+		topic := d.String()
+		payload := d.Bytes(int(d.Uint16()))
+		c.will = &Message{
+			Topic:   topic,
+			Payload: append([]byte{}, payload...),
+			Retain:  flags&packet.FlagWillRetain != 0,
+		}
+	}
+	var username, password string
+	if flags&packet.FlagUsername != 0 {
+		username = d.String()
+	}
+	if flags&packet.FlagPassword != 0 {
+		password = d.String()
+	}
+
+	switch {
+	case d.Err != nil:
+		return c, 2
+	case protocol != "MQTT" || level != 4:
+		return c, 1
+	case b.Username != "" && (username != b.Username || password != b.Password):
+		return c, 4
+	}
+	return c, 0
+}
+
+// subscribe adds the filters and sends the retained messages.
+func (b *Broker) subscribe(c *brokerClient, p packet.Packet) bool {
+	d := &packet.Decoder{Buf: p.Body}
+	packetID := d.Uint16()
+	var filters []string
+	for len(d.Buf) > 0 && d.Err == nil {
+		filters = append(filters, d.String())
+		d.Byte() // Requested QoS.
+	}
+	if d.Err != nil || len(filters) == 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	c.filters = append(c.filters, filters...)
+	var retained []Message
+	for _, msg := range b.retained {
+		for _, filter := range filters {
+			if MatchTopic(filter, msg.Topic) {
+				retained = append(retained, msg)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	// Granted QoS 0 for every filter.
+	body := packet.AppendUint16(nil, packetID)
+	body = append(body, make([]byte, len(filters))...)
+	if err := c.writePacket(packet.Packet{Type: packet.Suback, Body: body}); err != nil {
+		return false
+	}
+
+	for _, msg := range retained {
+		if err := c.writePacket(packet.NewPublish(msg)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Broker) publish(msg Message) {
+	b.mu.Lock()
+	if msg.Retain {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+		}
+	}
+	var receivers []*brokerClient
+	for c := range b.clients {
+		for _, filter := range c.filters {
+			if MatchTopic(filter, msg.Topic) {
+				receivers = append(receivers, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	// The retain flag is only set for retained messages
+	// that are sent when a new subscription is made.
+	live := packet.NewPublish(Message{Topic: msg.Topic, Payload: msg.Payload})
+	for _, c := range receivers {
+		c.writePacket(live) //nolint:errcheck
+	}
+}
+
+// MatchTopic returns true if the topic matches the filter.
+// Supports single level "+" and multi level "#" wildcards.
+func MatchTopic(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+func removeString(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
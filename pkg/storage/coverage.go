@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CoverageQuery query of recorded time.
+type CoverageQuery struct {
+	Monitors []string
+	Start    time.Time
+	End      time.Time
+}
+
+// Coverage recorded intervals and event markers by monitor ID.
+type Coverage map[string]*MonitorCoverage
+
+// MonitorCoverage recorded intervals and event markers of a single monitor.
+// Both are sorted oldest first.
+type MonitorCoverage struct {
+	Intervals []Interval    `json:"intervals"`
+	Events    []EventMarker `json:"events"`
+}
+
+// Interval of recorded time.
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// EventMarker event time and detection labels.
+type EventMarker struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Labels   []string      `json:"labels"`
+}
+
+// Recordings separated by less than this are merged.
+const coverageMergeGap = 2 * time.Second
+
+// Coverage returns the merged recorded intervals of each monitor.
+// Intervals are clipped to the query range.
+func (c *Crawler) Coverage(q CoverageQuery) (Coverage, error) {
+	if q.End.Before(q.Start) {
+		return nil, fmt.Errorf("end before start: %w", ErrInvalidValue)
+	}
+
+	coverage := make(Coverage)
+	for _, monitorID := range q.Monitors {
+		coverage[monitorID] = newMonitorCoverage()
+	}
+
+	// Include recordings that started during the last second.
+	cursor := q.End.Add(time.Second).Format(recIDTimeFormat)
+	scanStop := q.Start.Add(-c.searchLookback()).Format(recIDTimeFormat)
+
+	for {
+		batch, err := c.RecordingByQuery(&CrawlerQuery{
+			Time:        cursor,
+			Limit:       searchBatchSize,
+			Monitors:    q.Monitors,
+			IncludeData: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rec := range batch {
+			if rec.ID < scanStop {
+				coverage.finalize()
+				return coverage, nil
+			}
+			cursor = rec.ID
+			coverage.add(q, rec)
+		}
+
+		if len(batch) < searchBatchSize {
+			coverage.finalize()
+			return coverage, nil
+		}
+	}
+}
+
+func newMonitorCoverage() *MonitorCoverage {
+	return &MonitorCoverage{
+		Intervals: []Interval{},
+		Events:    []EventMarker{},
+	}
+}
+
+func (c Coverage) add(q CoverageQuery, rec Recording) {
+	if rec.Data == nil || len(rec.ID) <= 20 {
+		return
+	}
+	data := rec.Data
+	if data.End.Before(q.Start) || data.Start.After(q.End) {
+		return
+	}
+
+	monitorID := rec.ID[20:]
+	mc, exist := c[monitorID]
+	if !exist {
+		mc = newMonitorCoverage()
+		c[monitorID] = mc
+	}
+
+	start, end := data.Start, data.End
+	if start.Before(q.Start) {
+		start = q.Start
+	}
+	if end.After(q.End) {
+		end = q.End
+	}
+	mc.Intervals = append(mc.Intervals, Interval{Start: start, End: end})
+
+	for _, e := range data.Events {
+		if e.Time.Before(q.Start) || e.Time.After(q.End) {
+			continue
+		}
+		labels := []string{}
+		for _, d := range e.Detections {
+			if !stringInStrings(d.Label, labels) {
+				labels = append(labels, d.Label)
+			}
+		}
+		mc.Events = append(mc.Events, EventMarker{
+			Time:     e.Time,
+			Duration: e.Duration,
+			Labels:   labels,
+		})
+	}
+}
+
+// finalize sorts and merges the intervals.
+func (c Coverage) finalize() {
+	for _, mc := range c {
+		mc.Intervals = mergeIntervals(mc.Intervals)
+		sort.Slice(mc.Events, func(i, j int) bool {
+			return mc.Events[i].Time.Before(mc.Events[j].Time)
+		})
+	}
+}
+
+func mergeIntervals(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return intervals
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+
+	merged := []Interval{intervals[0]}
+	for _, in := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if in.Start.Sub(last.End) <= coverageMergeGap {
+			if in.End.After(last.End) {
+				last.End = in.End
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+	return merged
+}
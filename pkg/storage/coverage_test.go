@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverage(t *testing.T) {
+	at := func(hour, min, sec int) time.Time {
+		return time.Date(2001, 2, 3, hour, min, sec, 0, time.UTC)
+	}
+	fs := fstest.MapFS{
+		"2001/02/03/m1/2001-02-03_01-00-00_m1.json": searchTestFile(at(1, 0, 0), []Event{
+			{
+				Time: at(1, 1, 0),
+				Detections: []Detection{
+					{Label: "person"}, {Label: "car"}, {Label: "person"},
+				},
+				Duration: time.Second,
+			},
+		}),
+		"2001/02/03/m1/2001-02-03_01-10-01_m1.json": searchTestFile(at(1, 10, 1), nil),
+		"2001/02/03/m1/2001-02-03_02-00-00_m1.json": searchTestFile(at(2, 0, 0), nil),
+		"2001/02/03/m2/2001-02-03_01-05-00_m2.json": searchTestFile(at(1, 5, 0), []Event{
+			{Time: at(1, 6, 0)},
+		}),
+	}
+	crawler := NewCrawler(fs)
+
+	t.Run("ok", func(t *testing.T) {
+		coverage, err := crawler.Coverage(CoverageQuery{
+			Monitors: []string{"m1", "m3"},
+			Start:    at(1, 0, 0),
+			End:      at(2, 5, 0),
+		})
+		require.NoError(t, err)
+
+		expected := Coverage{
+			"m1": {
+				Intervals: []Interval{
+					{Start: at(1, 0, 0), End: at(1, 20, 1)},
+					{Start: at(2, 0, 0), End: at(2, 5, 0)},
+				},
+				Events: []EventMarker{{
+					Time:     at(1, 1, 0),
+					Duration: time.Second,
+					Labels:   []string{"person", "car"},
+				}},
+			},
+			"m3": {
+				Intervals: []Interval{},
+				Events:    []EventMarker{},
+			},
+		}
+		require.Equal(t, expected, coverage)
+	})
+	t.Run("allMonitors", func(t *testing.T) {
+		coverage, err := crawler.Coverage(CoverageQuery{
+			Start: at(1, 8, 0),
+			End:   at(1, 30, 0),
+		})
+		require.NoError(t, err)
+
+		expected := Coverage{
+			"m1": {
+				Intervals: []Interval{{Start: at(1, 8, 0), End: at(1, 20, 1)}},
+				Events:    []EventMarker{},
+			},
+			"m2": {
+				Intervals: []Interval{{Start: at(1, 8, 0), End: at(1, 15, 0)}},
+				Events:    []EventMarker{},
+			},
+		}
+		require.Equal(t, expected, coverage)
+	})
+	t.Run("endBeforeStart", func(t *testing.T) {
+		_, err := crawler.Coverage(CoverageQuery{
+			Start: at(2, 0, 0),
+			End:   at(1, 0, 0),
+		})
+		require.ErrorIs(t, err, ErrInvalidValue)
+	})
+}
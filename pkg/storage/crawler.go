@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 // Recordings are stored in the following format
@@ -45,6 +46,9 @@ type queryCache map[string][]dir
 // Crawler crawls through storage looking for recordings.
 type Crawler struct {
 	fs fs.FS
+
+	// Returns the longest possible recording, optional.
+	maxRecLength func() time.Duration
 }
 
 // NewCrawler creates new crawler.
@@ -52,6 +56,12 @@ func NewCrawler(fileSystem fs.FS) *Crawler {
 	return &Crawler{fs: fileSystem}
 }
 
+// SetMaxRecordingLength sets the function that returns the longest possible
+// recording. Searches use it to find recordings that started before the query.
+func (c *Crawler) SetMaxRecordingLength(f func() time.Duration) {
+	c.maxRecLength = f
+}
+
 // ErrInvalidValue invalid value.
 var ErrInvalidValue = errors.New("invalid value")
 
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ExportManifest summary of the exported recordings.
+type ExportManifest struct {
+	Created    time.Time           `json:"created"`
+	Recordings []ExportedRecording `json:"recordings"`
+}
+
+// ExportedRecording manifest entry.
+type ExportedRecording struct {
+	ID     string         `json:"id"`
+	Data   *RecordingData `json:"data"`
+	Files  []string       `json:"files"`
+	Errors []string       `json:"errors,omitempty"`
+}
+
+// ExportManifestName name of the manifest file in the archive.
+const ExportManifestName = "manifest.json"
+
+// ExportRecordings writes a zip archive containing the video,
+// thumbnail and data file of each recording to w. Recordings
+// and files that cannot be read are listed in the manifest.
+// The archive is streamed, w is only written to sequentially.
+func ExportRecordings(
+	w io.Writer,
+	recordingsDir string,
+	recIDs []string,
+	cache *VideoCache,
+) error {
+	zw := zip.NewWriter(w)
+
+	manifest := ExportManifest{
+		Created:    time.Now(),
+		Recordings: []ExportedRecording{},
+	}
+	for _, recID := range recIDs {
+		entry, err := exportRecording(zw, recordingsDir, recID, cache)
+		if err != nil {
+			return fmt.Errorf("export %v: %w", recID, err)
+		}
+		manifest.Recordings = append(manifest.Recordings, *entry)
+	}
+
+	rawManifest, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     ExportManifestName,
+		Method:   zip.Deflate,
+		Modified: manifest.Created,
+	})
+	if err != nil {
+		return fmt.Errorf("create manifest: %w", err)
+	}
+	if _, err := fw.Write(rawManifest); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	return zw.Close()
+}
+
+// exportRecording only returns errors from writing the archive,
+// other errors are added to the manifest entry.
+func exportRecording(
+	zw *zip.Writer,
+	recordingsDir string,
+	recID string,
+	cache *VideoCache,
+) (*ExportedRecording, error) {
+	entry := &ExportedRecording{
+		ID:    recID,
+		Files: []string{},
+	}
+	addErr := func(err error) {
+		entry.Errors = append(entry.Errors, err.Error())
+	}
+
+	recPath, err := RecordingIDToPath(recID)
+	if err != nil {
+		addErr(err)
+		return entry, nil
+	}
+	path := filepath.Join(recordingsDir, recPath)
+
+	if rawData, err := os.ReadFile(path + ".json"); err == nil {
+		var data RecordingData
+		if err := json.Unmarshal(rawData, &data); err == nil {
+			entry.Data = &data
+		}
+	}
+
+	// Video.
+	video, modTime, err := openExportVideo(path, cache)
+	if err != nil {
+		addErr(fmt.Errorf("video: %w", err))
+	} else {
+		err = copyToZip(zw, recID+".mp4", zip.Store, modTime, video)
+		video.Close()
+		if err != nil {
+			return nil, err
+		}
+		entry.Files = append(entry.Files, recID+".mp4")
+	}
+
+	// Thumbnail and data.
+	files := []struct {
+		ext    string
+		method uint16
+	}{
+		{".jpeg", zip.Store},
+		{".json", zip.Deflate},
+	}
+	for _, f := range files {
+		file, err := os.Open(path + f.ext)
+		if err != nil {
+			addErr(err)
+			continue
+		}
+		var modTime time.Time
+		if stat, err := file.Stat(); err == nil {
+			modTime = stat.ModTime()
+		}
+		err = copyToZip(zw, recID+f.ext, f.method, modTime, file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		entry.Files = append(entry.Files, recID+f.ext)
+	}
+
+	return entry, nil
+}
+
+// openExportVideo opens the mp4 file if it exists,
+// otherwise it generates a mp4 from the meta and mdat files.
+func openExportVideo(path string, cache *VideoCache) (io.ReadCloser, time.Time, error) {
+	mp4File, err := os.Open(path + ".mp4")
+	if err == nil {
+		var modTime time.Time
+		if stat, err := mp4File.Stat(); err == nil {
+			modTime = stat.ModTime()
+		}
+		return mp4File, modTime, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, err
+	}
+
+	video, err := NewVideoReader(path, cache)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return video, video.ModTime(), nil
+}
+
+func copyToZip(
+	zw *zip.Writer,
+	name string,
+	method uint16,
+	modTime time.Time,
+	r io.Reader,
+) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("create %v: %w", name, err)
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return fmt.Errorf("write %v: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRecordings(t *testing.T) {
+	tempDir := t.TempDir()
+	recID := "2001-02-03_04-05-06_m1"
+	recDir := filepath.Join(tempDir, "2001", "02", "03", "m1")
+	require.NoError(t, os.MkdirAll(recDir, 0o700))
+	path := filepath.Join(recDir, recID)
+
+	testMeta := []byte{
+		0,    // Version.
+		0, 7, // Video sps size.
+		103, 0, 0, 0, 172, 217, 0, // Video sps.
+		0, 3, // Video pps size.
+		2, 3, 4, // Video pps.
+		0, 0, // Audio config size.
+		0, 0, 0, 0, 0, 0, 0, 0, // Start time.
+
+		// Sample.
+		0,                        // Flags.
+		0, 0, 0, 0, 0, 0, 0, 0x0, // PTS.
+		0, 0, 0, 0, 0, 0, 0, 0, // DTS.
+		0, 0, 0, 0, 0, 0, 0, 0, // Next dts.
+		0, 0, 0, 0, // Offset.
+		0, 0, 0, 0, // Size.
+	}
+	writeFile := func(path string, data []byte) {
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+	}
+	writeFile(path+".meta", testMeta)
+	writeFile(path+".mdat", []byte{0, 0, 0, 0})
+	writeFile(path+".jpeg", []byte("jpeg"))
+	writeFile(path+".json", crawlerTestData)
+
+	buf := &bytes.Buffer{}
+	missingID := "2001-02-03_04-05-07_m1"
+	err := ExportRecordings(buf, tempDir, []string{recID, missingID, "invalid"}, nil)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+	}
+	require.Len(t, files, 4)
+	require.Equal(t, []byte("ftyp"), files[recID+".mp4"][4:8])
+	require.Equal(t, []byte("jpeg"), files[recID+".jpeg"])
+	require.Equal(t, crawlerTestData, files[recID+".json"])
+
+	var manifest ExportManifest
+	require.NoError(t, json.Unmarshal(files[ExportManifestName], &manifest))
+	require.Len(t, manifest.Recordings, 3)
+
+	rec := manifest.Recordings[0]
+	require.Equal(t, recID, rec.ID)
+	require.Equal(t, []string{recID + ".mp4", recID + ".jpeg", recID + ".json"}, rec.Files)
+	require.Empty(t, rec.Errors)
+	require.NotNil(t, rec.Data)
+	require.Len(t, rec.Data.Events, 1)
+
+	missing := manifest.Recordings[1]
+	require.Equal(t, missingID, missing.ID)
+	require.Empty(t, missing.Files)
+	require.Len(t, missing.Errors, 3)
+
+	require.Len(t, manifest.Recordings[2].Errors, 1)
+}
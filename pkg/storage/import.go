@@ -0,0 +1,357 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/video/customformat"
+	"nvr/pkg/video/gortsplib"
+	"nvr/pkg/video/hls"
+	"nvr/pkg/video/mp4"
+	"nvr/pkg/video/mp4muxer"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportConfig mp4 import config.
+type ImportConfig struct {
+	RecordingsDir string
+	MonitorID     string
+
+	// Recording start time. The mp4 creation time is used if zero.
+	Start time.Time
+
+	// Thumbnail generation is skipped if empty.
+	FFmpegBin string
+}
+
+// Import errors.
+var (
+	ErrImportNoVideo     = errors.New("no h264 video track")
+	ErrImportNoStart     = errors.New("start time missing")
+	ErrImportExist       = errors.New("recording already exists")
+	ErrImportTooLarge    = errors.New("video data exceeds 4GB")
+	ErrImportMonitorID   = errors.New("invalid monitor ID")
+	ErrImportNALULength  = errors.New("invalid nalu length")
+	ErrImportNoKeyframes = errors.New("no keyframes")
+)
+
+// ImportInputError the input file is invalid or unsupported.
+// Other import errors are storage failures.
+type ImportInputError struct {
+	Err error
+}
+
+func (e ImportInputError) Error() string { return e.Err.Error() }
+
+func (e ImportInputError) Unwrap() error { return e.Err }
+
+// ImportMP4 converts a H264/AAC mp4 file into a recording and
+// returns the recording ID. The video is stored in the same
+// format as native recordings and the data file has no events.
+func ImportMP4(in io.ReadSeeker, c ImportConfig) (string, error) { //nolint:funlen
+	if c.MonitorID == "" || strings.ContainsAny(c.MonitorID, `/\ `) ||
+		strings.Contains(c.MonitorID, "..") {
+		return "", ImportInputError{fmt.Errorf("%w: %q", ErrImportMonitorID, c.MonitorID)}
+	}
+
+	file, err := mp4.Demux(in)
+	if err != nil {
+		return "", ImportInputError{fmt.Errorf("demux: %w", err)}
+	}
+	videoTrack := file.VideoTrack()
+	if videoTrack == nil || len(videoTrack.SPS) == 0 || len(videoTrack.PPS) == 0 {
+		return "", ImportInputError{ErrImportNoVideo}
+	}
+	audioTrack := file.AudioTrack()
+	if audioTrack != nil && len(audioTrack.AudioConfig) == 0 {
+		audioTrack = nil
+	}
+
+	start := c.Start
+	if start.IsZero() {
+		start = file.CreationTime
+	}
+	if start.IsZero() {
+		return "", ImportInputError{ErrImportNoStart}
+	}
+
+	var dataSize uint64
+	for _, s := range videoTrack.Samples {
+		dataSize += uint64(s.Size)
+	}
+	if audioTrack != nil {
+		for _, s := range audioTrack.Samples {
+			dataSize += uint64(s.Size)
+		}
+	}
+	if dataSize > math.MaxUint32 {
+		return "", ImportInputError{ErrImportTooLarge}
+	}
+
+	recID := start.Format("2006-01-02_15-04-05_") + c.MonitorID
+	recDir := filepath.Join(c.RecordingsDir, start.Format("2006/01/02/")+c.MonitorID)
+	recPath := filepath.Join(recDir, recID)
+
+	if _, err := os.Stat(recPath + ".meta"); err == nil {
+		return "", fmt.Errorf("%w: %v", ErrImportExist, recID)
+	}
+	if err := os.MkdirAll(recDir, 0o755); err != nil {
+		return "", fmt.Errorf("make directory: %w", err)
+	}
+
+	end, thumbSegment, err := importVideo(in, recPath, start, videoTrack, audioTrack)
+	if errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("%w: %v", ErrImportExist, recID)
+	}
+	if err != nil {
+		removeRecording(recPath)
+		return "", err
+	}
+
+	data := RecordingData{
+		Start:  start,
+		End:    end,
+		Events: []Event{},
+	}
+	rawData, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		removeRecording(recPath)
+		return "", fmt.Errorf("marshal data: %w", err)
+	}
+	if err := os.WriteFile(recPath+".json", rawData, 0o600); err != nil {
+		removeRecording(recPath)
+		return "", fmt.Errorf("write data: %w", err)
+	}
+
+	if c.FFmpegBin != "" {
+		h264Track := &gortsplib.TrackH264{SPS: videoTrack.SPS, PPS: videoTrack.PPS}
+		err := GenerateThumbnail(c.FFmpegBin, recPath+".jpeg", thumbSegment, h264Track, nil)
+		if err != nil {
+			removeRecording(recPath)
+			return "", err
+		}
+	}
+
+	return recID, nil
+}
+
+// removeRecording removes the files of a partially imported recording.
+func removeRecording(recPath string) {
+	for _, ext := range []string{".meta", ".mdat", ".json", ".jpeg"} {
+		os.Remove(recPath + ext)
+	}
+}
+
+// importVideo writes the meta and mdat files one GOP at a time.
+// Returns the end time and a segment containing the first keyframe.
+func importVideo( //nolint:funlen
+	in io.ReadSeeker,
+	recPath string,
+	start time.Time,
+	videoTrack *mp4.Track,
+	audioTrack *mp4.Track,
+) (time.Time, *hls.Segment, error) {
+	meta, err := os.OpenFile(recPath+".meta", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("create meta file: %w", err)
+	}
+	defer meta.Close()
+
+	mdat, err := os.OpenFile(recPath+".mdat", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		meta.Close()
+		os.Remove(recPath + ".meta")
+		return time.Time{}, nil, fmt.Errorf("create mdat file: %w", err)
+	}
+	defer mdat.Close()
+
+	header := customformat.Header{
+		VideoSPS:  videoTrack.SPS,
+		VideoPPS:  videoTrack.PPS,
+		StartTime: start.UnixNano(),
+	}
+	if audioTrack != nil {
+		header.AudioConfig = audioTrack.AudioConfig
+	}
+
+	w, err := customformat.NewWriter(meta, mdat, header)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("new writer: %w", err)
+	}
+
+	startNano := start.UnixNano()
+	videoTime := func(v int64) int64 {
+		return startNano + timescaleToNano(v, videoTrack.Timescale)
+	}
+
+	// Skip samples before the first keyframe.
+	videoSamples := videoTrack.Samples
+	for len(videoSamples) > 0 && !videoSamples[0].IsSync {
+		videoSamples = videoSamples[1:]
+	}
+	if len(videoSamples) == 0 {
+		return time.Time{}, nil, ImportInputError{ErrImportNoKeyframes}
+	}
+
+	var audioSamples []mp4.Sample
+	if audioTrack != nil {
+		audioSamples = audioTrack.Samples
+	}
+	audioTime := func(v int64) int64 {
+		return startNano + timescaleToNano(v, audioTrack.Timescale)
+	}
+
+	var thumbSegment *hls.Segment
+	var end int64
+	for len(videoSamples) > 0 {
+		// Group of pictures.
+		n := 1
+		for n < len(videoSamples) && !videoSamples[n].IsSync {
+			n++
+		}
+		gop := videoSamples[:n]
+		videoSamples = videoSamples[n:]
+
+		part := &hls.MuxerPart{}
+		for _, s := range gop {
+			avcc, err := readSample(in, s)
+			if err != nil {
+				return time.Time{}, nil, err
+			}
+			if videoTrack.NALULengthSize != 4 {
+				avcc, err = convertNALULength(avcc, videoTrack.NALULengthSize)
+				if err != nil {
+					return time.Time{}, nil, ImportInputError{err}
+				}
+			}
+			dts := videoTime(int64(s.DTS))
+			part.VideoSamples = append(part.VideoSamples, &hls.VideoSample{
+				PTS:        videoTime(int64(s.DTS) + s.CTS),
+				DTS:        dts,
+				AVCC:       avcc,
+				IdrPresent: s.IsSync,
+				Duration:   time.Duration(videoTime(int64(s.DTS+uint64(s.Duration))) - dts),
+			})
+			end = dts + int64(part.VideoSamples[len(part.VideoSamples)-1].Duration)
+		}
+
+		// Audio samples before the next keyframe.
+		for len(audioSamples) > 0 {
+			s := audioSamples[0]
+			pts := audioTime(int64(s.DTS))
+			if len(videoSamples) > 0 && pts >= videoTime(int64(videoSamples[0].DTS)) {
+				break
+			}
+			audioSamples = audioSamples[1:]
+
+			au, err := readSample(in, s)
+			if err != nil {
+				return time.Time{}, nil, err
+			}
+			part.AudioSamples = append(part.AudioSamples, &hls.AudioSample{
+				AU:      au,
+				PTS:     pts,
+				NextPTS: audioTime(int64(s.DTS + uint64(s.Duration))),
+			})
+		}
+
+		segment := &hls.Segment{Parts: []*hls.MuxerPart{part}}
+		if err := w.WriteSegment(segment); err != nil {
+			return time.Time{}, nil, fmt.Errorf("write segment: %w", err)
+		}
+		if thumbSegment == nil {
+			thumbSegment = &hls.Segment{Parts: []*hls.MuxerPart{{
+				VideoSamples: part.VideoSamples[:1],
+			}}}
+		}
+	}
+
+	return time.Unix(0, end), thumbSegment, nil
+}
+
+func readSample(in io.ReadSeeker, s mp4.Sample) ([]byte, error) {
+	if _, err := in.Seek(int64(s.Offset), io.SeekStart); err != nil {
+		return nil, ImportInputError{fmt.Errorf("seek sample: %w", err)}
+	}
+	buf := make([]byte, s.Size)
+	if _, err := io.ReadFull(in, buf); err != nil {
+		return nil, ImportInputError{fmt.Errorf("read sample: %w", err)}
+	}
+	return buf, nil
+}
+
+// convertNALULength converts NALU length prefixes to 4 bytes.
+func convertNALULength(avcc []byte, lengthSize int) ([]byte, error) {
+	var out []byte
+	for len(avcc) > 0 {
+		if len(avcc) < lengthSize {
+			return nil, ErrImportNALULength
+		}
+		var size int
+		for i := 0; i < lengthSize; i++ {
+			size = size<<8 | int(avcc[i])
+		}
+		avcc = avcc[lengthSize:]
+		if size > len(avcc) {
+			return nil, ErrImportNALULength
+		}
+		out = binary.BigEndian.AppendUint32(out, uint32(size))
+		out = append(out, avcc[:size]...)
+		avcc = avcc[size:]
+	}
+	return out, nil
+}
+
+// timescaleToNano converts value in the timescale into nanoseconds.
+func timescaleToNano(value int64, timescale uint32) int64 {
+	ts := int64(timescale)
+	secs := value / ts
+	dec := value % ts
+	return secs*int64(time.Second) + dec*int64(time.Second)/ts
+}
+
+// GenerateThumbnail generates a jpeg thumbnail from the first
+// keyframe in the segment. The ffmpeg output is passed to logFunc.
+func GenerateThumbnail(
+	ffmpegBin string,
+	thumbPath string,
+	segment *hls.Segment,
+	videoTrack *gortsplib.TrackH264,
+	logFunc ffmpeg.LogFunc,
+) error {
+	videoBuffer := &bytes.Buffer{}
+	err := mp4muxer.GenerateThumbnailVideo(videoBuffer, segment, videoTrack)
+	if err != nil {
+		return fmt.Errorf("generate thumbnail video: %w", err)
+	}
+
+	args := []string{
+		"-n", "-threads", "1", "-loglevel", "error",
+		"-i", "-", // Input.
+		"-frames:v", "1", thumbPath, // Output.
+	}
+	cmd := exec.Command(ffmpegBin, args...)
+	cmd.Stdin = videoBuffer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	process := ffmpeg.NewProcess(cmd).
+		StdoutLogger(logFunc).
+		StderrLogger(logFunc)
+	if err := process.Start(ctx); err != nil {
+		return fmt.Errorf("generate thumbnail: %w", err)
+	}
+	return nil
+}
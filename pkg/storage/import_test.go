@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nvr/pkg/video/customformat"
+	"nvr/pkg/video/gortsplib"
+	"nvr/pkg/video/gortsplib/pkg/mpeg4audio"
+	"nvr/pkg/video/mp4muxer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportMP4(t *testing.T) {
+	start := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	at := func(d time.Duration) int64 {
+		return start.Add(d).UnixNano()
+	}
+
+	sps := []byte{
+		103, 100, 0, 22, 172, 217, 64, 164,
+		59, 228, 136, 192, 68, 0, 0, 3,
+		0, 4, 0, 0, 3, 0, 96, 60,
+		88, 182, 88,
+	}
+	pps := []byte{1, 2}
+	audioConfig := &mpeg4audio.Config{
+		Type:         mpeg4audio.ObjectTypeAACLC,
+		SampleRate:   48000,
+		ChannelCount: 1,
+	}
+	rawAudioConfig, err := audioConfig.Marshal()
+	require.NoError(t, err)
+
+	samples := []customformat.Sample{
+		{IsSyncSample: true, PTS: at(0), DTS: at(0), Next: at(1 * time.Second), Size: 8},
+		{IsAudioSample: true, PTS: at(0), Next: at(500 * time.Millisecond), Size: 2},
+		{IsAudioSample: true, PTS: at(500 * time.Millisecond), Next: at(1 * time.Second), Size: 3},
+		{PTS: at(1 * time.Second), DTS: at(1 * time.Second), Next: at(2 * time.Second), Size: 6},
+	}
+	sampleData := []byte{
+		0, 0, 0, 4, 5, 1, 2, 3, // Video sample 1.
+		7, 7, // Audio sample 1.
+		8, 8, 8, // Audio sample 2.
+		0, 0, 0, 2, 1, 9, // Video sample 2.
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = mp4muxer.GenerateMP4(
+		buf,
+		start.UnixNano(),
+		samples,
+		&gortsplib.TrackH264{SPS: sps, PPS: pps},
+		&gortsplib.TrackMPEG4Audio{Config: audioConfig},
+	)
+	require.NoError(t, err)
+	buf.Write(sampleData)
+	testMP4 := buf.Bytes()
+
+	t.Run("ok", func(t *testing.T) {
+		tempDir := t.TempDir()
+		recID, err := ImportMP4(bytes.NewReader(testMP4), ImportConfig{
+			RecordingsDir: tempDir,
+			MonitorID:     "m1",
+			Start:         start,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "2001-02-03_04-05-06_m1", recID)
+
+		recPath := filepath.Join(tempDir, "2001", "02", "03", "m1", recID)
+
+		meta, err := os.Open(recPath + ".meta")
+		require.NoError(t, err)
+		defer meta.Close()
+		stat, err := meta.Stat()
+		require.NoError(t, err)
+
+		reader, header, err := customformat.NewReader(meta, int(stat.Size()))
+		require.NoError(t, err)
+		expectedHeader := &customformat.Header{
+			VideoSPS:    sps,
+			VideoPPS:    pps,
+			AudioConfig: rawAudioConfig,
+			StartTime:   start.UnixNano(),
+		}
+		require.Equal(t, expectedHeader, header)
+
+		gotSamples, err := reader.ReadAllSamples()
+		require.NoError(t, err)
+		expectedSamples := []customformat.Sample{
+			{
+				IsSyncSample: true,
+				PTS:          at(0),
+				DTS:          at(0),
+				Next:         at(1 * time.Second),
+				Size:         8,
+				Offset:       0,
+			},
+			{
+				IsAudioSample: true,
+				PTS:           at(0),
+				Next:          at(500 * time.Millisecond),
+				Size:          2,
+				Offset:        8,
+			},
+			{
+				IsAudioSample: true,
+				PTS:           at(500 * time.Millisecond),
+				Next:          at(1 * time.Second),
+				Size:          3,
+				Offset:        10,
+			},
+			{
+				PTS:    at(1 * time.Second),
+				DTS:    at(1 * time.Second),
+				Next:   at(2 * time.Second),
+				Size:   6,
+				Offset: 13,
+			},
+		}
+		require.Equal(t, expectedSamples, gotSamples)
+
+		mdat, err := os.ReadFile(recPath + ".mdat")
+		require.NoError(t, err)
+		require.Equal(t, sampleData, mdat)
+
+		rawData, err := os.ReadFile(recPath + ".json")
+		require.NoError(t, err)
+		var data RecordingData
+		require.NoError(t, json.Unmarshal(rawData, &data))
+		require.True(t, start.Equal(data.Start))
+		require.True(t, start.Add(2*time.Second).Equal(data.End))
+		require.Empty(t, data.Events)
+
+		// Second import of the same recording.
+		_, err = ImportMP4(bytes.NewReader(testMP4), ImportConfig{
+			RecordingsDir: tempDir,
+			MonitorID:     "m1",
+			Start:         start,
+		})
+		require.ErrorIs(t, err, ErrImportExist)
+	})
+	t.Run("invalidMonitorID", func(t *testing.T) {
+		for _, id := range []string{"", "../m1", "a/b", "a b"} {
+			_, err := ImportMP4(bytes.NewReader(testMP4), ImportConfig{
+				RecordingsDir: t.TempDir(),
+				MonitorID:     id,
+				Start:         start,
+			})
+			require.ErrorIs(t, err, ErrImportMonitorID)
+			require.ErrorAs(t, err, &ImportInputError{})
+		}
+	})
+	t.Run("invalidInput", func(t *testing.T) {
+		_, err := ImportMP4(bytes.NewReader(testMP4[:len(testMP4)-1]), ImportConfig{
+			RecordingsDir: t.TempDir(),
+			MonitorID:     "m1",
+			Start:         start,
+		})
+		require.ErrorAs(t, err, &ImportInputError{})
+	})
+	t.Run("thumbnailErr", func(t *testing.T) {
+		tempDir := t.TempDir()
+		_, err := ImportMP4(bytes.NewReader(testMP4), ImportConfig{
+			RecordingsDir: tempDir,
+			MonitorID:     "m1",
+			Start:         start,
+			FFmpegBin:     filepath.Join(tempDir, "nil"),
+		})
+		require.Error(t, err)
+		require.False(t, errors.As(err, &ImportInputError{}))
+
+		// The partial recording is removed.
+		recDir := filepath.Join(tempDir, "2001", "02", "03", "m1")
+		entries, err := os.ReadDir(recDir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+
+		_, err = ImportMP4(bytes.NewReader(testMP4), ImportConfig{
+			RecordingsDir: tempDir,
+			MonitorID:     "m1",
+			Start:         start,
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestConvertNALULength(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		avcc := []byte{0, 2, 1, 2, 0, 1, 3}
+		converted, err := convertNALULength(avcc, 2)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0, 0, 0, 2, 1, 2, 0, 0, 0, 1, 3}, converted)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		_, err := convertNALULength([]byte{0, 3, 1, 2}, 2)
+		require.ErrorIs(t, err, ErrImportNALULength)
+	})
+}
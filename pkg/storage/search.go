@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"nvr/pkg/ffmpeg"
+	"time"
+)
+
+// SearchQuery query of recordings with matching detections.
+// Recordings are returned newest first.
+type SearchQuery struct {
+	Monitors []string
+	Start    time.Time
+	End      time.Time
+
+	// Empty values are ignored.
+	Labels      []string
+	MinScore    float64
+	Region      ffmpeg.Polygon // Detection center must be inside, percent values.
+	MinDuration time.Duration  // Minimum event duration.
+
+	Limit int
+
+	// Cursor from the previous response.
+	Cursor string
+}
+
+// SearchResponse search result and cursor to the next page.
+type SearchResponse struct {
+	Recordings []Recording `json:"recordings"`
+
+	// Empty if there are no more pages.
+	Cursor string `json:"cursor"`
+}
+
+// DetectionMatch points to a detection in RecordingData.Events.
+type DetectionMatch struct {
+	Event     int `json:"event"`
+	Detection int `json:"detection"`
+}
+
+const (
+	// Used if the longest recording is unknown.
+	defaultSearchLookback = 1 * time.Hour
+
+	// Recordings may run a few segments past the video length.
+	searchLookbackMargin = 1 * time.Minute
+
+	searchBatchSize = 100
+	recIDTimeFormat = "2006-01-02_15-04-05"
+)
+
+// searchLookback returns how long before the query start to scan.
+// Recordings are ordered by start time, a recording that
+// started before the query start may still overlap it.
+func (c *Crawler) searchLookback() time.Duration {
+	if c.maxRecLength == nil {
+		return defaultSearchLookback
+	}
+	return c.maxRecLength() + searchLookbackMargin
+}
+
+// filtersDetections if the query has any detection filters.
+func (q *SearchQuery) filtersDetections() bool {
+	return len(q.Labels) != 0 ||
+		q.MinScore != 0 ||
+		len(q.Region) != 0 ||
+		q.MinDuration != 0
+}
+
+// Search finds recordings with events that match the query.
+func (c *Crawler) Search(q SearchQuery) (*SearchResponse, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("limit: %v: %w", q.Limit, ErrInvalidValue)
+	}
+	if q.End.Before(q.Start) {
+		return nil, fmt.Errorf("end before start: %w", ErrInvalidValue)
+	}
+
+	// Include recordings that started during the last second.
+	cursor := q.End.Add(time.Second).Format(recIDTimeFormat)
+	if q.Cursor != "" {
+		var err error
+		cursor, err = decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	scanStop := q.Start.Add(-c.searchLookback()).Format(recIDTimeFormat)
+
+	res := &SearchResponse{Recordings: []Recording{}}
+	for {
+		batch, err := c.RecordingByQuery(&CrawlerQuery{
+			Time:        cursor,
+			Limit:       searchBatchSize,
+			Monitors:    q.Monitors,
+			IncludeData: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rec := range batch {
+			if rec.ID < scanStop {
+				return res, nil
+			}
+			cursor = rec.ID
+
+			matches, ok := q.match(rec.Data)
+			if !ok {
+				continue
+			}
+			rec.Matches = matches
+			res.Recordings = append(res.Recordings, rec)
+
+			if len(res.Recordings) >= q.Limit {
+				res.Cursor = encodeCursor(cursor)
+				return res, nil
+			}
+		}
+
+		if len(batch) < searchBatchSize {
+			return res, nil
+		}
+	}
+}
+
+// match returns the matching detections and true if the recording matches.
+func (q *SearchQuery) match(data *RecordingData) ([]DetectionMatch, bool) {
+	// Recordings without data haven't been saved successfully.
+	if data == nil {
+		return nil, false
+	}
+	if data.End.Before(q.Start) || data.Start.After(q.End) {
+		return nil, false
+	}
+
+	var matches []DetectionMatch
+	for i, event := range data.Events {
+		if event.Time.Before(q.Start) || event.Time.After(q.End) {
+			continue
+		}
+		if event.Duration < q.MinDuration {
+			continue
+		}
+		for j, d := range event.Detections {
+			if q.matchDetection(d) {
+				matches = append(matches, DetectionMatch{Event: i, Detection: j})
+			}
+		}
+	}
+
+	if !q.filtersDetections() {
+		return matches, true
+	}
+	return matches, len(matches) != 0
+}
+
+func (q *SearchQuery) matchDetection(d Detection) bool {
+	if d.Score < q.MinScore {
+		return false
+	}
+	if len(q.Labels) != 0 && !stringInStrings(d.Label, q.Labels) {
+		return false
+	}
+	if len(q.Region) != 0 {
+		if d.Region == nil || d.Region.Rect == nil {
+			return false
+		}
+		x, y := d.Region.Rect.Center()
+		if !ffmpeg.VertexInsidePoly(int(x), int(y), q.Region) {
+			return false
+		}
+	}
+	return true
+}
+
+func stringInStrings(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeCursor(recID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(recID))
+}
+
+// ErrInvalidCursor invalid cursor.
+var ErrInvalidCursor = fmt.Errorf("%w: cursor", ErrInvalidValue)
+
+func decodeCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	recID := string(raw)
+	if _, err := RecordingIDToPath(recID); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return recID, nil
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package storage
+
+import (
+	"encoding/json"
+	"nvr/pkg/ffmpeg"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func searchTestFile(start time.Time, events []Event) *fstest.MapFile {
+	data := RecordingData{
+		Start:  start,
+		End:    start.Add(10 * time.Minute),
+		Events: events,
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	return &fstest.MapFile{Data: raw}
+}
+
+func searchTestFS() fstest.MapFS {
+	t := func(hour, min int) time.Time {
+		return time.Date(2001, 2, 3, hour, min, 0, 0, time.UTC)
+	}
+	rect := func(top, left, bottom, right int) *Region {
+		return &Region{Rect: &ffmpeg.Rect{top, left, bottom, right}}
+	}
+	return fstest.MapFS{
+		"2001/02/03/m1/2001-02-03_01-00-00_m1.json": searchTestFile(t(1, 0), []Event{
+			{
+				Time:       t(1, 1),
+				Detections: []Detection{{Label: "person", Score: 90, Region: rect(0, 0, 20, 20)}},
+				Duration:   10 * time.Second,
+			},
+		}),
+		"2001/02/03/m1/2001-02-03_02-00-00_m1.json": searchTestFile(t(2, 0), []Event{
+			{
+				Time: t(2, 1),
+				Detections: []Detection{
+					{Label: "car", Score: 50, Region: rect(80, 80, 100, 100)},
+					{Label: "person", Score: 40, Region: rect(80, 80, 100, 100)},
+				},
+				Duration: 1 * time.Second,
+			},
+		}),
+		"2001/02/03/m2/2001-02-03_03-00-00_m2.json": searchTestFile(t(3, 0), []Event{
+			{
+				Time:       t(3, 1),
+				Detections: []Detection{{Label: "person", Score: 70, Region: rect(0, 0, 20, 20)}},
+				Duration:   5 * time.Second,
+			},
+		}),
+		"2001/02/03/m2/2001-02-03_04-00-00_m2.json": searchTestFile(t(4, 0), nil),
+	}
+}
+
+func TestSearch(t *testing.T) {
+	start := time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2001, 2, 3, 23, 0, 0, 0, time.UTC)
+
+	search := func(q SearchQuery) []string {
+		if q.Start.IsZero() {
+			q.Start = start
+		}
+		if q.End.IsZero() {
+			q.End = end
+		}
+		if q.Limit == 0 {
+			q.Limit = 10
+		}
+		res, err := NewCrawler(searchTestFS()).Search(q)
+		require.NoError(t, err)
+
+		ids := []string{}
+		for _, rec := range res.Recordings {
+			ids = append(ids, rec.ID)
+		}
+		return ids
+	}
+
+	t.Run("noFilters", func(t *testing.T) {
+		expected := []string{
+			"2001-02-03_04-00-00_m2",
+			"2001-02-03_03-00-00_m2",
+			"2001-02-03_02-00-00_m1",
+			"2001-02-03_01-00-00_m1",
+		}
+		require.Equal(t, expected, search(SearchQuery{}))
+	})
+	t.Run("timeRange", func(t *testing.T) {
+		q := SearchQuery{
+			Start: time.Date(2001, 2, 3, 2, 5, 0, 0, time.UTC),
+			End:   time.Date(2001, 2, 3, 3, 5, 0, 0, time.UTC),
+		}
+		expected := []string{
+			"2001-02-03_03-00-00_m2",
+			"2001-02-03_02-00-00_m1",
+		}
+		require.Equal(t, expected, search(q))
+	})
+	t.Run("label", func(t *testing.T) {
+		q := SearchQuery{Labels: []string{"car"}}
+		require.Equal(t, []string{"2001-02-03_02-00-00_m1"}, search(q))
+	})
+	t.Run("minScore", func(t *testing.T) {
+		q := SearchQuery{Labels: []string{"person"}, MinScore: 60}
+		expected := []string{
+			"2001-02-03_03-00-00_m2",
+			"2001-02-03_01-00-00_m1",
+		}
+		require.Equal(t, expected, search(q))
+	})
+	t.Run("region", func(t *testing.T) {
+		q := SearchQuery{Region: ffmpeg.Polygon{{50, 50}, {100, 50}, {100, 100}, {50, 100}}}
+		require.Equal(t, []string{"2001-02-03_02-00-00_m1"}, search(q))
+	})
+	t.Run("minDuration", func(t *testing.T) {
+		q := SearchQuery{MinDuration: 6 * time.Second}
+		require.Equal(t, []string{"2001-02-03_01-00-00_m1"}, search(q))
+	})
+	t.Run("monitors", func(t *testing.T) {
+		q := SearchQuery{Monitors: []string{"m2"}, Labels: []string{"person"}}
+		require.Equal(t, []string{"2001-02-03_03-00-00_m2"}, search(q))
+	})
+	t.Run("matches", func(t *testing.T) {
+		res, err := NewCrawler(searchTestFS()).Search(SearchQuery{
+			Start:  start,
+			End:    end,
+			Labels: []string{"person"},
+			Limit:  10,
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Recordings, 3)
+		require.Equal(t,
+			[]DetectionMatch{{Event: 0, Detection: 1}},
+			res.Recordings[1].Matches,
+		)
+	})
+	t.Run("cursor", func(t *testing.T) {
+		crawler := NewCrawler(searchTestFS())
+		q := SearchQuery{
+			Start:  start,
+			End:    end,
+			Labels: []string{"person"},
+			Limit:  2,
+		}
+		res, err := crawler.Search(q)
+		require.NoError(t, err)
+		require.Len(t, res.Recordings, 2)
+		require.Equal(t, "2001-02-03_02-00-00_m1", res.Recordings[1].ID)
+		require.NotEmpty(t, res.Cursor)
+
+		q.Cursor = res.Cursor
+		res, err = crawler.Search(q)
+		require.NoError(t, err)
+		require.Len(t, res.Recordings, 1)
+		require.Equal(t, "2001-02-03_01-00-00_m1", res.Recordings[0].ID)
+		require.Empty(t, res.Cursor)
+	})
+	t.Run("invalidCursor", func(t *testing.T) {
+		_, err := NewCrawler(searchTestFS()).Search(SearchQuery{
+			Start:  start,
+			End:    end,
+			Limit:  1,
+			Cursor: "x",
+		})
+		require.ErrorIs(t, err, ErrInvalidCursor)
+	})
+	t.Run("lookback", func(t *testing.T) {
+		longStart := time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)
+		raw, err := json.Marshal(RecordingData{
+			Start:  longStart,
+			End:    longStart.Add(3 * time.Hour),
+			Events: []Event{{Time: longStart.Add(150 * time.Minute)}},
+		})
+		require.NoError(t, err)
+		fs := fstest.MapFS{
+			"2001/02/03/m1/2001-02-03_00-00-00_m1.json": &fstest.MapFile{Data: raw},
+		}
+		q := SearchQuery{
+			Start: longStart.Add(140 * time.Minute),
+			End:   longStart.Add(160 * time.Minute),
+			Limit: 10,
+		}
+
+		// The recording started before the default lookback.
+		res, err := NewCrawler(fs).Search(q)
+		require.NoError(t, err)
+		require.Empty(t, res.Recordings)
+
+		crawler := NewCrawler(fs)
+		crawler.SetMaxRecordingLength(func() time.Duration { return 3 * time.Hour })
+		res, err = crawler.Search(q)
+		require.NoError(t, err)
+		require.Len(t, res.Recordings, 1)
+	})
+	t.Run("invalidLimit", func(t *testing.T) {
+		_, err := NewCrawler(searchTestFS()).Search(SearchQuery{
+			Start: start,
+			End:   end,
+		})
+		require.ErrorIs(t, err, ErrInvalidValue)
+	})
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"image"
 	"nvr/pkg/ffmpeg"
 	"time"
 )
@@ -13,6 +14,9 @@ import (
 type Recording struct {
 	ID   string         `json:"id"`
 	Data *RecordingData `json:"data"`
+
+	// Detections that matched the search query.
+	Matches []DetectionMatch `json:"matches,omitempty"`
 }
 
 // RecordingData recording data marshaled to json and saved next to video and thumbnail.
@@ -49,6 +53,32 @@ type Event struct {
 	Detections  []Detection   `json:"detections,omitempty"`
 	Duration    time.Duration `json:"duration,omitempty"`
 	RecDuration time.Duration `json:"-"`
+
+	// Optional, the frame that produced the detections.
+	// Only available to event hooks and not saved.
+	Frame *Frame `json:"-"`
+}
+
+// Frame video frame and where the detection regions are located on it.
+type Frame struct {
+	Image image.Image
+
+	// Position of the full camera frame in image coordinates. Detection
+	// regions are in percent of the full frame, which may extend beyond
+	// the image if it was cropped. Zero value means the image bounds.
+	FullFrame image.Rectangle
+}
+
+// ToImage converts a point from a detection region to image coordinates.
+func (f Frame) ToImage(p ffmpeg.Point) image.Point {
+	full := f.FullFrame
+	if full.Empty() {
+		full = f.Image.Bounds()
+	}
+	return image.Point{
+		X: full.Min.X + p[0]*full.Dx()/100,
+		Y: full.Min.Y + p[1]*full.Dy()/100,
+	}
 }
 
 func (e Event) String() string {
@@ -75,6 +105,9 @@ type Detection struct {
 	Label  string  `json:"label,omitempty"`
 	Score  float64 `json:"score,omitempty"`
 	Region *Region `json:"region,omitempty"`
+
+	// Optional, detections of the same object share the same ID.
+	TrackID int `json:"trackID,omitempty"`
 }
 
 // Region where detection occurred.
@@ -0,0 +1,689 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// File demuxed mp4 file. Only the metadata is read,
+// sample data can be read from the file using the sample offsets.
+type File struct {
+	CreationTime time.Time // Zero if unset.
+	Tracks       []*Track
+}
+
+// Track demuxed track.
+type Track struct {
+	ID          uint32
+	HandlerType [4]byte // "vide" or "soun".
+	Timescale   uint32
+
+	// Codec is the sample entry type, "avc1" or "mp4a".
+	// Other codecs are not parsed.
+	Codec BoxType
+
+	// avc1.
+	Width          uint16
+	Height         uint16
+	SPS            []byte
+	PPS            []byte
+	NALULengthSize int
+
+	// mp4a.
+	ChannelCount uint16
+	SampleRate   uint32
+	AudioConfig  []byte // AudioSpecificConfig.
+
+	Samples []Sample
+}
+
+// Sample location and timing. Timestamps are in the track timescale.
+type Sample struct {
+	Offset   uint64 // Absolute offset in the file.
+	Size     uint32
+	DTS      uint64
+	CTS      int64 // Composition offset, PTS = DTS + CTS.
+	Duration uint32
+	IsSync   bool
+}
+
+// VideoTrack returns the first avc1 track or nil.
+func (f *File) VideoTrack() *Track {
+	for _, t := range f.Tracks {
+		if t.Codec == TypeAvc1() {
+			return t
+		}
+	}
+	return nil
+}
+
+// AudioTrack returns the first mp4a track or nil.
+func (f *File) AudioTrack() *Track {
+	for _, t := range f.Tracks {
+		if t.Codec == TypeMp4a() {
+			return t
+		}
+	}
+	return nil
+}
+
+// Demuxer errors.
+var (
+	ErrMoovMissing  = errors.New("moov box missing")
+	ErrFragmented   = errors.New("fragmented mp4 is not supported")
+	ErrBoxTooShort  = errors.New("box too short")
+	ErrInvalidTable = errors.New("invalid sample table")
+)
+
+// Maximum moov size, protects against allocating huge buffers.
+const maxMoovSize = 256 << 20
+
+// Demux reads the metadata of a mp4 file.
+func Demux(r io.ReadSeeker) (*File, error) {
+	var moov []byte
+	for {
+		size, typ, headerSize, err := readBoxHeader(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case TypeMoov():
+			if size == 0 || size-headerSize > maxMoovSize {
+				return nil, fmt.Errorf("moov size: %v", size)
+			}
+			moov = make([]byte, size-headerSize)
+			if _, err := io.ReadFull(r, moov); err != nil {
+				return nil, fmt.Errorf("read moov: %w", err)
+			}
+			continue
+		case TypeMoof():
+			return nil, ErrFragmented
+		}
+
+		if size == 0 { // Box extends to end of file.
+			break
+		}
+		if _, err := r.Seek(int64(size-headerSize), io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("seek: %w", err)
+		}
+	}
+
+	if moov == nil {
+		return nil, ErrMoovMissing
+	}
+	return parseMoov(moov)
+}
+
+// readBoxHeader returns the box size including the header.
+// Zero size means the box extends to the end of the file.
+func readBoxHeader(r io.Reader) (uint64, BoxType, uint64, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, BoxType{}, 0, err
+	}
+	size := uint64(binary.BigEndian.Uint32(header[:4]))
+	var typ BoxType
+	copy(typ[:], header[4:])
+
+	if size == 1 {
+		var largeSize [8]byte
+		if _, err := io.ReadFull(r, largeSize[:]); err != nil {
+			return 0, BoxType{}, 0, err
+		}
+		size = binary.BigEndian.Uint64(largeSize[:])
+		if size < 16 {
+			return 0, BoxType{}, 0, fmt.Errorf("%w: %v", ErrBoxTooShort, typ)
+		}
+		return size, typ, 16, nil
+	}
+	if size != 0 && size < 8 {
+		return 0, BoxType{}, 0, fmt.Errorf("%w: %v", ErrBoxTooShort, typ)
+	}
+	return size, typ, 8, nil
+}
+
+// box parsed from a buffer.
+type box struct {
+	typ     BoxType
+	payload []byte
+}
+
+// parseBoxes splits the buffer into boxes.
+func parseBoxes(buf []byte) ([]box, error) {
+	var boxes []box
+	for len(buf) > 0 {
+		if len(buf) < 8 {
+			return nil, ErrBoxTooShort
+		}
+		size := uint64(binary.BigEndian.Uint32(buf[:4]))
+		var typ BoxType
+		copy(typ[:], buf[4:8])
+		headerSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(buf))
+		case 1:
+			if len(buf) < 16 {
+				return nil, ErrBoxTooShort
+			}
+			size = binary.BigEndian.Uint64(buf[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(buf)) {
+			return nil, fmt.Errorf("%w: %v", ErrBoxTooShort, typ)
+		}
+
+		boxes = append(boxes, box{typ: typ, payload: buf[headerSize:size]})
+		buf = buf[size:]
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []box, typ BoxType) *box {
+	for i := range boxes {
+		if boxes[i].typ == typ {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// reader reads big endian values from a buffer.
+// Reading past the end sets err and returns zero values.
+type reader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.buf) {
+		r.err = ErrBoxTooShort
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) skip(n int) { r.bytes(n) }
+
+func (r *reader) uint8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// fullBox reads the version and skips the flags.
+func (r *reader) fullBox() uint8 {
+	version := r.uint8()
+	r.skip(3)
+	return version
+}
+
+// Seconds between 1904-01-01 and 1970-01-01.
+const mp4EpochOffset = 2082844800
+
+func parseMoov(buf []byte) (*File, error) {
+	boxes, err := parseBoxes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("moov: %w", err)
+	}
+
+	file := &File{}
+	if mvhd := findBox(boxes, TypeMvhd()); mvhd != nil {
+		r := &reader{buf: mvhd.payload}
+		var creationTime uint64
+		if r.fullBox() == 0 {
+			creationTime = uint64(r.uint32())
+		} else {
+			creationTime = r.uint64()
+		}
+		if r.err == nil && creationTime > mp4EpochOffset {
+			file.CreationTime = time.Unix(int64(creationTime-mp4EpochOffset), 0)
+		}
+	}
+
+	for _, b := range boxes {
+		if b.typ != TypeTrak() {
+			continue
+		}
+		track, err := parseTrak(b.payload)
+		if err != nil {
+			return nil, fmt.Errorf("trak: %w", err)
+		}
+		file.Tracks = append(file.Tracks, track)
+	}
+	return file, nil
+}
+
+func parseTrak(buf []byte) (*Track, error) { //nolint:funlen
+	boxes, err := parseBoxes(buf)
+	if err != nil {
+		return nil, err
+	}
+	track := &Track{}
+
+	if tkhd := findBox(boxes, TypeTkhd()); tkhd != nil {
+		r := &reader{buf: tkhd.payload}
+		if r.fullBox() == 0 {
+			r.skip(8)
+		} else {
+			r.skip(16)
+		}
+		track.ID = r.uint32()
+		if r.err != nil {
+			return nil, fmt.Errorf("tkhd: %w", r.err)
+		}
+	}
+
+	mdia := findBox(boxes, TypeMdia())
+	if mdia == nil {
+		return nil, fmt.Errorf("%w: mdia", ErrBoxTooShort)
+	}
+	mdiaBoxes, err := parseBoxes(mdia.payload)
+	if err != nil {
+		return nil, fmt.Errorf("mdia: %w", err)
+	}
+
+	if mdhd := findBox(mdiaBoxes, TypeMdhd()); mdhd != nil {
+		r := &reader{buf: mdhd.payload}
+		if r.fullBox() == 0 {
+			r.skip(8)
+		} else {
+			r.skip(16)
+		}
+		track.Timescale = r.uint32()
+		if r.err != nil {
+			return nil, fmt.Errorf("mdhd: %w", r.err)
+		}
+	}
+	if track.Timescale == 0 {
+		return nil, fmt.Errorf("%w: timescale missing", ErrInvalidTable)
+	}
+
+	if hdlr := findBox(mdiaBoxes, TypeHdlr()); hdlr != nil {
+		r := &reader{buf: hdlr.payload}
+		r.fullBox()
+		r.skip(4) // Pre defined.
+		copy(track.HandlerType[:], r.bytes(4))
+	}
+
+	minf := findBox(mdiaBoxes, TypeMinf())
+	if minf == nil {
+		return nil, fmt.Errorf("%w: minf", ErrBoxTooShort)
+	}
+	minfBoxes, err := parseBoxes(minf.payload)
+	if err != nil {
+		return nil, fmt.Errorf("minf: %w", err)
+	}
+	stbl := findBox(minfBoxes, TypeStbl())
+	if stbl == nil {
+		return nil, fmt.Errorf("%w: stbl", ErrBoxTooShort)
+	}
+	if err := parseStbl(track, stbl.payload); err != nil {
+		return nil, fmt.Errorf("stbl: %w", err)
+	}
+	return track, nil
+}
+
+func parseStbl(track *Track, buf []byte) error { //nolint:funlen,gocognit
+	boxes, err := parseBoxes(buf)
+	if err != nil {
+		return err
+	}
+
+	if stsd := findBox(boxes, TypeStsd()); stsd != nil {
+		if err := parseStsd(track, stsd.payload); err != nil {
+			return fmt.Errorf("stsd: %w", err)
+		}
+	}
+
+	// Sample sizes.
+	stsz := findBox(boxes, TypeStsz())
+	if stsz == nil {
+		return fmt.Errorf("%w: stsz missing", ErrInvalidTable)
+	}
+	r := &reader{buf: stsz.payload}
+	r.fullBox()
+	sampleSize := r.uint32()
+	sampleCount := int(r.uint32())
+	if r.err != nil || sampleCount > len(stsz.payload) {
+		return fmt.Errorf("stsz: %w", ErrInvalidTable)
+	}
+	samples := make([]Sample, sampleCount)
+	for i := range samples {
+		if sampleSize != 0 {
+			samples[i].Size = sampleSize
+		} else {
+			samples[i].Size = r.uint32()
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("stsz: %w", r.err)
+	}
+
+	// Decoding times.
+	stts := findBox(boxes, TypeStts())
+	if stts == nil {
+		return fmt.Errorf("%w: stts missing", ErrInvalidTable)
+	}
+	r = &reader{buf: stts.payload}
+	r.fullBox()
+	entryCount := int(r.uint32())
+	i := 0
+	var dts uint64
+	for e := 0; e < entryCount && r.err == nil; e++ {
+		count := int(r.uint32())
+		delta := r.uint32()
+		for j := 0; j < count && i < len(samples); j++ {
+			samples[i].DTS = dts
+			samples[i].Duration = delta
+			dts += uint64(delta)
+			i++
+		}
+	}
+	if r.err != nil || i != len(samples) {
+		return fmt.Errorf("stts: %w", ErrInvalidTable)
+	}
+
+	// Composition offsets.
+	if ctts := findBox(boxes, TypeCtts()); ctts != nil {
+		r = &reader{buf: ctts.payload}
+		version := r.fullBox()
+		entryCount := int(r.uint32())
+		i := 0
+		for e := 0; e < entryCount && r.err == nil; e++ {
+			count := int(r.uint32())
+			rawOffset := r.uint32()
+			offset := int64(rawOffset)
+			if version == 1 {
+				offset = int64(int32(rawOffset))
+			}
+			for j := 0; j < count && i < len(samples); j++ {
+				samples[i].CTS = offset
+				i++
+			}
+		}
+		if r.err != nil {
+			return fmt.Errorf("ctts: %w", r.err)
+		}
+	}
+
+	// Sync samples, all samples are sync samples if stss is missing.
+	if stss := findBox(boxes, TypeStss()); stss != nil {
+		r = &reader{buf: stss.payload}
+		r.fullBox()
+		entryCount := int(r.uint32())
+		for e := 0; e < entryCount && r.err == nil; e++ {
+			n := int(r.uint32())
+			if n >= 1 && n <= len(samples) {
+				samples[n-1].IsSync = true
+			}
+		}
+		if r.err != nil {
+			return fmt.Errorf("stss: %w", r.err)
+		}
+	} else {
+		for i := range samples {
+			samples[i].IsSync = true
+		}
+	}
+
+	// Chunk offsets.
+	var chunkOffsets []uint64
+	if stco := findBox(boxes, TypeStco()); stco != nil {
+		r = &reader{buf: stco.payload}
+		r.fullBox()
+		entryCount := int(r.uint32())
+		for e := 0; e < entryCount && r.err == nil; e++ {
+			chunkOffsets = append(chunkOffsets, uint64(r.uint32()))
+		}
+	} else if co64 := findBox(boxes, BoxType{'c', 'o', '6', '4'}); co64 != nil {
+		r = &reader{buf: co64.payload}
+		r.fullBox()
+		entryCount := int(r.uint32())
+		for e := 0; e < entryCount && r.err == nil; e++ {
+			chunkOffsets = append(chunkOffsets, r.uint64())
+		}
+	} else {
+		return fmt.Errorf("%w: stco missing", ErrInvalidTable)
+	}
+	if r.err != nil {
+		return fmt.Errorf("stco: %w", r.err)
+	}
+
+	// Sample to chunk.
+	stsc := findBox(boxes, TypeStsc())
+	if stsc == nil {
+		return fmt.Errorf("%w: stsc missing", ErrInvalidTable)
+	}
+	r = &reader{buf: stsc.payload}
+	r.fullBox()
+	entryCount = int(r.uint32())
+	if r.err != nil || entryCount > len(stsc.payload) {
+		return fmt.Errorf("stsc: %w", ErrInvalidTable)
+	}
+	type stscEntry struct {
+		firstChunk      uint32
+		samplesPerChunk uint32
+	}
+	entries := make([]stscEntry, 0, entryCount)
+	for e := 0; e < entryCount && r.err == nil; e++ {
+		entries = append(entries, stscEntry{
+			firstChunk:      r.uint32(),
+			samplesPerChunk: r.uint32(),
+		})
+		r.skip(4) // Sample description index.
+	}
+	if r.err != nil {
+		return fmt.Errorf("stsc: %w", r.err)
+	}
+
+	i = 0
+	for e, entry := range entries {
+		lastChunk := uint32(len(chunkOffsets))
+		if e+1 < len(entries) {
+			lastChunk = entries[e+1].firstChunk - 1
+		}
+		if entry.firstChunk == 0 || lastChunk > uint32(len(chunkOffsets)) {
+			return fmt.Errorf("stsc: %w", ErrInvalidTable)
+		}
+		for chunk := entry.firstChunk; chunk <= lastChunk; chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for j := uint32(0); j < entry.samplesPerChunk && i < len(samples); j++ {
+				samples[i].Offset = offset
+				offset += uint64(samples[i].Size)
+				i++
+			}
+		}
+	}
+	if i != len(samples) {
+		return fmt.Errorf("stsc: %w", ErrInvalidTable)
+	}
+
+	track.Samples = samples
+	return nil
+}
+
+func parseStsd(track *Track, buf []byte) error {
+	r := &reader{buf: buf}
+	r.fullBox()
+	entryCount := r.uint32()
+	if r.err != nil {
+		return r.err
+	}
+	if entryCount == 0 {
+		return nil
+	}
+
+	// Only the first entry is used.
+	entries, err := parseBoxes(buf[r.pos:])
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: entry missing", ErrInvalidTable)
+	}
+	entry := entries[0]
+	track.Codec = entry.typ
+
+	switch entry.typ {
+	case TypeAvc1():
+		return parseAvc1(track, entry.payload)
+	case TypeMp4a():
+		return parseMp4a(track, entry.payload)
+	}
+	return nil
+}
+
+func parseAvc1(track *Track, buf []byte) error {
+	const avc1HeaderSize = 78
+	r := &reader{buf: buf}
+	r.skip(24) // Sample entry, pre defined and reserved.
+	track.Width = r.uint16()
+	track.Height = r.uint16()
+	if r.err != nil || len(buf) < avc1HeaderSize {
+		return fmt.Errorf("avc1: %w", ErrBoxTooShort)
+	}
+
+	children, err := parseBoxes(buf[avc1HeaderSize:])
+	if err != nil {
+		return fmt.Errorf("avc1: %w", err)
+	}
+	avcC := findBox(children, TypeAvcC())
+	if avcC == nil {
+		return fmt.Errorf("%w: avcC missing", ErrInvalidTable)
+	}
+
+	r = &reader{buf: avcC.payload}
+	r.skip(4) // Version, profile, compatibility and level.
+	track.NALULengthSize = int(r.uint8()&0x3) + 1
+	spsCount := int(r.uint8() & 0x1f)
+	for i := 0; i < spsCount; i++ {
+		sps := r.bytes(int(r.uint16()))
+		if i == 0 {
+			track.SPS = sps
+		}
+	}
+	ppsCount := int(r.uint8())
+	for i := 0; i < ppsCount; i++ {
+		pps := r.bytes(int(r.uint16()))
+		if i == 0 {
+			track.PPS = pps
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("avcC: %w", r.err)
+	}
+	return nil
+}
+
+func parseMp4a(track *Track, buf []byte) error {
+	const mp4aHeaderSize = 28
+	r := &reader{buf: buf}
+	r.skip(16) // Sample entry and reserved.
+	track.ChannelCount = r.uint16()
+	r.skip(6) // Sample size, pre defined and reserved.
+	track.SampleRate = r.uint32() >> 16
+	if r.err != nil {
+		return fmt.Errorf("mp4a: %w", r.err)
+	}
+
+	children, err := parseBoxes(buf[mp4aHeaderSize:])
+	if err != nil {
+		return fmt.Errorf("mp4a: %w", err)
+	}
+	esds := findBox(children, TypeEsds())
+	if esds == nil {
+		return fmt.Errorf("%w: esds missing", ErrInvalidTable)
+	}
+
+	config, err := parseEsds(esds.payload)
+	if err != nil {
+		return fmt.Errorf("esds: %w", err)
+	}
+	track.AudioConfig = config
+	return nil
+}
+
+// parseEsds returns the decoder specific info.
+func parseEsds(buf []byte) ([]byte, error) {
+	r := &reader{buf: buf}
+	r.fullBox()
+
+	readDescriptor := func() (uint8, int) {
+		tag := r.uint8()
+		size := 0
+		for i := 0; i < 4; i++ {
+			b := r.uint8()
+			size = size<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		return tag, size
+	}
+
+	for r.err == nil {
+		tag, size := readDescriptor()
+		switch tag {
+		case ESDescrTag:
+			r.skip(2) // ES ID.
+			flags := r.uint8()
+			if flags&0x80 != 0 { // Stream dependence.
+				r.skip(2)
+			}
+			if flags&0x40 != 0 { // URL.
+				r.skip(int(r.uint8()))
+			}
+			if flags&0x20 != 0 { // OCR stream.
+				r.skip(2)
+			}
+		case DecoderConfigDescrTag:
+			r.skip(13)
+		case DecSpecificInfoTag:
+			config := r.bytes(size)
+			if r.err != nil {
+				return nil, r.err
+			}
+			return config, nil
+		default:
+			r.skip(size)
+		}
+	}
+	return nil, r.err
+}
@@ -0,0 +1,284 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"nvr/pkg/video/mp4/bitio"
+
+	"github.com/stretchr/testify/require"
+)
+
+func marshalBoxes(t *testing.T, boxes ...Boxes) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := bitio.NewWriter(buf)
+	for _, b := range boxes {
+		require.NoError(t, b.Marshal(w))
+	}
+	return buf.Bytes()
+}
+
+func testVideoTrak(chunkOffsets []uint32) Boxes {
+	return Boxes{
+		Box: &Trak{},
+		Children: []Boxes{
+			{Box: &Tkhd{TrackID: 1}},
+			{
+				Box: &Mdia{},
+				Children: []Boxes{
+					{Box: &Mdhd{Timescale: 90000}},
+					{Box: &Hdlr{HandlerType: [4]byte{'v', 'i', 'd', 'e'}}},
+					{
+						Box: &Minf{},
+						Children: []Boxes{{
+							Box: &Stbl{},
+							Children: []Boxes{
+								{
+									Box: &Stsd{EntryCount: 1},
+									Children: []Boxes{{
+										Box: &Avc1{
+											SampleEntry: SampleEntry{DataReferenceIndex: 1},
+											Width:       640,
+											Height:      480,
+										},
+										Children: []Boxes{{Box: &AvcC{
+											ConfigurationVersion:       1,
+											LengthSizeMinusOne:         3,
+											NumOfSequenceParameterSets: 1,
+											SequenceParameterSets: []AVCParameterSet{
+												{NALUnit: []byte{1, 2, 3}},
+											},
+											NumOfPictureParameterSets: 1,
+											PictureParameterSets: []AVCParameterSet{
+												{NALUnit: []byte{4, 5}},
+											},
+										}}},
+									}},
+								},
+								{Box: &Stts{Entries: []SttsEntry{
+									{SampleCount: 3, SampleDelta: 3000},
+									{SampleCount: 1, SampleDelta: 6000},
+								}}},
+								{Box: &Ctts{
+									FullBox: FullBox{Version: 1},
+									Entries: []CttsEntry{
+										{SampleCount: 1, SampleOffsetV1: 3000},
+										{SampleCount: 1, SampleOffsetV1: -3000},
+										{SampleCount: 2, SampleOffsetV1: 0},
+									},
+								}},
+								{Box: &Stss{SampleNumbers: []uint32{1, 3}}},
+								{Box: &Stsc{Entries: []StscEntry{
+									{FirstChunk: 1, SamplesPerChunk: 2, SampleDescriptionIndex: 1},
+									{FirstChunk: 2, SamplesPerChunk: 1, SampleDescriptionIndex: 1},
+								}}},
+								{Box: &Stsz{SampleCount: 4, EntrySizes: []uint32{1, 2, 3, 4}}},
+								{Box: &Stco{ChunkOffsets: chunkOffsets}},
+							},
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestDemux(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		ftyp := Boxes{Box: &Ftyp{MajorBrand: [4]byte{'i', 's', 'o', '4'}}}
+		mdat := Boxes{Box: &Mdat{Data: []byte{1, 2, 2, 3, 3, 3, 4, 4, 4, 4}}}
+
+		// The moov box is placed after the mdat box.
+		mdatStart := uint32(ftyp.Size() + 8)
+		moov := Boxes{
+			Box: &Moov{},
+			Children: []Boxes{
+				{Box: &Mvhd{CreationTimeV0: mp4EpochOffset + 1000, Timescale: 1000}},
+				testVideoTrak([]uint32{mdatStart, mdatStart + 3, mdatStart + 6}),
+			},
+		}
+
+		file, err := Demux(bytes.NewReader(marshalBoxes(t, ftyp, mdat, moov)))
+		require.NoError(t, err)
+
+		expected := &File{
+			CreationTime: time.Unix(1000, 0),
+			Tracks: []*Track{{
+				ID:             1,
+				HandlerType:    [4]byte{'v', 'i', 'd', 'e'},
+				Timescale:      90000,
+				Codec:          TypeAvc1(),
+				Width:          640,
+				Height:         480,
+				SPS:            []byte{1, 2, 3},
+				PPS:            []byte{4, 5},
+				NALULengthSize: 4,
+				Samples: []Sample{
+					{Offset: uint64(mdatStart), Size: 1, DTS: 0, CTS: 3000, Duration: 3000, IsSync: true},
+					{Offset: uint64(mdatStart + 1), Size: 2, DTS: 3000, CTS: -3000, Duration: 3000},
+					{Offset: uint64(mdatStart + 3), Size: 3, DTS: 6000, Duration: 3000, IsSync: true},
+					{Offset: uint64(mdatStart + 6), Size: 4, DTS: 9000, Duration: 6000},
+				},
+			}},
+		}
+		require.Equal(t, expected, file)
+		require.Equal(t, file.Tracks[0], file.VideoTrack())
+		require.Nil(t, file.AudioTrack())
+	})
+	t.Run("moovMissing", func(t *testing.T) {
+		ftyp := Boxes{Box: &Ftyp{MajorBrand: [4]byte{'i', 's', 'o', '4'}}}
+		_, err := Demux(bytes.NewReader(marshalBoxes(t, ftyp)))
+		require.ErrorIs(t, err, ErrMoovMissing)
+	})
+	t.Run("fragmented", func(t *testing.T) {
+		moof := Boxes{Box: &Moof{}}
+		_, err := Demux(bytes.NewReader(marshalBoxes(t, moof)))
+		require.ErrorIs(t, err, ErrFragmented)
+	})
+	t.Run("invalidTable", func(t *testing.T) {
+		moov := Boxes{
+			Box:      &Moov{},
+			Children: []Boxes{testVideoTrak([]uint32{0})},
+		}
+		_, err := Demux(bytes.NewReader(marshalBoxes(t, moov)))
+		require.ErrorIs(t, err, ErrInvalidTable)
+	})
+}
+
+func rawBox(typ string, payload ...byte) []byte {
+	buf := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(8+len(payload)))
+	copy(buf[4:], typ)
+	return append(buf, payload...)
+}
+
+func concat(bufs ...[]byte) []byte {
+	var out []byte
+	for _, b := range bufs {
+		out = append(out, b...)
+	}
+	return out
+}
+
+// rawMoov returns a moov box with a single track and the given sample table.
+func rawMoov(stbl ...[]byte) []byte {
+	mdhd := rawBox("mdhd",
+		0, 0, 0, 0, // Version and flags.
+		0, 0, 0, 0, // Creation time.
+		0, 0, 0, 0, // Modification time.
+		0, 0, 0x03, 0xe8, // Timescale.
+	)
+	minf := rawBox("minf", rawBox("stbl", concat(stbl...)...)...)
+	mdia := rawBox("mdia", concat(mdhd, minf)...)
+	return rawBox("moov", rawBox("trak", mdia...)...)
+}
+
+func TestDemuxInvalidSampleTable(t *testing.T) {
+	var (
+		stsd = rawBox("stsd", 0, 0, 0, 0, 0, 0, 0, 0)
+		stsz = rawBox("stsz", 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1)
+		stts = rawBox("stts", 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1)
+		stsc = rawBox("stsc", 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1)
+		stco = rawBox("stco", 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0)
+	)
+	valid := map[string][]byte{
+		"stsd": stsd,
+		"stsz": stsz,
+		"stts": stts,
+		"stsc": stsc,
+		"stco": stco,
+	}
+	order := []string{"stsd", "stsz", "stts", "stsc", "stco"}
+
+	// newMoov returns the valid moov with one box replaced.
+	newMoov := func(typ string, box []byte) []byte {
+		var boxes [][]byte
+		for _, name := range order {
+			if name == typ {
+				boxes = append(boxes, box)
+			} else {
+				boxes = append(boxes, valid[name])
+			}
+		}
+		return rawMoov(boxes...)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		file, err := Demux(bytes.NewReader(newMoov("", nil)))
+		require.NoError(t, err)
+		require.Len(t, file.Tracks[0].Samples, 1)
+	})
+
+	cases := map[string]struct {
+		typ         string
+		box         []byte
+		expectedErr error
+	}{
+		"stsdEmpty": {
+			"stsd", rawBox("stsd", 0, 0, 0, 0, 0, 0, 0, 1), ErrInvalidTable,
+		},
+		"stsdTruncated": {
+			"stsd", rawBox("stsd", 0, 0, 0, 0, 0, 0), ErrBoxTooShort,
+		},
+		"stsdTruncatedEntry": {
+			"stsd", rawBox("stsd", 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 9), ErrBoxTooShort,
+		},
+		"stsdTruncatedAvc1": {
+			"stsd", rawBox("stsd", concat([]byte{0, 0, 0, 0, 0, 0, 0, 1}, rawBox("avc1", 1, 2))...), ErrBoxTooShort,
+		},
+		"stszEmpty": {
+			"stsz", rawBox("stsz"), ErrInvalidTable,
+		},
+		"stszTruncated": {
+			"stsz", rawBox("stsz", 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 1), ErrBoxTooShort,
+		},
+		"stszHugeCount": {
+			"stsz", rawBox("stsz", 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff), ErrInvalidTable,
+		},
+		"sttsEmpty": {
+			"stts", rawBox("stts"), ErrInvalidTable,
+		},
+		"sttsTruncated": {
+			"stts", rawBox("stts", 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 1), ErrInvalidTable,
+		},
+		"sttsMissing": {
+			"stts", nil, ErrInvalidTable,
+		},
+		"stscEmpty": {
+			"stsc", rawBox("stsc"), ErrInvalidTable,
+		},
+		"stscHugeCount": {
+			"stsc", rawBox("stsc", 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff), ErrInvalidTable,
+		},
+		"stcoEmpty": {
+			"stco", rawBox("stco"), ErrBoxTooShort,
+		},
+		"stcoTruncated": {
+			"stco", rawBox("stco", 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0), ErrBoxTooShort,
+		},
+		"stcoNoEntries": {
+			"stco", rawBox("stco", 0, 0, 0, 0, 0, 0, 0, 0), ErrInvalidTable,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Demux(bytes.NewReader(newMoov(tc.typ, tc.box)))
+			require.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+
+	// Every truncated payload must return a error without panicking.
+	t.Run("truncated", func(t *testing.T) {
+		for _, typ := range order {
+			box := valid[typ]
+			for n := 8; n < len(box); n++ {
+				truncated := rawBox(typ, box[8:n]...)
+				_, err := Demux(bytes.NewReader(newMoov(typ, truncated)))
+				require.Error(t, err, "%v %v", typ, n)
+			}
+		}
+	})
+}
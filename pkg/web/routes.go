@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"nvr/pkg/eventfeed"
+	"nvr/pkg/eventstore"
 	"nvr/pkg/group"
 	"nvr/pkg/log"
 	"nvr/pkg/monitor"
@@ -18,6 +21,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/gorilla/websocket"
@@ -279,6 +283,66 @@ func MonitorDelete(m *monitor.Manager) http.Handler {
 	})
 }
 
+// MonitorTrigger sends an event to a monitor from an external system.
+// The request must have admin privileges or the trigger token of
+// the monitor in the "X-Trigger-Token" header or "token" parameter.
+func MonitorTrigger(m *monitor.Manager, a auth.Authenticator) http.Handler {
+	trigger := monitorTrigger(m)
+	adminTrigger := a.Admin(trigger)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		token := r.Header.Get("X-Trigger-Token")
+		if token == "" {
+			token = query.Get("token")
+		}
+		if token != "" && m.ValidTriggerToken(query.Get("id"), token) {
+			trigger.ServeHTTP(w, r)
+			return
+		}
+		adminTrigger.ServeHTTP(w, r)
+	})
+}
+
+func monitorTrigger(m *monitor.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id missing", http.StatusBadRequest)
+			return
+		}
+
+		event, err := parseTriggerRequest(r.Body, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = m.TriggerEvent(id, event)
+		switch {
+		case errors.Is(err, monitor.ErrMonitorNotExist):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, monitor.ErrNotRunning):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, fmt.Sprintf("could not trigger monitor: %v", err),
+				http.StatusInternalServerError)
+		}
+	})
+}
+
+func parseTriggerRequest(body io.Reader, now time.Time) (storage.Event, error) {
+	var req monitor.TriggerRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return storage.Event{}, fmt.Errorf("could not decode request: %w", err)
+	}
+	return req.Event(now)
+}
+
 // GroupConfigs returns group configurations in json format.
 func GroupConfigs(m *group.Manager) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -566,6 +630,309 @@ func RecordingQuery(crawler *storage.Crawler, logger *log.Logger) http.Handler {
 	})
 }
 
+// RecordingSearch handles recording search by detections.
+func RecordingSearch(crawler *storage.Crawler, logger *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q, err := parseSearchQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := crawler.Search(*q)
+		if errors.Is(err, storage.ErrInvalidValue) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Log(log.Entry{
+				Level: log.LevelError,
+				Src:   "app",
+				Msg:   fmt.Sprintf("crawler: could not process recording search: %v", err),
+			})
+			http.Error(w, "could not process recording search", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", jsonContentType)
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// RecordingCoverage handles recorded intervals and event markers by monitor.
+func RecordingCoverage(crawler *storage.Crawler, logger *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+
+		start, end, err := parseTimeRange(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		coverage, err := crawler.Coverage(storage.CoverageQuery{
+			Monitors: parseCSVParam(query, "monitors"),
+			Start:    start,
+			End:      end,
+		})
+		if errors.Is(err, storage.ErrInvalidValue) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Log(log.Entry{
+				Level: log.LevelError,
+				Src:   "app",
+				Msg:   fmt.Sprintf("crawler: could not process coverage query: %v", err),
+			})
+			http.Error(w, "could not process coverage query", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", jsonContentType)
+		err = json.NewEncoder(w).Encode(coverage)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// Maximum number of recordings in a single export.
+const exportMaxRecordings = 1000
+
+// RecordingExport streams a zip archive of recordings. The recordings
+// are selected by a list of IDs or by a search query.
+func RecordingExport(
+	crawler *storage.Crawler,
+	logger *log.Logger,
+	recordingsDir string,
+) http.Handler {
+	videoReaderCache := storage.NewVideoCache()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+
+		recIDs := parseCSVParam(query, "ids")
+		if len(recIDs) == 0 {
+			q, err := parseSearchQuery(query)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			res, err := crawler.Search(*q)
+			if errors.Is(err, storage.ErrInvalidValue) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				logger.Log(log.Entry{
+					Level: log.LevelError,
+					Src:   "app",
+					Msg:   fmt.Sprintf("crawler: could not process recording search: %v", err),
+				})
+				http.Error(w, "could not process recording search", http.StatusInternalServerError)
+				return
+			}
+			for _, rec := range res.Recordings {
+				recIDs = append(recIDs, rec.ID)
+			}
+		}
+
+		if len(recIDs) == 0 {
+			http.Error(w, "no recordings", http.StatusNotFound)
+			return
+		}
+		if len(recIDs) > exportMaxRecordings {
+			http.Error(w,
+				fmt.Sprintf("too many recordings, max %v", exportMaxRecordings),
+				http.StatusBadRequest)
+			return
+		}
+		for _, recID := range recIDs {
+			if _, err := storage.RecordingIDToPath(recID); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if containsDotDot(recID) {
+				http.Error(w, "invalid recording ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		filename := "recordings_" + time.Now().Format(searchTimeFormat) + ".zip"
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		err := storage.ExportRecordings(w, recordingsDir, recIDs, videoReaderCache)
+		if err != nil {
+			// The response has already started, the archive will be incomplete.
+			logger.Log(log.Entry{
+				Level: log.LevelError,
+				Src:   "app",
+				Msg:   fmt.Sprintf("recording export: %v", err),
+			})
+		}
+	})
+}
+
+// RecordingImport imports a mp4 file from the request body as a recording.
+func RecordingImport(
+	logger *log.Logger,
+	recordingsDir string,
+	tempDir string,
+	ffmpegBin string,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+
+		monitorID := query.Get("monitor")
+		if monitorID == "" {
+			http.Error(w, "monitor missing", http.StatusBadRequest)
+			return
+		}
+
+		// The mp4 creation time is used if start is empty.
+		var start time.Time
+		if rawStart := query.Get("start"); rawStart != "" {
+			var err error
+			start, err = time.ParseInLocation(searchTimeFormat, rawStart, time.Local)
+			if err != nil {
+				http.Error(w, "could not parse start: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// The demuxer needs to seek, the body is copied to a temporary file.
+		if err := os.MkdirAll(tempDir, 0o700); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		file, err := os.CreateTemp(tempDir, "import-*.mp4")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		if _, err := io.Copy(file, r.Body); err != nil {
+			http.Error(w, "could not read body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		recID, err := storage.ImportMP4(file, storage.ImportConfig{
+			RecordingsDir: recordingsDir,
+			MonitorID:     monitorID,
+			Start:         start,
+			FFmpegBin:     ffmpegBin,
+		})
+		if errors.Is(err, storage.ErrImportExist) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		var inputErr storage.ImportInputError
+		if errors.As(err, &inputErr) {
+			http.Error(w, "could not import recording: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Log(log.Entry{
+				Level: log.LevelError,
+				Src:   "app",
+				Msg:   fmt.Sprintf("recording import: %v", err),
+			})
+			http.Error(w, "could not import recording", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", jsonContentType)
+		err = json.NewEncoder(w).Encode(struct {
+			ID string `json:"id"`
+		}{ID: recID})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+const searchTimeFormat = "2006-01-02_15-04-05"
+
+// Errors.
+var (
+	ErrStartMissing = errors.New("start missing")
+	ErrEndMissing   = errors.New("end missing")
+	ErrLimitMissing = errors.New("limit missing")
+)
+
+func parseSearchQuery(query url.Values) (*storage.SearchQuery, error) { //nolint:funlen
+	q := &storage.SearchQuery{
+		Monitors: parseCSVParam(query, "monitors"),
+		Labels:   parseCSVParam(query, "labels"),
+		Cursor:   query.Get("cursor"),
+	}
+
+	var err error
+	q.Start, q.End, err = parseTimeRange(query)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := query.Get("limit")
+	if limit == "" {
+		return nil, ErrLimitMissing
+	}
+	q.Limit, err = strconv.Atoi(limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert limit to int: %w", err)
+	}
+
+	if minScore := query.Get("minScore"); minScore != "" {
+		q.MinScore, err = strconv.ParseFloat(minScore, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse minScore: %w", err)
+		}
+	}
+
+	if region := query.Get("region"); region != "" {
+		err = json.Unmarshal([]byte(region), &q.Region)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse region: %w", err)
+		}
+	}
+
+	if minDuration := query.Get("minDuration"); minDuration != "" {
+		seconds, err := strconv.ParseFloat(minDuration, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse minDuration: %w", err)
+		}
+		q.MinDuration = time.Duration(seconds * float64(time.Second))
+	}
+
+	return q, nil
+}
+
 // LogFeed opens a websocket with system logs.
 func LogFeed(logger *log.Logger, a auth.Authenticator) http.Handler { //nolint:funlen,gocognit
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -706,6 +1073,31 @@ func LogQuery(logStore *log.Store) http.Handler {
 	})
 }
 
+// parseTimeRange parses the "start" and "end" parameters in local time.
+func parseTimeRange(query url.Values) (time.Time, time.Time, error) {
+	parseTime := func(key string, errMissing error) (time.Time, error) {
+		raw := query.Get(key)
+		if raw == "" {
+			return time.Time{}, errMissing
+		}
+		t, err := time.ParseInLocation(searchTimeFormat, raw, time.Local)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not parse %v: %w", key, err)
+		}
+		return t, nil
+	}
+
+	start, err := parseTime("start", ErrStartMissing)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseTime("end", ErrEndMissing)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
 func parseCSVParam(query url.Values, key string) []string {
 	CSV := query.Get(key)
 	var monitors []string
@@ -732,6 +1124,134 @@ func LogSources(l *log.Logger) http.Handler {
 	})
 }
 
+// EventFeed opens a websocket with live events and recording status.
+func EventFeed(feed *eventfeed.Feed, a auth.Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+
+		monitors := parseCSVParam(query, "monitors")
+		var types []string
+		for _, t := range parseCSVParam(query, "types") {
+			switch eventfeed.Type(t) {
+			case eventfeed.TypeEvent,
+				eventfeed.TypeRecordingStarted,
+				eventfeed.TypeRecordingSaved,
+				eventfeed.TypeRecordingFailed:
+			default:
+				http.Error(w, fmt.Sprintf("invalid type: %q", t), http.StatusBadRequest)
+				return
+			}
+			types = append(types, t)
+		}
+
+		upgrader := websocket.Upgrader{}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer c.Close()
+
+		msgs, cancel := feed.Subscribe()
+		defer cancel()
+
+		for {
+			var msg eventfeed.Message
+			select {
+			case msg = <-msgs:
+			case <-feed.Ctx.Done():
+				return
+			}
+
+			if !log.StringInStrings(msg.MonitorID, monitors) {
+				continue
+			}
+			if !log.StringInStrings(string(msg.Type), types) {
+				continue
+			}
+
+			// Validate auth before each message.
+			auth := a.ValidateRequest(r)
+			if !auth.IsValid {
+				return
+			}
+
+			if err := c.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// EventQuery handles event queries.
+func EventQuery(eventStore *eventstore.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+
+		limit := query.Get("limit")
+		if limit == "" {
+			http.Error(w, "limit missing", http.StatusBadRequest)
+			return
+		}
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not convert limit to int: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		parseTime := func(key string) (log.UnixMicro, error) {
+			raw := query.Get(key)
+			if raw == "" {
+				return 0, nil
+			}
+			t, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("could not convert %v to int: %w", key, err)
+			}
+			return log.UnixMicro(t), nil
+		}
+		start, err := parseTime("start")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		end, err := parseTime("end")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q := eventstore.Query{
+			Start:    start,
+			End:      end,
+			Monitors: parseCSVParam(query, "monitors"),
+			Labels:   parseCSVParam(query, "labels"),
+			Limit:    limitInt,
+		}
+
+		events, err := eventStore.Query(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", jsonContentType)
+		err = json.NewEncoder(w).Encode(events)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
 func containsSpaces(s string) bool {
 	return strings.Contains(s, " ")
 }
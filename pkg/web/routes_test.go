@@ -2,7 +2,12 @@ package web
 
 import (
 	"net/url"
+	"nvr/pkg/ffmpeg"
+	"nvr/pkg/monitor"
+	"nvr/pkg/storage"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -24,3 +29,77 @@ func TestParseCSVParam(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSearchQuery(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		query, err := url.ParseQuery(
+			"start=2001-02-03_04-05-06&end=2001-02-03_05-05-06&limit=5" +
+				"&monitors=m1,m2&labels=person&minScore=50.5&minDuration=1.5" +
+				"&region=[[0,0],[100,0],[100,100]]&cursor=abc")
+		require.NoError(t, err)
+
+		q, err := parseSearchQuery(query)
+		require.NoError(t, err)
+
+		expected := &storage.SearchQuery{
+			Monitors:    []string{"m1", "m2"},
+			Start:       time.Date(2001, 2, 3, 4, 5, 6, 0, time.Local),
+			End:         time.Date(2001, 2, 3, 5, 5, 6, 0, time.Local),
+			Labels:      []string{"person"},
+			MinScore:    50.5,
+			Region:      ffmpeg.Polygon{{0, 0}, {100, 0}, {100, 100}},
+			MinDuration: 1500 * time.Millisecond,
+			Limit:       5,
+			Cursor:      "abc",
+		}
+		require.Equal(t, expected, q)
+	})
+	t.Run("errors", func(t *testing.T) {
+		cases := map[string]string{
+			"startMissing": "end=2001-02-03_04-05-06&limit=1",
+			"endMissing":   "start=2001-02-03_04-05-06&limit=1",
+			"limitMissing": "start=2001-02-03_04-05-06&end=2001-02-03_04-05-06",
+			"badStart":     "start=x&end=2001-02-03_04-05-06&limit=1",
+			"badRegion":    "start=2001-02-03_04-05-06&end=2001-02-03_04-05-06&limit=1&region=x",
+		}
+		for name, raw := range cases {
+			t.Run(name, func(t *testing.T) {
+				query, err := url.ParseQuery(raw)
+				require.NoError(t, err)
+				_, err = parseSearchQuery(query)
+				require.Error(t, err)
+			})
+		}
+	})
+}
+
+func TestParseTriggerRequest(t *testing.T) {
+	now := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	t.Run("ok", func(t *testing.T) {
+		body := `{"label":"door","score":100,"duration":1.5,"recDuration":30}`
+		event, err := parseTriggerRequest(strings.NewReader(body), now)
+		require.NoError(t, err)
+
+		expected := storage.Event{
+			Time:        now,
+			Detections:  []storage.Detection{{Label: "door", Score: 100}},
+			Duration:    1500 * time.Millisecond,
+			RecDuration: 30 * time.Second,
+		}
+		require.Equal(t, expected, event)
+	})
+	t.Run("labelMissing", func(t *testing.T) {
+		body := `{"recDuration":30}`
+		_, err := parseTriggerRequest(strings.NewReader(body), now)
+		require.ErrorIs(t, err, monitor.ErrLabelMissing)
+	})
+	t.Run("recDurationMissing", func(t *testing.T) {
+		body := `{"label":"door"}`
+		_, err := parseTriggerRequest(strings.NewReader(body), now)
+		require.ErrorIs(t, err, storage.ErrValueMissing)
+	})
+	t.Run("invalidJSON", func(t *testing.T) {
+		_, err := parseTriggerRequest(strings.NewReader("{"), now)
+		require.Error(t, err)
+	})
+}
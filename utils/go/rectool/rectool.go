@@ -0,0 +1,524 @@
+// Package rectool is a CLI utility for inspecting and repairing recordings.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"nvr/pkg/storage"
+	"nvr/pkg/video/customformat"
+	"nvr/pkg/video/gortsplib/pkg/h264"
+	"nvr/pkg/video/hls"
+	"nvr/pkg/video/mp4muxer"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `usage: rectool <command> [flags] <recording>
+
+The recording path may include or exclude the file extension.
+example: rectool info ./storage/recordings/2022/01/01/x/2022-01-01_00-00-00_x
+
+commands:
+  info     print header, codec, duration and sample statistics
+  verify   check sample offsets and sizes against the mdat file
+  export   export time range to mp4 file
+             --start  offset from recording start, "1m30s"
+             --end    offset from recording start, default end of recording
+             --output output file, default <recording>_export.mp4
+  thumb    generate thumbnail from the first keyframe
+             --ffmpeg ffmpeg binary, default "ffmpeg"
+  reindex  rebuild the data file, existing events are kept
+  import   import a H264/AAC mp4 file as a recording, rectool import [flags] <file.mp4>
+             --recordings recordings directory
+             --monitor    monitor ID
+             --time       start time "YYYY-MM-DD_hh-mm-ss", default mp4 creation time
+             --ffmpeg     ffmpeg binary for the thumbnail, default "ffmpeg"`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Errors.
+var (
+	ErrVerifyFailed         = errors.New("verification failed")
+	ErrRecordingsDirMissing = errors.New("--recordings missing")
+	ErrUnknownCommand       = errors.New("unknown command")
+	ErrArgCount             = errors.New("expected one recording or file argument")
+)
+
+func run(args []string, out io.Writer) error {
+	if len(args) < 1 {
+		fmt.Fprintln(out, usage)
+		return nil
+	}
+	cmd, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	start := flags.Duration("start", 0, "")
+	end := flags.Duration("end", 0, "")
+	output := flags.String("output", "", "")
+	ffmpegBin := flags.String("ffmpeg", "ffmpeg", "")
+	recordingsDir := flags.String("recordings", "", "")
+	monitorID := flags.String("monitor", "", "")
+	startTime := flags.String("time", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(out, usage)
+		return fmt.Errorf("%w, got %v", ErrArgCount, flags.NArg())
+	}
+	if cmd == "import" {
+		return importMP4(out, flags.Arg(0), *recordingsDir, *monitorID, *startTime, *ffmpegBin)
+	}
+	recPath := trimExt(flags.Arg(0))
+
+	switch cmd {
+	case "info":
+		return info(out, recPath)
+	case "verify":
+		return verify(out, recPath)
+	case "export":
+		if *output == "" {
+			*output = recPath + "_export.mp4"
+		}
+		return export(out, recPath, *output, *start, *end)
+	case "thumb":
+		return thumb(out, recPath, *ffmpegBin)
+	case "reindex":
+		return reindex(out, recPath)
+	default:
+		fmt.Fprintln(out, usage)
+		return fmt.Errorf("%w: %v", ErrUnknownCommand, cmd)
+	}
+}
+
+func trimExt(path string) string {
+	exts := []string{".meta", ".mdat", ".json", ".jpeg", ".mp4"}
+	for _, ext := range exts {
+		if strings.HasSuffix(path, ext) {
+			return strings.TrimSuffix(path, ext)
+		}
+	}
+	return path
+}
+
+type recording struct {
+	header   *customformat.Header
+	samples  []customformat.Sample
+	mdatSize int64
+}
+
+func readRecording(recPath string) (*recording, error) {
+	metaPath := recPath + ".meta"
+	mdatPath := recPath + ".mdat"
+
+	metaStat, err := os.Stat(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat meta file: %w", err)
+	}
+	meta, err := os.Open(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("open meta file: %w", err)
+	}
+	defer meta.Close()
+
+	reader, header, err := customformat.NewReader(meta, int(metaStat.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("new reader: %w", err)
+	}
+	samples, err := reader.ReadAllSamples()
+	if err != nil {
+		return nil, fmt.Errorf("read all samples: %w", err)
+	}
+
+	mdatStat, err := os.Stat(mdatPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat mdat file: %w", err)
+	}
+
+	return &recording{
+		header:   header,
+		samples:  samples,
+		mdatSize: mdatStat.Size(),
+	}, nil
+}
+
+// sampleStats sample counts and sizes of a recording by track.
+// The end is the end of the last video sample.
+type sampleStats struct {
+	videoSamples int
+	audioSamples int
+	keyframes    int
+	videoBytes   int64
+	audioBytes   int64
+
+	start time.Time
+	end   time.Time
+}
+
+func (s sampleStats) duration() time.Duration {
+	return s.end.Sub(s.start)
+}
+
+func newSampleStats(header *customformat.Header, samples []customformat.Sample) sampleStats {
+	stats := sampleStats{
+		start: time.Unix(0, header.StartTime),
+		end:   time.Unix(0, header.StartTime),
+	}
+	for _, s := range samples {
+		if s.IsAudioSample {
+			stats.audioSamples++
+			stats.audioBytes += int64(s.Size)
+			continue
+		}
+		stats.videoSamples++
+		stats.videoBytes += int64(s.Size)
+		if s.IsSyncSample {
+			stats.keyframes++
+		}
+		if end := time.Unix(0, s.Next); end.After(stats.end) {
+			stats.end = end
+		}
+	}
+	return stats
+}
+
+func info(out io.Writer, recPath string) error {
+	rec, err := readRecording(recPath)
+	if err != nil {
+		return err
+	}
+	videoTrack, audioTrack, err := rec.header.GetTracks()
+	if err != nil {
+		return fmt.Errorf("get tracks: %w", err)
+	}
+
+	var sps h264.SPS
+	if err := sps.Unmarshal(videoTrack.SPS); err != nil {
+		return fmt.Errorf("unmarshal sps: %w", err)
+	}
+
+	stats := newSampleStats(rec.header, rec.samples)
+
+	fmt.Fprintf(out, "start:      %v\n", stats.start.Format(time.RFC3339Nano))
+	fmt.Fprintf(out, "end:        %v\n", stats.end.Format(time.RFC3339Nano))
+	fmt.Fprintf(out, "duration:   %v\n", stats.duration())
+	fmt.Fprintf(out, "video:      h264 %vx%v\n", sps.Width(), sps.Height())
+	if audioTrack != nil {
+		fmt.Fprintf(out, "audio:      aac %vHz %v channels\n",
+			audioTrack.Config.SampleRate, audioTrack.Config.ChannelCount)
+	} else {
+		fmt.Fprintf(out, "audio:      none\n")
+	}
+	fmt.Fprintf(out, "video samples: %v (%v keyframes, %v bytes)\n",
+		stats.videoSamples, stats.keyframes, stats.videoBytes)
+	fmt.Fprintf(out, "audio samples: %v (%v bytes)\n", stats.audioSamples, stats.audioBytes)
+	if stats.keyframes != 0 {
+		fmt.Fprintf(out, "keyframe interval: %v\n",
+			stats.duration()/time.Duration(stats.keyframes))
+	}
+	fmt.Fprintf(out, "mdat size:  %v\n", rec.mdatSize)
+	return nil
+}
+
+func verify(out io.Writer, recPath string) error {
+	rec, err := readRecording(recPath)
+	if err != nil {
+		return err
+	}
+
+	problems := verifySamples(rec.samples, rec.mdatSize)
+	for _, p := range problems {
+		fmt.Fprintln(out, p)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%w: %v problems", ErrVerifyFailed, len(problems))
+	}
+	fmt.Fprintf(out, "ok: %v samples\n", len(rec.samples))
+	return nil
+}
+
+// verifySamples returns a description of each inconsistency.
+func verifySamples(samples []customformat.Sample, mdatSize int64) []string {
+	var problems []string
+	if len(samples) == 0 {
+		return []string{"no samples"}
+	}
+
+	firstVideo := true
+	var expectedOffset int64
+	var prevVideoDTS int64
+	for i, s := range samples {
+		if int64(s.Offset) != expectedOffset {
+			problems = append(problems, fmt.Sprintf(
+				"sample %v: offset %v, expected %v", i, s.Offset, expectedOffset))
+		}
+		end := int64(s.Offset) + int64(s.Size)
+		if end > mdatSize {
+			problems = append(problems, fmt.Sprintf(
+				"sample %v: ends at %v, mdat size %v", i, end, mdatSize))
+		}
+		expectedOffset = end
+
+		if s.IsAudioSample {
+			continue
+		}
+		if firstVideo && !s.IsSyncSample {
+			problems = append(problems, fmt.Sprintf(
+				"sample %v: first video sample isn't a keyframe", i))
+		}
+		if !firstVideo && s.DTS < prevVideoDTS {
+			problems = append(problems, fmt.Sprintf(
+				"sample %v: dts %v before previous %v", i, s.DTS, prevVideoDTS))
+		}
+		if s.Next < s.DTS {
+			problems = append(problems, fmt.Sprintf(
+				"sample %v: next %v before dts %v", i, s.Next, s.DTS))
+		}
+		firstVideo = false
+		prevVideoDTS = s.DTS
+	}
+
+	if expectedOffset < mdatSize {
+		problems = append(problems, fmt.Sprintf(
+			"mdat has %v unreferenced bytes", mdatSize-expectedOffset))
+	}
+	return problems
+}
+
+// ErrNoSamples no samples in range.
+var ErrNoSamples = errors.New("no samples in range")
+
+// selectSamples returns the samples within the range, starting
+// from the last keyframe at or before start. Zero end means no end.
+func selectSamples(
+	samples []customformat.Sample,
+	start int64,
+	end int64,
+) ([]customformat.Sample, error) {
+	first := -1
+	for i, s := range samples {
+		if s.IsAudioSample || !s.IsSyncSample {
+			continue
+		}
+		if s.DTS > start && first != -1 {
+			break
+		}
+		first = i
+	}
+	if first == -1 {
+		return nil, ErrNoSamples
+	}
+	firstDTS := samples[first].DTS
+
+	var selected []customformat.Sample
+	for _, s := range samples[first:] {
+		if end != 0 && s.DTS >= end {
+			break
+		}
+		if s.IsAudioSample && s.PTS < firstDTS {
+			continue
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+func export(
+	out io.Writer,
+	recPath string,
+	outputPath string,
+	start time.Duration,
+	end time.Duration,
+) error {
+	rec, err := readRecording(recPath)
+	if err != nil {
+		return err
+	}
+	videoTrack, audioTrack, err := rec.header.GetTracks()
+	if err != nil {
+		return fmt.Errorf("get tracks: %w", err)
+	}
+
+	startTime := rec.header.StartTime + int64(start)
+	var endTime int64
+	if end != 0 {
+		endTime = rec.header.StartTime + int64(end)
+	}
+	samples, err := selectSamples(rec.samples, startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	mdat, err := os.Open(recPath + ".mdat")
+	if err != nil {
+		return fmt.Errorf("open mdat file: %w", err)
+	}
+	defer mdat.Close()
+
+	file, err := os.OpenFile(outputPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open output file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = mp4muxer.GenerateMP4(file, samples[0].DTS, samples, videoTrack, audioTrack)
+	if err != nil {
+		return fmt.Errorf("generate mp4: %w", err)
+	}
+
+	// The muxer expects the samples to be written sequentially.
+	for _, s := range samples {
+		_, err := io.Copy(file, io.NewSectionReader(mdat, int64(s.Offset), int64(s.Size)))
+		if err != nil {
+			return fmt.Errorf("copy sample: %w", err)
+		}
+	}
+
+	fmt.Fprintf(out, "exported %v samples: %v\n", len(samples), outputPath)
+	return nil
+}
+
+func thumb(out io.Writer, recPath string, ffmpegBin string) error {
+	rec, err := readRecording(recPath)
+	if err != nil {
+		return err
+	}
+	videoTrack, _, err := rec.header.GetTracks()
+	if err != nil {
+		return fmt.Errorf("get tracks: %w", err)
+	}
+
+	segment, err := firstKeyframeSegment(recPath, rec.samples)
+	if err != nil {
+		return err
+	}
+
+	thumbPath := recPath + ".jpeg"
+	logFunc := func(msg string) {
+		fmt.Fprintf(out, "ffmpeg: %v\n", msg)
+	}
+	err = storage.GenerateThumbnail(ffmpegBin, thumbPath, segment, videoTrack, logFunc)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "thumbnail generated: %v\n", thumbPath)
+	return nil
+}
+
+// firstKeyframeSegment returns a segment containing the first keyframe.
+func firstKeyframeSegment(recPath string, samples []customformat.Sample) (*hls.Segment, error) {
+	for _, s := range samples {
+		if s.IsAudioSample || !s.IsSyncSample {
+			continue
+		}
+
+		mdat, err := os.Open(recPath + ".mdat")
+		if err != nil {
+			return nil, fmt.Errorf("open mdat file: %w", err)
+		}
+		defer mdat.Close()
+
+		avcc := make([]byte, s.Size)
+		if _, err := mdat.ReadAt(avcc, int64(s.Offset)); err != nil {
+			return nil, fmt.Errorf("read sample: %w", err)
+		}
+
+		return &hls.Segment{
+			Parts: []*hls.MuxerPart{{
+				VideoSamples: []*hls.VideoSample{{
+					PTS:        s.PTS,
+					DTS:        s.DTS,
+					AVCC:       avcc,
+					IdrPresent: true,
+					Duration:   time.Duration(s.Next - s.DTS),
+				}},
+			}},
+		}, nil
+	}
+	return nil, fmt.Errorf("keyframe: %w", ErrNoSamples)
+}
+
+func reindex(out io.Writer, recPath string) error {
+	rec, err := readRecording(recPath)
+	if err != nil {
+		return err
+	}
+	stats := newSampleStats(rec.header, rec.samples)
+
+	data := storage.RecordingData{
+		Start:  stats.start,
+		End:    stats.end,
+		Events: []storage.Event{},
+	}
+
+	// Keep existing events.
+	dataPath := recPath + ".json"
+	if rawData, err := os.ReadFile(dataPath); err == nil {
+		var oldData storage.RecordingData
+		if err := json.Unmarshal(rawData, &oldData); err == nil && oldData.Events != nil {
+			data.Events = oldData.Events
+		}
+	}
+
+	json, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	if err := os.WriteFile(dataPath, json, 0o600); err != nil {
+		return fmt.Errorf("write data: %w", err)
+	}
+
+	fmt.Fprintf(out, "data file written: %v\n", dataPath)
+	return nil
+}
+
+func importMP4(
+	out io.Writer,
+	inputPath string,
+	recordingsDir string,
+	monitorID string,
+	rawStart string,
+	ffmpegBin string,
+) error {
+	if recordingsDir == "" {
+		return ErrRecordingsDirMissing
+	}
+
+	var start time.Time
+	if rawStart != "" {
+		var err error
+		start, err = time.ParseInLocation("2006-01-02_15-04-05", rawStart, time.Local)
+		if err != nil {
+			return fmt.Errorf("parse time: %w", err)
+		}
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	recID, err := storage.ImportMP4(file, storage.ImportConfig{
+		RecordingsDir: recordingsDir,
+		MonitorID:     monitorID,
+		Start:         start,
+		FFmpegBin:     ffmpegBin,
+	})
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	fmt.Fprintf(out, "recording imported: %v\n", recID)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"nvr/pkg/video/customformat"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySamples(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		samples := []customformat.Sample{
+			{IsSyncSample: true, DTS: 0, Next: 1, Offset: 0, Size: 2},
+			{IsAudioSample: true, PTS: 0, Next: 1, Offset: 2, Size: 3},
+			{DTS: 1, Next: 2, Offset: 5, Size: 1},
+		}
+		require.Empty(t, verifySamples(samples, 6))
+	})
+	t.Run("errors", func(t *testing.T) {
+		samples := []customformat.Sample{
+			{DTS: 2, Next: 3, Offset: 0, Size: 2},
+			{DTS: 1, Next: 0, Offset: 3, Size: 4},
+		}
+		expected := []string{
+			"sample 0: first video sample isn't a keyframe",
+			"sample 1: offset 3, expected 2",
+			"sample 1: ends at 7, mdat size 6",
+			"sample 1: dts 1 before previous 2",
+			"sample 1: next 0 before dts 1",
+		}
+		require.Equal(t, expected, verifySamples(samples, 6))
+	})
+	t.Run("unreferenced", func(t *testing.T) {
+		samples := []customformat.Sample{
+			{IsSyncSample: true, Offset: 0, Size: 2},
+		}
+		require.Equal(t,
+			[]string{"mdat has 1 unreferenced bytes"},
+			verifySamples(samples, 3),
+		)
+	})
+}
+
+func TestSelectSamples(t *testing.T) {
+	samples := []customformat.Sample{
+		{IsSyncSample: true, DTS: 0},
+		{DTS: 10},
+		{IsSyncSample: true, DTS: 20},
+		{IsAudioSample: true, PTS: 15},
+		{IsAudioSample: true, PTS: 25},
+		{DTS: 30},
+		{IsSyncSample: true, DTS: 40},
+		{DTS: 50},
+	}
+
+	t.Run("range", func(t *testing.T) {
+		selected, err := selectSamples(samples, 25, 40)
+		require.NoError(t, err)
+		expected := []customformat.Sample{
+			{IsSyncSample: true, DTS: 20},
+			{IsAudioSample: true, PTS: 25},
+			{DTS: 30},
+		}
+		require.Equal(t, expected, selected)
+	})
+	t.Run("noEnd", func(t *testing.T) {
+		selected, err := selectSamples(samples, 40, 0)
+		require.NoError(t, err)
+		require.Equal(t, samples[6:], selected)
+	})
+	t.Run("noKeyframe", func(t *testing.T) {
+		_, err := selectSamples([]customformat.Sample{{DTS: 1}}, 0, 0)
+		require.ErrorIs(t, err, ErrNoSamples)
+	})
+}
+
+func TestTrimExt(t *testing.T) {
+	require.Equal(t, "a/b", trimExt("a/b.meta"))
+	require.Equal(t, "a/b", trimExt("a/b"))
+}
+
+func TestRun(t *testing.T) {
+	t.Run("usage", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, run(nil, out))
+		require.Contains(t, out.String(), "usage:")
+	})
+	t.Run("unknownCommand", func(t *testing.T) {
+		err := run([]string{"x", "a"}, &bytes.Buffer{})
+		require.ErrorIs(t, err, ErrUnknownCommand)
+	})
+	t.Run("argCount", func(t *testing.T) {
+		err := run([]string{"info"}, &bytes.Buffer{})
+		require.ErrorIs(t, err, ErrArgCount)
+
+		err = run([]string{"info", "a", "b"}, &bytes.Buffer{})
+		require.ErrorIs(t, err, ErrArgCount)
+	})
+}
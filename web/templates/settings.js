@@ -106,6 +106,17 @@ if (isAdmin) {
 		alwaysRecord: fieldTemplate.toggle("Always record", "false"),
 		videoLength: fieldTemplate.text("Video length (min)", "15", "15"),
 		timestampOffset: fieldTemplate.integer("Timestamp offset (ms)", "500", "500"),
+		triggerToken: newField(
+			[inputRules.noSpaces],
+			{
+				errorField: true,
+				input: "text",
+			},
+			{
+				label: "Trigger token",
+				placeholder: "optional",
+			}
+		),
 		logLevel: fieldTemplate.select(
 			"Log level",
 			["quiet", "fatal", "error", "warning", "info", "debug"],